@@ -96,8 +96,13 @@ type StreamEvent struct {
 	ReasoningContent string                 `protobuf:"bytes,2,opt,name=reasoningContent,proto3" json:"reasoningContent,omitempty"`
 	Content          string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
 	Err              string                 `protobuf:"bytes,4,opt,name=err,proto3" json:"err,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	// 正在生成的消息 ID 以及事件的序号，断线之后用它们调用 ResumeStream
+	MessageId int64 `protobuf:"varint,5,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Seq       int64 `protobuf:"varint,6,opt,name=seq,proto3" json:"seq,omitempty"`
+	// 生成被取消了，只会出现在最后一个事件上
+	Cancelled     bool `protobuf:"varint,7,opt,name=cancelled,proto3" json:"cancelled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *StreamEvent) Reset() {
@@ -158,13 +163,46 @@ func (x *StreamEvent) GetErr() string {
 	return ""
 }
 
+func (x *StreamEvent) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *StreamEvent) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StreamEvent) GetCancelled() bool {
+	if x != nil {
+		return x.Cancelled
+	}
+	return false
+}
+
 type Conversation struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
-	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
-	Title         string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
-	Message       []*Message             `protobuf:"bytes,4,rep,name=message,proto3" json:"message,omitempty"`
-	Ctime         string                 `protobuf:"bytes,5,opt,name=ctime,proto3" json:"ctime,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Sn      string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Uid     string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	Title   string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Message []*Message             `protobuf:"bytes,4,rep,name=message,proto3" json:"message,omitempty"`
+	Ctime   string                 `protobuf:"bytes,5,opt,name=ctime,proto3" json:"ctime,omitempty"`
+	// 对话使用的 prompt，不传表示不使用
+	PromptId int64 `protobuf:"varint,6,opt,name=prompt_id,json=promptId,proto3" json:"prompt_id,omitempty"`
+	// 对话所属业务的配置 ID，用于读取业务的上下文配置
+	BizId int64 `protobuf:"varint,7,opt,name=biz_id,json=bizId,proto3" json:"biz_id,omitempty"`
+	// 对话自己的上下文配置，优先级高于业务配置
+	Context *ContextConfig `protobuf:"bytes,8,opt,name=context,proto3" json:"context,omitempty"`
+	// 不自动生成标题
+	DisableAutoTitle bool `protobuf:"varint,9,opt,name=disable_auto_title,json=disableAutoTitle,proto3" json:"disable_auto_title,omitempty"`
+	Archived         bool `protobuf:"varint,10,opt,name=archived,proto3" json:"archived,omitempty"`
+	Pinned           bool `protobuf:"varint,11,opt,name=pinned,proto3" json:"pinned,omitempty"`
+	// 最后活跃的时间，秒
+	Utime         int64 `protobuf:"varint,12,opt,name=utime,proto3" json:"utime,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -234,18 +272,152 @@ func (x *Conversation) GetCtime() string {
 	return ""
 }
 
+func (x *Conversation) GetPromptId() int64 {
+	if x != nil {
+		return x.PromptId
+	}
+	return 0
+}
+
+func (x *Conversation) GetBizId() int64 {
+	if x != nil {
+		return x.BizId
+	}
+	return 0
+}
+
+func (x *Conversation) GetContext() *ContextConfig {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *Conversation) GetDisableAutoTitle() bool {
+	if x != nil {
+		return x.DisableAutoTitle
+	}
+	return false
+}
+
+func (x *Conversation) GetArchived() bool {
+	if x != nil {
+		return x.Archived
+	}
+	return false
+}
+
+func (x *Conversation) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+func (x *Conversation) GetUtime() int64 {
+	if x != nil {
+		return x.Utime
+	}
+	return 0
+}
+
+// ContextConfig 构建对话上下文的配置，不传的字段使用默认值
+type ContextConfig struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// tokens 按照 token 数裁剪，last_n 只保留最近的 N 条消息
+	Strategy string `protobuf:"bytes,1,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// 模型的上下文窗口，不传使用模型自身的窗口大小
+	WindowTokens int64 `protobuf:"varint,2,opt,name=window_tokens,json=windowTokens,proto3" json:"window_tokens,omitempty"`
+	// 给模型输出预留的 token 数
+	ReservedTokens int64 `protobuf:"varint,3,opt,name=reserved_tokens,json=reservedTokens,proto3" json:"reserved_tokens,omitempty"`
+	LastN          int32 `protobuf:"varint,4,opt,name=last_n,json=lastN,proto3" json:"last_n,omitempty"`
+	// 最多读取多少条历史消息
+	MaxHistory    int32 `protobuf:"varint,5,opt,name=max_history,json=maxHistory,proto3" json:"max_history,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ContextConfig) Reset() {
+	*x = ContextConfig{}
+	mi := &file_ai_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ContextConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ContextConfig) ProtoMessage() {}
+
+func (x *ContextConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ContextConfig.ProtoReflect.Descriptor instead.
+func (*ContextConfig) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ContextConfig) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *ContextConfig) GetWindowTokens() int64 {
+	if x != nil {
+		return x.WindowTokens
+	}
+	return 0
+}
+
+func (x *ContextConfig) GetReservedTokens() int64 {
+	if x != nil {
+		return x.ReservedTokens
+	}
+	return 0
+}
+
+func (x *ContextConfig) GetLastN() int32 {
+	if x != nil {
+		return x.LastN
+	}
+	return 0
+}
+
+func (x *ContextConfig) GetMaxHistory() int32 {
+	if x != nil {
+		return x.MaxHistory
+	}
+	return 0
+}
+
 type ListReq struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Uid           string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
-	Offset        int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
-	Limit         int64                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Uid    string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	Offset int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Limit  int64                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	// 为 true 的时候只列出归档的对话，否则只列出没有归档的对话
+	Archived bool `protobuf:"varint,4,opt,name=archived,proto3" json:"archived,omitempty"`
+	// 只列出置顶的对话
+	PinnedOnly    bool `protobuf:"varint,5,opt,name=pinned_only,json=pinnedOnly,proto3" json:"pinned_only,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *ListReq) Reset() {
 	*x = ListReq{}
-	mi := &file_ai_proto_msgTypes[2]
+	mi := &file_ai_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -257,7 +429,7 @@ func (x *ListReq) String() string {
 func (*ListReq) ProtoMessage() {}
 
 func (x *ListReq) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[2]
+	mi := &file_ai_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -270,7 +442,7 @@ func (x *ListReq) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListReq.ProtoReflect.Descriptor instead.
 func (*ListReq) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{2}
+	return file_ai_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *ListReq) GetUid() string {
@@ -294,6 +466,20 @@ func (x *ListReq) GetLimit() int64 {
 	return 0
 }
 
+func (x *ListReq) GetArchived() bool {
+	if x != nil {
+		return x.Archived
+	}
+	return false
+}
+
+func (x *ListReq) GetPinnedOnly() bool {
+	if x != nil {
+		return x.PinnedOnly
+	}
+	return false
+}
+
 type ListResp struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Conversations []*Conversation        `protobuf:"bytes,1,rep,name=conversations,proto3" json:"conversations,omitempty"`
@@ -303,7 +489,7 @@ type ListResp struct {
 
 func (x *ListResp) Reset() {
 	*x = ListResp{}
-	mi := &file_ai_proto_msgTypes[3]
+	mi := &file_ai_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -315,7 +501,7 @@ func (x *ListResp) String() string {
 func (*ListResp) ProtoMessage() {}
 
 func (x *ListResp) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[3]
+	mi := &file_ai_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -328,7 +514,7 @@ func (x *ListResp) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListResp.ProtoReflect.Descriptor instead.
 func (*ListResp) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{3}
+	return file_ai_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ListResp) GetConversations() []*Conversation {
@@ -348,7 +534,7 @@ type LLMRequest struct {
 
 func (x *LLMRequest) Reset() {
 	*x = LLMRequest{}
-	mi := &file_ai_proto_msgTypes[4]
+	mi := &file_ai_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -360,7 +546,7 @@ func (x *LLMRequest) String() string {
 func (*LLMRequest) ProtoMessage() {}
 
 func (x *LLMRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[4]
+	mi := &file_ai_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -373,7 +559,7 @@ func (x *LLMRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use LLMRequest.ProtoReflect.Descriptor instead.
 func (*LLMRequest) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{4}
+	return file_ai_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *LLMRequest) GetSn() string {
@@ -399,7 +585,7 @@ type DetailRequest struct {
 
 func (x *DetailRequest) Reset() {
 	*x = DetailRequest{}
-	mi := &file_ai_proto_msgTypes[5]
+	mi := &file_ai_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -411,7 +597,7 @@ func (x *DetailRequest) String() string {
 func (*DetailRequest) ProtoMessage() {}
 
 func (x *DetailRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[5]
+	mi := &file_ai_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -424,7 +610,7 @@ func (x *DetailRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DetailRequest.ProtoReflect.Descriptor instead.
 func (*DetailRequest) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{5}
+	return file_ai_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *DetailRequest) GetSn() string {
@@ -434,6 +620,7 @@ func (x *DetailRequest) GetSn() string {
 	return ""
 }
 
+// DetailResponse 当前分支上的消息，按照时间先后排列
 type DetailResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Message       []*Message             `protobuf:"bytes,2,rep,name=message,proto3" json:"message,omitempty"`
@@ -443,7 +630,7 @@ type DetailResponse struct {
 
 func (x *DetailResponse) Reset() {
 	*x = DetailResponse{}
-	mi := &file_ai_proto_msgTypes[6]
+	mi := &file_ai_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -455,7 +642,7 @@ func (x *DetailResponse) String() string {
 func (*DetailResponse) ProtoMessage() {}
 
 func (x *DetailResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[6]
+	mi := &file_ai_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -468,7 +655,7 @@ func (x *DetailResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DetailResponse.ProtoReflect.Descriptor instead.
 func (*DetailResponse) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{6}
+	return file_ai_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *DetailResponse) GetMessage() []*Message {
@@ -484,13 +671,20 @@ type Message struct {
 	Role             Role                   `protobuf:"varint,2,opt,name=role,proto3,enum=ai.v1.Role" json:"role,omitempty"`
 	Content          string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`
 	ReasoningContent string                 `protobuf:"bytes,4,opt,name=reasoningContent,proto3" json:"reasoningContent,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	ParentId         string                 `protobuf:"bytes,5,opt,name=parent_id,json=parentId,proto3" json:"parent_id,omitempty"`
+	// 和这条消息有同一个上一条消息的数量，包括自己，大于 1 说明有别的分支
+	Siblings int32 `protobuf:"varint,6,opt,name=siblings,proto3" json:"siblings,omitempty"`
+	// 这条消息在兄弟消息里面的位置，从 0 开始
+	SiblingIndex int32 `protobuf:"varint,7,opt,name=sibling_index,json=siblingIndex,proto3" json:"sibling_index,omitempty"`
+	// 0 生成完毕，1 正在生成，2 生成失败，3 被取消
+	Status        int32 `protobuf:"varint,8,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Message) Reset() {
 	*x = Message{}
-	mi := &file_ai_proto_msgTypes[7]
+	mi := &file_ai_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -502,7 +696,7 @@ func (x *Message) String() string {
 func (*Message) ProtoMessage() {}
 
 func (x *Message) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[7]
+	mi := &file_ai_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -515,7 +709,7 @@ func (x *Message) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Message.ProtoReflect.Descriptor instead.
 func (*Message) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{7}
+	return file_ai_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *Message) GetId() string {
@@ -546,6 +740,34 @@ func (x *Message) GetReasoningContent() string {
 	return ""
 }
 
+func (x *Message) GetParentId() string {
+	if x != nil {
+		return x.ParentId
+	}
+	return ""
+}
+
+func (x *Message) GetSiblings() int32 {
+	if x != nil {
+		return x.Siblings
+	}
+	return 0
+}
+
+func (x *Message) GetSiblingIndex() int32 {
+	if x != nil {
+		return x.SiblingIndex
+	}
+	return 0
+}
+
+func (x *Message) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
 type ChatResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
@@ -557,7 +779,7 @@ type ChatResponse struct {
 
 func (x *ChatResponse) Reset() {
 	*x = ChatResponse{}
-	mi := &file_ai_proto_msgTypes[8]
+	mi := &file_ai_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -569,7 +791,7 @@ func (x *ChatResponse) String() string {
 func (*ChatResponse) ProtoMessage() {}
 
 func (x *ChatResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_ai_proto_msgTypes[8]
+	mi := &file_ai_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -582,7 +804,7 @@ func (x *ChatResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ChatResponse.ProtoReflect.Descriptor instead.
 func (*ChatResponse) Descriptor() ([]byte, []int) {
-	return file_ai_proto_rawDescGZIP(), []int{8}
+	return file_ai_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *ChatResponse) GetSn() string {
@@ -606,61 +828,1761 @@ func (x *ChatResponse) GetMetadata() string {
 	return ""
 }
 
-var File_ai_proto protoreflect.FileDescriptor
+type FeedbackRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	MessageId int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// 大于 0 表示赞，小于 0 表示踩，0 表示取消
+	Score int32 `protobuf:"varint,2,opt,name=score,proto3" json:"score,omitempty"`
+	// 必填，只能评价这个用户自己的对话
+	Uid string `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	// inaccurate、unhelpful、incomplete、off_topic、harmful 或者 other，可以不传
+	Reason string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// 补充说明，最多 500 个字
+	Comment       string `protobuf:"bytes,5,opt,name=comment,proto3" json:"comment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_ai_proto_rawDesc = "" +
-	"\n" +
-	"\bai.proto\x12\x05ai.v1\"{\n" +
-	"\vStreamEvent\x12\x14\n" +
-	"\x05final\x18\x01 \x01(\bR\x05final\x12*\n" +
-	"\x10reasoningContent\x18\x02 \x01(\tR\x10reasoningContent\x12\x18\n" +
-	"\acontent\x18\x03 \x01(\tR\acontent\x12\x10\n" +
-	"\x03err\x18\x04 \x01(\tR\x03err\"\x86\x01\n" +
-	"\fConversation\x12\x0e\n" +
-	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
-	"\x03uid\x18\x02 \x01(\tR\x03uid\x12\x14\n" +
-	"\x05title\x18\x03 \x01(\tR\x05title\x12(\n" +
-	"\amessage\x18\x04 \x03(\v2\x0e.ai.v1.MessageR\amessage\x12\x14\n" +
-	"\x05ctime\x18\x05 \x01(\tR\x05ctime\"I\n" +
-	"\aListReq\x12\x10\n" +
-	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x16\n" +
-	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x14\n" +
-	"\x05limit\x18\x03 \x01(\x03R\x05limit\"E\n" +
-	"\bListResp\x129\n" +
-	"\rconversations\x18\x01 \x03(\v2\x13.ai.v1.ConversationR\rconversations\"F\n" +
-	"\n" +
-	"LLMRequest\x12\x0e\n" +
-	"\x02sn\x18\x01 \x01(\tR\x02sn\x12(\n" +
-	"\amessage\x18\x02 \x03(\v2\x0e.ai.v1.MessageR\amessage\"\x1f\n" +
-	"\rDetailRequest\x12\x0e\n" +
-	"\x02sn\x18\x01 \x01(\tR\x02sn\":\n" +
-	"\x0eDetailResponse\x12(\n" +
-	"\amessage\x18\x02 \x03(\v2\x0e.ai.v1.MessageR\amessage\"\x80\x01\n" +
-	"\aMessage\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1f\n" +
-	"\x04role\x18\x02 \x01(\x0e2\v.ai.v1.RoleR\x04role\x12\x18\n" +
-	"\acontent\x18\x03 \x01(\tR\acontent\x12*\n" +
-	"\x10reasoningContent\x18\x04 \x01(\tR\x10reasoningContent\"f\n" +
-	"\fChatResponse\x12\x0e\n" +
-	"\x02sn\x18\x01 \x01(\tR\x02sn\x12*\n" +
-	"\bresponse\x18\x02 \x01(\v2\x0e.ai.v1.MessageR\bresponse\x12\x1a\n" +
-	"\bmetadata\x18\x03 \x01(\tR\bmetadata*B\n" +
-	"\x04Role\x12\v\n" +
-	"\aUNKNOWN\x10\x00\x12\b\n" +
-	"\x04USER\x10\x01\x12\r\n" +
-	"\tASSISTANT\x10\x02\x12\n" +
-	"\n" +
-	"\x06SYSTEM\x10\x03\x12\b\n" +
-	"\x04TOOL\x10\x042h\n" +
-	"\tAIService\x12+\n" +
-	"\x04Chat\x12\x0e.ai.v1.Message\x1a\x13.ai.v1.ChatResponse\x12.\n" +
-	"\x06Stream\x12\x0e.ai.v1.Message\x1a\x12.ai.v1.StreamEvent0\x012\x8c\x02\n" +
-	"\x13ConversationService\x122\n" +
-	"\x06Create\x12\x13.ai.v1.Conversation\x1a\x13.ai.v1.Conversation\x12'\n" +
-	"\x04List\x12\x0e.ai.v1.ListReq\x1a\x0f.ai.v1.ListResp\x12.\n" +
-	"\x04Chat\x12\x11.ai.v1.LLMRequest\x1a\x13.ai.v1.ChatResponse\x125\n" +
-	"\x06Detail\x12\x14.ai.v1.DetailRequest\x1a\x15.ai.v1.DetailResponse\x121\n" +
-	"\x06Stream\x12\x11.ai.v1.LLMRequest\x1a\x12.ai.v1.StreamEvent0\x01Bz\n" +
+func (x *FeedbackRequest) Reset() {
+	*x = FeedbackRequest{}
+	mi := &file_ai_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FeedbackRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeedbackRequest) ProtoMessage() {}
+
+func (x *FeedbackRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeedbackRequest.ProtoReflect.Descriptor instead.
+func (*FeedbackRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *FeedbackRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *FeedbackRequest) GetScore() int32 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *FeedbackRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *FeedbackRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *FeedbackRequest) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+type FeedbackResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FeedbackResponse) Reset() {
+	*x = FeedbackResponse{}
+	mi := &file_ai_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FeedbackResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeedbackResponse) ProtoMessage() {}
+
+func (x *FeedbackResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeedbackResponse.ProtoReflect.Descriptor instead.
+func (*FeedbackResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{11}
+}
+
+type RegenerateTitleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegenerateTitleRequest) Reset() {
+	*x = RegenerateTitleRequest{}
+	mi := &file_ai_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegenerateTitleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegenerateTitleRequest) ProtoMessage() {}
+
+func (x *RegenerateTitleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegenerateTitleRequest.ProtoReflect.Descriptor instead.
+func (*RegenerateTitleRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RegenerateTitleRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *RegenerateTitleRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Uid           string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_ai_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SubscribeRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type ConversationEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// title_updated
+	Type          string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Sn            string `protobuf:"bytes,2,opt,name=sn,proto3" json:"sn,omitempty"`
+	Title         string `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConversationEvent) Reset() {
+	*x = ConversationEvent{}
+	mi := &file_ai_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConversationEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConversationEvent) ProtoMessage() {}
+
+func (x *ConversationEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConversationEvent.ProtoReflect.Descriptor instead.
+func (*ConversationEvent) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ConversationEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ConversationEvent) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *ConversationEvent) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+type UpdateConversationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	Title         string                 `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateConversationRequest) Reset() {
+	*x = UpdateConversationRequest{}
+	mi := &file_ai_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateConversationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateConversationRequest) ProtoMessage() {}
+
+func (x *UpdateConversationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateConversationRequest.ProtoReflect.Descriptor instead.
+func (*UpdateConversationRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *UpdateConversationRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *UpdateConversationRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *UpdateConversationRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+type ConversationOpRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConversationOpRequest) Reset() {
+	*x = ConversationOpRequest{}
+	mi := &file_ai_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConversationOpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConversationOpRequest) ProtoMessage() {}
+
+func (x *ConversationOpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConversationOpRequest.ProtoReflect.Descriptor instead.
+func (*ConversationOpRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ConversationOpRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *ConversationOpRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type PinRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Sn    string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Uid   string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	// false 表示取消置顶
+	Pinned        bool `protobuf:"varint,3,opt,name=pinned,proto3" json:"pinned,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PinRequest) Reset() {
+	*x = PinRequest{}
+	mi := &file_ai_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PinRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PinRequest) ProtoMessage() {}
+
+func (x *PinRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PinRequest.ProtoReflect.Descriptor instead.
+func (*PinRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PinRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *PinRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *PinRequest) GetPinned() bool {
+	if x != nil {
+		return x.Pinned
+	}
+	return false
+}
+
+type ConversationOpResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConversationOpResponse) Reset() {
+	*x = ConversationOpResponse{}
+	mi := &file_ai_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConversationOpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConversationOpResponse) ProtoMessage() {}
+
+func (x *ConversationOpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConversationOpResponse.ProtoReflect.Descriptor instead.
+func (*ConversationOpResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{18}
+}
+
+type RegenerateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegenerateRequest) Reset() {
+	*x = RegenerateRequest{}
+	mi := &file_ai_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegenerateRequest) ProtoMessage() {}
+
+func (x *RegenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegenerateRequest.ProtoReflect.Descriptor instead.
+func (*RegenerateRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RegenerateRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *RegenerateRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type EditAndResendRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	Uid           string                 `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EditAndResendRequest) Reset() {
+	*x = EditAndResendRequest{}
+	mi := &file_ai_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EditAndResendRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EditAndResendRequest) ProtoMessage() {}
+
+func (x *EditAndResendRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EditAndResendRequest.ProtoReflect.Descriptor instead.
+func (*EditAndResendRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *EditAndResendRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *EditAndResendRequest) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *EditAndResendRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type SwitchBranchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sn            string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	MessageId     int64                  `protobuf:"varint,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Uid           string                 `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SwitchBranchRequest) Reset() {
+	*x = SwitchBranchRequest{}
+	mi := &file_ai_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SwitchBranchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SwitchBranchRequest) ProtoMessage() {}
+
+func (x *SwitchBranchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SwitchBranchRequest.ProtoReflect.Descriptor instead.
+func (*SwitchBranchRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SwitchBranchRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *SwitchBranchRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *SwitchBranchRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type ResumeStreamRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	MessageId int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	LastSeq   int64                  `protobuf:"varint,2,opt,name=last_seq,json=lastSeq,proto3" json:"last_seq,omitempty"`
+	// 只能续传这个用户自己的对话
+	Uid           string `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeStreamRequest) Reset() {
+	*x = ResumeStreamRequest{}
+	mi := &file_ai_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeStreamRequest) ProtoMessage() {}
+
+func (x *ResumeStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeStreamRequest.ProtoReflect.Descriptor instead.
+func (*ResumeStreamRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ResumeStreamRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *ResumeStreamRequest) GetLastSeq() int64 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+func (x *ResumeStreamRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type CancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Uid           string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRequest) Reset() {
+	*x = CancelRequest{}
+	mi := &file_ai_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRequest) ProtoMessage() {}
+
+func (x *CancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRequest.ProtoReflect.Descriptor instead.
+func (*CancelRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *CancelRequest) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *CancelRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type CancelResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelResponse) Reset() {
+	*x = CancelResponse{}
+	mi := &file_ai_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelResponse) ProtoMessage() {}
+
+func (x *CancelResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelResponse.ProtoReflect.Descriptor instead.
+func (*CancelResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{24}
+}
+
+type SearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Uid   string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	// 至少两个字
+	Keyword string `protobuf:"bytes,2,opt,name=keyword,proto3" json:"keyword,omitempty"`
+	// 最多返回多少个对话，默认 20，最多 50
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_ai_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *SearchRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetKeyword() string {
+	if x != nil {
+		return x.Keyword
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SearchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*SearchResult        `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResponse) Reset() {
+	*x = SearchResponse{}
+	mi := &file_ai_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResponse) ProtoMessage() {}
+
+func (x *SearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResponse.ProtoReflect.Descriptor instead.
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *SearchResponse) GetResults() []*SearchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// SearchResult 命中的对话，命中的部分用 <em></em> 包起来，其余的内容已经做了 HTML 转义
+type SearchResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Sn    string                 `protobuf:"bytes,1,opt,name=sn,proto3" json:"sn,omitempty"`
+	Title string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	// 标题没有命中的时候为空
+	TitleHighlight string          `protobuf:"bytes,3,opt,name=title_highlight,json=titleHighlight,proto3" json:"title_highlight,omitempty"`
+	Matches        []*MessageMatch `protobuf:"bytes,4,rep,name=matches,proto3" json:"matches,omitempty"`
+	Utime          int64           `protobuf:"varint,5,opt,name=utime,proto3" json:"utime,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SearchResult) Reset() {
+	*x = SearchResult{}
+	mi := &file_ai_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResult) ProtoMessage() {}
+
+func (x *SearchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResult.ProtoReflect.Descriptor instead.
+func (*SearchResult) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *SearchResult) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *SearchResult) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *SearchResult) GetTitleHighlight() string {
+	if x != nil {
+		return x.TitleHighlight
+	}
+	return ""
+}
+
+func (x *SearchResult) GetMatches() []*MessageMatch {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+func (x *SearchResult) GetUtime() int64 {
+	if x != nil {
+		return x.Utime
+	}
+	return 0
+}
+
+type MessageMatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MessageId     int64                  `protobuf:"varint,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Role          Role                   `protobuf:"varint,2,opt,name=role,proto3,enum=ai.v1.Role" json:"role,omitempty"`
+	Snippet       string                 `protobuf:"bytes,3,opt,name=snippet,proto3" json:"snippet,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageMatch) Reset() {
+	*x = MessageMatch{}
+	mi := &file_ai_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageMatch) ProtoMessage() {}
+
+func (x *MessageMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageMatch.ProtoReflect.Descriptor instead.
+func (*MessageMatch) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *MessageMatch) GetMessageId() int64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *MessageMatch) GetRole() Role {
+	if x != nil {
+		return x.Role
+	}
+	return Role_UNKNOWN
+}
+
+func (x *MessageMatch) GetSnippet() string {
+	if x != nil {
+		return x.Snippet
+	}
+	return ""
+}
+
+type ExportRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Uid   string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	// 不为空的时候只导出这个对话，否则导出 [start, end) 之间创建的对话，单位秒
+	Sn    string `protobuf:"bytes,2,opt,name=sn,proto3" json:"sn,omitempty"`
+	Start int64  `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
+	End   int64  `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	// markdown、json 或者 jsonl。jsonl 是 OpenAI 微调的格式
+	Format           string `protobuf:"bytes,5,opt,name=format,proto3" json:"format,omitempty"`
+	IncludeReasoning bool   `protobuf:"varint,6,opt,name=include_reasoning,json=includeReasoning,proto3" json:"include_reasoning,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ExportRequest) Reset() {
+	*x = ExportRequest{}
+	mi := &file_ai_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportRequest) ProtoMessage() {}
+
+func (x *ExportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportRequest.ProtoReflect.Descriptor instead.
+func (*ExportRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *ExportRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *ExportRequest) GetSn() string {
+	if x != nil {
+		return x.Sn
+	}
+	return ""
+}
+
+func (x *ExportRequest) GetStart() int64 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *ExportRequest) GetEnd() int64 {
+	if x != nil {
+		return x.End
+	}
+	return 0
+}
+
+func (x *ExportRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *ExportRequest) GetIncludeReasoning() bool {
+	if x != nil {
+		return x.IncludeReasoning
+	}
+	return false
+}
+
+type ExportResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Content       []byte                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportResponse) Reset() {
+	*x = ExportResponse{}
+	mi := &file_ai_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportResponse) ProtoMessage() {}
+
+func (x *ExportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportResponse.ProtoReflect.Descriptor instead.
+func (*ExportResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ExportResponse) GetContent() []byte {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+type GraphRunRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	GraphId int64                  `protobuf:"varint,1,opt,name=graph_id,json=graphId,proto3" json:"graph_id,omitempty"`
+	Uid     int64                  `protobuf:"varint,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	// JSON 格式的输入，没有上游的节点以它作为输入
+	Input string `protobuf:"bytes,3,opt,name=input,proto3" json:"input,omitempty"`
+	// 执行图的某个版本，为 0 的时候执行图当前的状态
+	Version       int64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraphRunRequest) Reset() {
+	*x = GraphRunRequest{}
+	mi := &file_ai_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphRunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphRunRequest) ProtoMessage() {}
+
+func (x *GraphRunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphRunRequest.ProtoReflect.Descriptor instead.
+func (*GraphRunRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *GraphRunRequest) GetGraphId() int64 {
+	if x != nil {
+		return x.GraphId
+	}
+	return 0
+}
+
+func (x *GraphRunRequest) GetUid() int64 {
+	if x != nil {
+		return x.Uid
+	}
+	return 0
+}
+
+func (x *GraphRunRequest) GetInput() string {
+	if x != nil {
+		return x.Input
+	}
+	return ""
+}
+
+func (x *GraphRunRequest) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type GraphRunEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// run_started、node_started、node_finished、node_waiting、run_finished 或者 run_waiting
+	Type      string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	RunId     int64  `protobuf:"varint,2,opt,name=run_id,json=runId,proto3" json:"run_id,omitempty"`
+	RunStatus string `protobuf:"bytes,3,opt,name=run_status,json=runStatus,proto3" json:"run_status,omitempty"`
+	// 下面的字段只有节点的事件才有
+	NodeId     int64  `protobuf:"varint,4,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	NodeStatus string `protobuf:"bytes,5,opt,name=node_status,json=nodeStatus,proto3" json:"node_status,omitempty"`
+	// JSON 格式，run_finished 的时候是整个图的输出
+	Output string `protobuf:"bytes,6,opt,name=output,proto3" json:"output,omitempty"`
+	Error  string `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	Tokens int64  `protobuf:"varint,8,opt,name=tokens,proto3" json:"tokens,omitempty"`
+	// 节点执行耗时，毫秒
+	Latency       int64 `protobuf:"varint,9,opt,name=latency,proto3" json:"latency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraphRunEvent) Reset() {
+	*x = GraphRunEvent{}
+	mi := &file_ai_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraphRunEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraphRunEvent) ProtoMessage() {}
+
+func (x *GraphRunEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraphRunEvent.ProtoReflect.Descriptor instead.
+func (*GraphRunEvent) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *GraphRunEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *GraphRunEvent) GetRunId() int64 {
+	if x != nil {
+		return x.RunId
+	}
+	return 0
+}
+
+func (x *GraphRunEvent) GetRunStatus() string {
+	if x != nil {
+		return x.RunStatus
+	}
+	return ""
+}
+
+func (x *GraphRunEvent) GetNodeId() int64 {
+	if x != nil {
+		return x.NodeId
+	}
+	return 0
+}
+
+func (x *GraphRunEvent) GetNodeStatus() string {
+	if x != nil {
+		return x.NodeStatus
+	}
+	return ""
+}
+
+func (x *GraphRunEvent) GetOutput() string {
+	if x != nil {
+		return x.Output
+	}
+	return ""
+}
+
+func (x *GraphRunEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *GraphRunEvent) GetTokens() int64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return 0
+}
+
+func (x *GraphRunEvent) GetLatency() int64 {
+	if x != nil {
+		return x.Latency
+	}
+	return 0
+}
+
+type EmbedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Uid   int64                  `protobuf:"varint,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	// 最多 256 个，不能有空的文本
+	Input []string `protobuf:"bytes,2,rep,name=input,proto3" json:"input,omitempty"`
+	// 幂等的 key，带着相同的 request_id 重试不会重复扣费
+	RequestId     string `protobuf:"bytes,3,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedRequest) Reset() {
+	*x = EmbedRequest{}
+	mi := &file_ai_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedRequest) ProtoMessage() {}
+
+func (x *EmbedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedRequest.ProtoReflect.Descriptor instead.
+func (*EmbedRequest) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *EmbedRequest) GetUid() int64 {
+	if x != nil {
+		return x.Uid
+	}
+	return 0
+}
+
+func (x *EmbedRequest) GetInput() []string {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+func (x *EmbedRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type EmbedResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 和 input 一一对应
+	Data          []*Embedding `protobuf:"bytes,1,rep,name=data,proto3" json:"data,omitempty"`
+	Model         string       `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	PromptTokens  int64        `protobuf:"varint,3,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	TotalTokens   int64        `protobuf:"varint,4,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmbedResponse) Reset() {
+	*x = EmbedResponse{}
+	mi := &file_ai_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmbedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmbedResponse) ProtoMessage() {}
+
+func (x *EmbedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmbedResponse.ProtoReflect.Descriptor instead.
+func (*EmbedResponse) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *EmbedResponse) GetData() []*Embedding {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *EmbedResponse) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *EmbedResponse) GetPromptTokens() int64 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *EmbedResponse) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+type Embedding struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Vector        []float32              `protobuf:"fixed32,2,rep,packed,name=vector,proto3" json:"vector,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Embedding) Reset() {
+	*x = Embedding{}
+	mi := &file_ai_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Embedding) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Embedding) ProtoMessage() {}
+
+func (x *Embedding) ProtoReflect() protoreflect.Message {
+	mi := &file_ai_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Embedding.ProtoReflect.Descriptor instead.
+func (*Embedding) Descriptor() ([]byte, []int) {
+	return file_ai_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *Embedding) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *Embedding) GetVector() []float32 {
+	if x != nil {
+		return x.Vector
+	}
+	return nil
+}
+
+var File_ai_proto protoreflect.FileDescriptor
+
+const file_ai_proto_rawDesc = "" +
+	"\n" +
+	"\bai.proto\x12\x05ai.v1\"\xca\x01\n" +
+	"\vStreamEvent\x12\x14\n" +
+	"\x05final\x18\x01 \x01(\bR\x05final\x12*\n" +
+	"\x10reasoningContent\x18\x02 \x01(\tR\x10reasoningContent\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12\x10\n" +
+	"\x03err\x18\x04 \x01(\tR\x03err\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x05 \x01(\x03R\tmessageId\x12\x10\n" +
+	"\x03seq\x18\x06 \x01(\x03R\x03seq\x12\x1c\n" +
+	"\tcancelled\x18\a \x01(\bR\tcancelled\"\xe2\x02\n" +
+	"\fConversation\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12(\n" +
+	"\amessage\x18\x04 \x03(\v2\x0e.ai.v1.MessageR\amessage\x12\x14\n" +
+	"\x05ctime\x18\x05 \x01(\tR\x05ctime\x12\x1b\n" +
+	"\tprompt_id\x18\x06 \x01(\x03R\bpromptId\x12\x15\n" +
+	"\x06biz_id\x18\a \x01(\x03R\x05bizId\x12.\n" +
+	"\acontext\x18\b \x01(\v2\x14.ai.v1.ContextConfigR\acontext\x12,\n" +
+	"\x12disable_auto_title\x18\t \x01(\bR\x10disableAutoTitle\x12\x1a\n" +
+	"\barchived\x18\n" +
+	" \x01(\bR\barchived\x12\x16\n" +
+	"\x06pinned\x18\v \x01(\bR\x06pinned\x12\x14\n" +
+	"\x05utime\x18\f \x01(\x03R\x05utime\"\xb1\x01\n" +
+	"\rContextConfig\x12\x1a\n" +
+	"\bstrategy\x18\x01 \x01(\tR\bstrategy\x12#\n" +
+	"\rwindow_tokens\x18\x02 \x01(\x03R\fwindowTokens\x12'\n" +
+	"\x0freserved_tokens\x18\x03 \x01(\x03R\x0ereservedTokens\x12\x15\n" +
+	"\x06last_n\x18\x04 \x01(\x05R\x05lastN\x12\x1f\n" +
+	"\vmax_history\x18\x05 \x01(\x05R\n" +
+	"maxHistory\"\x86\x01\n" +
+	"\aListReq\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x03R\x05limit\x12\x1a\n" +
+	"\barchived\x18\x04 \x01(\bR\barchived\x12\x1f\n" +
+	"\vpinned_only\x18\x05 \x01(\bR\n" +
+	"pinnedOnly\"E\n" +
+	"\bListResp\x129\n" +
+	"\rconversations\x18\x01 \x03(\v2\x13.ai.v1.ConversationR\rconversations\"F\n" +
+	"\n" +
+	"LLMRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12(\n" +
+	"\amessage\x18\x02 \x03(\v2\x0e.ai.v1.MessageR\amessage\"\x1f\n" +
+	"\rDetailRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\":\n" +
+	"\x0eDetailResponse\x12(\n" +
+	"\amessage\x18\x02 \x03(\v2\x0e.ai.v1.MessageR\amessage\"\xf6\x01\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1f\n" +
+	"\x04role\x18\x02 \x01(\x0e2\v.ai.v1.RoleR\x04role\x12\x18\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12*\n" +
+	"\x10reasoningContent\x18\x04 \x01(\tR\x10reasoningContent\x12\x1b\n" +
+	"\tparent_id\x18\x05 \x01(\tR\bparentId\x12\x1a\n" +
+	"\bsiblings\x18\x06 \x01(\x05R\bsiblings\x12#\n" +
+	"\rsibling_index\x18\a \x01(\x05R\fsiblingIndex\x12\x16\n" +
+	"\x06status\x18\b \x01(\x05R\x06status\"f\n" +
+	"\fChatResponse\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12*\n" +
+	"\bresponse\x18\x02 \x01(\v2\x0e.ai.v1.MessageR\bresponse\x12\x1a\n" +
+	"\bmetadata\x18\x03 \x01(\tR\bmetadata\"\x8a\x01\n" +
+	"\x0fFeedbackRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x05R\x05score\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x18\n" +
+	"\acomment\x18\x05 \x01(\tR\acomment\"\x12\n" +
+	"\x10FeedbackResponse\":\n" +
+	"\x16RegenerateTitleRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\"$\n" +
+	"\x10SubscribeRequest\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\"M\n" +
+	"\x11ConversationEvent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x0e\n" +
+	"\x02sn\x18\x02 \x01(\tR\x02sn\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\"S\n" +
+	"\x19UpdateConversationRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\"9\n" +
+	"\x15ConversationOpRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\"F\n" +
+	"\n" +
+	"PinRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\x12\x16\n" +
+	"\x06pinned\x18\x03 \x01(\bR\x06pinned\"\x18\n" +
+	"\x16ConversationOpResponse\"D\n" +
+	"\x11RegenerateRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\"a\n" +
+	"\x14EditAndResendRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\"V\n" +
+	"\x13SwitchBranchRequest\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\x03R\tmessageId\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\"a\n" +
+	"\x13ResumeStreamRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x19\n" +
+	"\blast_seq\x18\x02 \x01(\x03R\alastSeq\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\"@\n" +
+	"\rCancelRequest\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\"\x10\n" +
+	"\x0eCancelResponse\"Q\n" +
+	"\rSearchRequest\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x18\n" +
+	"\akeyword\x18\x02 \x01(\tR\akeyword\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"?\n" +
+	"\x0eSearchResponse\x12-\n" +
+	"\aresults\x18\x01 \x03(\v2\x13.ai.v1.SearchResultR\aresults\"\xa2\x01\n" +
+	"\fSearchResult\x12\x0e\n" +
+	"\x02sn\x18\x01 \x01(\tR\x02sn\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\x12'\n" +
+	"\x0ftitle_highlight\x18\x03 \x01(\tR\x0etitleHighlight\x12-\n" +
+	"\amatches\x18\x04 \x03(\v2\x13.ai.v1.MessageMatchR\amatches\x12\x14\n" +
+	"\x05utime\x18\x05 \x01(\x03R\x05utime\"h\n" +
+	"\fMessageMatch\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\x03R\tmessageId\x12\x1f\n" +
+	"\x04role\x18\x02 \x01(\x0e2\v.ai.v1.RoleR\x04role\x12\x18\n" +
+	"\asnippet\x18\x03 \x01(\tR\asnippet\"\x9e\x01\n" +
+	"\rExportRequest\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x0e\n" +
+	"\x02sn\x18\x02 \x01(\tR\x02sn\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\x03R\x05start\x12\x10\n" +
+	"\x03end\x18\x04 \x01(\x03R\x03end\x12\x16\n" +
+	"\x06format\x18\x05 \x01(\tR\x06format\x12+\n" +
+	"\x11include_reasoning\x18\x06 \x01(\bR\x10includeReasoning\"*\n" +
+	"\x0eExportResponse\x12\x18\n" +
+	"\acontent\x18\x01 \x01(\fR\acontent\"n\n" +
+	"\x0fGraphRunRequest\x12\x19\n" +
+	"\bgraph_id\x18\x01 \x01(\x03R\agraphId\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\x03R\x03uid\x12\x14\n" +
+	"\x05input\x18\x03 \x01(\tR\x05input\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x03R\aversion\"\xf3\x01\n" +
+	"\rGraphRunEvent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x15\n" +
+	"\x06run_id\x18\x02 \x01(\x03R\x05runId\x12\x1d\n" +
+	"\n" +
+	"run_status\x18\x03 \x01(\tR\trunStatus\x12\x17\n" +
+	"\anode_id\x18\x04 \x01(\x03R\x06nodeId\x12\x1f\n" +
+	"\vnode_status\x18\x05 \x01(\tR\n" +
+	"nodeStatus\x12\x16\n" +
+	"\x06output\x18\x06 \x01(\tR\x06output\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12\x16\n" +
+	"\x06tokens\x18\b \x01(\x03R\x06tokens\x12\x18\n" +
+	"\alatency\x18\t \x01(\x03R\alatency\"U\n" +
+	"\fEmbedRequest\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\x03R\x03uid\x12\x14\n" +
+	"\x05input\x18\x02 \x03(\tR\x05input\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x03 \x01(\tR\trequestId\"\x93\x01\n" +
+	"\rEmbedResponse\x12$\n" +
+	"\x04data\x18\x01 \x03(\v2\x10.ai.v1.EmbeddingR\x04data\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12#\n" +
+	"\rprompt_tokens\x18\x03 \x01(\x03R\fpromptTokens\x12!\n" +
+	"\ftotal_tokens\x18\x04 \x01(\x03R\vtotalTokens\"9\n" +
+	"\tEmbedding\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x16\n" +
+	"\x06vector\x18\x02 \x03(\x02R\x06vector*B\n" +
+	"\x04Role\x12\v\n" +
+	"\aUNKNOWN\x10\x00\x12\b\n" +
+	"\x04USER\x10\x01\x12\r\n" +
+	"\tASSISTANT\x10\x02\x12\n" +
+	"\n" +
+	"\x06SYSTEM\x10\x03\x12\b\n" +
+	"\x04TOOL\x10\x042h\n" +
+	"\tAIService\x12+\n" +
+	"\x04Chat\x12\x0e.ai.v1.Message\x1a\x13.ai.v1.ChatResponse\x12.\n" +
+	"\x06Stream\x12\x0e.ai.v1.Message\x1a\x12.ai.v1.StreamEvent0\x012\x95\n" +
+	"\n" +
+	"\x13ConversationService\x122\n" +
+	"\x06Create\x12\x13.ai.v1.Conversation\x1a\x13.ai.v1.Conversation\x12'\n" +
+	"\x04List\x12\x0e.ai.v1.ListReq\x1a\x0f.ai.v1.ListResp\x12.\n" +
+	"\x04Chat\x12\x11.ai.v1.LLMRequest\x1a\x13.ai.v1.ChatResponse\x125\n" +
+	"\x06Detail\x12\x14.ai.v1.DetailRequest\x1a\x15.ai.v1.DetailResponse\x121\n" +
+	"\x06Stream\x12\x11.ai.v1.LLMRequest\x1a\x12.ai.v1.StreamEvent0\x01\x12;\n" +
+	"\bFeedback\x12\x16.ai.v1.FeedbackRequest\x1a\x17.ai.v1.FeedbackResponse\x12E\n" +
+	"\x0fRegenerateTitle\x12\x1d.ai.v1.RegenerateTitleRequest\x1a\x13.ai.v1.Conversation\x12@\n" +
+	"\tSubscribe\x12\x17.ai.v1.SubscribeRequest\x1a\x18.ai.v1.ConversationEvent0\x01\x12?\n" +
+	"\x06Update\x12 .ai.v1.UpdateConversationRequest\x1a\x13.ai.v1.Conversation\x12F\n" +
+	"\aArchive\x12\x1c.ai.v1.ConversationOpRequest\x1a\x1d.ai.v1.ConversationOpResponse\x12H\n" +
+	"\tUnarchive\x12\x1c.ai.v1.ConversationOpRequest\x1a\x1d.ai.v1.ConversationOpResponse\x127\n" +
+	"\x03Pin\x12\x11.ai.v1.PinRequest\x1a\x1d.ai.v1.ConversationOpResponse\x12E\n" +
+	"\x06Delete\x12\x1c.ai.v1.ConversationOpRequest\x1a\x1d.ai.v1.ConversationOpResponse\x12D\n" +
+	"\x05Purge\x12\x1c.ai.v1.ConversationOpRequest\x1a\x1d.ai.v1.ConversationOpResponse\x12;\n" +
+	"\n" +
+	"Regenerate\x12\x18.ai.v1.RegenerateRequest\x1a\x13.ai.v1.ChatResponse\x12A\n" +
+	"\rEditAndResend\x12\x1b.ai.v1.EditAndResendRequest\x1a\x13.ai.v1.ChatResponse\x12A\n" +
+	"\fSwitchBranch\x12\x1a.ai.v1.SwitchBranchRequest\x1a\x15.ai.v1.DetailResponse\x12@\n" +
+	"\fResumeStream\x12\x1a.ai.v1.ResumeStreamRequest\x1a\x12.ai.v1.StreamEvent0\x01\x125\n" +
+	"\x06Cancel\x12\x14.ai.v1.CancelRequest\x1a\x15.ai.v1.CancelResponse\x125\n" +
+	"\x06Search\x12\x14.ai.v1.SearchRequest\x1a\x15.ai.v1.SearchResponse\x125\n" +
+	"\x06Export\x12\x14.ai.v1.ExportRequest\x1a\x15.ai.v1.ExportResponse2E\n" +
+	"\fGraphService\x125\n" +
+	"\x03Run\x12\x16.ai.v1.GraphRunRequest\x1a\x14.ai.v1.GraphRunEvent0\x012F\n" +
+	"\x10EmbeddingService\x122\n" +
+	"\x05Embed\x12\x13.ai.v1.EmbedRequest\x1a\x14.ai.v1.EmbedResponseBz\n" +
 	"\tcom.ai.v1B\aAiProtoP\x01Z/github.com/ecodeclub/ai-gateway-go/api/gen;aiv1\xa2\x02\x03AXX\xaa\x02\x05Ai.V1\xca\x02\x05Ai\\V1\xe2\x02\x11Ai\\V1\\GPBMetadata\xea\x02\x06Ai::V1b\x06proto3"
 
 var (
@@ -676,45 +2598,113 @@ func file_ai_proto_rawDescGZIP() []byte {
 }
 
 var file_ai_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_ai_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_ai_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
 var file_ai_proto_goTypes = []any{
-	(Role)(0),              // 0: ai.v1.Role
-	(*StreamEvent)(nil),    // 1: ai.v1.StreamEvent
-	(*Conversation)(nil),   // 2: ai.v1.Conversation
-	(*ListReq)(nil),        // 3: ai.v1.ListReq
-	(*ListResp)(nil),       // 4: ai.v1.ListResp
-	(*LLMRequest)(nil),     // 5: ai.v1.LLMRequest
-	(*DetailRequest)(nil),  // 6: ai.v1.DetailRequest
-	(*DetailResponse)(nil), // 7: ai.v1.DetailResponse
-	(*Message)(nil),        // 8: ai.v1.Message
-	(*ChatResponse)(nil),   // 9: ai.v1.ChatResponse
+	(Role)(0),                         // 0: ai.v1.Role
+	(*StreamEvent)(nil),               // 1: ai.v1.StreamEvent
+	(*Conversation)(nil),              // 2: ai.v1.Conversation
+	(*ContextConfig)(nil),             // 3: ai.v1.ContextConfig
+	(*ListReq)(nil),                   // 4: ai.v1.ListReq
+	(*ListResp)(nil),                  // 5: ai.v1.ListResp
+	(*LLMRequest)(nil),                // 6: ai.v1.LLMRequest
+	(*DetailRequest)(nil),             // 7: ai.v1.DetailRequest
+	(*DetailResponse)(nil),            // 8: ai.v1.DetailResponse
+	(*Message)(nil),                   // 9: ai.v1.Message
+	(*ChatResponse)(nil),              // 10: ai.v1.ChatResponse
+	(*FeedbackRequest)(nil),           // 11: ai.v1.FeedbackRequest
+	(*FeedbackResponse)(nil),          // 12: ai.v1.FeedbackResponse
+	(*RegenerateTitleRequest)(nil),    // 13: ai.v1.RegenerateTitleRequest
+	(*SubscribeRequest)(nil),          // 14: ai.v1.SubscribeRequest
+	(*ConversationEvent)(nil),         // 15: ai.v1.ConversationEvent
+	(*UpdateConversationRequest)(nil), // 16: ai.v1.UpdateConversationRequest
+	(*ConversationOpRequest)(nil),     // 17: ai.v1.ConversationOpRequest
+	(*PinRequest)(nil),                // 18: ai.v1.PinRequest
+	(*ConversationOpResponse)(nil),    // 19: ai.v1.ConversationOpResponse
+	(*RegenerateRequest)(nil),         // 20: ai.v1.RegenerateRequest
+	(*EditAndResendRequest)(nil),      // 21: ai.v1.EditAndResendRequest
+	(*SwitchBranchRequest)(nil),       // 22: ai.v1.SwitchBranchRequest
+	(*ResumeStreamRequest)(nil),       // 23: ai.v1.ResumeStreamRequest
+	(*CancelRequest)(nil),             // 24: ai.v1.CancelRequest
+	(*CancelResponse)(nil),            // 25: ai.v1.CancelResponse
+	(*SearchRequest)(nil),             // 26: ai.v1.SearchRequest
+	(*SearchResponse)(nil),            // 27: ai.v1.SearchResponse
+	(*SearchResult)(nil),              // 28: ai.v1.SearchResult
+	(*MessageMatch)(nil),              // 29: ai.v1.MessageMatch
+	(*ExportRequest)(nil),             // 30: ai.v1.ExportRequest
+	(*ExportResponse)(nil),            // 31: ai.v1.ExportResponse
+	(*GraphRunRequest)(nil),           // 32: ai.v1.GraphRunRequest
+	(*GraphRunEvent)(nil),             // 33: ai.v1.GraphRunEvent
+	(*EmbedRequest)(nil),              // 34: ai.v1.EmbedRequest
+	(*EmbedResponse)(nil),             // 35: ai.v1.EmbedResponse
+	(*Embedding)(nil),                 // 36: ai.v1.Embedding
 }
 var file_ai_proto_depIdxs = []int32{
-	8,  // 0: ai.v1.Conversation.message:type_name -> ai.v1.Message
-	2,  // 1: ai.v1.ListResp.conversations:type_name -> ai.v1.Conversation
-	8,  // 2: ai.v1.LLMRequest.message:type_name -> ai.v1.Message
-	8,  // 3: ai.v1.DetailResponse.message:type_name -> ai.v1.Message
-	0,  // 4: ai.v1.Message.role:type_name -> ai.v1.Role
-	8,  // 5: ai.v1.ChatResponse.response:type_name -> ai.v1.Message
-	8,  // 6: ai.v1.AIService.Chat:input_type -> ai.v1.Message
-	8,  // 7: ai.v1.AIService.Stream:input_type -> ai.v1.Message
-	2,  // 8: ai.v1.ConversationService.Create:input_type -> ai.v1.Conversation
-	3,  // 9: ai.v1.ConversationService.List:input_type -> ai.v1.ListReq
-	5,  // 10: ai.v1.ConversationService.Chat:input_type -> ai.v1.LLMRequest
-	6,  // 11: ai.v1.ConversationService.Detail:input_type -> ai.v1.DetailRequest
-	5,  // 12: ai.v1.ConversationService.Stream:input_type -> ai.v1.LLMRequest
-	9,  // 13: ai.v1.AIService.Chat:output_type -> ai.v1.ChatResponse
-	1,  // 14: ai.v1.AIService.Stream:output_type -> ai.v1.StreamEvent
-	2,  // 15: ai.v1.ConversationService.Create:output_type -> ai.v1.Conversation
-	4,  // 16: ai.v1.ConversationService.List:output_type -> ai.v1.ListResp
-	9,  // 17: ai.v1.ConversationService.Chat:output_type -> ai.v1.ChatResponse
-	7,  // 18: ai.v1.ConversationService.Detail:output_type -> ai.v1.DetailResponse
-	1,  // 19: ai.v1.ConversationService.Stream:output_type -> ai.v1.StreamEvent
-	13, // [13:20] is the sub-list for method output_type
-	6,  // [6:13] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	6,  // [6:6] is the sub-list for extension extendee
-	0,  // [0:6] is the sub-list for field type_name
+	9,  // 0: ai.v1.Conversation.message:type_name -> ai.v1.Message
+	3,  // 1: ai.v1.Conversation.context:type_name -> ai.v1.ContextConfig
+	2,  // 2: ai.v1.ListResp.conversations:type_name -> ai.v1.Conversation
+	9,  // 3: ai.v1.LLMRequest.message:type_name -> ai.v1.Message
+	9,  // 4: ai.v1.DetailResponse.message:type_name -> ai.v1.Message
+	0,  // 5: ai.v1.Message.role:type_name -> ai.v1.Role
+	9,  // 6: ai.v1.ChatResponse.response:type_name -> ai.v1.Message
+	28, // 7: ai.v1.SearchResponse.results:type_name -> ai.v1.SearchResult
+	29, // 8: ai.v1.SearchResult.matches:type_name -> ai.v1.MessageMatch
+	0,  // 9: ai.v1.MessageMatch.role:type_name -> ai.v1.Role
+	36, // 10: ai.v1.EmbedResponse.data:type_name -> ai.v1.Embedding
+	9,  // 11: ai.v1.AIService.Chat:input_type -> ai.v1.Message
+	9,  // 12: ai.v1.AIService.Stream:input_type -> ai.v1.Message
+	2,  // 13: ai.v1.ConversationService.Create:input_type -> ai.v1.Conversation
+	4,  // 14: ai.v1.ConversationService.List:input_type -> ai.v1.ListReq
+	6,  // 15: ai.v1.ConversationService.Chat:input_type -> ai.v1.LLMRequest
+	7,  // 16: ai.v1.ConversationService.Detail:input_type -> ai.v1.DetailRequest
+	6,  // 17: ai.v1.ConversationService.Stream:input_type -> ai.v1.LLMRequest
+	11, // 18: ai.v1.ConversationService.Feedback:input_type -> ai.v1.FeedbackRequest
+	13, // 19: ai.v1.ConversationService.RegenerateTitle:input_type -> ai.v1.RegenerateTitleRequest
+	14, // 20: ai.v1.ConversationService.Subscribe:input_type -> ai.v1.SubscribeRequest
+	16, // 21: ai.v1.ConversationService.Update:input_type -> ai.v1.UpdateConversationRequest
+	17, // 22: ai.v1.ConversationService.Archive:input_type -> ai.v1.ConversationOpRequest
+	17, // 23: ai.v1.ConversationService.Unarchive:input_type -> ai.v1.ConversationOpRequest
+	18, // 24: ai.v1.ConversationService.Pin:input_type -> ai.v1.PinRequest
+	17, // 25: ai.v1.ConversationService.Delete:input_type -> ai.v1.ConversationOpRequest
+	17, // 26: ai.v1.ConversationService.Purge:input_type -> ai.v1.ConversationOpRequest
+	20, // 27: ai.v1.ConversationService.Regenerate:input_type -> ai.v1.RegenerateRequest
+	21, // 28: ai.v1.ConversationService.EditAndResend:input_type -> ai.v1.EditAndResendRequest
+	22, // 29: ai.v1.ConversationService.SwitchBranch:input_type -> ai.v1.SwitchBranchRequest
+	23, // 30: ai.v1.ConversationService.ResumeStream:input_type -> ai.v1.ResumeStreamRequest
+	24, // 31: ai.v1.ConversationService.Cancel:input_type -> ai.v1.CancelRequest
+	26, // 32: ai.v1.ConversationService.Search:input_type -> ai.v1.SearchRequest
+	30, // 33: ai.v1.ConversationService.Export:input_type -> ai.v1.ExportRequest
+	32, // 34: ai.v1.GraphService.Run:input_type -> ai.v1.GraphRunRequest
+	34, // 35: ai.v1.EmbeddingService.Embed:input_type -> ai.v1.EmbedRequest
+	10, // 36: ai.v1.AIService.Chat:output_type -> ai.v1.ChatResponse
+	1,  // 37: ai.v1.AIService.Stream:output_type -> ai.v1.StreamEvent
+	2,  // 38: ai.v1.ConversationService.Create:output_type -> ai.v1.Conversation
+	5,  // 39: ai.v1.ConversationService.List:output_type -> ai.v1.ListResp
+	10, // 40: ai.v1.ConversationService.Chat:output_type -> ai.v1.ChatResponse
+	8,  // 41: ai.v1.ConversationService.Detail:output_type -> ai.v1.DetailResponse
+	1,  // 42: ai.v1.ConversationService.Stream:output_type -> ai.v1.StreamEvent
+	12, // 43: ai.v1.ConversationService.Feedback:output_type -> ai.v1.FeedbackResponse
+	2,  // 44: ai.v1.ConversationService.RegenerateTitle:output_type -> ai.v1.Conversation
+	15, // 45: ai.v1.ConversationService.Subscribe:output_type -> ai.v1.ConversationEvent
+	2,  // 46: ai.v1.ConversationService.Update:output_type -> ai.v1.Conversation
+	19, // 47: ai.v1.ConversationService.Archive:output_type -> ai.v1.ConversationOpResponse
+	19, // 48: ai.v1.ConversationService.Unarchive:output_type -> ai.v1.ConversationOpResponse
+	19, // 49: ai.v1.ConversationService.Pin:output_type -> ai.v1.ConversationOpResponse
+	19, // 50: ai.v1.ConversationService.Delete:output_type -> ai.v1.ConversationOpResponse
+	19, // 51: ai.v1.ConversationService.Purge:output_type -> ai.v1.ConversationOpResponse
+	10, // 52: ai.v1.ConversationService.Regenerate:output_type -> ai.v1.ChatResponse
+	10, // 53: ai.v1.ConversationService.EditAndResend:output_type -> ai.v1.ChatResponse
+	8,  // 54: ai.v1.ConversationService.SwitchBranch:output_type -> ai.v1.DetailResponse
+	1,  // 55: ai.v1.ConversationService.ResumeStream:output_type -> ai.v1.StreamEvent
+	25, // 56: ai.v1.ConversationService.Cancel:output_type -> ai.v1.CancelResponse
+	27, // 57: ai.v1.ConversationService.Search:output_type -> ai.v1.SearchResponse
+	31, // 58: ai.v1.ConversationService.Export:output_type -> ai.v1.ExportResponse
+	33, // 59: ai.v1.GraphService.Run:output_type -> ai.v1.GraphRunEvent
+	35, // 60: ai.v1.EmbeddingService.Embed:output_type -> ai.v1.EmbedResponse
+	36, // [36:61] is the sub-list for method output_type
+	11, // [11:36] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_ai_proto_init() }
@@ -728,9 +2718,9 @@ func file_ai_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ai_proto_rawDesc), len(file_ai_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   9,
+			NumMessages:   36,
 			NumExtensions: 0,
-			NumServices:   2,
+			NumServices:   4,
 		},
 		GoTypes:           file_ai_proto_goTypes,
 		DependencyIndexes: file_ai_proto_depIdxs,
@@ -177,11 +177,27 @@ var AIService_ServiceDesc = grpc.ServiceDesc{
 }
 
 const (
-	ConversationService_Create_FullMethodName = "/ai.v1.ConversationService/Create"
-	ConversationService_List_FullMethodName   = "/ai.v1.ConversationService/List"
-	ConversationService_Chat_FullMethodName   = "/ai.v1.ConversationService/Chat"
-	ConversationService_Detail_FullMethodName = "/ai.v1.ConversationService/Detail"
-	ConversationService_Stream_FullMethodName = "/ai.v1.ConversationService/Stream"
+	ConversationService_Create_FullMethodName          = "/ai.v1.ConversationService/Create"
+	ConversationService_List_FullMethodName            = "/ai.v1.ConversationService/List"
+	ConversationService_Chat_FullMethodName            = "/ai.v1.ConversationService/Chat"
+	ConversationService_Detail_FullMethodName          = "/ai.v1.ConversationService/Detail"
+	ConversationService_Stream_FullMethodName          = "/ai.v1.ConversationService/Stream"
+	ConversationService_Feedback_FullMethodName        = "/ai.v1.ConversationService/Feedback"
+	ConversationService_RegenerateTitle_FullMethodName = "/ai.v1.ConversationService/RegenerateTitle"
+	ConversationService_Subscribe_FullMethodName       = "/ai.v1.ConversationService/Subscribe"
+	ConversationService_Update_FullMethodName          = "/ai.v1.ConversationService/Update"
+	ConversationService_Archive_FullMethodName         = "/ai.v1.ConversationService/Archive"
+	ConversationService_Unarchive_FullMethodName       = "/ai.v1.ConversationService/Unarchive"
+	ConversationService_Pin_FullMethodName             = "/ai.v1.ConversationService/Pin"
+	ConversationService_Delete_FullMethodName          = "/ai.v1.ConversationService/Delete"
+	ConversationService_Purge_FullMethodName           = "/ai.v1.ConversationService/Purge"
+	ConversationService_Regenerate_FullMethodName      = "/ai.v1.ConversationService/Regenerate"
+	ConversationService_EditAndResend_FullMethodName   = "/ai.v1.ConversationService/EditAndResend"
+	ConversationService_SwitchBranch_FullMethodName    = "/ai.v1.ConversationService/SwitchBranch"
+	ConversationService_ResumeStream_FullMethodName    = "/ai.v1.ConversationService/ResumeStream"
+	ConversationService_Cancel_FullMethodName          = "/ai.v1.ConversationService/Cancel"
+	ConversationService_Search_FullMethodName          = "/ai.v1.ConversationService/Search"
+	ConversationService_Export_FullMethodName          = "/ai.v1.ConversationService/Export"
 )
 
 // ConversationServiceClient is the client API for ConversationService service.
@@ -193,6 +209,35 @@ type ConversationServiceClient interface {
 	Chat(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (*ChatResponse, error)
 	Detail(ctx context.Context, in *DetailRequest, opts ...grpc.CallOption) (*DetailResponse, error)
 	Stream(ctx context.Context, in *LLMRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamEvent], error)
+	Feedback(ctx context.Context, in *FeedbackRequest, opts ...grpc.CallOption) (*FeedbackResponse, error)
+	// 重新生成对话的标题
+	RegenerateTitle(ctx context.Context, in *RegenerateTitleRequest, opts ...grpc.CallOption) (*Conversation, error)
+	// 订阅用户所有对话的事件，例如标题更新
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConversationEvent], error)
+	// 修改对话的标题
+	Update(ctx context.Context, in *UpdateConversationRequest, opts ...grpc.CallOption) (*Conversation, error)
+	Archive(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error)
+	Unarchive(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error)
+	Pin(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error)
+	// Delete 软删除，数据还在，只是不再出现在列表里面
+	Delete(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error)
+	// Purge 彻底删除对话和所有的消息
+	Purge(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error)
+	// 重新生成某条回答，新的回答作为一个新的分支
+	Regenerate(ctx context.Context, in *RegenerateRequest, opts ...grpc.CallOption) (*ChatResponse, error)
+	// 修改某个问题之后重新发送，修改之后的问题作为一个新的分支
+	EditAndResend(ctx context.Context, in *EditAndResendRequest, opts ...grpc.CallOption) (*ChatResponse, error)
+	// 切换到某条消息所在的分支，返回新的分支上的消息
+	SwitchBranch(ctx context.Context, in *SwitchBranchRequest, opts ...grpc.CallOption) (*DetailResponse, error)
+	// 断线之后重新接收 Stream 的事件，先补发 last_seq 之后的事件，再继续接收新的事件。
+	// 如果缓冲已经过期，那么返回保存下来的完整消息，这个事件的 seq 为 0
+	ResumeStream(ctx context.Context, in *ResumeStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamEvent], error)
+	// 停止生成，已经生成的内容会被保存下来，无论生成是在哪个实例上
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
+	// 在用户自己的对话里面搜索标题和消息内容
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// 导出一个对话，或者用户在一段时间内创建的所有对话
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*ExportResponse, error)
 }
 
 type conversationServiceClient struct {
@@ -262,6 +307,184 @@ func (c *conversationServiceClient) Stream(ctx context.Context, in *LLMRequest,
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ConversationService_StreamClient = grpc.ServerStreamingClient[StreamEvent]
 
+func (c *conversationServiceClient) Feedback(ctx context.Context, in *FeedbackRequest, opts ...grpc.CallOption) (*FeedbackResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FeedbackResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Feedback_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) RegenerateTitle(ctx context.Context, in *RegenerateTitleRequest, opts ...grpc.CallOption) (*Conversation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conversation)
+	err := c.cc.Invoke(ctx, ConversationService_RegenerateTitle_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConversationEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ConversationService_ServiceDesc.Streams[1], ConversationService_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, ConversationEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConversationService_SubscribeClient = grpc.ServerStreamingClient[ConversationEvent]
+
+func (c *conversationServiceClient) Update(ctx context.Context, in *UpdateConversationRequest, opts ...grpc.CallOption) (*Conversation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conversation)
+	err := c.cc.Invoke(ctx, ConversationService_Update_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Archive(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationOpResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Archive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Unarchive(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationOpResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Unarchive_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Pin(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationOpResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Pin_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Delete(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationOpResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Purge(ctx context.Context, in *ConversationOpRequest, opts ...grpc.CallOption) (*ConversationOpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConversationOpResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Purge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Regenerate(ctx context.Context, in *RegenerateRequest, opts ...grpc.CallOption) (*ChatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChatResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Regenerate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) EditAndResend(ctx context.Context, in *EditAndResendRequest, opts ...grpc.CallOption) (*ChatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChatResponse)
+	err := c.cc.Invoke(ctx, ConversationService_EditAndResend_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) SwitchBranch(ctx context.Context, in *SwitchBranchRequest, opts ...grpc.CallOption) (*DetailResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DetailResponse)
+	err := c.cc.Invoke(ctx, ConversationService_SwitchBranch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) ResumeStream(ctx context.Context, in *ResumeStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ConversationService_ServiceDesc.Streams[2], ConversationService_ResumeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ResumeStreamRequest, StreamEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConversationService_ResumeStreamClient = grpc.ServerStreamingClient[StreamEvent]
+
+func (c *conversationServiceClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *conversationServiceClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*ExportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportResponse)
+	err := c.cc.Invoke(ctx, ConversationService_Export_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ConversationServiceServer is the server API for ConversationService service.
 // All implementations must embed UnimplementedConversationServiceServer
 // for forward compatibility.
@@ -271,6 +494,35 @@ type ConversationServiceServer interface {
 	Chat(context.Context, *LLMRequest) (*ChatResponse, error)
 	Detail(context.Context, *DetailRequest) (*DetailResponse, error)
 	Stream(*LLMRequest, grpc.ServerStreamingServer[StreamEvent]) error
+	Feedback(context.Context, *FeedbackRequest) (*FeedbackResponse, error)
+	// 重新生成对话的标题
+	RegenerateTitle(context.Context, *RegenerateTitleRequest) (*Conversation, error)
+	// 订阅用户所有对话的事件，例如标题更新
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[ConversationEvent]) error
+	// 修改对话的标题
+	Update(context.Context, *UpdateConversationRequest) (*Conversation, error)
+	Archive(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error)
+	Unarchive(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error)
+	Pin(context.Context, *PinRequest) (*ConversationOpResponse, error)
+	// Delete 软删除，数据还在，只是不再出现在列表里面
+	Delete(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error)
+	// Purge 彻底删除对话和所有的消息
+	Purge(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error)
+	// 重新生成某条回答，新的回答作为一个新的分支
+	Regenerate(context.Context, *RegenerateRequest) (*ChatResponse, error)
+	// 修改某个问题之后重新发送，修改之后的问题作为一个新的分支
+	EditAndResend(context.Context, *EditAndResendRequest) (*ChatResponse, error)
+	// 切换到某条消息所在的分支，返回新的分支上的消息
+	SwitchBranch(context.Context, *SwitchBranchRequest) (*DetailResponse, error)
+	// 断线之后重新接收 Stream 的事件，先补发 last_seq 之后的事件，再继续接收新的事件。
+	// 如果缓冲已经过期，那么返回保存下来的完整消息，这个事件的 seq 为 0
+	ResumeStream(*ResumeStreamRequest, grpc.ServerStreamingServer[StreamEvent]) error
+	// 停止生成，已经生成的内容会被保存下来，无论生成是在哪个实例上
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
+	// 在用户自己的对话里面搜索标题和消息内容
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// 导出一个对话，或者用户在一段时间内创建的所有对话
+	Export(context.Context, *ExportRequest) (*ExportResponse, error)
 	mustEmbedUnimplementedConversationServiceServer()
 }
 
@@ -296,6 +548,54 @@ func (UnimplementedConversationServiceServer) Detail(context.Context, *DetailReq
 func (UnimplementedConversationServiceServer) Stream(*LLMRequest, grpc.ServerStreamingServer[StreamEvent]) error {
 	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
 }
+func (UnimplementedConversationServiceServer) Feedback(context.Context, *FeedbackRequest) (*FeedbackResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Feedback not implemented")
+}
+func (UnimplementedConversationServiceServer) RegenerateTitle(context.Context, *RegenerateTitleRequest) (*Conversation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegenerateTitle not implemented")
+}
+func (UnimplementedConversationServiceServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[ConversationEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedConversationServiceServer) Update(context.Context, *UpdateConversationRequest) (*Conversation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedConversationServiceServer) Archive(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Archive not implemented")
+}
+func (UnimplementedConversationServiceServer) Unarchive(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unarchive not implemented")
+}
+func (UnimplementedConversationServiceServer) Pin(context.Context, *PinRequest) (*ConversationOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pin not implemented")
+}
+func (UnimplementedConversationServiceServer) Delete(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedConversationServiceServer) Purge(context.Context, *ConversationOpRequest) (*ConversationOpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (UnimplementedConversationServiceServer) Regenerate(context.Context, *RegenerateRequest) (*ChatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Regenerate not implemented")
+}
+func (UnimplementedConversationServiceServer) EditAndResend(context.Context, *EditAndResendRequest) (*ChatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EditAndResend not implemented")
+}
+func (UnimplementedConversationServiceServer) SwitchBranch(context.Context, *SwitchBranchRequest) (*DetailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SwitchBranch not implemented")
+}
+func (UnimplementedConversationServiceServer) ResumeStream(*ResumeStreamRequest, grpc.ServerStreamingServer[StreamEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method ResumeStream not implemented")
+}
+func (UnimplementedConversationServiceServer) Cancel(context.Context, *CancelRequest) (*CancelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedConversationServiceServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedConversationServiceServer) Export(context.Context, *ExportRequest) (*ExportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
 func (UnimplementedConversationServiceServer) mustEmbedUnimplementedConversationServiceServer() {}
 func (UnimplementedConversationServiceServer) testEmbeddedByValue()                             {}
 
@@ -400,6 +700,280 @@ func _ConversationService_Stream_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ConversationService_StreamServer = grpc.ServerStreamingServer[StreamEvent]
 
+func _ConversationService_Feedback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FeedbackRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Feedback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Feedback_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Feedback(ctx, req.(*FeedbackRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_RegenerateTitle_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegenerateTitleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).RegenerateTitle(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_RegenerateTitle_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).RegenerateTitle(ctx, req.(*RegenerateTitleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConversationServiceServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, ConversationEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConversationService_SubscribeServer = grpc.ServerStreamingServer[ConversationEvent]
+
+func _ConversationService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Update(ctx, req.(*UpdateConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Archive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConversationOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Archive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Archive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Archive(ctx, req.(*ConversationOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Unarchive_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConversationOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Unarchive(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Unarchive_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Unarchive(ctx, req.(*ConversationOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Pin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Pin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Pin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Pin(ctx, req.(*PinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConversationOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Delete(ctx, req.(*ConversationOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConversationOpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Purge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Purge(ctx, req.(*ConversationOpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Regenerate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegenerateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Regenerate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Regenerate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Regenerate(ctx, req.(*RegenerateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_EditAndResend_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EditAndResendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).EditAndResend(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_EditAndResend_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).EditAndResend(ctx, req.(*EditAndResendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_SwitchBranch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SwitchBranchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).SwitchBranch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_SwitchBranch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).SwitchBranch(ctx, req.(*SwitchBranchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_ResumeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ResumeStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConversationServiceServer).ResumeStream(m, &grpc.GenericServerStream[ResumeStreamRequest, StreamEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ConversationService_ResumeStreamServer = grpc.ServerStreamingServer[StreamEvent]
+
+func _ConversationService_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ConversationService_Export_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConversationServiceServer).Export(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ConversationService_Export_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConversationServiceServer).Export(ctx, req.(*ExportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ConversationService_ServiceDesc is the grpc.ServiceDesc for ConversationService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -423,6 +997,62 @@ var ConversationService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Detail",
 			Handler:    _ConversationService_Detail_Handler,
 		},
+		{
+			MethodName: "Feedback",
+			Handler:    _ConversationService_Feedback_Handler,
+		},
+		{
+			MethodName: "RegenerateTitle",
+			Handler:    _ConversationService_RegenerateTitle_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _ConversationService_Update_Handler,
+		},
+		{
+			MethodName: "Archive",
+			Handler:    _ConversationService_Archive_Handler,
+		},
+		{
+			MethodName: "Unarchive",
+			Handler:    _ConversationService_Unarchive_Handler,
+		},
+		{
+			MethodName: "Pin",
+			Handler:    _ConversationService_Pin_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ConversationService_Delete_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _ConversationService_Purge_Handler,
+		},
+		{
+			MethodName: "Regenerate",
+			Handler:    _ConversationService_Regenerate_Handler,
+		},
+		{
+			MethodName: "EditAndResend",
+			Handler:    _ConversationService_EditAndResend_Handler,
+		},
+		{
+			MethodName: "SwitchBranch",
+			Handler:    _ConversationService_SwitchBranch_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _ConversationService_Cancel_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _ConversationService_Search_Handler,
+		},
+		{
+			MethodName: "Export",
+			Handler:    _ConversationService_Export_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -430,6 +1060,227 @@ var ConversationService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ConversationService_Stream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _ConversationService_Subscribe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ResumeStream",
+			Handler:       _ConversationService_ResumeStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ai.proto",
+}
+
+const (
+	GraphService_Run_FullMethodName = "/ai.v1.GraphService/Run"
+)
+
+// GraphServiceClient is the client API for GraphService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GraphServiceClient interface {
+	// 执行图，按照执行的顺序返回节点的进度，最后一个事件是 run_finished，遇到审批节点的时候是 run_waiting
+	Run(ctx context.Context, in *GraphRunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GraphRunEvent], error)
+}
+
+type graphServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGraphServiceClient(cc grpc.ClientConnInterface) GraphServiceClient {
+	return &graphServiceClient{cc}
+}
+
+func (c *graphServiceClient) Run(ctx context.Context, in *GraphRunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GraphRunEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GraphService_ServiceDesc.Streams[0], GraphService_Run_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GraphRunRequest, GraphRunEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GraphService_RunClient = grpc.ServerStreamingClient[GraphRunEvent]
+
+// GraphServiceServer is the server API for GraphService service.
+// All implementations must embed UnimplementedGraphServiceServer
+// for forward compatibility.
+type GraphServiceServer interface {
+	// 执行图，按照执行的顺序返回节点的进度，最后一个事件是 run_finished，遇到审批节点的时候是 run_waiting
+	Run(*GraphRunRequest, grpc.ServerStreamingServer[GraphRunEvent]) error
+	mustEmbedUnimplementedGraphServiceServer()
+}
+
+// UnimplementedGraphServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGraphServiceServer struct{}
+
+func (UnimplementedGraphServiceServer) Run(*GraphRunRequest, grpc.ServerStreamingServer[GraphRunEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedGraphServiceServer) mustEmbedUnimplementedGraphServiceServer() {}
+func (UnimplementedGraphServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeGraphServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GraphServiceServer will
+// result in compilation errors.
+type UnsafeGraphServiceServer interface {
+	mustEmbedUnimplementedGraphServiceServer()
+}
+
+func RegisterGraphServiceServer(s grpc.ServiceRegistrar, srv GraphServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGraphServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GraphService_ServiceDesc, srv)
+}
+
+func _GraphService_Run_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GraphRunRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GraphServiceServer).Run(m, &grpc.GenericServerStream[GraphRunRequest, GraphRunEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GraphService_RunServer = grpc.ServerStreamingServer[GraphRunEvent]
+
+// GraphService_ServiceDesc is the grpc.ServiceDesc for GraphService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GraphService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ai.v1.GraphService",
+	HandlerType: (*GraphServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Run",
+			Handler:       _GraphService_Run_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ai.proto",
+}
+
+const (
+	EmbeddingService_Embed_FullMethodName = "/ai.v1.EmbeddingService/Embed"
+)
+
+// EmbeddingServiceClient is the client API for EmbeddingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EmbeddingServiceClient interface {
+	// 把文本转换成向量，按照消耗的 token 扣减 uid 的额度，额度不够的时候返回错误
+	Embed(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (*EmbedResponse, error)
+}
+
+type embeddingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEmbeddingServiceClient(cc grpc.ClientConnInterface) EmbeddingServiceClient {
+	return &embeddingServiceClient{cc}
+}
+
+func (c *embeddingServiceClient) Embed(ctx context.Context, in *EmbedRequest, opts ...grpc.CallOption) (*EmbedResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EmbedResponse)
+	err := c.cc.Invoke(ctx, EmbeddingService_Embed_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EmbeddingServiceServer is the server API for EmbeddingService service.
+// All implementations must embed UnimplementedEmbeddingServiceServer
+// for forward compatibility.
+type EmbeddingServiceServer interface {
+	// 把文本转换成向量，按照消耗的 token 扣减 uid 的额度，额度不够的时候返回错误
+	Embed(context.Context, *EmbedRequest) (*EmbedResponse, error)
+	mustEmbedUnimplementedEmbeddingServiceServer()
+}
+
+// UnimplementedEmbeddingServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEmbeddingServiceServer struct{}
+
+func (UnimplementedEmbeddingServiceServer) Embed(context.Context, *EmbedRequest) (*EmbedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Embed not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) mustEmbedUnimplementedEmbeddingServiceServer() {}
+func (UnimplementedEmbeddingServiceServer) testEmbeddedByValue()                          {}
+
+// UnsafeEmbeddingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EmbeddingServiceServer will
+// result in compilation errors.
+type UnsafeEmbeddingServiceServer interface {
+	mustEmbedUnimplementedEmbeddingServiceServer()
+}
+
+func RegisterEmbeddingServiceServer(s grpc.ServiceRegistrar, srv EmbeddingServiceServer) {
+	// If the following call pancis, it indicates UnimplementedEmbeddingServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EmbeddingService_ServiceDesc, srv)
+}
+
+func _EmbeddingService_Embed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).Embed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_Embed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).Embed(ctx, req.(*EmbedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EmbeddingService_ServiceDesc is the grpc.ServiceDesc for EmbeddingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EmbeddingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ai.v1.EmbeddingService",
+	HandlerType: (*EmbeddingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Embed",
+			Handler:    _EmbeddingService_Embed_Handler,
+		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "ai.proto",
 }
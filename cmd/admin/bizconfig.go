@@ -15,6 +15,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
@@ -27,11 +29,18 @@ import (
 )
 
 func main() {
+	// admin prompt export|import ... 用于在命令行导入导出 prompt
+	if len(os.Args) > 1 && os.Args[1] == "prompt" {
+		runPromptCommand(initDB(), os.Args[2:])
+		return
+	}
 	infra.Init()
 	db := initDB()
 	server := gin.Default()
 	bizconfig := initBizConfig(db)
 	bizconfig.RegisterRoutes(server)
+	initFeedback(db).PrivateRoutes(server)
+	initEvaluation(db).PrivateRoutes(server)
 	err := server.Run(":8080")
 	if err != nil {
 		panic(err)
@@ -0,0 +1,47 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	ds "github.com/cohesion-org/deepseek-go"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm/platform/deepseek"
+	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"gorm.io/gorm"
+)
+
+// initEvaluation 在数据集上评测 prompt 的版本，评测使用的模型 token 从环境变量 DEEPSEEK_TOKEN 读取
+func initEvaluation(db *gorm.DB) *web.EvaluationHandler {
+	// 评测需要读取 prompt 的版本
+	if err := dao.InitTable(db); err != nil {
+		panic(err)
+	}
+	if err := dao.InitEvaluationTable(db); err != nil {
+		panic(err)
+	}
+	handler := deepseek.NewHandler(ds.NewClient(os.Getenv("DEEPSEEK_TOKEN")))
+	promptRepo := repository.NewPromptRepo(dao.NewPromptDAO(db))
+	svc := service.NewEvaluationService(
+		repository.NewEvaluationRepo(dao.NewEvaluationDAO(db)),
+		promptRepo,
+		service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(db)), promptRepo),
+		handler,
+	)
+	return web.NewEvaluationHandler(svc)
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"gorm.io/gorm"
+)
+
+// initFeedback 管理后台查看用户对回答的评价
+func initFeedback(db *gorm.DB) *web.FeedbackHandler {
+	// 评价以及关联的消息都是对话的表
+	if err := dao.InitConversation(db); err != nil {
+		panic(err)
+	}
+	svc := service.NewFeedbackService(repository.NewFeedbackRepo(dao.NewFeedbackDAO(db)))
+	return web.NewFeedbackHandler(svc)
+}
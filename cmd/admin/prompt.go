@@ -0,0 +1,124 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"gorm.io/gorm"
+)
+
+const promptUsage = `用法:
+  admin prompt export -id <prompt id> [-format yaml|json] [-o 文件]
+  admin prompt import -f <文件> -owner <owner> [-format yaml|json] [-dry-run]`
+
+// runPromptCommand 执行 prompt 的导入导出子命令，出错直接退出进程
+func runPromptCommand(db *gorm.DB, args []string) {
+	if len(args) == 0 {
+		exit(promptUsage)
+	}
+	if err := dao.InitTable(db); err != nil {
+		exit(err.Error())
+	}
+	svc := service.NewPromptService(repository.NewPromptRepo(dao.NewPromptDAO(db)))
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportPrompt(svc, args[1:])
+	case "import":
+		err = importPrompt(svc, args[1:])
+	default:
+		exit(promptUsage)
+	}
+	if err != nil {
+		exit(err.Error())
+	}
+}
+
+func exportPrompt(svc *service.PromptService, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	id := fs.Int64("id", 0, "prompt 的 ID")
+	format := fs.String("format", "", "yaml 或者 json，默认按照输出文件的后缀判断")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	_ = fs.Parse(args)
+	if *id <= 0 {
+		return fmt.Errorf("缺少 -id")
+	}
+	doc, err := svc.Export(context.Background(), *id)
+	if err != nil {
+		return err
+	}
+	content, err := service.MarshalPromptDocument(doc, formatOf(*format, *output))
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	return os.WriteFile(*output, content, 0o644)
+}
+
+func importPrompt(svc *service.PromptService, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("f", "", "要导入的文件")
+	owner := fs.Int64("owner", 0, "导入到哪个用户或者组织下面")
+	format := fs.String("format", "", "yaml 或者 json，默认按照文件的后缀判断")
+	dryRun := fs.Bool("dry-run", false, "只输出将要执行的操作，不修改数据")
+	_ = fs.Parse(args)
+	if *file == "" || *owner <= 0 {
+		return fmt.Errorf("缺少 -f 或者 -owner")
+	}
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	doc, err := service.UnmarshalPromptDocument(content, formatOf(*format, *file))
+	if err != nil {
+		return err
+	}
+	res, err := svc.Import(context.Background(), doc, *owner, *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("prompt %s (id=%d): %s\n", res.Name, res.PromptID, res.Action)
+	for _, v := range res.Versions {
+		fmt.Printf("  version %q: %s\n", v.Label, v.Action)
+	}
+	return nil
+}
+
+func formatOf(format string, file string) string {
+	if format != "" {
+		return format
+	}
+	if ext := strings.TrimPrefix(filepath.Ext(file), "."); ext != "" {
+		return ext
+	}
+	return "yaml"
+}
+
+func exit(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(1)
+}
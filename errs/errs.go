@@ -19,7 +19,16 @@ import (
 )
 
 var (
-	ErrBizConfigNotFound   = errors.New("查询业务配置失败")
-	ErrInvalidParam        = errors.New("参数错误")
-	ErrInsufficientBalance = errors.New("余额不足")
+	ErrBizConfigNotFound    = errors.New("查询业务配置失败")
+	ErrInvalidParam         = errors.New("参数错误")
+	ErrInsufficientBalance  = errors.New("余额不足")
+	ErrPermissionDenied     = errors.New("没有权限")
+	ErrConversationNotFound = errors.New("对话不存在")
+	ErrShareNotFound        = errors.New("分享不存在或者已经撤销")
+	ErrGraphNotFound        = errors.New("图不存在")
+	// ErrGraphVersionConflict 保存的时候图已经被其他人修改了
+	ErrGraphVersionConflict = errors.New("图已经被修改")
+	ErrGraphTriggerNotFound = errors.New("触发器不存在")
+	ErrKnowledgeNotFound    = errors.New("知识库或者文档不存在")
+	ErrEvaluationNotFound   = errors.New("评测数据集或者评测不存在")
 )
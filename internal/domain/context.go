@@ -0,0 +1,63 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+// ContextStrategy 构建对话上下文时裁剪历史消息的策略
+type ContextStrategy string
+
+const (
+	// ContextStrategyTokens 按照 token 数裁剪，是默认的策略
+	ContextStrategyTokens ContextStrategy = "tokens"
+	// ContextStrategyLastN 只保留最近的 N 条消息
+	ContextStrategyLastN ContextStrategy = "last_n"
+)
+
+// ContextConfig 对话上下文的配置，零值字段使用默认值
+type ContextConfig struct {
+	Strategy ContextStrategy
+	// 模型的上下文窗口，为 0 的时候使用模型自身的窗口大小
+	WindowTokens int64
+	// 给模型输出预留的 token 数
+	ReservedTokens int64
+	// last_n 策略下保留的消息条数
+	LastN int
+	// 最多读取多少条历史消息
+	MaxHistory int
+}
+
+// IsZero 没有任何配置
+func (c ContextConfig) IsZero() bool {
+	return c == ContextConfig{}
+}
+
+// Merge 用 c 中非零的字段覆盖 base
+func (c ContextConfig) Merge(base ContextConfig) ContextConfig {
+	if c.Strategy != "" {
+		base.Strategy = c.Strategy
+	}
+	if c.WindowTokens > 0 {
+		base.WindowTokens = c.WindowTokens
+	}
+	if c.ReservedTokens > 0 {
+		base.ReservedTokens = c.ReservedTokens
+	}
+	if c.LastN > 0 {
+		base.LastN = c.LastN
+	}
+	if c.MaxHistory > 0 {
+		base.MaxHistory = c.MaxHistory
+	}
+	return base
+}
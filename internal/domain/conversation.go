@@ -27,11 +27,59 @@ const (
 )
 
 type Conversation struct {
-	Sn       string
-	Uid      string
-	Title    string
-	Messages []Message
-	Time     string
+	Sn    string
+	Uid   string
+	Title string
+	// 对话使用的 prompt，为 0 表示不使用
+	PromptID int64
+	// 对话所属业务的配置，为 0 表示不使用
+	BizID int64
+	// 对话自己的上下文配置，优先级高于业务配置
+	Context ContextConfig
+	// 早期对话被压缩成的摘要，SummarizedID 是摘要覆盖到的最后一条消息
+	Summary      string
+	SummarizedID int64
+	// 不自动生成标题
+	DisableAutoTitle bool
+	Archived         bool
+	Pinned           bool
+	Messages         []Message
+	Time             string
+	Ctime            int64
+	// 最后活跃的时间，每次有新消息都会更新
+	Utime int64
+}
+
+type ConversationExportFormat string
+
+const (
+	// ExportFormatMarkdown 方便人阅读
+	ExportFormatMarkdown ConversationExportFormat = "markdown"
+	// ExportFormatJSON 完整的结构化数据
+	ExportFormatJSON ConversationExportFormat = "json"
+	// ExportFormatJSONL OpenAI 微调格式，每一行是一个对话
+	ExportFormatJSONL ConversationExportFormat = "jsonl"
+)
+
+// ConversationExportQuery 导出一个对话，Sn 为空的时候导出用户在 [Start, End) 之间创建的对话
+type ConversationExportQuery struct {
+	Uid              string
+	Sn               string
+	Start            int64
+	End              int64
+	Format           ConversationExportFormat
+	IncludeReasoning bool
+}
+
+// ConversationQuery 查询对话列表的条件，已经删除的对话不会被查询出来。
+// 置顶的对话排在最前面，其余的按照最后活跃的时间倒序排列
+type ConversationQuery struct {
+	Uid string
+	// 为 true 的时候只查询归档的对话，否则只查询没有归档的对话
+	Archived   bool
+	PinnedOnly bool
+	Limit      int64
+	Offset     int64
 }
 type Message struct {
 	ID               int64
@@ -39,10 +87,60 @@ type Message struct {
 	Role             int32
 	Content          string
 	ReasoningContent string
+	// 生成这条消息的 prompt 版本
+	PromptVersionID int64
+	// 生成这条消息的模型，用户的消息为空
+	Provider string
+	Model    string
+	// 生成耗时，毫秒
+	Latency int64
+	// 消耗的 token 数
+	Tokens int64
+	// 上一条消息，对话的消息组成了一棵树，编辑或者重新生成的时候会产生新的分支
+	ParentID int64
+	// 和自己有同一个 ParentID 的消息数量，包括自己。SiblingIndex 是自己在其中的位置，从 0 开始
+	Siblings     int
+	SiblingIndex int
+	Status       MessageStatus
+}
+
+type MessageStatus int8
+
+const (
+	// MessageStatusCompleted 零值，之前的消息都是生成完毕之后才保存的
+	MessageStatusCompleted MessageStatus = iota
+	// MessageStatusStreaming 正在流式生成
+	MessageStatusStreaming
+	// MessageStatusFailed 生成的过程中出错了，内容是出错之前生成的部分
+	MessageStatusFailed
+	// MessageStatusCancelled 用户取消了生成，内容是取消之前生成的部分
+	MessageStatusCancelled
+)
+
+// Usage token 的使用情况
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+}
+
+type ConversationEventType string
+
+const (
+	// ConversationEventTitleUpdated 对话的标题更新了
+	ConversationEventTitleUpdated ConversationEventType = "title_updated"
+)
+
+// ConversationEvent 通知客户端对话发生了变化
+type ConversationEvent struct {
+	Type  ConversationEventType
+	Sn    string
+	Title string
 }
 
 type ChatResponse struct {
 	Sn       string
 	Response Message
+	Usage    Usage
 	Metadata ekit.AnyValue
 }
@@ -0,0 +1,37 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+// ConversationShare 对话的只读分享链接，分享的是对话截止到 MessageID 的快照，
+// 之后的消息不会被看到。持有 Token 的人不需要登录就可以查看
+type ConversationShare struct {
+	ID    int64
+	Token string
+	Sn    string
+	Uid   string
+	// 创建分享的时候对话的标题
+	Title     string
+	MessageID int64
+	// 默认不公开模型的思考过程
+	IncludeReasoning bool
+	Ctime            int64
+}
+
+// SharedConversation 通过分享链接看到的对话
+type SharedConversation struct {
+	Title    string
+	Messages []Message
+	Ctime    int64
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+// EmbeddingRequest 网关对外的 embeddings 请求，消耗的 token 记在 Uid 名下
+type EmbeddingRequest struct {
+	Uid   int64
+	Input []string
+	// 幂等的 key，为空的时候每次请求都单独计费
+	Key string
+}
+
+// EmbeddingResponse Vectors 和请求的 Input 一一对应
+type EmbeddingResponse struct {
+	Model   string
+	Vectors [][]float32
+	Usage   Usage
+}
+
+// VectorRecord 向量库里面的一条记录，Metadata 可以用来过滤
+type VectorRecord struct {
+	ID       string
+	Vector   []float32
+	Metadata map[string]string
+}
+
+// VectorQuery 检索和 Vector 最相似的 TopK 条记录，Filter 里面的每一项都需要和 Metadata 完全相等
+type VectorQuery struct {
+	Vector []float32
+	TopK   int
+	Filter map[string]string
+}
+
+// VectorMatch 检索的结果，Score 是余弦相似度，越大越相似
+type VectorMatch struct {
+	ID       string
+	Score    float32
+	Metadata map[string]string
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"time"
+)
+
+type AssertionType string
+
+const (
+	AssertionContains   AssertionType = "contains"
+	AssertionRegex      AssertionType = "regex"
+	AssertionJSONSchema AssertionType = "json_schema"
+	AssertionExact      AssertionType = "exact"
+	// AssertionLLMJudge 让大模型来判断输出是否满足 Value 中描述的标准
+	AssertionLLMJudge AssertionType = "llm_judge"
+)
+
+type Assertion struct {
+	Type  AssertionType
+	Value string
+}
+
+// EvalDataset 评测数据集
+type EvalDataset struct {
+	ID          int64
+	Name        string
+	Owner       int64
+	Description string
+	Cases       []EvalCase
+	Ctime       time.Time
+	Utime       time.Time
+}
+
+// EvalCase 一条评测用例
+type EvalCase struct {
+	ID        int64
+	DatasetID int64
+	// 用于渲染 prompt 的变量
+	Variables map[string]string
+	// 期望的输出，没有断言的时候按照完全匹配处理
+	Expected   string
+	Assertions []Assertion
+}
+
+type EvalRunStatus string
+
+const (
+	EvalRunStatusRunning EvalRunStatus = "running"
+	EvalRunStatusSuccess EvalRunStatus = "success"
+	// EvalRunStatusFailed 有用例没能执行完，例如调用模型失败，这些用例按照不合格计算得分
+	EvalRunStatusFailed EvalRunStatus = "failed"
+)
+
+// EvalRun 某个 prompt 版本在某个数据集上的一次评测
+type EvalRun struct {
+	ID int64
+	// 发起评测的用户
+	Uid       int64
+	DatasetID int64
+	VersionID int64
+	Status    EvalRunStatus
+	Total     int64
+	Passed    int64
+	// 所有用例得分的平均值，范围是 [0, 1]
+	Score   float64
+	Results []EvalResult
+	Ctime   time.Time
+	Utime   time.Time
+}
+
+type EvalResult struct {
+	ID      int64
+	RunID   int64
+	CaseID  int64
+	Output  string
+	Passed  bool
+	Score   float64
+	Reason  string
+	Latency int64
+	Tokens  int64
+}
+
+// EvalComparison 两次评测的对比，用于决定是否发布新版本
+type EvalComparison struct {
+	A     EvalRun
+	B     EvalRun
+	Cases []EvalCaseComparison
+}
+
+// EvalCaseComparison 两次评测在同一条用例上的结果
+type EvalCaseComparison struct {
+	CaseID int64
+	A      EvalResult
+	B      EvalResult
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+// FeedbackRating 用户对回答的评价
+type FeedbackRating int8
+
+const (
+	FeedbackDown FeedbackRating = -1
+	// FeedbackNone 取消评价
+	FeedbackNone FeedbackRating = 0
+	FeedbackUp   FeedbackRating = 1
+)
+
+// FeedbackReason 评价的原因分类，主要用于点踩
+type FeedbackReason string
+
+const (
+	// FeedbackReasonInaccurate 内容有事实错误
+	FeedbackReasonInaccurate FeedbackReason = "inaccurate"
+	// FeedbackReasonUnhelpful 没有解决问题
+	FeedbackReasonUnhelpful FeedbackReason = "unhelpful"
+	// FeedbackReasonIncomplete 回答不完整
+	FeedbackReasonIncomplete FeedbackReason = "incomplete"
+	// FeedbackReasonOffTopic 答非所问
+	FeedbackReasonOffTopic FeedbackReason = "off_topic"
+	// FeedbackReasonHarmful 有害或者不合规的内容
+	FeedbackReasonHarmful FeedbackReason = "harmful"
+	FeedbackReasonOther   FeedbackReason = "other"
+)
+
+// Valid 为空表示没有选择原因，也是合法的
+func (r FeedbackReason) Valid() bool {
+	switch r {
+	case "", FeedbackReasonInaccurate, FeedbackReasonUnhelpful, FeedbackReasonIncomplete,
+		FeedbackReasonOffTopic, FeedbackReasonHarmful, FeedbackReasonOther:
+		return true
+	default:
+		return false
+	}
+}
+
+// MessageFeedback 用户对一条回答的评价，每条回答只保留最后一次评价。
+// 生成回答的模型和 prompt 版本在评价的时候从消息上复制过来，方便聚合
+type MessageFeedback struct {
+	ID        int64
+	MessageID int64
+	Sn        string
+	Uid       string
+	Rating    FeedbackRating
+	Reason    FeedbackReason
+	// 用户填写的补充说明
+	Comment         string
+	Provider        string
+	Model           string
+	PromptVersionID int64
+	Ctime           int64
+	Utime           int64
+}
+
+type FeedbackGroupBy string
+
+const (
+	FeedbackGroupByModel         FeedbackGroupBy = "model"
+	FeedbackGroupByPromptVersion FeedbackGroupBy = "prompt_version"
+)
+
+// FeedbackStatsQuery 聚合评价的条件，PromptID 不为 0 的时候只统计这个 prompt 的版本
+type FeedbackStatsQuery struct {
+	GroupBy  FeedbackGroupBy
+	PromptID int64
+	// [Start, End) 之间的评价，单位秒，End 为 0 表示不限制
+	Start int64
+	End   int64
+}
+
+// FeedbackStats 按照模型或者 prompt 版本聚合的评价，没有用到的分组字段为零值
+type FeedbackStats struct {
+	Provider        string
+	Model           string
+	PromptVersionID int64
+	Up              int64
+	Down            int64
+	// 点踩的原因分布，没有选择原因的不统计
+	Reasons map[FeedbackReason]int64
+}
+
+// FeedbackQuery 查询评价的条件，零值的字段不作为条件
+type FeedbackQuery struct {
+	Rating   FeedbackRating
+	Reason   FeedbackReason
+	PromptID int64
+	Provider string
+	Model    string
+	Start    int64
+	End      int64
+	Limit    int
+}
+
+// FeedbackReview 导出给人工复核的评价，带上用户的问题和模型的回答
+type FeedbackReview struct {
+	Feedback MessageFeedback
+	Question string
+	Answer   string
+}
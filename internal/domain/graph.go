@@ -39,4 +39,23 @@ type Graph struct {
 	Steps    []Node
 	Edges    []Edge
 	Metadata ekit.AnyValue
+	// 最后一次整体保存的版本，保存的时候用来检查并发修改
+	Version int64
+}
+
+// GraphVersion 整体保存图的时候生成的快照，执行的时候可以指定使用哪个版本
+type GraphVersion struct {
+	GraphID int64
+	Version int64
+	// ListVersions 返回的版本里面没有快照
+	Graph Graph
+	Ctime int64
+}
+
+// GraphTemplate 内置的图模板，Document 是导出格式的 JSON 文档
+type GraphTemplate struct {
+	Name        string
+	Title       string
+	Description string
+	Document    []byte
 }
@@ -0,0 +1,275 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import "encoding/json"
+
+// 节点的类型，节点的配置以 JSON 的形式保存在 Node.Metadata 里面
+const (
+	// NodeTypeLLM 使用 prompt 调用大模型，配置是 LLMNodeConfig
+	NodeTypeLLM = "llm"
+	// NodeTypeTemplate 渲染模板，配置是 TemplateNodeConfig
+	NodeTypeTemplate = "template"
+	// NodeTypeHTTP 发送 HTTP 请求，配置是 HTTPNodeConfig
+	NodeTypeHTTP = "http"
+	// NodeTypeCondition 根据输入选择分支，配置是 ConditionNodeConfig
+	NodeTypeCondition = "condition"
+	// NodeTypeMerge 合并多个上游的输出，配置是 MergeNodeConfig
+	NodeTypeMerge = "merge"
+	// NodeTypeTransform 从输入里面挑选字段组成新的对象，配置是 TransformNodeConfig
+	NodeTypeTransform = "transform"
+	// NodeTypeApproval 暂停执行，等待人工审批，配置是 ApprovalNodeConfig
+	NodeTypeApproval = "approval"
+)
+
+// NodeConfig 所有节点共有的配置
+type NodeConfig struct {
+	// Key 在模板里面引用这个节点的输出时使用的名字，为空的时候是 node_<id>
+	Key string `json:"key,omitempty"`
+}
+
+type LLMNodeConfig struct {
+	NodeConfig
+	PromptID int64 `json:"prompt_id"`
+	// 为 0 的时候按照 prompt 的发布策略选择版本
+	VersionID int64 `json:"version_id,omitempty"`
+}
+
+type TemplateNodeConfig struct {
+	NodeConfig
+	// 使用 {{path}} 引用变量，例如 {{input.question}}、{{nodes.classify}}
+	Template string `json:"template"`
+}
+
+type HTTPNodeConfig struct {
+	NodeConfig
+	// 默认 GET
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// 请求体模板
+	Body string `json:"body,omitempty"`
+	// 超时时间，毫秒，默认 10 秒
+	TimeoutMs int64 `json:"timeout_ms,omitempty"`
+}
+
+// ConditionNodeConfig 按照顺序匹配 Cases，第一个满足的 Case 的 Branch 就是选中的分支，都不满足的时候选择 Default。
+// 出边的 Metadata 里面用 {"branch": "xxx"} 声明自己属于哪个分支，没有声明的出边总是会被执行
+type ConditionNodeConfig struct {
+	NodeConfig
+	Cases   []ConditionCase `json:"cases"`
+	Default string          `json:"default,omitempty"`
+}
+
+type ConditionCase struct {
+	// 变量的路径，例如 input.category
+	Path string `json:"path"`
+	// eq、ne、contains、gt、gte、lt、lte、exists
+	Op     string `json:"op"`
+	Value  any    `json:"value,omitempty"`
+	Branch string `json:"branch"`
+}
+
+type MergeNodeConfig struct {
+	NodeConfig
+	// object 按照上游的 Key 组成对象，array 按照上游的 ID 顺序组成数组，first 取第一个有输出的上游。默认 object
+	Mode string `json:"mode,omitempty"`
+}
+
+type TransformNodeConfig struct {
+	NodeConfig
+	// 输出的字段名到变量路径的映射
+	Fields map[string]string `json:"fields"`
+}
+
+// ApprovalNodeConfig 审批通过的时候输出审批人修改之后的内容，没有修改的时候输出输入。
+// 出边用 {"branch": "approved"} 或者 {"branch": "rejected"} 声明分支，没有声明的出边属于 approved
+type ApprovalNodeConfig struct {
+	NodeConfig
+	// 超时时间，秒，默认 24 小时
+	TimeoutSeconds int64 `json:"timeout_seconds,omitempty"`
+	// 超时之后的处理，approve 或者 reject，默认 reject
+	OnTimeout string `json:"on_timeout,omitempty"`
+}
+
+const (
+	ApprovalBranchApproved = "approved"
+	ApprovalBranchRejected = "rejected"
+)
+
+// EdgeConfig 边的配置，保存在 Edge.Metadata 里面
+type EdgeConfig struct {
+	// 条件节点的出边属于哪个分支
+	Branch string `json:"branch,omitempty"`
+}
+
+// ParseNodeConfig 解析节点的配置，Metadata 为空的时候 cfg 保持零值
+func ParseNodeConfig(node Node, cfg any) error {
+	return parseMetadata(node.Metadata.Val, cfg)
+}
+
+// ParseEdgeConfig 解析边的配置
+func ParseEdgeConfig(edge Edge) (EdgeConfig, error) {
+	var cfg EdgeConfig
+	err := parseMetadata(edge.Metadata.Val, &cfg)
+	return cfg, err
+}
+
+func parseMetadata(val any, cfg any) error {
+	var data []byte
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+type GraphRunStatus string
+
+const (
+	GraphRunStatusRunning   GraphRunStatus = "running"
+	GraphRunStatusSucceeded GraphRunStatus = "succeeded"
+	GraphRunStatusFailed    GraphRunStatus = "failed"
+	// GraphRunStatusPaused 失败的节点单独重试成功了，下游的节点还没有执行，可以继续执行
+	GraphRunStatusPaused GraphRunStatus = "paused"
+	// GraphRunStatusWaiting 执行到了审批节点，审批之后继续执行
+	GraphRunStatusWaiting GraphRunStatus = "waiting"
+)
+
+type NodeRunStatus string
+
+const (
+	NodeRunStatusPending   NodeRunStatus = "pending"
+	NodeRunStatusRunning   NodeRunStatus = "running"
+	NodeRunStatusSucceeded NodeRunStatus = "succeeded"
+	NodeRunStatusFailed    NodeRunStatus = "failed"
+	// NodeRunStatusSkipped 所在的分支没有被条件节点选中
+	NodeRunStatusSkipped NodeRunStatus = "skipped"
+	// NodeRunStatusWaiting 审批节点在等待审批
+	NodeRunStatusWaiting NodeRunStatus = "waiting"
+)
+
+// GraphRunRequest 执行图的请求，Version 为 0 的时候执行图当前的状态
+type GraphRunRequest struct {
+	GraphID int64
+	Version int64
+	Uid     int64
+	Input   any
+}
+
+// GraphRunQuery 查询某个用户的执行记录，按照创建时间倒序排列。GraphID 和 Status 为零值的时候不过滤
+type GraphRunQuery struct {
+	Uid     int64
+	GraphID int64
+	Status  GraphRunStatus
+	Limit   int
+	Offset  int
+}
+
+// GraphRun 图的一次执行
+type GraphRun struct {
+	ID      int64
+	GraphID int64
+	// 执行的图的版本，执行图当前的状态的时候是最后一次整体保存的版本
+	Version int64
+	// 发起执行的用户，用于大模型节点计费，为 0 表示不计费
+	Uid    int64
+	Status GraphRunStatus
+	Input  any
+	// 没有下游的节点的输出，只有一个的时候直接是它的输出，多个的时候按照 Key 组成对象
+	Output any
+	Error  string
+	Nodes  []NodeRun
+	Ctime  int64
+	Utime  int64
+}
+
+// NodeRun 节点在一次执行中的状态
+type NodeRun struct {
+	RunID  int64
+	NodeID int64
+	Status NodeRunStatus
+	Input  any
+	Output any
+	Error  string
+	// 条件节点选中的分支，继续执行的时候用来判断下游的节点要不要执行
+	Branch string
+	// 所有执行消耗的 token 之和
+	Tokens int64
+	// 最后一次执行的耗时，毫秒
+	Latency int64
+	// 执行的次数，重试和继续执行都会增加
+	Attempts int
+	// 审批节点的审批截止时间，毫秒
+	Deadline int64
+	// 审批节点的审批结果，审批之前为 nil
+	Approval *NodeApproval
+}
+
+type NodeApproval struct {
+	Approved bool
+	// 审批人，超时自动处理的时候为 0
+	Uid     int64
+	Comment string
+	// 审批人修改了输出
+	Edited  bool
+	Timeout bool
+	Time    int64
+}
+
+// GraphApproval 审批一个等待中的审批节点，Payload 不为 nil 的时候替换节点的输出
+type GraphApproval struct {
+	RunID    int64
+	NodeID   int64
+	Uid      int64
+	Approved bool
+	Payload  any
+	Comment  string
+}
+
+type GraphRunEventType string
+
+const (
+	GraphRunEventRunStarted  GraphRunEventType = "run_started"
+	GraphRunEventNodeStarted GraphRunEventType = "node_started"
+	// GraphRunEventNodeFinished 节点执行结束，结果看 Node.Status
+	GraphRunEventNodeFinished GraphRunEventType = "node_finished"
+	// GraphRunEventNodeWaiting 审批节点开始等待审批
+	GraphRunEventNodeWaiting GraphRunEventType = "node_waiting"
+	// GraphRunEventRunFinished 执行结束之后的最后一个事件，结果看 Run.Status
+	GraphRunEventRunFinished GraphRunEventType = "run_finished"
+	// GraphRunEventRunWaiting 执行暂停等待审批，是这一段执行的最后一个事件
+	GraphRunEventRunWaiting GraphRunEventType = "run_waiting"
+)
+
+// GraphRunEvent 执行过程中的事件，用于流式返回执行进度
+type GraphRunEvent struct {
+	Type GraphRunEventType
+	Run  GraphRun
+	// 节点相关的事件才有
+	Node NodeRun
+}
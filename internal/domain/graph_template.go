@@ -0,0 +1,145 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var templateVariable = regexp.MustCompile(`\{\{\s*([\w.\-]+)\s*\}\}`)
+
+// RenderTemplate 使用 scope 里面的变量替换模板中形如 {{a.b.c}} 的占位符。
+// 字符串原样替换，其余的值替换为 JSON，找不到的变量替换为空字符串
+func RenderTemplate(tpl string, scope map[string]any) string {
+	return templateVariable.ReplaceAllStringFunc(tpl, func(s string) string {
+		path := templateVariable.FindStringSubmatch(s)[1]
+		val, _ := LookupPath(scope, path)
+		return Stringify(val)
+	})
+}
+
+// LookupPath 按照点分隔的路径查找变量，数组使用下标，例如 nodes.search.items.0.title
+func LookupPath(root any, path string) (any, bool) {
+	cur := root
+	for _, seg := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			val, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = val
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			cur = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Stringify 把变量转换成字符串，nil 为空字符串
+func Stringify(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// Match 判断 scope 是否满足条件
+func (c ConditionCase) Match(scope map[string]any) bool {
+	val, ok := LookupPath(scope, c.Path)
+	switch c.Op {
+	case "exists":
+		return ok && val != nil && val != ""
+	case "eq":
+		return ok && equalValue(val, c.Value)
+	case "ne":
+		return !ok || !equalValue(val, c.Value)
+	case "contains":
+		if arr, isArr := val.([]any); isArr {
+			for _, item := range arr {
+				if equalValue(item, c.Value) {
+					return true
+				}
+			}
+			return false
+		}
+		return ok && strings.Contains(Stringify(val), Stringify(c.Value))
+	case "gt", "gte", "lt", "lte":
+		a, okA := toNumber(val)
+		b, okB := toNumber(c.Value)
+		if !ok || !okA || !okB {
+			return false
+		}
+		switch c.Op {
+		case "gt":
+			return a > b
+		case "gte":
+			return a >= b
+		case "lt":
+			return a < b
+		default:
+			return a <= b
+		}
+	default:
+		return false
+	}
+}
+
+// equalValue 两边都是数字的时候按照数字比较，否则按照字符串比较
+func equalValue(a any, b any) bool {
+	x, okA := toNumber(a)
+	y, okB := toNumber(b)
+	if okA && okB {
+		return x == y
+	}
+	return Stringify(a) == Stringify(b)
+}
+
+func toNumber(val any) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
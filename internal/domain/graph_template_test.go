@@ -0,0 +1,73 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	scope := map[string]any{
+		"input": map[string]any{"question": "怎么退款", "tags": []any{"a", "b"}, "count": float64(3)},
+		"nodes": map[string]any{"classify": "billing"},
+	}
+	testCases := []struct {
+		name string
+		tpl  string
+		want string
+	}{
+		{name: "字符串", tpl: "问题：{{input.question}}，分类：{{ nodes.classify }}", want: "问题：怎么退款，分类：billing"},
+		{name: "数组下标", tpl: "{{input.tags.1}}", want: "b"},
+		{name: "非字符串转换成 JSON", tpl: "{{input.tags}} {{input.count}}", want: `["a","b"] 3`},
+		{name: "找不到的变量", tpl: "[{{input.missing}}][{{input.tags.5}}]", want: "[][]"},
+		{name: "没有占位符", tpl: "hello", want: "hello"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, RenderTemplate(tc.tpl, scope))
+		})
+	}
+}
+
+func TestConditionCase_Match(t *testing.T) {
+	scope := map[string]any{
+		"input": map[string]any{"category": "billing", "score": float64(0.8), "tags": []any{"vip"}, "empty": ""},
+	}
+	testCases := []struct {
+		name string
+		c    ConditionCase
+		want bool
+	}{
+		{name: "eq", c: ConditionCase{Path: "input.category", Op: "eq", Value: "billing"}, want: true},
+		{name: "eq 数字和字符串", c: ConditionCase{Path: "input.score", Op: "eq", Value: "0.8"}, want: true},
+		{name: "ne", c: ConditionCase{Path: "input.category", Op: "ne", Value: "billing"}, want: false},
+		{name: "ne 不存在的变量", c: ConditionCase{Path: "input.missing", Op: "ne", Value: "billing"}, want: true},
+		{name: "contains 字符串", c: ConditionCase{Path: "input.category", Op: "contains", Value: "bill"}, want: true},
+		{name: "contains 数组", c: ConditionCase{Path: "input.tags", Op: "contains", Value: "vip"}, want: true},
+		{name: "gt", c: ConditionCase{Path: "input.score", Op: "gt", Value: 0.5}, want: true},
+		{name: "lte", c: ConditionCase{Path: "input.score", Op: "lte", Value: 0.5}, want: false},
+		{name: "gt 不是数字", c: ConditionCase{Path: "input.category", Op: "gt", Value: 1}, want: false},
+		{name: "exists", c: ConditionCase{Path: "input.category", Op: "exists"}, want: true},
+		{name: "exists 空字符串", c: ConditionCase{Path: "input.empty", Op: "exists"}, want: false},
+		{name: "未知的操作", c: ConditionCase{Path: "input.category", Op: "like", Value: "b"}, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.c.Match(scope))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+type GraphTriggerType string
+
+const (
+	// GraphTriggerCron 按照 cron 表达式定时执行
+	GraphTriggerCron GraphTriggerType = "cron"
+	// GraphTriggerWebhook 外部系统调用 webhook 地址执行，时间戳和请求体用共享的密钥签名
+	GraphTriggerWebhook GraphTriggerType = "webhook"
+	// GraphTriggerManual 用户手动执行
+	GraphTriggerManual GraphTriggerType = "manual"
+)
+
+// GraphTrigger 图的触发器，触发之后以 Uid 的身份执行图，触发时的数据作为图的输入
+type GraphTrigger struct {
+	ID      int64
+	GraphID int64
+	// 创建者，执行记录和计费都属于这个用户
+	Uid  int64
+	Type GraphTriggerType
+	// 标准的五段 cron 表达式，比如 "0 9 * * 1-5"
+	Cron string
+	// webhook 的签名密钥，创建的时候为空会自动生成
+	Secret  string
+	Enabled bool
+	// 下一次定时执行的时间，毫秒。多个实例通过更新这个字段保证同一次只会执行一次
+	NextTime int64
+	Ctime    int64
+	Utime    int64
+}
+
+type GraphTriggerRecordStatus string
+
+const (
+	// GraphTriggerRecordStarted 图已经开始执行，执行的结果看 RunID 对应的执行记录
+	GraphTriggerRecordStarted GraphTriggerRecordStatus = "started"
+	// GraphTriggerRecordFailed 图没能开始执行，比如图已经不合法了
+	GraphTriggerRecordFailed GraphTriggerRecordStatus = "failed"
+)
+
+// GraphTriggerRecord 触发的历史
+type GraphTriggerRecord struct {
+	ID        int64
+	TriggerID int64
+	GraphID   int64
+	// 执行图的用户
+	Uid     int64
+	Type    GraphTriggerType
+	Payload any
+	RunID   int64
+	Status  GraphTriggerRecordStatus
+	Error   string
+	// 定时触发的时候是计划执行的时间，其余的时候是触发的时间
+	FireTime int64
+	Ctime    int64
+}
+
+// GraphTriggerQuery 查询用户的触发历史，GraphID 和 TriggerID 为 0 的时候不过滤
+type GraphTriggerQuery struct {
+	Uid       int64
+	GraphID   int64
+	TriggerID int64
+	Limit     int
+	Offset    int
+}
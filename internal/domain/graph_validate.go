@@ -0,0 +1,51 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+type GraphIssueLevel string
+
+const (
+	// GraphIssueLevelError 图不能执行，保存的时候会被拒绝
+	GraphIssueLevelError GraphIssueLevel = "error"
+	// GraphIssueLevelWarning 图可以执行，但是很可能不是预期的结果
+	GraphIssueLevelWarning GraphIssueLevel = "warning"
+)
+
+type GraphIssueCode string
+
+const (
+	GraphIssueUnknownType     GraphIssueCode = "unknown_type"
+	GraphIssueInvalidMetadata GraphIssueCode = "invalid_metadata"
+	// GraphIssueDuplicateKey 两个节点的 Key 相同，模板里面引用的时候会互相覆盖
+	GraphIssueDuplicateKey GraphIssueCode = "duplicate_key"
+	// GraphIssueDanglingEdge 边连接的节点不存在
+	GraphIssueDanglingEdge GraphIssueCode = "dangling_edge"
+	// GraphIssueCrossGraphEdge 边连接了其他图的节点
+	GraphIssueCrossGraphEdge GraphIssueCode = "cross_graph_edge"
+	// GraphIssueInvalidBranch 边声明的分支在上游节点里面不存在
+	GraphIssueInvalidBranch GraphIssueCode = "invalid_branch"
+	GraphIssueCycle         GraphIssueCode = "cycle"
+	// GraphIssueOrphanedNode 节点没有任何边，只有一个节点的图不算
+	GraphIssueOrphanedNode GraphIssueCode = "orphaned_node"
+)
+
+// GraphIssue 图的一个问题，NodeID 和 EdgeID 是问题所在的节点或者边，没有的时候为 0
+type GraphIssue struct {
+	Level   GraphIssueLevel
+	Code    GraphIssueCode
+	NodeID  int64
+	EdgeID  int64
+	Message string
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+// KnowledgeBase 用户自己的知识库，文档按照知识库的配置切分
+type KnowledgeBase struct {
+	ID          int64
+	Owner       int64
+	Name        string
+	Description string
+	// 每个片段最多的字符数
+	ChunkSize int
+	// 相邻的片段重叠的字符数，必须小于 ChunkSize
+	ChunkOverlap int
+	Ctime        int64
+	Utime        int64
+}
+
+type DocumentFormat string
+
+const (
+	DocumentFormatText     DocumentFormat = "text"
+	DocumentFormatMarkdown DocumentFormat = "markdown"
+	DocumentFormatHTML     DocumentFormat = "html"
+	// DocumentFormatPDF 从 PDF 里面提取出来的文本，换页符会被当成段落的分隔
+	DocumentFormatPDF DocumentFormat = "pdf"
+)
+
+type DocumentStatus string
+
+const (
+	DocumentStatusPending    DocumentStatus = "pending"
+	DocumentStatusProcessing DocumentStatus = "processing"
+	DocumentStatusSucceeded  DocumentStatus = "succeeded"
+	DocumentStatusFailed     DocumentStatus = "failed"
+)
+
+// KnowledgeDocument 知识库里面的文档，导入在后台执行，Status 和 Progress 是导入的进度
+type KnowledgeDocument struct {
+	ID     int64
+	KBID   int64
+	Owner  int64
+	Title  string
+	Format DocumentFormat
+	// 原始的内容，列表里面为空
+	Content string
+	Status  DocumentStatus
+	// 导入的进度，0 到 100
+	Progress int
+	Chunks   int
+	Error    string
+	Ctime    int64
+	Utime    int64
+}
+
+// KnowledgeChunk 文档切分出来的片段，Index 是片段在文档里面的顺序，从 0 开始
+type KnowledgeChunk struct {
+	ID      int64
+	DocID   int64
+	KBID    int64
+	Owner   int64
+	Index   int
+	Content string
+	Ctime   int64
+}
+
+type KnowledgeDocumentQuery struct {
+	Owner  int64
+	KBID   int64
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import "slices"
+
+// ActivePath 从 leafID 沿着 ParentID 往上找到根，返回按照时间先后排列的路径。
+// 路径上的每一条消息都会填上兄弟消息的数量和自己的位置，方便切换分支。
+// messages 是对话的全部消息，找不到 leafID 的时候返回空
+func ActivePath(messages []Message, leafID int64) []Message {
+	byID := make(map[int64]Message, len(messages))
+	children := make(map[int64][]int64, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+		children[msg.ParentID] = append(children[msg.ParentID], msg.ID)
+	}
+	var path []Message
+	for id := leafID; id > 0; {
+		msg, ok := byID[id]
+		// 防止脏数据导致死循环
+		if !ok || len(path) > len(messages) {
+			break
+		}
+		siblings := children[msg.ParentID]
+		slices.Sort(siblings)
+		msg.Siblings = len(siblings)
+		msg.SiblingIndex = slices.Index(siblings, msg.ID)
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// LatestLeaf 从 id 开始一直往下走，每一步都选择最新的子消息，返回最后到达的消息。
+// 切换到某个分支的时候，展示的是这个分支最新的对话
+func LatestLeaf(messages []Message, id int64) int64 {
+	latest := make(map[int64]int64, len(messages))
+	for _, msg := range messages {
+		latest[msg.ParentID] = max(latest[msg.ParentID], msg.ID)
+	}
+	for i := 0; i < len(messages); i++ {
+		child, ok := latest[id]
+		if !ok {
+			break
+		}
+		id = child
+	}
+	return id
+}
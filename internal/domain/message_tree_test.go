@@ -0,0 +1,101 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/stretchr/testify/assert"
+)
+
+// 1 -> 2 -> 3
+//
+//	     -> 4 -> 5
+//	-> 6
+func treeMessages() []Message {
+	return []Message{
+		{ID: 1},
+		{ID: 2, ParentID: 1},
+		{ID: 3, ParentID: 2},
+		{ID: 4, ParentID: 2},
+		{ID: 5, ParentID: 4},
+		{ID: 6, ParentID: 1},
+	}
+}
+
+func TestActivePath(t *testing.T) {
+	testCases := []struct {
+		name         string
+		leafID       int64
+		wantIDs      []int64
+		wantSiblings []int
+		wantIndex    []int
+	}{
+		{
+			name:         "最新的分支",
+			leafID:       5,
+			wantIDs:      []int64{1, 2, 4, 5},
+			wantSiblings: []int{1, 2, 2, 1},
+			wantIndex:    []int{0, 0, 1, 0},
+		},
+		{
+			name:         "旧的分支",
+			leafID:       3,
+			wantIDs:      []int64{1, 2, 3},
+			wantSiblings: []int{1, 2, 2},
+			wantIndex:    []int{0, 0, 0},
+		},
+		{
+			name:         "分支在中间",
+			leafID:       6,
+			wantIDs:      []int64{1, 6},
+			wantSiblings: []int{1, 2},
+			wantIndex:    []int{0, 1},
+		},
+		{
+			name:         "消息不存在",
+			leafID:       100,
+			wantIDs:      []int64{},
+			wantSiblings: []int{},
+			wantIndex:    []int{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ActivePath(treeMessages(), tc.leafID)
+			assert.Equal(t, tc.wantIDs, slice.Map(path, func(idx int, src Message) int64 { return src.ID }))
+			assert.Equal(t, tc.wantSiblings, slice.Map(path, func(idx int, src Message) int { return src.Siblings }))
+			assert.Equal(t, tc.wantIndex, slice.Map(path, func(idx int, src Message) int { return src.SiblingIndex }))
+		})
+	}
+}
+
+func TestLatestLeaf(t *testing.T) {
+	testCases := []struct {
+		name string
+		id   int64
+		want int64
+	}{
+		{name: "从根开始", id: 1, want: 6},
+		{name: "从中间开始", id: 2, want: 5},
+		{name: "本身就是叶子", id: 3, want: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, LatestLeaf(treeMessages(), tc.id))
+		})
+	}
+}
@@ -15,6 +15,9 @@
 package domain
 
 import (
+	"hash/fnv"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -25,8 +28,8 @@ func (o OwnerType) String() string {
 }
 
 const (
-	_ OwnerType = "personal"
-	_ OwnerType = "organization"
+	OwnerTypePersonal     OwnerType = "personal"
+	OwnerTypeOrganization OwnerType = "organization"
 )
 
 type Prompt struct {
@@ -35,6 +38,7 @@ type Prompt struct {
 	Owner       int64
 	OwnerType   OwnerType
 	Description string
+	Status      uint8
 	// 当前发布版本的 id
 	ActiveVersion int64
 	// prompt 所有的版本信息
@@ -52,6 +56,117 @@ type PromptVersion struct {
 	TopN          float32
 	MaxTokens     int
 	Status        uint8
-	Ctime         time.Time
-	Utime         time.Time
+	// 流量权重，大于 0 的版本才会参与分流
+	Weight int
+	Ctime  time.Time
+	Utime  time.Time
+}
+
+// Render 使用 vars 替换 Content 中形如 {{name}} 的占位符
+func (v PromptVersion) Render(vars map[string]string) string {
+	if len(vars) == 0 {
+		return v.Content
+	}
+	pairs := make([]string, 0, len(vars)*2)
+	for key, val := range vars {
+		pairs = append(pairs, "{{"+key+"}}", val)
+	}
+	return strings.NewReplacer(pairs...).Replace(v.Content)
+}
+
+// Pick 根据 key 的哈希值，按照各个版本的权重确定性地选出一个版本。
+// 同一个 key 总是命中同一个版本，没有配置权重的时候退化为当前发布版本
+func (p Prompt) Pick(key string) (PromptVersion, bool) {
+	candidates := make([]PromptVersion, 0, len(p.Versions))
+	total := 0
+	for _, v := range p.Versions {
+		if v.Status == 0 || v.Weight <= 0 {
+			continue
+		}
+		candidates = append(candidates, v)
+		total += v.Weight
+	}
+	if total == 0 {
+		for _, v := range p.Versions {
+			if v.ID == p.ActiveVersion {
+				return v, true
+			}
+		}
+		return PromptVersion{}, false
+	}
+	// 保证不同的查询顺序下结果一致
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID < candidates[j].ID
+	})
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	point := int(h.Sum32() % uint32(total))
+	for _, v := range candidates {
+		if point < v.Weight {
+			return v, true
+		}
+		point -= v.Weight
+	}
+	return candidates[len(candidates)-1], true
+}
+
+// PromptVersionStats 某个版本的线上使用情况
+type PromptVersionStats struct {
+	VersionID int64
+	// 使用次数
+	Count int64
+	// 平均耗时，毫秒
+	AvgLatency int64
+	// 消耗的 token 总数
+	Tokens int64
+	// 点赞数
+	Up int64
+	// 点踩数
+	Down int64
+}
+
+// PromptQuery 查询 prompt 列表的条件，已经删除的 prompt 永远不会被查询出来
+type PromptQuery struct {
+	Owner     int64
+	OwnerType OwnerType
+	// 在名字和描述里面搜索
+	Keyword string
+	// 为 0 表示不限制
+	Status uint8
+	// 为 nil 表示不限制
+	HasPublished *bool
+	// 排序字段，可以是 id, ctime 和 utime，默认是 utime
+	SortBy string
+	Asc    bool
+	// 上一页返回的游标，第一页不需要传
+	Cursor string
+	Limit  int
+}
+
+type PromptPage struct {
+	Prompts []Prompt
+	// 为空表示没有下一页了
+	NextCursor string
+}
+
+// PromptImportAction 导入的时候对 prompt 或者版本执行的操作
+type PromptImportAction string
+
+const (
+	PromptImportCreate    PromptImportAction = "create"
+	PromptImportUpdate    PromptImportAction = "update"
+	PromptImportUnchanged PromptImportAction = "unchanged"
+)
+
+type PromptImportResult struct {
+	// dry run 并且是新建的时候为 0
+	PromptID int64
+	Name     string
+	Action   PromptImportAction
+	Versions []PromptVersionImportResult
+}
+
+type PromptVersionImportResult struct {
+	Label  string
+	Action PromptImportAction
 }
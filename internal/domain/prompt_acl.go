@@ -0,0 +1,80 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import "time"
+
+// PromptRole 角色之间是包含关系，publisher 拥有 editor 的全部权限，editor 拥有 viewer 的全部权限
+type PromptRole uint8
+
+const (
+	PromptRoleNone PromptRole = iota
+	// PromptRoleViewer 可以查看 prompt 和统计数据
+	PromptRoleViewer
+	// PromptRoleEditor 可以修改 prompt 以及新增、修改和删除版本
+	PromptRoleEditor
+	// PromptRolePublisher 可以发布版本、删除 prompt 以及管理权限
+	PromptRolePublisher
+)
+
+func (r PromptRole) String() string {
+	switch r {
+	case PromptRoleViewer:
+		return "viewer"
+	case PromptRoleEditor:
+		return "editor"
+	case PromptRolePublisher:
+		return "publisher"
+	default:
+		return "none"
+	}
+}
+
+// Allow 判断当前角色是否满足 need 的要求
+func (r PromptRole) Allow(need PromptRole) bool {
+	return r >= need
+}
+
+func ParsePromptRole(s string) (PromptRole, bool) {
+	switch s {
+	case "viewer":
+		return PromptRoleViewer, true
+	case "editor":
+		return PromptRoleEditor, true
+	case "publisher":
+		return PromptRolePublisher, true
+	default:
+		return PromptRoleNone, false
+	}
+}
+
+// ACLScope 授权的范围，可以授权单个 prompt，也可以授权整个组织
+type ACLScope string
+
+const (
+	ACLScopePrompt       ACLScope = "prompt"
+	ACLScopeOrganization ACLScope = "organization"
+)
+
+type PromptACL struct {
+	ID    int64
+	Scope ACLScope
+	// Scope 为 prompt 的时候是 prompt 的 ID，为 organization 的时候是组织的 ID
+	ScopeID int64
+	Uid     int64
+	Role    PromptRole
+	Ctime   time.Time
+	Utime   time.Time
+}
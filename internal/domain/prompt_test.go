@@ -0,0 +1,106 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrompt_Pick(t *testing.T) {
+	testCases := []struct {
+		name   string
+		prompt Prompt
+		key    string
+		wantID int64
+		wantOk bool
+	}{
+		{
+			name: "没有权重使用发布版本",
+			prompt: Prompt{
+				ActiveVersion: 2,
+				Versions:      []PromptVersion{{ID: 1, Status: 1}, {ID: 2, Status: 1}},
+			},
+			key:    "abc",
+			wantID: 2,
+			wantOk: true,
+		},
+		{
+			name: "没有权重也没有发布版本",
+			prompt: Prompt{
+				Versions: []PromptVersion{{ID: 1, Status: 1}},
+			},
+			key:    "abc",
+			wantOk: false,
+		},
+		{
+			name: "只有一个版本有权重",
+			prompt: Prompt{
+				ActiveVersion: 1,
+				Versions:      []PromptVersion{{ID: 1, Status: 1}, {ID: 2, Status: 1, Weight: 10}},
+			},
+			key:    "abc",
+			wantID: 2,
+			wantOk: true,
+		},
+		{
+			name: "已删除的版本不参与分流",
+			prompt: Prompt{
+				ActiveVersion: 1,
+				Versions:      []PromptVersion{{ID: 1, Status: 1, Weight: 1}, {ID: 2, Status: 0, Weight: 100}},
+			},
+			key:    "abc",
+			wantID: 1,
+			wantOk: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := tc.prompt.Pick(tc.key)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantID, v.ID)
+		})
+	}
+}
+
+func TestPrompt_PickDistribution(t *testing.T) {
+	prompt := Prompt{
+		Versions: []PromptVersion{
+			{ID: 2, Status: 1, Weight: 10},
+			{ID: 1, Status: 1, Weight: 90},
+		},
+	}
+	counts := map[int64]int{}
+	for i := 0; i < 10000; i++ {
+		key := "user-" + strconv.Itoa(i)
+		v, ok := prompt.Pick(key)
+		assert.True(t, ok)
+		// 同一个 key 多次选择的结果必须一致
+		again, _ := prompt.Pick(key)
+		assert.Equal(t, v.ID, again.ID)
+		counts[v.ID]++
+	}
+	assert.InDelta(t, 9000, counts[1], 300)
+	assert.InDelta(t, 1000, counts[2], 300)
+}
+
+func TestPromptVersion_Render(t *testing.T) {
+	v := PromptVersion{Content: "把 {{text}} 翻译成{{lang}}，{{unknown}} 保持不变"}
+	assert.Equal(t, "把 hello 翻译成中文，{{unknown}} 保持不变",
+		v.Render(map[string]string{"text": "hello", "lang": "中文"}))
+	assert.Equal(t, v.Content, v.Render(nil))
+}
@@ -29,4 +29,9 @@ type TempQuota struct {
 	Uid       int64
 }
 
-type Record struct{}
+// Record 一次扣费的记录，Key 相同的扣费只会有一条记录
+type Record struct {
+	Uid    int64
+	Key    string
+	Amount int64
+}
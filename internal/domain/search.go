@@ -0,0 +1,110 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	HighlightPre  = "<em>"
+	HighlightPost = "</em>"
+)
+
+// ConversationSearchQuery 在用户自己的对话里面搜索标题和消息内容
+type ConversationSearchQuery struct {
+	Uid     string
+	Keyword string
+	Limit   int
+}
+
+// ConversationSearchResult 一个命中的对话，按照最后活跃的时间倒序排列
+type ConversationSearchResult struct {
+	Sn    string
+	Title string
+	// 高亮之后的标题，标题没有命中的时候为空
+	TitleHighlight string
+	Matches        []MessageMatch
+	Utime          int64
+}
+
+// MessageMatch 命中的消息，Snippet 是命中位置附近的片段，关键字用 HighlightPre 和 HighlightPost 包起来
+type MessageMatch struct {
+	MessageID int64
+	Role      int32
+	Snippet   string
+}
+
+// Snippet 截取 text 里面第一次出现 keyword 的位置前后 radius 个字，并且高亮其中所有的 keyword。
+// 匹配不区分大小写，原文会被 HTML 转义，所以可以直接渲染
+func Snippet(text string, keyword string, radius int) (string, bool) {
+	src := []rune(text)
+	kw := []rune(keyword)
+	if len(kw) == 0 {
+		return "", false
+	}
+	first := -1
+	for i := 0; i+len(kw) <= len(src); i++ {
+		if matchFold(src, kw, i) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	start := max(first-radius, 0)
+	end := min(first+len(kw)+radius, len(src))
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	plain := start
+	for i := start; i+len(kw) <= end; {
+		if !matchFold(src, kw, i) {
+			i++
+			continue
+		}
+		sb.WriteString(html.EscapeString(string(src[plain:i])))
+		sb.WriteString(HighlightPre)
+		sb.WriteString(html.EscapeString(string(src[i : i+len(kw)])))
+		sb.WriteString(HighlightPost)
+		i += len(kw)
+		plain = i
+	}
+	sb.WriteString(html.EscapeString(string(src[plain:end])))
+	if end < len(src) {
+		sb.WriteString("…")
+	}
+	return sb.String(), true
+}
+
+// ContainsFold 判断 text 里面是否包含 keyword，不区分大小写
+func ContainsFold(text string, keyword string) bool {
+	_, ok := Snippet(text, keyword, 0)
+	return ok
+}
+
+func matchFold(src []rune, kw []rune, at int) bool {
+	for j, r := range kw {
+		if unicode.ToLower(src[at+j]) != unicode.ToLower(r) {
+			return false
+		}
+	}
+	return true
+}
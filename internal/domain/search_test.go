@@ -0,0 +1,71 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	testCases := []struct {
+		name    string
+		text    string
+		keyword string
+		radius  int
+		want    string
+		wantOk  bool
+	}{
+		{
+			name:    "高亮所有的关键字",
+			text:    "Go 的并发模型，go 语言",
+			keyword: "go",
+			radius:  20,
+			want:    "<em>Go</em> 的并发模型，<em>go</em> 语言",
+			wantOk:  true,
+		},
+		{
+			name:    "截取前后的内容",
+			text:    strings.Repeat("a", 10) + "关键字" + strings.Repeat("b", 10),
+			keyword: "关键字",
+			radius:  3,
+			want:    "…aaa<em>关键字</em>bbb…",
+			wantOk:  true,
+		},
+		{
+			name:    "转义 HTML",
+			text:    "<script>alert(1)</script>",
+			keyword: "alert",
+			radius:  20,
+			want:    "&lt;script&gt;<em>alert</em>(1)&lt;/script&gt;",
+			wantOk:  true,
+		},
+		{
+			name:    "没有命中",
+			text:    "hello",
+			keyword: "world",
+			radius:  10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := Snippet(tc.text, tc.keyword, tc.radius)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -19,4 +19,11 @@ type StreamEvent struct {
 	Content          string
 	Done             bool
 	Error            error
+	// 生成被用户取消了，只会出现在最后一个事件上
+	Cancelled bool
+	// 只有最后一个事件才可能带上 token 的使用情况
+	Usage Usage
+	// 正在生成的消息以及事件的序号，序号从 1 开始，断线之后可以从这个序号继续接收
+	MessageID int64
+	Seq       int64
 }
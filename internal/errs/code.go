@@ -18,6 +18,9 @@ var (
 	SystemError              = ErrorCode{Code: 501001, Msg: "系统错误"}
 	InvalidParamError        = ErrorCode{Code: 400001, Msg: "参数错误"}
 	InsufficientBalanceError = ErrorCode{Code: 400002, Msg: "余额不足"}
+	PermissionDeniedError    = ErrorCode{Code: 403001, Msg: "没有权限"}
+	NotFoundError            = ErrorCode{Code: 404001, Msg: "资源不存在"}
+	ConflictError            = ErrorCode{Code: 409001, Msg: "数据已经被修改，请刷新之后重试"}
 )
 
 type ErrorCode struct {
@@ -16,6 +16,7 @@ package grpc
 
 import (
 	"context"
+	"strconv"
 
 	ai "github.com/ecodeclub/ai-gateway-go/api/gen/ai/v1"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
@@ -34,9 +35,13 @@ func NewConversationServer(svc *service.ConversationService) *ConversationServer
 
 func (c *ConversationServer) Create(ctx context.Context, conversation *ai.Conversation) (*ai.Conversation, error) {
 	id, err := c.svc.Create(ctx, domain.Conversation{
-		Sn:    conversation.Sn,
-		Title: conversation.Title,
-		Uid:   conversation.Uid,
+		Sn:               conversation.Sn,
+		Title:            conversation.Title,
+		Uid:              conversation.Uid,
+		PromptID:         conversation.PromptId,
+		BizID:            conversation.BizId,
+		Context:          c.toDomainContextConfig(conversation.Context),
+		DisableAutoTitle: conversation.DisableAutoTitle,
 	})
 	if err != nil {
 		return &ai.Conversation{}, err
@@ -45,7 +50,13 @@ func (c *ConversationServer) Create(ctx context.Context, conversation *ai.Conver
 }
 
 func (c *ConversationServer) List(ctx context.Context, req *ai.ListReq) (*ai.ListResp, error) {
-	conversation, err := c.svc.List(ctx, req.Uid, req.Limit, req.Offset)
+	conversation, err := c.svc.List(ctx, domain.ConversationQuery{
+		Uid:        req.Uid,
+		Archived:   req.Archived,
+		PinnedOnly: req.PinnedOnly,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	})
 	if err != nil {
 		return &ai.ListResp{}, err
 	}
@@ -65,15 +76,31 @@ func (c *ConversationServer) Chat(ctx context.Context, request *ai.LLMRequest) (
 	if err != nil {
 		return &ai.ChatResponse{}, err
 	}
+	return c.toChatResponse(response), nil
+}
 
-	return &ai.ChatResponse{
-		Sn: request.Sn,
-		Response: &ai.Message{
-			Role:             ai.Role(response.Response.Role),
-			Content:          response.Response.Content,
-			ReasoningContent: response.Response.ReasoningContent,
-		},
-	}, nil
+func (c *ConversationServer) Regenerate(ctx context.Context, req *ai.RegenerateRequest) (*ai.ChatResponse, error) {
+	response, err := c.svc.Regenerate(ctx, req.Uid, req.MessageId)
+	if err != nil {
+		return &ai.ChatResponse{}, err
+	}
+	return c.toChatResponse(response), nil
+}
+
+func (c *ConversationServer) EditAndResend(ctx context.Context, req *ai.EditAndResendRequest) (*ai.ChatResponse, error) {
+	response, err := c.svc.EditAndResend(ctx, req.Uid, req.MessageId, req.Content)
+	if err != nil {
+		return &ai.ChatResponse{}, err
+	}
+	return c.toChatResponse(response), nil
+}
+
+func (c *ConversationServer) SwitchBranch(ctx context.Context, req *ai.SwitchBranchRequest) (*ai.DetailResponse, error) {
+	path, err := c.svc.SwitchBranch(ctx, req.Uid, req.Sn, req.MessageId)
+	if err != nil {
+		return &ai.DetailResponse{}, err
+	}
+	return &ai.DetailResponse{Message: c.toMessage(path)}, nil
 }
 
 func (c *ConversationServer) Stream(request *ai.LLMRequest, resp ai.ConversationService_StreamServer) error {
@@ -85,6 +112,130 @@ func (c *ConversationServer) Stream(request *ai.LLMRequest, resp ai.Conversation
 	return c.stream(ctx, ch, resp)
 }
 
+func (c *ConversationServer) ResumeStream(req *ai.ResumeStreamRequest, resp ai.ConversationService_ResumeStreamServer) error {
+	ctx := resp.Context()
+	ch, err := c.svc.ResumeStream(ctx, req.Uid, req.MessageId, req.LastSeq)
+	if err != nil {
+		return err
+	}
+	return c.stream(ctx, ch, resp)
+}
+
+func (c *ConversationServer) Cancel(ctx context.Context, req *ai.CancelRequest) (*ai.CancelResponse, error) {
+	return &ai.CancelResponse{}, c.svc.Cancel(ctx, req.Uid, req.MessageId)
+}
+
+func (c *ConversationServer) Search(ctx context.Context, req *ai.SearchRequest) (*ai.SearchResponse, error) {
+	results, err := c.svc.Search(ctx, domain.ConversationSearchQuery{
+		Uid:     req.Uid,
+		Keyword: req.Keyword,
+		Limit:   int(req.Limit),
+	})
+	if err != nil {
+		return &ai.SearchResponse{}, err
+	}
+	return &ai.SearchResponse{
+		Results: slice.Map(results, func(idx int, src domain.ConversationSearchResult) *ai.SearchResult {
+			return &ai.SearchResult{
+				Sn:             src.Sn,
+				Title:          src.Title,
+				TitleHighlight: src.TitleHighlight,
+				Utime:          src.Utime,
+				Matches: slice.Map(src.Matches, func(idx int, m domain.MessageMatch) *ai.MessageMatch {
+					return &ai.MessageMatch{MessageId: m.MessageID, Role: ai.Role(m.Role), Snippet: m.Snippet}
+				}),
+			}
+		}),
+	}, nil
+}
+
+func (c *ConversationServer) Export(ctx context.Context, req *ai.ExportRequest) (*ai.ExportResponse, error) {
+	content, err := c.svc.Export(ctx, domain.ConversationExportQuery{
+		Uid:              req.Uid,
+		Sn:               req.Sn,
+		Start:            req.Start,
+		End:              req.End,
+		Format:           domain.ConversationExportFormat(req.Format),
+		IncludeReasoning: req.IncludeReasoning,
+	})
+	if err != nil {
+		return &ai.ExportResponse{}, err
+	}
+	return &ai.ExportResponse{Content: content}, nil
+}
+
+func (c *ConversationServer) Feedback(ctx context.Context, req *ai.FeedbackRequest) (*ai.FeedbackResponse, error) {
+	err := c.svc.Feedback(ctx, domain.MessageFeedback{
+		MessageID: req.MessageId,
+		Uid:       req.Uid,
+		Rating:    domain.FeedbackRating(max(min(req.Score, 1), -1)),
+		Reason:    domain.FeedbackReason(req.Reason),
+		Comment:   req.Comment,
+	})
+	if err != nil {
+		return &ai.FeedbackResponse{}, err
+	}
+	return &ai.FeedbackResponse{}, nil
+}
+
+func (c *ConversationServer) RegenerateTitle(ctx context.Context, req *ai.RegenerateTitleRequest) (*ai.Conversation, error) {
+	conversation, err := c.svc.RegenerateTitle(ctx, req.Uid, req.Sn)
+	if err != nil {
+		return &ai.Conversation{}, err
+	}
+	return c.toConversation([]domain.Conversation{conversation})[0], nil
+}
+
+func (c *ConversationServer) Subscribe(req *ai.SubscribeRequest, resp ai.ConversationService_SubscribeServer) error {
+	ctx := resp.Context()
+	ch, err := c.svc.Subscribe(ctx, req.Uid)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			err = resp.Send(&ai.ConversationEvent{Type: string(e.Type), Sn: e.Sn, Title: e.Title})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *ConversationServer) Update(ctx context.Context, req *ai.UpdateConversationRequest) (*ai.Conversation, error) {
+	conversation, err := c.svc.Update(ctx, req.Sn, req.Uid, req.Title)
+	if err != nil {
+		return &ai.Conversation{}, err
+	}
+	return c.toConversation([]domain.Conversation{conversation})[0], nil
+}
+
+func (c *ConversationServer) Archive(ctx context.Context, req *ai.ConversationOpRequest) (*ai.ConversationOpResponse, error) {
+	return &ai.ConversationOpResponse{}, c.svc.Archive(ctx, req.Sn, req.Uid)
+}
+
+func (c *ConversationServer) Unarchive(ctx context.Context, req *ai.ConversationOpRequest) (*ai.ConversationOpResponse, error) {
+	return &ai.ConversationOpResponse{}, c.svc.Unarchive(ctx, req.Sn, req.Uid)
+}
+
+func (c *ConversationServer) Pin(ctx context.Context, req *ai.PinRequest) (*ai.ConversationOpResponse, error) {
+	return &ai.ConversationOpResponse{}, c.svc.Pin(ctx, req.Sn, req.Uid, req.Pinned)
+}
+
+func (c *ConversationServer) Delete(ctx context.Context, req *ai.ConversationOpRequest) (*ai.ConversationOpResponse, error) {
+	return &ai.ConversationOpResponse{}, c.svc.Delete(ctx, req.Sn, req.Uid)
+}
+
+func (c *ConversationServer) Purge(ctx context.Context, req *ai.ConversationOpRequest) (*ai.ConversationOpResponse, error) {
+	return &ai.ConversationOpResponse{}, c.svc.Purge(ctx, req.Sn, req.Uid)
+}
+
 func (c *ConversationServer) stream(ctx context.Context, ch chan domain.StreamEvent, resp ai.ConversationService_StreamServer) error {
 	var err error
 	for {
@@ -93,14 +244,20 @@ func (c *ConversationServer) stream(ctx context.Context, ch chan domain.StreamEv
 			return ctx.Err()
 		case e, ok := <-ch:
 			if !ok || e.Done {
-				err = resp.Send(&ai.StreamEvent{Final: true})
+				err = resp.Send(&ai.StreamEvent{Final: true, MessageId: e.MessageID, Seq: e.Seq, Cancelled: e.Cancelled})
 				return err
 			}
 			if e.Error != nil {
-				err = resp.Send(&ai.StreamEvent{Err: e.Error.Error()})
+				err = resp.Send(&ai.StreamEvent{Err: e.Error.Error(), MessageId: e.MessageID, Seq: e.Seq})
 				return err
 			}
-			err = resp.Send(&ai.StreamEvent{Final: false, Content: e.Content, ReasoningContent: e.ReasoningContent})
+			err = resp.Send(&ai.StreamEvent{
+				Final:            false,
+				Content:          e.Content,
+				ReasoningContent: e.ReasoningContent,
+				MessageId:        e.MessageID,
+				Seq:              e.Seq,
+			})
 			if err != nil {
 				return err
 			}
@@ -111,13 +268,30 @@ func (c *ConversationServer) stream(ctx context.Context, ch chan domain.StreamEv
 func (c *ConversationServer) toConversation(conversations []domain.Conversation) []*ai.Conversation {
 	return slice.Map(conversations, func(idx int, src domain.Conversation) *ai.Conversation {
 		return &ai.Conversation{
-			Sn:    src.Sn,
-			Title: src.Title,
-			Uid:   src.Uid,
+			Sn:               src.Sn,
+			Title:            src.Title,
+			Uid:              src.Uid,
+			DisableAutoTitle: src.DisableAutoTitle,
+			Archived:         src.Archived,
+			Pinned:           src.Pinned,
+			Utime:            src.Utime,
 		}
 	})
 }
 
+func (c *ConversationServer) toDomainContextConfig(cfg *ai.ContextConfig) domain.ContextConfig {
+	if cfg == nil {
+		return domain.ContextConfig{}
+	}
+	return domain.ContextConfig{
+		Strategy:       domain.ContextStrategy(cfg.Strategy),
+		WindowTokens:   cfg.WindowTokens,
+		ReservedTokens: cfg.ReservedTokens,
+		LastN:          int(cfg.LastN),
+		MaxHistory:     int(cfg.MaxHistory),
+	}
+}
+
 func (c *ConversationServer) toDomainMessage(messages []*ai.Message) []domain.Message {
 	return slice.Map(messages, func(idx int, src *ai.Message) domain.Message {
 		return domain.Message{
@@ -127,12 +301,27 @@ func (c *ConversationServer) toDomainMessage(messages []*ai.Message) []domain.Me
 	})
 }
 
+func (c *ConversationServer) toChatResponse(response domain.ChatResponse) *ai.ChatResponse {
+	return &ai.ChatResponse{
+		Sn:       response.Sn,
+		Response: c.toMessage([]domain.Message{response.Response})[0],
+	}
+}
+
 func (c *ConversationServer) toMessage(messages []domain.Message) []*ai.Message {
 	return slice.Map(messages, func(idx int, src domain.Message) *ai.Message {
-		return &ai.Message{
+		res := &ai.Message{
+			Id:               strconv.FormatInt(src.ID, 10),
 			Role:             ai.Role(src.Role),
 			Content:          src.Content,
 			ReasoningContent: src.ReasoningContent,
+			Siblings:         int32(src.Siblings),
+			SiblingIndex:     int32(src.SiblingIndex),
+			Status:           int32(src.Status),
+		}
+		if src.ParentID > 0 {
+			res.ParentId = strconv.FormatInt(src.ParentID, 10)
 		}
+		return res
 	})
 }
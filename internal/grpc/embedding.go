@@ -0,0 +1,53 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+
+	ai "github.com/ecodeclub/ai-gateway-go/api/gen/ai/v1"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+)
+
+type EmbeddingServer struct {
+	svc *service.EmbeddingService
+	ai.UnimplementedEmbeddingServiceServer
+}
+
+func NewEmbeddingServer(svc *service.EmbeddingService) *EmbeddingServer {
+	return &EmbeddingServer{svc: svc}
+}
+
+func (e *EmbeddingServer) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	resp, err := e.svc.Embed(ctx, domain.EmbeddingRequest{
+		Uid:   req.GetUid(),
+		Input: req.GetInput(),
+		Key:   req.GetRequestId(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	data := make([]*ai.Embedding, 0, len(resp.Vectors))
+	for i, vector := range resp.Vectors {
+		data = append(data, &ai.Embedding{Index: int32(i), Vector: vector})
+	}
+	return &ai.EmbedResponse{
+		Data:         data,
+		Model:        resp.Model,
+		PromptTokens: resp.Usage.PromptTokens,
+		TotalTokens:  resp.Usage.TotalTokens,
+	}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	ai "github.com/ecodeclub/ai-gateway-go/api/gen/ai/v1"
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+)
+
+type GraphServer struct {
+	svc *service.GraphRunService
+	ai.UnimplementedGraphServiceServer
+}
+
+func NewGraphServer(svc *service.GraphRunService) *GraphServer {
+	return &GraphServer{svc: svc}
+}
+
+func (g *GraphServer) Run(req *ai.GraphRunRequest, resp ai.GraphService_RunServer) error {
+	var input any
+	if req.Input != "" {
+		if err := json.Unmarshal([]byte(req.Input), &input); err != nil {
+			return fmt.Errorf("%w: 输入不是合法的 JSON", errs.ErrInvalidParam)
+		}
+	}
+	ctx := resp.Context()
+	ch, err := g.svc.Stream(ctx, domain.GraphRunRequest{
+		GraphID: req.GraphId,
+		Version: req.Version,
+		Uid:     req.Uid,
+		Input:   input,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			err = resp.Send(g.toEvent(e))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (g *GraphServer) toEvent(e domain.GraphRunEvent) *ai.GraphRunEvent {
+	res := &ai.GraphRunEvent{
+		Type:      string(e.Type),
+		RunId:     e.Run.ID,
+		RunStatus: string(e.Run.Status),
+	}
+	switch e.Type {
+	case domain.GraphRunEventNodeStarted, domain.GraphRunEventNodeFinished, domain.GraphRunEventNodeWaiting:
+		res.NodeId = e.Node.NodeID
+		res.NodeStatus = string(e.Node.Status)
+		res.Output = g.marshal(e.Node.Output)
+		res.Error = e.Node.Error
+		res.Tokens = e.Node.Tokens
+		res.Latency = e.Node.Latency
+	case domain.GraphRunEventRunFinished:
+		res.Output = g.marshal(e.Run.Output)
+		res.Error = e.Run.Error
+	}
+	return res
+}
+
+func (g *GraphServer) marshal(val any) string {
+	if val == nil {
+		return ""
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
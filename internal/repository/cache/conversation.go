@@ -17,7 +17,9 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -26,6 +28,10 @@ import (
 const (
 	NameSpace         = "conversation:%s"
 	DefaultExpiration = 24 * time.Hour
+	// 流式事件只是为了断线重连，生成结束之后保留一段时间就可以了
+	StreamExpiration = time.Hour
+
+	cancelChannel = "conversation:cancel"
 )
 
 type ConversationCache struct {
@@ -52,19 +58,9 @@ func (c *ConversationCache) AddMessages(ctx context.Context, sn string, messages
 	return err
 }
 
+// GetMessage 从最新的消息往前跳过 offset 条，再取 limit 条，结果按照时间先后排列
 func (c *ConversationCache) GetMessage(ctx context.Context, sn string, limit int64, offset int64) ([]Message, error) {
-	length, err := c.rdb.LLen(ctx, c.key(sn)).Result()
-	if err != nil {
-		return []Message{}, err
-	}
-
-	start := offset
-	end := offset + limit - 1
-	if end >= length {
-		end = length - 1
-	}
-
-	messagesJSON, err := c.rdb.LRange(ctx, sn, start, end).Result()
+	messagesJSON, err := c.rdb.LRange(ctx, c.key(sn), -(offset + limit), -(offset + 1)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -81,12 +77,205 @@ func (c *ConversationCache) GetMessage(ctx context.Context, sn string, limit int
 	return messages, nil
 }
 
+// Reset 用 messages 替换缓存里面的消息，切换分支之后缓存里面的消息就不对了
+func (c *ConversationCache) Reset(ctx context.Context, sn string, messages []Message) error {
+	pipe := c.rdb.TxPipeline()
+	pipe.Del(ctx, c.key(sn))
+	for _, msg := range messages {
+		jsonMsg, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		pipe.RPush(ctx, c.key(sn), jsonMsg)
+	}
+	pipe.Expire(ctx, c.key(sn), DefaultExpiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AddStreamEvent 把流式事件写入 Redis Stream，seq 作为 Stream 的 ID，保证顺序和幂等
+func (c *ConversationCache) AddStreamEvent(ctx context.Context, messageID int64, event StreamEvent) error {
+	val, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	pipe := c.rdb.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: c.streamKey(messageID),
+		ID:     fmt.Sprintf("0-%d", event.Seq),
+		Values: map[string]any{"data": val},
+	})
+	pipe.Expire(ctx, c.streamKey(messageID), StreamExpiration)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ReadStreamEvents 读取 afterSeq 之后的事件。block 小于 0 表示不等待，
+// 否则没有新的事件的时候最多等待 block，超时返回空
+func (c *ConversationCache) ReadStreamEvents(ctx context.Context, messageID int64, afterSeq int64, block time.Duration) ([]StreamEvent, error) {
+	res, err := c.rdb.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{c.streamKey(messageID), fmt.Sprintf("0-%d", afterSeq)},
+		Count:   100,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	for _, stream := range res {
+		for _, msg := range stream.Messages {
+			var event StreamEvent
+			data, _ := msg.Values["data"].(string)
+			if err = json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// PublishEvent 把对话的事件发布给订阅了这个用户的客户端
+func (c *ConversationCache) PublishEvent(ctx context.Context, uid string, event Event) error {
+	val, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return c.rdb.Publish(ctx, c.eventKey(uid), val).Err()
+}
+
+// SubscribeEvents 订阅用户的对话事件，ctx 结束的时候取消订阅并关闭返回的 channel
+func (c *ConversationCache) SubscribeEvents(ctx context.Context, uid string) (<-chan Event, error) {
+	payloads, err := c.subscribe(ctx, c.eventKey(uid))
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event, 10)
+	go func() {
+		defer close(ch)
+		for payload := range payloads {
+			var event Event
+			if err := json.Unmarshal([]byte(payload), &event); err != nil {
+				continue
+			}
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// PublishCancel 通知所有实例取消消息的生成
+func (c *ConversationCache) PublishCancel(ctx context.Context, messageID int64) error {
+	return c.rdb.Publish(ctx, cancelChannel, strconv.FormatInt(messageID, 10)).Err()
+}
+
+// SubscribeCancel 订阅取消生成的通知，返回需要取消的消息 ID
+func (c *ConversationCache) SubscribeCancel(ctx context.Context) (<-chan int64, error) {
+	payloads, err := c.subscribe(ctx, cancelChannel)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan int64, 10)
+	go func() {
+		defer close(ch)
+		for payload := range payloads {
+			id, err := strconv.ParseInt(payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// subscribe 订阅 channel，ctx 结束的时候取消订阅并关闭返回的 channel
+func (c *ConversationCache) subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	subscriber, ok := c.rdb.(interface {
+		Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	})
+	if !ok {
+		return nil, errors.New("redis 客户端不支持订阅")
+	}
+	pubsub := subscriber.Subscribe(ctx, channel)
+	// 确认订阅成功
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+	ch := make(chan string, 10)
+	go func() {
+		defer close(ch)
+		defer pubsub.Close()
+		msgs := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Delete 删除对话缓存的消息
+func (c *ConversationCache) Delete(ctx context.Context, sn string) error {
+	return c.rdb.Del(ctx, c.key(sn)).Err()
+}
+
+func (c *ConversationCache) streamKey(messageID int64) string {
+	return fmt.Sprintf("conversation:stream:%d", messageID)
+}
+
+func (c *ConversationCache) eventKey(uid string) string {
+	return fmt.Sprintf("conversation:events:%s", uid)
+}
+
 func (c *ConversationCache) key(sn string) string {
 	return fmt.Sprintf(NameSpace, sn)
 }
 
 type Message struct {
+	ID            int64  `json:"id"`
 	Role          int32  `json:"role"`
 	Content       string `json:"content"`
 	ReasonContent string `json:"reason_content"`
 }
+
+type StreamEvent struct {
+	Seq              int64  `json:"seq"`
+	Content          string `json:"content,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	Done             bool   `json:"done,omitempty"`
+	Error            string `json:"error,omitempty"`
+	Cancelled        bool   `json:"cancelled,omitempty"`
+	PromptTokens     int64  `json:"prompt_tokens,omitempty"`
+	CompletionTokens int64  `json:"completion_tokens,omitempty"`
+	TotalTokens      int64  `json:"total_tokens,omitempty"`
+}
+
+type Event struct {
+	Type  string `json:"type"`
+	Sn    string `json:"sn"`
+	Title string `json:"title"`
+}
@@ -16,14 +16,19 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"slices"
+	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/cache"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
 )
 
 type ConversationRepo struct {
@@ -36,7 +41,14 @@ func NewConversationRepo(d *dao.ConversationDao, c *cache.ConversationCache) *Co
 }
 
 func (repo *ConversationRepo) Create(ctx context.Context, conversation domain.Conversation) (string, error) {
-	res, err := repo.dao.Create(ctx, dao.Conversation{Title: conversation.Title, Uid: conversation.Uid})
+	res, err := repo.dao.Create(ctx, dao.Conversation{
+		Title:            conversation.Title,
+		Uid:              conversation.Uid,
+		PromptID:         conversation.PromptID,
+		BizID:            conversation.BizID,
+		ContextConfig:    repo.toDaoContextConfig(conversation.Context),
+		DisableAutoTitle: conversation.DisableAutoTitle,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -44,19 +56,169 @@ func (repo *ConversationRepo) Create(ctx context.Context, conversation domain.Co
 	return res.Sn, nil
 }
 
-func (repo *ConversationRepo) AddMessages(ctx context.Context, sn string, messages []domain.Message) error {
-	err := repo.dao.AddMessages(ctx, repo.toDaoMessage(sn, messages))
+// AddMessages 保存消息，返回的消息带上了数据库生成的 ID
+func (repo *ConversationRepo) AddMessages(ctx context.Context, sn string, messages []domain.Message) ([]domain.Message, error) {
+	res, err := repo.dao.AddMessages(ctx, repo.toDaoMessage(sn, messages))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	domainMessages := repo.toDomainMessage(res)
+	err = repo.cache.AddMessages(ctx, sn, repo.toCacheMessage(domainMessages))
+	if err != nil {
+		elog.Error(fmt.Sprintf("写入redis 失败: %s", sn), elog.Any("err", err))
+	}
+	return domainMessages, nil
+}
+
+// StartMessage 流式生成开始的时候先保存一条空的消息，拿到消息的 ID。
+// 这个时候还没有内容，所以不写缓存，等到 FinishMessage 的时候再写
+func (repo *ConversationRepo) StartMessage(ctx context.Context, sn string, msg domain.Message) (domain.Message, error) {
+	res, err := repo.dao.AddMessages(ctx, repo.toDaoMessage(sn, []domain.Message{msg}))
+	if err != nil {
+		return domain.Message{}, err
 	}
+	return repo.toDomainMessage(res)[0], nil
+}
 
-	err = repo.cache.AddMessages(ctx, sn, repo.toCacheMessage(messages))
+// FinishMessage 保存流式生成的完整内容
+func (repo *ConversationRepo) FinishMessage(ctx context.Context, sn string, msg domain.Message) error {
+	err := repo.dao.FinishMessage(ctx, repo.toDaoMessage(sn, []domain.Message{msg})[0])
+	if err != nil {
+		return err
+	}
+	err = repo.cache.AddMessages(ctx, sn, repo.toCacheMessage([]domain.Message{msg}))
 	if err != nil {
 		elog.Error(fmt.Sprintf("写入redis 失败: %s", sn), elog.Any("err", err))
 	}
 	return nil
 }
 
+func (repo *ConversationRepo) AddStreamEvent(ctx context.Context, event domain.StreamEvent) error {
+	se := cache.StreamEvent{
+		Seq:              event.Seq,
+		Content:          event.Content,
+		ReasoningContent: event.ReasoningContent,
+		Done:             event.Done,
+		Cancelled:        event.Cancelled,
+		PromptTokens:     event.Usage.PromptTokens,
+		CompletionTokens: event.Usage.CompletionTokens,
+		TotalTokens:      event.Usage.TotalTokens,
+	}
+	if event.Error != nil {
+		se.Error = event.Error.Error()
+	}
+	return repo.cache.AddStreamEvent(ctx, event.MessageID, se)
+}
+
+func (repo *ConversationRepo) ReadStreamEvents(ctx context.Context, messageID int64, afterSeq int64, block time.Duration) ([]domain.StreamEvent, error) {
+	events, err := repo.cache.ReadStreamEvents(ctx, messageID, afterSeq, block)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(events, func(idx int, src cache.StreamEvent) domain.StreamEvent {
+		res := domain.StreamEvent{
+			MessageID:        messageID,
+			Seq:              src.Seq,
+			Content:          src.Content,
+			ReasoningContent: src.ReasoningContent,
+			Done:             src.Done,
+			Cancelled:        src.Cancelled,
+			Usage: domain.Usage{
+				PromptTokens:     src.PromptTokens,
+				CompletionTokens: src.CompletionTokens,
+				TotalTokens:      src.TotalTokens,
+			},
+		}
+		if src.Error != "" {
+			res.Error = errors.New(src.Error)
+		}
+		return res
+	}), nil
+}
+
+func (repo *ConversationRepo) PublishCancel(ctx context.Context, messageID int64) error {
+	return repo.cache.PublishCancel(ctx, messageID)
+}
+
+func (repo *ConversationRepo) SubscribeCancel(ctx context.Context) (<-chan int64, error) {
+	return repo.cache.SubscribeCancel(ctx)
+}
+
+// GetBySn 根据 sn 查找对话，对话不存在的时候返回零值
+func (repo *ConversationRepo) GetBySn(ctx context.Context, sn string) (domain.Conversation, error) {
+	res, err := repo.dao.GetBySn(ctx, sn)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Conversation{Sn: sn}, nil
+	}
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	return domain.Conversation{
+		Sn:               res.Sn,
+		Uid:              res.Uid,
+		Title:            res.Title,
+		PromptID:         res.PromptID,
+		BizID:            res.BizID,
+		Context:          repo.toDomainContextConfig(res.ContextConfig),
+		Summary:          res.Summary,
+		SummarizedID:     res.SummarizedID,
+		DisableAutoTitle: res.DisableAutoTitle,
+		Archived:         res.Archived,
+		Pinned:           res.Pinned,
+		Ctime:            res.Ctime,
+		Utime:            res.Utime,
+	}, nil
+}
+
+func (repo *ConversationRepo) UpdateTitle(ctx context.Context, sn string, title string) error {
+	return repo.dao.UpdateTitle(ctx, sn, title)
+}
+
+func (repo *ConversationRepo) PublishEvent(ctx context.Context, uid string, event domain.ConversationEvent) error {
+	return repo.cache.PublishEvent(ctx, uid, cache.Event{
+		Type:  string(event.Type),
+		Sn:    event.Sn,
+		Title: event.Title,
+	})
+}
+
+func (repo *ConversationRepo) SubscribeEvents(ctx context.Context, uid string) (<-chan domain.ConversationEvent, error) {
+	events, err := repo.cache.SubscribeEvents(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan domain.ConversationEvent)
+	go func() {
+		defer close(ch)
+		for event := range events {
+			select {
+			case ch <- domain.ConversationEvent{
+				Type:  domain.ConversationEventType(event.Type),
+				Sn:    event.Sn,
+				Title: event.Title,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (repo *ConversationRepo) UpdateSummary(ctx context.Context, sn string, summary string, summarizedID int64) error {
+	return repo.dao.UpdateSummary(ctx, sn, summary, summarizedID)
+}
+
+// ListByCtime 按照创建时间查询用户的对话，end 为 0 表示不限制结束时间
+func (repo *ConversationRepo) ListByCtime(ctx context.Context, uid string, start int64, end int64, limit int) ([]domain.Conversation, error) {
+	conversations, err := repo.dao.ListByCtime(ctx, uid, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	return repo.toConversation(conversations), nil
+}
+
 // GetByUid 根据 uid 获取对话列表
 func (repo *ConversationRepo) GetByUid(ctx context.Context, uid string, limit int64, offset int64) ([]domain.Conversation, error) {
 	conversation, err := repo.dao.GetByUid(ctx, uid, limit, offset)
@@ -66,25 +228,199 @@ func (repo *ConversationRepo) GetByUid(ctx context.Context, uid string, limit in
 	return repo.toConversation(conversation), nil
 }
 
-// GetHistoryMessageList 用来获取历史消息列表
+// List 查询用户的对话列表
+func (repo *ConversationRepo) List(ctx context.Context, q domain.ConversationQuery) ([]domain.Conversation, error) {
+	conversations, err := repo.dao.List(ctx, dao.ConversationQuery{
+		Uid:        q.Uid,
+		Archived:   q.Archived,
+		PinnedOnly: q.PinnedOnly,
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo.toConversation(conversations), nil
+}
+
+func (repo *ConversationRepo) Rename(ctx context.Context, sn string, uid string, title string) error {
+	return repo.update(ctx, sn, uid, map[string]any{"title": title})
+}
+
+func (repo *ConversationRepo) SetArchived(ctx context.Context, sn string, uid string, archived bool) error {
+	return repo.update(ctx, sn, uid, map[string]any{"archived": archived})
+}
+
+func (repo *ConversationRepo) SetPinned(ctx context.Context, sn string, uid string, pinned bool) error {
+	return repo.update(ctx, sn, uid, map[string]any{"pinned": pinned})
+}
+
+// Delete 软删除对话，消息保留在数据库里面，缓存里面的消息等它自己过期
+func (repo *ConversationRepo) Delete(ctx context.Context, sn string, uid string) error {
+	return repo.update(ctx, sn, uid, map[string]any{"deleted": true})
+}
+
+// Purge 彻底删除对话、消息以及缓存
+func (repo *ConversationRepo) Purge(ctx context.Context, sn string, uid string) error {
+	found, err := repo.dao.Purge(ctx, sn, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errs.ErrConversationNotFound, sn)
+	}
+	return repo.cache.Delete(ctx, sn)
+}
+
+func (repo *ConversationRepo) update(ctx context.Context, sn string, uid string, fields map[string]any) error {
+	found, err := repo.dao.Update(ctx, sn, uid, fields)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errs.ErrConversationNotFound, sn)
+	}
+	return nil
+}
+
+// GetHistoryMessageList 用来获取当前分支上最近的 limit 条历史消息，按照时间先后排列
 func (repo *ConversationRepo) GetHistoryMessageList(ctx context.Context, sn string, limit int64, offset int64) ([]domain.Message, error) {
 	messageCache, err := repo.cache.GetMessage(ctx, sn, limit, offset)
-	if err != nil {
-		messages, err := repo.dao.GetMessages(ctx, sn, limit, offset)
+	if err != nil || len(messageCache) == 0 {
+		path, err := repo.GetActivePath(ctx, sn)
 		if err != nil {
 			return []domain.Message{}, err
 		}
-
-		domainMessages := repo.toDomainMessage(messages)
+		end := max(len(path)-int(offset), 0)
+		domainMessages := path[max(end-int(limit), 0):end]
 		err = repo.cache.AddMessages(ctx, sn, repo.toCacheMessage(domainMessages))
 		if err != nil {
 			elog.Error(fmt.Sprintf("消息写入redis 失败: %s", sn), elog.Any("err", err))
 		}
-		return repo.toDomainMessage(messages), nil
+		return domainMessages, nil
 	}
 	return repo.toMessage(messageCache), nil
 }
 
+// GetActivePath 返回当前分支上的全部消息，按照时间先后排列
+func (repo *ConversationRepo) GetActivePath(ctx context.Context, sn string) ([]domain.Message, error) {
+	conversation, all, err := repo.getTree(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	return repo.activePath(conversation.LeafID, all), nil
+}
+
+// GetMessage 根据 ID 查找消息，同时返回消息所属对话的 sn
+func (repo *ConversationRepo) GetMessage(ctx context.Context, id int64) (domain.Message, string, error) {
+	msg, err := repo.dao.GetMessageByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Message{}, "", fmt.Errorf("%w: 消息 %d 不存在", errs.ErrInvalidParam, id)
+	}
+	if err != nil {
+		return domain.Message{}, "", err
+	}
+	return repo.toDomainMessage([]dao.Message{msg})[0], msg.Sn, nil
+}
+
+// AddBranch 从 parentID 开始创建新的分支，并且切换到这个分支
+func (repo *ConversationRepo) AddBranch(ctx context.Context, sn string, parentID int64, messages []domain.Message) ([]domain.Message, error) {
+	conversation, all, err := repo.getTree(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	path := domain.ActivePath(all, parentID)
+	if parentID > 0 && len(path) == 0 {
+		return nil, fmt.Errorf("%w: 消息 %d 不在对话 %s 里面", errs.ErrInvalidParam, parentID, sn)
+	}
+	res, err := repo.dao.AddBranch(ctx, parentID, repo.toDaoMessage(sn, messages), repo.needResetSummary(conversation, path))
+	if err != nil {
+		return nil, err
+	}
+	domainMessages := repo.toDomainMessage(res)
+	repo.resetCache(ctx, sn, append(path, domainMessages...))
+	return domainMessages, nil
+}
+
+// LinkLegacyMessages 引入分支之前的消息没有 parent_id，在这些消息上创建分支之前需要先把它们串起来
+func (repo *ConversationRepo) LinkLegacyMessages(ctx context.Context, sn string) error {
+	return repo.dao.LinkLegacyMessages(ctx, sn)
+}
+
+// SetLeaf 切换到以 leafID 结尾的分支，返回新的分支上的全部消息
+func (repo *ConversationRepo) SetLeaf(ctx context.Context, sn string, leafID int64) ([]domain.Message, error) {
+	conversation, all, err := repo.getTree(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	return repo.setLeaf(ctx, conversation, all, leafID)
+}
+
+// SwitchBranch 切换到 messageID 所在的分支，如果 messageID 后面还有消息，那么切换到其中最新的一条
+func (repo *ConversationRepo) SwitchBranch(ctx context.Context, sn string, messageID int64) ([]domain.Message, error) {
+	conversation, all, err := repo.getTree(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	return repo.setLeaf(ctx, conversation, all, domain.LatestLeaf(all, messageID))
+}
+
+func (repo *ConversationRepo) setLeaf(ctx context.Context, conversation dao.Conversation, all []domain.Message, leafID int64) ([]domain.Message, error) {
+	path := domain.ActivePath(all, leafID)
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: 消息 %d 不在对话 %s 里面", errs.ErrInvalidParam, leafID, conversation.Sn)
+	}
+	err := repo.dao.SetLeaf(ctx, conversation.Sn, leafID, repo.needResetSummary(conversation, path))
+	if err != nil {
+		return nil, err
+	}
+	repo.resetCache(ctx, conversation.Sn, path)
+	return path, nil
+}
+
+// getTree 返回对话以及它全部的消息，对话不存在的时候返回零值
+func (repo *ConversationRepo) getTree(ctx context.Context, sn string) (dao.Conversation, []domain.Message, error) {
+	conversation, err := repo.dao.GetBySn(ctx, sn)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return dao.Conversation{}, nil, err
+	}
+	conversation.Sn = sn
+	messages, err := repo.dao.GetAllMessages(ctx, sn)
+	if err != nil {
+		return dao.Conversation{}, nil, err
+	}
+	return conversation, repo.toDomainMessage(messages), nil
+}
+
+func (repo *ConversationRepo) activePath(leafID int64, all []domain.Message) []domain.Message {
+	if leafID > 0 {
+		return domain.ActivePath(all, leafID)
+	}
+	// 引入分支之前的对话，所有的消息都在一条线上
+	for i := range all {
+		all[i].Siblings = 1
+	}
+	return all
+}
+
+// needResetSummary 摘要覆盖的最后一条消息不在新的分支上，说明摘要里面有别的分支的内容
+func (repo *ConversationRepo) needResetSummary(conversation dao.Conversation, path []domain.Message) bool {
+	return conversation.SummarizedID > 0 && !slices.ContainsFunc(path, func(msg domain.Message) bool {
+		return msg.ID == conversation.SummarizedID
+	})
+}
+
+func (repo *ConversationRepo) resetCache(ctx context.Context, sn string, path []domain.Message) {
+	err := repo.cache.Reset(ctx, sn, repo.toCacheMessage(path))
+	if err != nil {
+		// 缓存里面是旧分支的消息，删掉之后会从数据库重新加载
+		elog.Error("重置对话缓存失败", elog.String("sn", sn), elog.FieldErr(err))
+		if err = repo.cache.Delete(ctx, sn); err != nil {
+			elog.Error("删除对话缓存失败", elog.String("sn", sn), elog.FieldErr(err))
+		}
+	}
+}
+
 func (repo *ConversationRepo) GetMessageList(ctx context.Context, sn string, limit int64, offset int64) ([]domain.Message, error) {
 	messages, err := repo.dao.GetMessages(ctx, sn, limit, offset)
 	if err != nil {
@@ -96,11 +432,17 @@ func (repo *ConversationRepo) GetMessageList(ctx context.Context, sn string, lim
 func (repo *ConversationRepo) toDaoMessage(sn string, messages []domain.Message) []dao.Message {
 	return slice.Map[domain.Message, dao.Message](messages, func(idx int, src domain.Message) dao.Message {
 		return dao.Message{
-			ID:            src.ID,
-			Sn:            sn,
-			Role:          src.Role,
-			Content:       src.Content,
-			ReasonContent: src.ReasoningContent,
+			ID:              src.ID,
+			Sn:              sn,
+			Role:            src.Role,
+			Content:         src.Content,
+			ReasonContent:   src.ReasoningContent,
+			PromptVersionID: src.PromptVersionID,
+			Provider:        src.Provider,
+			Model:           src.Model,
+			Latency:         src.Latency,
+			Tokens:          src.Tokens,
+			Status:          int8(src.Status),
 		}
 	})
 }
@@ -112,6 +454,13 @@ func (repo *ConversationRepo) toDomainMessage(messages []dao.Message) []domain.M
 			Role:             src.Role,
 			Content:          src.Content,
 			ReasoningContent: src.ReasonContent,
+			PromptVersionID:  src.PromptVersionID,
+			Provider:         src.Provider,
+			Model:            src.Model,
+			Latency:          src.Latency,
+			Tokens:           src.Tokens,
+			ParentID:         src.ParentID,
+			Status:           domain.MessageStatus(src.Status),
 		}
 	})
 }
@@ -119,6 +468,7 @@ func (repo *ConversationRepo) toDomainMessage(messages []dao.Message) []domain.M
 func (repo *ConversationRepo) toCacheMessage(messages []domain.Message) []cache.Message {
 	return slice.Map[domain.Message, cache.Message](messages, func(idx int, src domain.Message) cache.Message {
 		return cache.Message{
+			ID:            src.ID,
 			Role:          src.Role,
 			Content:       src.Content,
 			ReasonContent: src.ReasoningContent,
@@ -129,6 +479,7 @@ func (repo *ConversationRepo) toCacheMessage(messages []domain.Message) []cache.
 func (repo *ConversationRepo) toMessage(messages []cache.Message) []domain.Message {
 	return slice.Map[cache.Message, domain.Message](messages, func(idx int, src cache.Message) domain.Message {
 		return domain.Message{
+			ID:               src.ID,
 			Role:             src.Role,
 			Content:          src.Content,
 			ReasoningContent: src.ReasonContent,
@@ -136,11 +487,59 @@ func (repo *ConversationRepo) toMessage(messages []cache.Message) []domain.Messa
 	})
 }
 
+// contextConfig 对话上下文配置的存储格式
+type contextConfig struct {
+	Strategy       string `json:"strategy,omitempty"`
+	WindowTokens   int64  `json:"window_tokens,omitempty"`
+	ReservedTokens int64  `json:"reserved_tokens,omitempty"`
+	LastN          int    `json:"last_n,omitempty"`
+	MaxHistory     int    `json:"max_history,omitempty"`
+}
+
+func (repo *ConversationRepo) toDaoContextConfig(cfg domain.ContextConfig) string {
+	if cfg.IsZero() {
+		return ""
+	}
+	val, _ := json.Marshal(contextConfig{
+		Strategy:       string(cfg.Strategy),
+		WindowTokens:   cfg.WindowTokens,
+		ReservedTokens: cfg.ReservedTokens,
+		LastN:          cfg.LastN,
+		MaxHistory:     cfg.MaxHistory,
+	})
+	return string(val)
+}
+
+func (repo *ConversationRepo) toDomainContextConfig(val string) domain.ContextConfig {
+	var cfg contextConfig
+	if val == "" {
+		return domain.ContextConfig{}
+	}
+	if err := json.Unmarshal([]byte(val), &cfg); err != nil {
+		elog.Error("解析上下文配置失败", elog.String("config", val), elog.FieldErr(err))
+		return domain.ContextConfig{}
+	}
+	return domain.ContextConfig{
+		Strategy:       domain.ContextStrategy(cfg.Strategy),
+		WindowTokens:   cfg.WindowTokens,
+		ReservedTokens: cfg.ReservedTokens,
+		LastN:          cfg.LastN,
+		MaxHistory:     cfg.MaxHistory,
+	}
+}
+
 func (repo *ConversationRepo) toConversation(conversations []dao.Conversation) []domain.Conversation {
 	return slice.Map(conversations, func(idx int, src dao.Conversation) domain.Conversation {
 		return domain.Conversation{
-			Sn:    strconv.Itoa(int(src.ID)),
-			Title: src.Title,
+			Sn:               src.Sn,
+			Uid:              src.Uid,
+			Title:            src.Title,
+			PromptID:         src.PromptID,
+			DisableAutoTitle: src.DisableAutoTitle,
+			Archived:         src.Archived,
+			Pinned:           src.Pinned,
+			Ctime:            src.Ctime,
+			Utime:            src.Utime,
 		}
 	})
 }
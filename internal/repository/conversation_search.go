@@ -0,0 +1,148 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+const (
+	// 每个对话最多返回的命中消息
+	maxMatchesPerConversation = 3
+	// 命中位置前后保留的字数
+	snippetRadius = 30
+)
+
+// Search 基于 MySQL 全文索引搜索用户的对话
+func (repo *ConversationRepo) Search(ctx context.Context, q domain.ConversationSearchQuery) ([]domain.ConversationSearchResult, error) {
+	titleHits, err := repo.dao.SearchConversations(ctx, q.Uid, q.Keyword, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	// 一个对话里面可能命中很多条消息，多取一些，保证能凑够 limit 个对话
+	messageHits, err := repo.dao.SearchMessages(ctx, q.Uid, q.Keyword, q.Limit*maxMatchesPerConversation)
+	if err != nil {
+		return nil, err
+	}
+
+	conversations := make(map[string]domain.Conversation, len(titleHits))
+	for _, c := range titleHits {
+		conversations[c.Sn] = repo.toConversation([]dao.Conversation{c})[0]
+	}
+	var missing []string
+	for _, msg := range messageHits {
+		if _, ok := conversations[msg.Sn]; !ok && !slices.Contains(missing, msg.Sn) {
+			missing = append(missing, msg.Sn)
+		}
+	}
+	if len(missing) > 0 {
+		others, err := repo.dao.GetBySns(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range others {
+			conversations[c.Sn] = repo.toConversation([]dao.Conversation{c})[0]
+		}
+	}
+
+	messages := make(map[string][]domain.Message, len(conversations))
+	for _, msg := range messageHits {
+		messages[msg.Sn] = append(messages[msg.Sn], repo.toDomainMessage([]dao.Message{msg})...)
+	}
+	return buildSearchResults(q, conversations, messages), nil
+}
+
+// buildSearchResults 生成高亮的片段，按照最后活跃的时间倒序排列。
+// messages 是每个对话命中的消息，最新的在前面
+func buildSearchResults(q domain.ConversationSearchQuery, conversations map[string]domain.Conversation,
+	messages map[string][]domain.Message) []domain.ConversationSearchResult {
+	res := make([]domain.ConversationSearchResult, 0, len(conversations))
+	for sn, c := range conversations {
+		result := domain.ConversationSearchResult{Sn: sn, Title: c.Title, Utime: c.Utime}
+		result.TitleHighlight, _ = domain.Snippet(c.Title, q.Keyword, len([]rune(c.Title)))
+		for _, msg := range messages[sn] {
+			if len(result.Matches) == maxMatchesPerConversation {
+				break
+			}
+			snippet, ok := domain.Snippet(msg.Content, q.Keyword, snippetRadius)
+			if !ok {
+				continue
+			}
+			result.Matches = append(result.Matches, domain.MessageMatch{MessageID: msg.ID, Role: msg.Role, Snippet: snippet})
+		}
+		if result.TitleHighlight == "" && len(result.Matches) == 0 {
+			continue
+		}
+		res = append(res, result)
+	}
+	slices.SortFunc(res, func(a, b domain.ConversationSearchResult) int {
+		return cmp.Or(cmp.Compare(b.Utime, a.Utime), cmp.Compare(a.Sn, b.Sn))
+	})
+	if len(res) > q.Limit {
+		res = res[:q.Limit]
+	}
+	return res
+}
+
+// MemoryConversationSearcher 在内存里面搜索，用于测试或者数据量很小的场景
+type MemoryConversationSearcher struct {
+	mu            sync.RWMutex
+	conversations map[string]domain.Conversation
+}
+
+func NewMemoryConversationSearcher() *MemoryConversationSearcher {
+	return &MemoryConversationSearcher{conversations: make(map[string]domain.Conversation)}
+}
+
+// Save 保存对话以及 conversation.Messages 里面的消息，已经存在的对话会被覆盖
+func (s *MemoryConversationSearcher) Save(conversation domain.Conversation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations[conversation.Sn] = conversation
+}
+
+func (s *MemoryConversationSearcher) Delete(sn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conversations, sn)
+}
+
+func (s *MemoryConversationSearcher) Search(ctx context.Context, q domain.ConversationSearchQuery) ([]domain.ConversationSearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	conversations := make(map[string]domain.Conversation)
+	messages := make(map[string][]domain.Message)
+	for sn, c := range s.conversations {
+		if c.Uid != q.Uid {
+			continue
+		}
+		conversations[sn] = c
+		hits := slice.FilterMap(c.Messages, func(idx int, src domain.Message) (domain.Message, bool) {
+			return src, domain.ContainsFold(src.Content, q.Keyword)
+		})
+		slices.SortFunc(hits, func(a, b domain.Message) int {
+			return cmp.Compare(b.ID, a.ID)
+		})
+		messages[sn] = hits
+	}
+	return buildSearchResults(q, conversations, messages), nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
+)
+
+func (repo *ConversationRepo) CreateShare(ctx context.Context, share domain.ConversationShare) (domain.ConversationShare, error) {
+	res, err := repo.dao.CreateShare(ctx, dao.ConversationShare{
+		Token:            share.Token,
+		Sn:               share.Sn,
+		Uid:              share.Uid,
+		Title:            share.Title,
+		MessageID:        share.MessageID,
+		IncludeReasoning: share.IncludeReasoning,
+	})
+	if err != nil {
+		return domain.ConversationShare{}, err
+	}
+	return repo.toDomainShare(res), nil
+}
+
+// GetShare 查询没有撤销的分享，不存在的时候返回 ErrShareNotFound
+func (repo *ConversationRepo) GetShare(ctx context.Context, token string) (domain.ConversationShare, error) {
+	res, err := repo.dao.GetShare(ctx, token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.ConversationShare{}, fmt.Errorf("%w: %s", errs.ErrShareNotFound, token)
+	}
+	if err != nil {
+		return domain.ConversationShare{}, err
+	}
+	return repo.toDomainShare(res), nil
+}
+
+func (repo *ConversationRepo) ListShares(ctx context.Context, sn string, uid string) ([]domain.ConversationShare, error) {
+	res, err := repo.dao.ListShares(ctx, sn, uid)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.ConversationShare) domain.ConversationShare {
+		return repo.toDomainShare(src)
+	}), nil
+}
+
+func (repo *ConversationRepo) RevokeShare(ctx context.Context, token string, uid string) error {
+	found, err := repo.dao.RevokeShare(ctx, token, uid)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", errs.ErrShareNotFound, token)
+	}
+	return nil
+}
+
+// GetPathTo 返回从第一条消息到 messageID 的消息，不管 messageID 是不是在当前的分支上
+func (repo *ConversationRepo) GetPathTo(ctx context.Context, sn string, messageID int64) ([]domain.Message, error) {
+	conversation, all, err := repo.getTree(ctx, sn)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.LeafID > 0 {
+		return domain.ActivePath(all, messageID), nil
+	}
+	// 引入分支之前的对话，所有的消息都在一条线上
+	return repo.activePath(0, slice.FilterDelete(all, func(idx int, src domain.Message) bool {
+		return src.ID > messageID
+	})), nil
+}
+
+func (repo *ConversationRepo) toDomainShare(src dao.ConversationShare) domain.ConversationShare {
+	return domain.ConversationShare{
+		ID:               src.ID,
+		Token:            src.Token,
+		Sn:               src.Sn,
+		Uid:              src.Uid,
+		Title:            src.Title,
+		MessageID:        src.MessageID,
+		IncludeReasoning: src.IncludeReasoning,
+		Ctime:            src.Ctime,
+	}
+}
@@ -16,10 +16,15 @@ package dao
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ConversationDao struct {
@@ -43,11 +48,20 @@ func (dao *ConversationDao) Create(ctx context.Context, c Conversation) (Convers
 }
 
 func (dao *ConversationDao) GetByUid(ctx context.Context, uid string, limit int64, offset int64) ([]Conversation, error) {
+	return dao.List(ctx, ConversationQuery{Uid: uid, Limit: limit, Offset: offset})
+}
+
+// List 查询用户的对话，置顶的在前面，其余的按照最后活跃的时间倒序排列
+func (dao *ConversationDao) List(ctx context.Context, q ConversationQuery) ([]Conversation, error) {
 	var conversations []Conversation
-	err := dao.db.WithContext(ctx).Model(&Conversation{}).Where("uid = ?", uid).
-		Order("id DESC").
-		Offset(int(offset)).
-		Limit(int(limit)).
+	db := dao.db.WithContext(ctx).Model(&Conversation{}).
+		Where("uid = ? AND deleted = ? AND archived = ?", q.Uid, false, q.Archived)
+	if q.PinnedOnly {
+		db = db.Where("pinned = ?", true)
+	}
+	err := db.Order("pinned DESC").Order("utime DESC").Order("id DESC").
+		Offset(int(q.Offset)).
+		Limit(int(q.Limit)).
 		Find(&conversations).Error
 	if err != nil {
 		return conversations, err
@@ -55,6 +69,17 @@ func (dao *ConversationDao) GetByUid(ctx context.Context, uid string, limit int6
 	return conversations, nil
 }
 
+// ListByCtime 按照创建时间查询用户的对话，end 为 0 表示不限制结束时间
+func (dao *ConversationDao) ListByCtime(ctx context.Context, uid string, start int64, end int64, limit int) ([]Conversation, error) {
+	var conversations []Conversation
+	db := dao.db.WithContext(ctx).Where("uid = ? AND deleted = ? AND ctime >= ?", uid, false, start)
+	if end > 0 {
+		db = db.Where("ctime < ?", end)
+	}
+	err := db.Order("ctime ASC").Order("id ASC").Limit(limit).Find(&conversations).Error
+	return conversations, err
+}
+
 func (dao *ConversationDao) GetById(ctx context.Context, id int64) (Conversation, error) {
 	var conversation Conversation
 	err := dao.db.WithContext(ctx).Model(&Conversation{}).Where("id = ?", id).First(&conversation).Error
@@ -64,6 +89,13 @@ func (dao *ConversationDao) GetById(ctx context.Context, id int64) (Conversation
 	return conversation, nil
 }
 
+// GetBySn 已经删除的对话当作不存在
+func (dao *ConversationDao) GetBySn(ctx context.Context, sn string) (Conversation, error) {
+	var conversation Conversation
+	err := dao.db.WithContext(ctx).Where("sn = ? AND deleted = ?", sn, false).First(&conversation).Error
+	return conversation, err
+}
+
 func (dao *ConversationDao) GetMessages(ctx context.Context, sn string, limit int64, offset int64) ([]Message, error) {
 	var messages []Message
 	err := dao.db.WithContext(ctx).Where("sn = ?", sn).
@@ -77,33 +109,283 @@ func (dao *ConversationDao) GetMessages(ctx context.Context, sn string, limit in
 	return messages, nil
 }
 
-func (dao *ConversationDao) AddMessages(ctx context.Context, messages []Message) error {
+// GetAllMessages 按照 id 升序返回对话的全部消息，包括不在当前分支上的消息
+func (dao *ConversationDao) GetAllMessages(ctx context.Context, sn string) ([]Message, error) {
+	var messages []Message
+	err := dao.db.WithContext(ctx).Where("sn = ?", sn).Order("id ASC").Find(&messages).Error
+	return messages, err
+}
+
+func (dao *ConversationDao) GetMessageByID(ctx context.Context, id int64) (Message, error) {
+	var message Message
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&message).Error
+	return message, err
+}
+
+// AddMessages 把消息依次追加到当前分支的末尾，同时更新对话最后活跃的时间
+func (dao *ConversationDao) AddMessages(ctx context.Context, messages []Message) ([]Message, error) {
+	if len(messages) == 0 {
+		return messages, nil
+	}
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		conversation, err := dao.lockConversation(tx, messages[0].Sn)
+		if err != nil {
+			return err
+		}
+		parentID, err := dao.currentLeaf(tx, conversation, messages[0].Sn)
+		if err != nil {
+			return err
+		}
+		return dao.appendMessages(tx, parentID, messages, map[string]any{})
+	})
+	return messages, err
+}
+
+// FinishMessage 流式生成结束之后写入完整的内容
+func (dao *ConversationDao) FinishMessage(ctx context.Context, msg Message) error {
+	return dao.db.WithContext(ctx).Model(&Message{}).Where("id = ?", msg.ID).Updates(map[string]any{
+		"content":        msg.Content,
+		"reason_content": msg.ReasonContent,
+		"latency":        msg.Latency,
+		"tokens":         msg.Tokens,
+		"status":         msg.Status,
+		"utime":          time.Now().Unix(),
+	}).Error
+}
+
+// AddBranch 从 parentID 开始创建一个新的分支，parentID 为 0 表示从第一条消息开始分叉。
+// resetSummary 为 true 的时候清空摘要，因为摘要里面有不在新分支上的消息
+func (dao *ConversationDao) AddBranch(ctx context.Context, parentID int64, messages []Message, resetSummary bool) ([]Message, error) {
+	if len(messages) == 0 {
+		return messages, nil
+	}
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := dao.lockConversation(tx, messages[0].Sn); err != nil {
+			return err
+		}
+		return dao.appendMessages(tx, parentID, messages, dao.summaryFields(resetSummary))
+	})
+	return messages, err
+}
+
+// LinkLegacyMessages 把引入分支之前的消息按照 id 的顺序串起来，并且把最后一条作为当前分支。
+// 已经有当前分支的对话什么也不做
+func (dao *ConversationDao) LinkLegacyMessages(ctx context.Context, sn string) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		conversation, err := dao.lockConversation(tx, sn)
+		if err != nil || conversation.LeafID > 0 {
+			return err
+		}
+		leafID, err := dao.currentLeaf(tx, conversation, sn)
+		if err != nil || leafID == 0 {
+			return err
+		}
+		return tx.Model(&Conversation{}).Where("sn = ?", sn).Update("leaf_id", leafID).Error
+	})
+}
+
+// SetLeaf 切换当前分支
+func (dao *ConversationDao) SetLeaf(ctx context.Context, sn string, leafID int64, resetSummary bool) error {
+	fields := dao.summaryFields(resetSummary)
+	fields["leaf_id"] = leafID
+	return dao.db.WithContext(ctx).Model(&Conversation{}).Where("sn = ?", sn).Updates(fields).Error
+}
+
+// lockConversation 锁住对话，避免并发追加消息的时候出现两个相同的 parent_id。
+// 已经删除的对话不能继续追加消息，返回 ErrConversationNotFound
+func (dao *ConversationDao) lockConversation(tx *gorm.DB, sn string) (Conversation, error) {
+	var conversation Conversation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sn = ?", sn).First(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return conversation, nil
+	}
+	if err == nil && conversation.Deleted {
+		return Conversation{}, fmt.Errorf("%w: %s", errs.ErrConversationNotFound, sn)
+	}
+	return conversation, err
+}
+
+// currentLeaf 返回当前分支的最后一条消息。
+// 引入分支之前的消息没有 parent_id，第一次追加的时候按照 id 的顺序把它们串起来
+func (dao *ConversationDao) currentLeaf(tx *gorm.DB, conversation Conversation, sn string) (int64, error) {
+	if conversation.LeafID > 0 {
+		return conversation.LeafID, nil
+	}
+	var roots []int64
+	err := tx.Model(&Message{}).Where("sn = ? AND parent_id = ?", sn, 0).Order("id ASC").Pluck("id", &roots).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := 1; i < len(roots); i++ {
+		err = tx.Model(&Message{}).Where("id = ?", roots[i]).Update("parent_id", roots[i-1]).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	var latest Message
+	err = tx.Where("sn = ?", sn).Order("id DESC").Limit(1).Find(&latest).Error
+	return latest.ID, err
+}
+
+// appendMessages 消息需要知道上一条消息的 id，所以只能一条一条插入
+func (dao *ConversationDao) appendMessages(tx *gorm.DB, parentID int64, messages []Message, fields map[string]any) error {
 	now := time.Now().Unix()
-	for _, msg := range messages {
-		msg.Ctime = now
-		msg.Utime = now
+	for i := range messages {
+		messages[i].ParentID = parentID
+		messages[i].Ctime = now
+		messages[i].Utime = now
+		if err := tx.Create(&messages[i]).Error; err != nil {
+			return err
+		}
+		parentID = messages[i].ID
 	}
+	fields["leaf_id"] = parentID
+	fields["utime"] = now
+	return tx.Model(&Conversation{}).Where("sn = ?", messages[0].Sn).Updates(fields).Error
+}
 
-	return dao.db.WithContext(ctx).Create(&messages).Error
+func (dao *ConversationDao) summaryFields(resetSummary bool) map[string]any {
+	if !resetSummary {
+		return map[string]any{}
+	}
+	return map[string]any{"summary": "", "summarized_id": 0}
+}
+
+// Update 按照 sn 和 uid 更新对话，返回是否找到了对话。
+// utime 表示最后活跃的时间，所以这里不更新它，避免改个标题对话就跑到了列表最前面
+func (dao *ConversationDao) Update(ctx context.Context, sn string, uid string, fields map[string]any) (bool, error) {
+	db := dao.db.WithContext(ctx).Model(&Conversation{}).
+		Where("sn = ? AND uid = ? AND deleted = ?", sn, uid, false).
+		Session(&gorm.Session{})
+	res := db.Updates(fields)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.RowsAffected > 0, res.Error
+	}
+	// MySQL 在值没有变化的时候返回的影响行数是 0，需要再确认一下对话是否存在
+	var cnt int64
+	err := db.Count(&cnt).Error
+	return cnt > 0, err
+}
+
+// Purge 删除对话、它所有的消息和分享，返回是否找到了对话
+func (dao *ConversationDao) Purge(ctx context.Context, sn string, uid string) (bool, error) {
+	var found bool
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("sn = ? AND uid = ?", sn, uid).Delete(&Conversation{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		found = true
+		if err := tx.Where("sn = ?", sn).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+		return deleteShares(tx, sn)
+	})
+	return found, err
+}
+
+// UpdateTitle 自动生成的标题不算用户的活跃，不修改 utime，否则会改变对话列表的顺序
+func (dao *ConversationDao) UpdateTitle(ctx context.Context, sn string, title string) error {
+	return dao.db.WithContext(ctx).Model(&Conversation{}).Where("sn = ?", sn).Update("title", title).Error
+}
+
+// UpdateSummary 更新对话的摘要，只会往前推进，避免并发的时候旧的摘要覆盖新的摘要
+func (dao *ConversationDao) UpdateSummary(ctx context.Context, sn string, summary string, summarizedID int64) error {
+	return dao.db.WithContext(ctx).Model(&Conversation{}).
+		Where("sn = ? AND summarized_id < ?", sn, summarizedID).
+		Updates(map[string]any{
+			"summary":       summary,
+			"summarized_id": summarizedID,
+			"utime":         time.Now().Unix(),
+		}).Error
 }
 
 type Conversation struct {
-	ID    int64  `gorm:"primary_key;autoIncrement"`
-	Sn    string `gorm:"uniqueIndex;column:sn;size:36"`
-	Uid   string `gorm:"column:uid;index"`
-	Title string `gorm:"column:title"`
-	Ctime int64  `gorm:"column:ctime"`
-	Utime int64  `gorm:"column:utime"`
+	ID  int64  `gorm:"primary_key;autoIncrement"`
+	Sn  string `gorm:"uniqueIndex;column:sn;size:36"`
+	Uid string `gorm:"column:uid;index"`
+	// 全文索引使用 ngram 分词，支持中文
+	Title    string `gorm:"column:title;index:idx_title_fulltext,class:FULLTEXT,option:WITH PARSER ngram"`
+	PromptID int64  `gorm:"column:prompt_id"`
+	BizID    int64  `gorm:"column:biz_id"`
+	// JSON 格式的上下文配置
+	ContextConfig string `gorm:"column:context_config;type:text"`
+	// 早期对话的摘要，SummarizedID 是摘要覆盖到的最后一条消息
+	Summary      string `gorm:"column:summary;type:text"`
+	SummarizedID int64  `gorm:"column:summarized_id"`
+	// 零值表示自动生成标题
+	DisableAutoTitle bool `gorm:"column:disable_auto_title"`
+	// 当前分支的最后一条消息，为 0 表示还没有消息或者是引入分支之前的对话
+	LeafID   int64 `gorm:"column:leaf_id"`
+	Archived bool  `gorm:"column:archived"`
+	Pinned   bool  `gorm:"column:pinned"`
+	// 软删除，彻底删除的时候才会删掉这一行
+	Deleted bool  `gorm:"column:deleted"`
+	Ctime   int64 `gorm:"column:ctime"`
+	// 最后活跃的时间，写入消息的时候也会更新
+	Utime int64 `gorm:"column:utime"`
+}
+
+// SearchConversations 按照标题搜索用户的对话
+func (dao *ConversationDao) SearchConversations(ctx context.Context, uid string, keyword string, limit int) ([]Conversation, error) {
+	var conversations []Conversation
+	err := dao.db.WithContext(ctx).
+		Where("uid = ? AND deleted = ? AND MATCH(title) AGAINST(? IN BOOLEAN MODE)", uid, false, fulltextPhrase(keyword)).
+		Order("utime DESC").
+		Limit(limit).
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// SearchMessages 在用户所有的对话里面搜索消息，最新的消息在前面
+func (dao *ConversationDao) SearchMessages(ctx context.Context, uid string, keyword string, limit int) ([]Message, error) {
+	var messages []Message
+	err := dao.db.WithContext(ctx).Model(&Message{}).
+		Select("messages.*").
+		Joins("JOIN conversations ON conversations.sn = messages.sn").
+		Where("conversations.uid = ? AND conversations.deleted = ?", uid, false).
+		Where("MATCH(messages.content) AGAINST(? IN BOOLEAN MODE)", fulltextPhrase(keyword)).
+		Order("messages.id DESC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (dao *ConversationDao) GetBySns(ctx context.Context, sns []string) ([]Conversation, error) {
+	var conversations []Conversation
+	err := dao.db.WithContext(ctx).Where("sn IN ?", sns).Find(&conversations).Error
+	return conversations, err
+}
+
+// fulltextPhrase 把关键字作为一个短语搜索，避免用户输入的内容被当成布尔模式的操作符
+func fulltextPhrase(keyword string) string {
+	return `"` + strings.ReplaceAll(keyword, `"`, " ") + `"`
+}
+
+type ConversationQuery struct {
+	Uid        string
+	Archived   bool
+	PinnedOnly bool
+	Limit      int64
+	Offset     int64
 }
 
 type Message struct {
-	ID            int64  `gorm:"primary_key;column:id"`
-	Sn            string `gorm:"column:sn;size:36;index"`
-	Content       string `gorm:"column:content"`
-	ReasonContent string `gorm:"column:reason_content"`
-	Role          int32  `gorm:"column:role"`
-	Ctime         int64  `gorm:"column:ctime"`
-	Utime         int64  `gorm:"column:utime"`
+	ID              int64  `gorm:"primary_key;column:id"`
+	Sn              string `gorm:"column:sn;size:36;index"`
+	Content         string `gorm:"column:content;index:idx_content_fulltext,class:FULLTEXT,option:WITH PARSER ngram"`
+	ReasonContent   string `gorm:"column:reason_content"`
+	Role            int32  `gorm:"column:role"`
+	PromptVersionID int64  `gorm:"column:prompt_version_id;index"`
+	Provider        string `gorm:"column:provider;size:32"`
+	Model           string `gorm:"column:model;size:64"`
+	Latency         int64  `gorm:"column:latency"`
+	Tokens          int64  `gorm:"column:tokens"`
+	Feedback        int8   `gorm:"column:feedback"`
+	ParentID        int64  `gorm:"column:parent_id;index"`
+	Status          int8   `gorm:"column:status"`
+	Ctime           int64  `gorm:"column:ctime"`
+	Utime           int64  `gorm:"column:utime"`
 }
 
 func (Conversation) TableName() string {
@@ -115,5 +397,5 @@ func (Message) TableName() string {
 }
 
 func InitConversation(db *gorm.DB) error {
-	return db.AutoMigrate(&Conversation{}, &Message{})
+	return db.AutoMigrate(&Conversation{}, &Message{}, &ConversationShare{}, &MessageFeedback{})
 }
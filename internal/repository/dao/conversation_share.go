@@ -0,0 +1,81 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConversationShare 对话的分享链接，分享的是对话截止到 MessageID 的快照
+type ConversationShare struct {
+	ID    int64  `gorm:"primary_key;autoIncrement"`
+	Token string `gorm:"uniqueIndex;column:token;size:64"`
+	Sn    string `gorm:"column:sn;size:36;index"`
+	Uid   string `gorm:"column:uid;index"`
+	// 分享的时候对话的标题，之后改名不会影响分享出去的内容
+	Title            string `gorm:"column:title"`
+	MessageID        int64  `gorm:"column:message_id"`
+	IncludeReasoning bool   `gorm:"column:include_reasoning"`
+	Revoked          bool   `gorm:"column:revoked"`
+	Ctime            int64  `gorm:"column:ctime"`
+	Utime            int64  `gorm:"column:utime"`
+}
+
+func (ConversationShare) TableName() string {
+	return "conversation_shares"
+}
+
+func (dao *ConversationDao) CreateShare(ctx context.Context, share ConversationShare) (ConversationShare, error) {
+	now := time.Now().Unix()
+	share.Ctime = now
+	share.Utime = now
+	err := dao.db.WithContext(ctx).Create(&share).Error
+	return share, err
+}
+
+// GetShare 查询没有撤销的分享
+func (dao *ConversationDao) GetShare(ctx context.Context, token string) (ConversationShare, error) {
+	var share ConversationShare
+	err := dao.db.WithContext(ctx).Where("token = ? AND revoked = ?", token, false).First(&share).Error
+	return share, err
+}
+
+// ListShares 查询用户在对话上创建的还没有撤销的分享，最新的在前面
+func (dao *ConversationDao) ListShares(ctx context.Context, sn string, uid string) ([]ConversationShare, error) {
+	var shares []ConversationShare
+	err := dao.db.WithContext(ctx).
+		Where("sn = ? AND uid = ? AND revoked = ?", sn, uid, false).
+		Order("id DESC").
+		Find(&shares).Error
+	return shares, err
+}
+
+// RevokeShare 撤销分享，返回是否找到了属于 uid 的分享
+func (dao *ConversationDao) RevokeShare(ctx context.Context, token string, uid string) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&ConversationShare{}).
+		Where("token = ? AND uid = ? AND revoked = ?", token, uid, false).
+		Updates(map[string]any{
+			"revoked": true,
+			"utime":   time.Now().Unix(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func deleteShares(tx *gorm.DB, sn string) error {
+	return tx.Where("sn = ?", sn).Delete(&ConversationShare{}).Error
+}
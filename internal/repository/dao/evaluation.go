@@ -0,0 +1,172 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type EvalDataset struct {
+	ID          int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	Name        string `gorm:"column:name"`
+	Owner       int64  `gorm:"column:owner;index"`
+	Description string `gorm:"column:description"`
+	Ctime       int64  `gorm:"column:ctime"`
+	Utime       int64  `gorm:"column:utime"`
+}
+
+func (EvalDataset) TableName() string {
+	return "eval_datasets"
+}
+
+type EvalCase struct {
+	ID        int64 `gorm:"column:id;primaryKey;autoIncrement"`
+	DatasetID int64 `gorm:"column:dataset_id;index"`
+	// JSON 格式的变量
+	Variables string `gorm:"column:variables;type:text"`
+	Expected  string `gorm:"column:expected;type:text"`
+	// JSON 格式的断言列表
+	Assertions string `gorm:"column:assertions;type:text"`
+	Ctime      int64  `gorm:"column:ctime"`
+	Utime      int64  `gorm:"column:utime"`
+}
+
+func (EvalCase) TableName() string {
+	return "eval_cases"
+}
+
+type EvalRun struct {
+	ID        int64   `gorm:"column:id;primaryKey;autoIncrement"`
+	Uid       int64   `gorm:"column:uid;index"`
+	DatasetID int64   `gorm:"column:dataset_id;index"`
+	VersionID int64   `gorm:"column:version_id;index"`
+	Status    string  `gorm:"column:status;type:varchar(20)"`
+	Total     int64   `gorm:"column:total"`
+	Passed    int64   `gorm:"column:passed"`
+	Score     float64 `gorm:"column:score"`
+	Ctime     int64   `gorm:"column:ctime"`
+	Utime     int64   `gorm:"column:utime"`
+}
+
+func (EvalRun) TableName() string {
+	return "eval_runs"
+}
+
+type EvalResult struct {
+	ID      int64   `gorm:"column:id;primaryKey;autoIncrement"`
+	RunID   int64   `gorm:"column:run_id;index"`
+	CaseID  int64   `gorm:"column:case_id"`
+	Output  string  `gorm:"column:output;type:text"`
+	Passed  bool    `gorm:"column:passed"`
+	Score   float64 `gorm:"column:score"`
+	Reason  string  `gorm:"column:reason;type:text"`
+	Latency int64   `gorm:"column:latency"`
+	Tokens  int64   `gorm:"column:tokens"`
+	Ctime   int64   `gorm:"column:ctime"`
+	Utime   int64   `gorm:"column:utime"`
+}
+
+func (EvalResult) TableName() string {
+	return "eval_results"
+}
+
+type EvaluationDAO struct {
+	db *gorm.DB
+}
+
+func NewEvaluationDAO(db *gorm.DB) *EvaluationDAO {
+	return &EvaluationDAO{db: db}
+}
+
+func (dao *EvaluationDAO) CreateDataset(ctx context.Context, dataset EvalDataset, cases []EvalCase) (int64, error) {
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		dataset.Ctime, dataset.Utime = now, now
+		if err := tx.Create(&dataset).Error; err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			return nil
+		}
+		for i := range cases {
+			cases[i].DatasetID = dataset.ID
+			cases[i].Ctime, cases[i].Utime = now, now
+		}
+		return tx.Create(&cases).Error
+	})
+	return dataset.ID, err
+}
+
+func (dao *EvaluationDAO) AddCases(ctx context.Context, datasetID int64, cases []EvalCase) error {
+	now := time.Now().UnixMilli()
+	for i := range cases {
+		cases[i].DatasetID = datasetID
+		cases[i].Ctime, cases[i].Utime = now, now
+	}
+	return dao.db.WithContext(ctx).Create(&cases).Error
+}
+
+func (dao *EvaluationDAO) GetDataset(ctx context.Context, id int64) (EvalDataset, []EvalCase, error) {
+	var dataset EvalDataset
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&dataset).Error
+	if err != nil {
+		return EvalDataset{}, nil, err
+	}
+	var cases []EvalCase
+	err = dao.db.WithContext(ctx).Where("dataset_id = ?", id).Order("id ASC").Find(&cases).Error
+	return dataset, cases, err
+}
+
+func (dao *EvaluationDAO) CreateRun(ctx context.Context, run EvalRun) (int64, error) {
+	now := time.Now().UnixMilli()
+	run.Ctime, run.Utime = now, now
+	err := dao.db.WithContext(ctx).Create(&run).Error
+	return run.ID, err
+}
+
+// FinishRun 更新评测的最终状态以及汇总得分
+func (dao *EvaluationDAO) FinishRun(ctx context.Context, run EvalRun) error {
+	return dao.db.WithContext(ctx).Model(&EvalRun{}).Where("id = ?", run.ID).Updates(map[string]any{
+		"status": run.Status,
+		"total":  run.Total,
+		"passed": run.Passed,
+		"score":  run.Score,
+		"utime":  time.Now().UnixMilli(),
+	}).Error
+}
+
+func (dao *EvaluationDAO) AddResult(ctx context.Context, result EvalResult) error {
+	now := time.Now().UnixMilli()
+	result.Ctime, result.Utime = now, now
+	return dao.db.WithContext(ctx).Create(&result).Error
+}
+
+func (dao *EvaluationDAO) GetRun(ctx context.Context, id int64) (EvalRun, []EvalResult, error) {
+	var run EvalRun
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&run).Error
+	if err != nil {
+		return EvalRun{}, nil, err
+	}
+	var results []EvalResult
+	err = dao.db.WithContext(ctx).Where("run_id = ?", id).Order("case_id ASC").Find(&results).Error
+	return run, results, err
+}
+
+func InitEvaluationTable(db *gorm.DB) error {
+	return db.AutoMigrate(&EvalDataset{}, &EvalCase{}, &EvalRun{}, &EvalResult{})
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageFeedback 用户对回答的评价，每条消息最多一条
+type MessageFeedback struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	MessageID int64  `gorm:"column:message_id;uniqueIndex"`
+	Sn        string `gorm:"column:sn;size:36;index"`
+	Uid       string `gorm:"column:uid;index"`
+	// 1 表示赞，-1 表示踩
+	Rating  int8   `gorm:"column:rating;index"`
+	Reason  string `gorm:"column:reason;size:32"`
+	Comment string `gorm:"column:comment;type:text"`
+	// 下面三个字段从消息上复制过来，避免聚合的时候关联消息表
+	Provider        string `gorm:"column:provider;size:32;index:idx_provider_model"`
+	Model           string `gorm:"column:model;size:64;index:idx_provider_model"`
+	PromptVersionID int64  `gorm:"column:prompt_version_id;index"`
+	Ctime           int64  `gorm:"column:ctime;index"`
+	Utime           int64  `gorm:"column:utime"`
+}
+
+func (MessageFeedback) TableName() string {
+	return "message_feedbacks"
+}
+
+type FeedbackDAO struct {
+	db *gorm.DB
+}
+
+func NewFeedbackDAO(db *gorm.DB) *FeedbackDAO {
+	return &FeedbackDAO{db: db}
+}
+
+// Save 保存评价，同一条消息重复评价的时候覆盖之前的评价，同时更新消息上的评价
+func (dao *FeedbackDAO) Save(ctx context.Context, feedback MessageFeedback) error {
+	now := time.Now().Unix()
+	feedback.Ctime = now
+	feedback.Utime = now
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"uid", "rating", "reason", "comment", "utime"}),
+		}).Create(&feedback).Error
+		if err != nil {
+			return err
+		}
+		return dao.updateMessageFeedback(tx, feedback.MessageID, feedback.Rating)
+	})
+}
+
+// Delete 取消评价
+func (dao *FeedbackDAO) Delete(ctx context.Context, messageID int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", messageID).Delete(&MessageFeedback{}).Error; err != nil {
+			return err
+		}
+		return dao.updateMessageFeedback(tx, messageID, 0)
+	})
+}
+
+// updateMessageFeedback 消息上的评价用于 prompt 版本的统计，1 表示赞，-1 表示踩
+func (dao *FeedbackDAO) updateMessageFeedback(tx *gorm.DB, messageID int64, feedback int8) error {
+	return tx.Model(&Message{}).Where("id = ?", messageID).Updates(map[string]any{
+		"feedback": feedback,
+		"utime":    time.Now().Unix(),
+	}).Error
+}
+
+// Stats 按照 groupBy 的字段、评价和原因分组计数，groupBy 是 model 或者 prompt_version
+func (dao *FeedbackDAO) Stats(ctx context.Context, groupBy string, q FeedbackQuery) ([]FeedbackStats, error) {
+	columns := "prompt_version_id"
+	if groupBy == "model" {
+		columns = "provider, model"
+	}
+	var res []FeedbackStats
+	err := dao.where(ctx, q).
+		Select(columns + ", rating, reason, COUNT(*) AS cnt").
+		Group(columns + ", rating, reason").
+		Scan(&res).Error
+	return res, err
+}
+
+// List 最新的评价在前面
+func (dao *FeedbackDAO) List(ctx context.Context, q FeedbackQuery) ([]MessageFeedback, error) {
+	var res []MessageFeedback
+	err := dao.where(ctx, q).Order("id DESC").Limit(q.Limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *FeedbackDAO) GetMessages(ctx context.Context, ids []int64) ([]Message, error) {
+	var res []Message
+	err := dao.db.WithContext(ctx).Where("id IN ?", ids).Find(&res).Error
+	return res, err
+}
+
+func (dao *FeedbackDAO) where(ctx context.Context, q FeedbackQuery) *gorm.DB {
+	db := dao.db.WithContext(ctx).Model(&MessageFeedback{})
+	if q.Rating != 0 {
+		db = db.Where("rating = ?", q.Rating)
+	}
+	if q.Reason != "" {
+		db = db.Where("reason = ?", q.Reason)
+	}
+	if q.PromptID > 0 {
+		db = db.Where("prompt_version_id IN (?)", dao.db.Model(&PromptVersion{}).Select("id").Where("prompt_id = ?", q.PromptID))
+	}
+	if q.Provider != "" {
+		db = db.Where("provider = ?", q.Provider)
+	}
+	if q.Model != "" {
+		db = db.Where("model = ?", q.Model)
+	}
+	if q.Start > 0 {
+		db = db.Where("ctime >= ?", q.Start)
+	}
+	if q.End > 0 {
+		db = db.Where("ctime < ?", q.End)
+	}
+	return db
+}
+
+type FeedbackQuery struct {
+	Rating   int8
+	Reason   string
+	PromptID int64
+	Provider string
+	Model    string
+	Start    int64
+	End      int64
+	Limit    int
+}
+
+type FeedbackStats struct {
+	Provider        string
+	Model           string
+	PromptVersionID int64
+	Rating          int8
+	Reason          string
+	Cnt             int64
+}
@@ -16,10 +16,8 @@ package dao
 
 import (
 	"context"
-	"time"
 
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type Node struct {
@@ -53,8 +51,10 @@ func (Edge) TableName() string {
 type Graph struct {
 	ID       int64  `gorm:"column:id;primaryKey;autoIncrement"`
 	Metadata string `gorm:"column:metadata"`
-	Ctime    int64  `gorm:"column:ctime"`
-	Utime    int64  `gorm:"column:utime"`
+	// 每次整体保存加 1，同时生成一个 GraphVersion
+	Version int64 `gorm:"column:version;not null;default:0"`
+	Ctime   int64 `gorm:"column:ctime"`
+	Utime   int64 `gorm:"column:utime"`
 }
 
 func (Graph) TableName() string {
@@ -69,62 +69,6 @@ func NewGraphDAO(db *gorm.DB) *GraphDAO {
 	return &GraphDAO{db: db}
 }
 
-func (dao *GraphDAO) SaveNode(ctx context.Context, node Node) (int64, error) {
-	now := time.Now().UnixMilli()
-	if node.ID > 0 {
-		node.Utime = now
-	} else {
-		node.Ctime = now
-		node.Utime = now
-	}
-
-	err := dao.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"graph_id", "type", "status", "metadata", "utime"}),
-	}).Create(&node).Error
-	return node.ID, err
-}
-
-func (dao *GraphDAO) DeleteNode(ctx context.Context, id int64) error {
-	return dao.db.WithContext(ctx).Delete(&Node{}, id).Error
-}
-
-func (dao *GraphDAO) SaveEdge(ctx context.Context, edge Edge) (int64, error) {
-	now := time.Now().UnixMilli()
-	if edge.ID > 0 {
-		edge.Utime = now
-	} else {
-		edge.Ctime = now
-		edge.Utime = now
-	}
-
-	err := dao.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"graph_id", "target_id", "source_id", "metadata", "utime"}),
-	}).Create(&edge).Error
-	return edge.ID, err
-}
-
-func (dao *GraphDAO) DeleteEdge(ctx context.Context, id int64) error {
-	return dao.db.WithContext(ctx).Delete(&Edge{}, id).Error
-}
-
-func (dao *GraphDAO) SaveGraph(ctx context.Context, graph Graph) (int64, error) {
-	now := time.Now().UnixMilli()
-	if graph.ID > 0 {
-		graph.Utime = now
-	} else {
-		graph.Ctime = now
-		graph.Utime = now
-	}
-
-	err := dao.db.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"utime", "metadata"}),
-	}).Create(&graph).Error
-	return graph.ID, err
-}
-
 func (dao *GraphDAO) DeleteGraph(ctx context.Context, id int64) error {
 	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		err := tx.Model(&Graph{}).Where("id = ?", id).Delete(&Graph{}).Error
@@ -141,7 +85,11 @@ func (dao *GraphDAO) DeleteGraph(ctx context.Context, id int64) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		err = tx.Where("graph_id = ?", id).Delete(&GraphVersion{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("graph_id = ?", id).Delete(&GraphTrigger{}).Error
 	})
 }
 
@@ -154,6 +102,18 @@ func (dao *GraphDAO) GetNodes(ctx context.Context, id int64) ([]Node, error) {
 	return nodes, nil
 }
 
+func (dao *GraphDAO) GetNodesByIDs(ctx context.Context, ids []int64) ([]Node, error) {
+	var nodes []Node
+	err := dao.db.WithContext(ctx).Where("id IN ?", ids).Find(&nodes).Error
+	return nodes, err
+}
+
+func (dao *GraphDAO) GetEdgesByIDs(ctx context.Context, ids []int64) ([]Edge, error) {
+	var edges []Edge
+	err := dao.db.WithContext(ctx).Where("id IN ?", ids).Find(&edges).Error
+	return edges, err
+}
+
 func (dao *GraphDAO) GetEdges(ctx context.Context, id int64) ([]Edge, error) {
 	var edges []Edge
 	err := dao.db.WithContext(ctx).Where("graph_id = ?", id).Find(&edges).Error
@@ -172,5 +132,5 @@ func (dao *GraphDAO) GetGraph(ctx context.Context, id int64) (Graph, error) {
 }
 
 func InitGraphTable(db *gorm.DB) error {
-	return db.AutoMigrate(&Graph{}, &Edge{}, &Node{})
+	return db.AutoMigrate(&Graph{}, &Edge{}, &Node{}, &GraphVersion{}, &GraphRun{}, &NodeRun{}, &GraphTrigger{}, &GraphTriggerRecord{})
 }
@@ -0,0 +1,167 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GraphRun 图的一次执行
+type GraphRun struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	GraphID int64  `gorm:"column:graph_id;index"`
+	Version int64  `gorm:"column:version"`
+	Uid     int64  `gorm:"column:uid;index"`
+	Status  string `gorm:"column:status;type:varchar(20)"`
+	// JSON 格式的输入和输出
+	Input  string `gorm:"column:input;type:mediumtext"`
+	Output string `gorm:"column:output;type:mediumtext"`
+	Error  string `gorm:"column:error;type:text"`
+	Ctime  int64  `gorm:"column:ctime"`
+	Utime  int64  `gorm:"column:utime"`
+}
+
+func (GraphRun) TableName() string {
+	return "graph_runs"
+}
+
+// NodeRun 节点在一次执行中的状态
+type NodeRun struct {
+	ID       int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	RunID    int64  `gorm:"column:run_id;uniqueIndex:uk_run_node"`
+	NodeID   int64  `gorm:"column:node_id;uniqueIndex:uk_run_node"`
+	Status   string `gorm:"column:status;type:varchar(20);index:idx_status_deadline"`
+	Input    string `gorm:"column:input;type:mediumtext"`
+	Output   string `gorm:"column:output;type:mediumtext"`
+	Error    string `gorm:"column:error;type:text"`
+	Branch   string `gorm:"column:branch;type:varchar(128)"`
+	Tokens   int64  `gorm:"column:tokens"`
+	Latency  int64  `gorm:"column:latency"`
+	Attempts int    `gorm:"column:attempts"`
+	// 审批节点的截止时间，用来查找超时的审批
+	Deadline int64 `gorm:"column:deadline;index:idx_status_deadline"`
+	// NodeApproval 的 JSON
+	Approval string `gorm:"column:approval;type:text"`
+	Ctime    int64  `gorm:"column:ctime"`
+	Utime    int64  `gorm:"column:utime"`
+}
+
+func (NodeRun) TableName() string {
+	return "graph_node_runs"
+}
+
+type GraphRunDAO struct {
+	db *gorm.DB
+}
+
+func NewGraphRunDAO(db *gorm.DB) *GraphRunDAO {
+	return &GraphRunDAO{db: db}
+}
+
+// CreateRun 创建执行记录，同时为每个节点创建一条状态记录
+func (dao *GraphRunDAO) CreateRun(ctx context.Context, run GraphRun, nodes []NodeRun) (int64, error) {
+	now := time.Now().UnixMilli()
+	run.Ctime = now
+	run.Utime = now
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return nil
+		}
+		for i := range nodes {
+			nodes[i].RunID = run.ID
+			nodes[i].Ctime = now
+			nodes[i].Utime = now
+		}
+		return tx.Create(&nodes).Error
+	})
+	return run.ID, err
+}
+
+// SaveNodeRun 更新节点的执行状态
+func (dao *GraphRunDAO) SaveNodeRun(ctx context.Context, node NodeRun) error {
+	now := time.Now().UnixMilli()
+	node.Ctime = now
+	node.Utime = now
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "run_id"}, {Name: "node_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "input", "output", "error", "branch", "tokens", "latency", "attempts", "deadline", "approval", "utime"}),
+	}).Create(&node).Error
+}
+
+// UpdateRun 更新执行的状态和结果
+func (dao *GraphRunDAO) UpdateRun(ctx context.Context, run GraphRun) error {
+	return dao.db.WithContext(ctx).Model(&GraphRun{}).Where("id = ?", run.ID).Updates(map[string]any{
+		"status": run.Status,
+		"output": run.Output,
+		"error":  run.Error,
+		"utime":  time.Now().UnixMilli(),
+	}).Error
+}
+
+// Restart 把失败或者暂停的执行改成执行中，返回 false 表示执行的状态已经变了，例如被其他请求继续执行了
+func (dao *GraphRunDAO) Restart(ctx context.Context, id int64, from []string) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&GraphRun{}).Where("id = ? AND status IN ?", id, from).Updates(map[string]any{
+		"status": "running",
+		"error":  "",
+		"utime":  time.Now().UnixMilli(),
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListWaitingNodeRuns 等待审批的节点，按照截止时间排序。
+// uid 大于 0 的时候只返回这个用户发起的执行里面的节点，before 大于 0 的时候只返回截止时间早于 before 的节点
+func (dao *GraphRunDAO) ListWaitingNodeRuns(ctx context.Context, uid int64, before int64, limit int, offset int) ([]NodeRun, error) {
+	query := dao.db.WithContext(ctx).Where("status = ?", "waiting")
+	if uid > 0 {
+		query = query.Where("run_id IN (?)", dao.db.Model(&GraphRun{}).Select("id").Where("uid = ?", uid))
+	}
+	if before > 0 {
+		query = query.Where("deadline > 0 AND deadline <= ?", before)
+	}
+	var res []NodeRun
+	err := query.Order("deadline ASC, id ASC").Limit(limit).Offset(offset).Find(&res).Error
+	return res, err
+}
+
+// ListRuns 不包含节点的状态
+func (dao *GraphRunDAO) ListRuns(ctx context.Context, uid int64, graphID int64, status string, limit int, offset int) ([]GraphRun, error) {
+	query := dao.db.WithContext(ctx).Where("uid = ?", uid)
+	if graphID > 0 {
+		query = query.Where("graph_id = ?", graphID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var res []GraphRun
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&res).Error
+	return res, err
+}
+
+func (dao *GraphRunDAO) GetRun(ctx context.Context, id int64) (GraphRun, []NodeRun, error) {
+	var run GraphRun
+	if err := dao.db.WithContext(ctx).First(&run, id).Error; err != nil {
+		return GraphRun{}, nil, err
+	}
+	var nodes []NodeRun
+	err := dao.db.WithContext(ctx).Where("run_id = ?", id).Order("node_id").Find(&nodes).Error
+	return run, nodes, err
+}
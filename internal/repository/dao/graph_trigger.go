@@ -0,0 +1,143 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GraphTrigger 图的触发器
+type GraphTrigger struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	GraphID int64  `gorm:"column:graph_id;index"`
+	Uid     int64  `gorm:"column:uid"`
+	Type    string `gorm:"column:type;type:varchar(20);index:idx_type_next_time"`
+	Cron    string `gorm:"column:cron;type:varchar(128)"`
+	Secret  string `gorm:"column:secret;type:varchar(128)"`
+	Enabled bool   `gorm:"column:enabled"`
+	// 下一次定时执行的时间，执行之前先用 CAS 更新它，更新成功的实例负责执行
+	NextTime int64 `gorm:"column:next_time;index:idx_type_next_time"`
+	Ctime    int64 `gorm:"column:ctime"`
+	Utime    int64 `gorm:"column:utime"`
+}
+
+func (GraphTrigger) TableName() string {
+	return "graph_triggers"
+}
+
+// GraphTriggerRecord 触发的历史
+type GraphTriggerRecord struct {
+	ID        int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	TriggerID int64  `gorm:"column:trigger_id;index"`
+	GraphID   int64  `gorm:"column:graph_id"`
+	Uid       int64  `gorm:"column:uid;index"`
+	Type      string `gorm:"column:type;type:varchar(20)"`
+	// JSON 格式的触发数据
+	Payload  string `gorm:"column:payload;type:mediumtext"`
+	RunID    int64  `gorm:"column:run_id"`
+	Status   string `gorm:"column:status;type:varchar(20)"`
+	Error    string `gorm:"column:error;type:text"`
+	FireTime int64  `gorm:"column:fire_time"`
+	Ctime    int64  `gorm:"column:ctime"`
+}
+
+func (GraphTriggerRecord) TableName() string {
+	return "graph_trigger_records"
+}
+
+type GraphTriggerDAO struct {
+	db *gorm.DB
+}
+
+func NewGraphTriggerDAO(db *gorm.DB) *GraphTriggerDAO {
+	return &GraphTriggerDAO{db: db}
+}
+
+// SaveTrigger ID 为 0 的时候创建，否则更新。图和类型创建之后不能修改
+func (dao *GraphTriggerDAO) SaveTrigger(ctx context.Context, trigger GraphTrigger) (int64, error) {
+	now := time.Now().UnixMilli()
+	trigger.Utime = now
+	if trigger.ID == 0 {
+		trigger.Ctime = now
+		err := dao.db.WithContext(ctx).Create(&trigger).Error
+		return trigger.ID, err
+	}
+	err := dao.db.WithContext(ctx).Model(&GraphTrigger{}).Where("id = ?", trigger.ID).Updates(map[string]any{
+		"cron":      trigger.Cron,
+		"secret":    trigger.Secret,
+		"enabled":   trigger.Enabled,
+		"next_time": trigger.NextTime,
+		"utime":     now,
+	}).Error
+	return trigger.ID, err
+}
+
+func (dao *GraphTriggerDAO) GetTrigger(ctx context.Context, id int64) (GraphTrigger, error) {
+	var res GraphTrigger
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+func (dao *GraphTriggerDAO) ListTriggers(ctx context.Context, graphID int64) ([]GraphTrigger, error) {
+	var res []GraphTrigger
+	err := dao.db.WithContext(ctx).Where("graph_id = ?", graphID).Order("id ASC").Find(&res).Error
+	return res, err
+}
+
+func (dao *GraphTriggerDAO) DeleteTrigger(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Where("id = ?", id).Delete(&GraphTrigger{}).Error
+}
+
+// ListDueTriggers 到了执行时间的定时触发器
+func (dao *GraphTriggerDAO) ListDueTriggers(ctx context.Context, now int64, limit int) ([]GraphTrigger, error) {
+	var res []GraphTrigger
+	err := dao.db.WithContext(ctx).
+		Where("type = ? AND enabled = ? AND next_time > 0 AND next_time <= ?", "cron", true, now).
+		Order("next_time ASC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// Claim 把下一次执行的时间从 prev 改成 next，返回 false 表示已经被别的实例改掉了
+func (dao *GraphTriggerDAO) Claim(ctx context.Context, id int64, prev int64, next int64) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&GraphTrigger{}).
+		Where("id = ? AND next_time = ?", id, prev).
+		Updates(map[string]any{
+			"next_time": next,
+			"utime":     time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (dao *GraphTriggerDAO) CreateRecord(ctx context.Context, record GraphTriggerRecord) (int64, error) {
+	record.Ctime = time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Create(&record).Error
+	return record.ID, err
+}
+
+func (dao *GraphTriggerDAO) ListRecords(ctx context.Context, uid int64, graphID int64, triggerID int64, limit int, offset int) ([]GraphTriggerRecord, error) {
+	query := dao.db.WithContext(ctx).Where("uid = ?", uid)
+	if graphID > 0 {
+		query = query.Where("graph_id = ?", graphID)
+	}
+	if triggerID > 0 {
+		query = query.Where("trigger_id = ?", triggerID)
+	}
+	var res []GraphTriggerRecord
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&res).Error
+	return res, err
+}
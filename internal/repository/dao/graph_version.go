@@ -0,0 +1,215 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"gorm.io/gorm"
+)
+
+// GraphVersion 每次整体保存图的时候生成的快照，生成之后不会再修改
+type GraphVersion struct {
+	ID      int64 `gorm:"column:id;primaryKey;autoIncrement"`
+	GraphID int64 `gorm:"column:graph_id;uniqueIndex:uk_graph_version"`
+	Version int64 `gorm:"column:version;uniqueIndex:uk_graph_version"`
+	// GraphSnapshot 的 JSON
+	Snapshot string `gorm:"column:snapshot;type:mediumtext"`
+	Ctime    int64  `gorm:"column:ctime"`
+}
+
+func (GraphVersion) TableName() string {
+	return "graph_versions"
+}
+
+type GraphSnapshot struct {
+	Metadata string `json:"metadata"`
+	Nodes    []Node `json:"nodes"`
+	Edges    []Edge `json:"edges"`
+}
+
+// SaveFullGraph 在一个事务里面保存图、节点和边，并且生成新的版本。
+// graph.Version 是调用者读到的版本，和数据库里面的不一致的时候返回 ErrGraphVersionConflict；graph.ID 为 0 的时候创建新的图。
+// ID 小于等于 0 的节点是新的节点，其中负数是客户端的临时 ID，边可以用它引用新的节点。
+// 请求里面没有的节点和边会被删除。返回保存之后的快照，里面的 ID 都是真实的 ID
+func (dao *GraphDAO) SaveFullGraph(ctx context.Context, graph Graph, nodes []Node, edges []Edge) (GraphVersion, error) {
+	var res GraphVersion
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		if graph.ID == 0 {
+			graph.Version = 1
+			graph.Ctime = now
+			graph.Utime = now
+			if err := tx.Create(&graph).Error; err != nil {
+				return err
+			}
+		} else {
+			updated := tx.Model(&Graph{}).Where("id = ? AND version = ?", graph.ID, graph.Version).Updates(map[string]any{
+				"metadata": graph.Metadata,
+				"version":  gorm.Expr("version + 1"),
+				"utime":    now,
+			})
+			if updated.Error != nil {
+				return updated.Error
+			}
+			if updated.RowsAffected == 0 {
+				var cnt int64
+				if err := tx.Model(&Graph{}).Where("id = ?", graph.ID).Count(&cnt).Error; err != nil {
+					return err
+				}
+				if cnt == 0 {
+					return errs.ErrGraphNotFound
+				}
+				return errs.ErrGraphVersionConflict
+			}
+			graph.Version++
+		}
+
+		ids, err := dao.saveNodes(tx, graph.ID, nodes, now)
+		if err != nil {
+			return err
+		}
+		if err = dao.saveEdges(tx, graph.ID, edges, ids, now); err != nil {
+			return err
+		}
+		snapshot, err := json.Marshal(GraphSnapshot{Metadata: graph.Metadata, Nodes: nodes, Edges: edges})
+		if err != nil {
+			return err
+		}
+		res = GraphVersion{GraphID: graph.ID, Version: graph.Version, Snapshot: string(snapshot), Ctime: now}
+		return tx.Create(&res).Error
+	})
+	return res, err
+}
+
+// saveNodes 返回请求里面的 ID 到真实 ID 的映射，nodes 里面的 ID 会被替换成真实的 ID
+func (dao *GraphDAO) saveNodes(tx *gorm.DB, graphID int64, nodes []Node, now int64) (map[int64]int64, error) {
+	var existing []int64
+	if err := tx.Model(&Node{}).Where("graph_id = ?", graphID).Pluck("id", &existing).Error; err != nil {
+		return nil, err
+	}
+	owned := make(map[int64]bool, len(existing))
+	for _, id := range existing {
+		owned[id] = true
+	}
+	ids := make(map[int64]int64, len(nodes))
+	keep := make([]int64, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		node.GraphID = graphID
+		node.Utime = now
+		if node.ID > 0 {
+			if !owned[node.ID] {
+				return nil, fmt.Errorf("%w: 节点 %d 不属于图 %d", errs.ErrInvalidParam, node.ID, graphID)
+			}
+			err := tx.Model(&Node{}).Where("id = ?", node.ID).Updates(map[string]any{
+				"type":     node.Type,
+				"status":   node.Status,
+				"metadata": node.Metadata,
+				"utime":    now,
+			}).Error
+			if err != nil {
+				return nil, err
+			}
+			ids[node.ID] = node.ID
+		} else {
+			tmp := node.ID
+			node.ID = 0
+			node.Ctime = now
+			if err := tx.Create(node).Error; err != nil {
+				return nil, err
+			}
+			if tmp < 0 {
+				ids[tmp] = node.ID
+			}
+		}
+		keep = append(keep, node.ID)
+	}
+	return ids, dao.deleteOthers(tx, &Node{}, graphID, keep)
+}
+
+func (dao *GraphDAO) saveEdges(tx *gorm.DB, graphID int64, edges []Edge, ids map[int64]int64, now int64) error {
+	var existing []int64
+	if err := tx.Model(&Edge{}).Where("graph_id = ?", graphID).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	owned := make(map[int64]bool, len(existing))
+	for _, id := range existing {
+		owned[id] = true
+	}
+	keep := make([]int64, 0, len(edges))
+	for i := range edges {
+		edge := &edges[i]
+		source, okSource := ids[edge.SourceID]
+		target, okTarget := ids[edge.TargetID]
+		if !okSource || !okTarget {
+			return fmt.Errorf("%w: 边 %d 连接的节点不在图里面", errs.ErrInvalidParam, edge.ID)
+		}
+		edge.GraphID = graphID
+		edge.SourceID = source
+		edge.TargetID = target
+		edge.Utime = now
+		if edge.ID > 0 {
+			if !owned[edge.ID] {
+				return fmt.Errorf("%w: 边 %d 不属于图 %d", errs.ErrInvalidParam, edge.ID, graphID)
+			}
+			err := tx.Model(&Edge{}).Where("id = ?", edge.ID).Updates(map[string]any{
+				"source_id": edge.SourceID,
+				"target_id": edge.TargetID,
+				"metadata":  edge.Metadata,
+				"utime":     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			edge.ID = 0
+			edge.Ctime = now
+			if err := tx.Create(edge).Error; err != nil {
+				return err
+			}
+		}
+		keep = append(keep, edge.ID)
+	}
+	return dao.deleteOthers(tx, &Edge{}, graphID, keep)
+}
+
+// deleteOthers 删除图里面除了 keep 以外的数据
+func (dao *GraphDAO) deleteOthers(tx *gorm.DB, model any, graphID int64, keep []int64) error {
+	query := tx.Where("graph_id = ?", graphID)
+	// NOT IN 空列表什么都不会匹配
+	if len(keep) > 0 {
+		query = query.Where("id NOT IN ?", keep)
+	}
+	return query.Delete(model).Error
+}
+
+// ListVersions 按照版本倒序返回，不包含快照
+func (dao *GraphDAO) ListVersions(ctx context.Context, graphID int64) ([]GraphVersion, error) {
+	var res []GraphVersion
+	err := dao.db.WithContext(ctx).Select("id", "graph_id", "version", "ctime").
+		Where("graph_id = ?", graphID).Order("version DESC").Find(&res).Error
+	return res, err
+}
+
+func (dao *GraphDAO) GetVersion(ctx context.Context, graphID int64, version int64) (GraphVersion, error) {
+	var res GraphVersion
+	err := dao.db.WithContext(ctx).Where("graph_id = ? AND version = ?", graphID, version).First(&res).Error
+	return res, err
+}
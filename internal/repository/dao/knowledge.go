@@ -0,0 +1,215 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KnowledgeBase struct {
+	ID           int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	Owner        int64  `gorm:"column:owner;index"`
+	Name         string `gorm:"column:name;type:varchar(256)"`
+	Description  string `gorm:"column:description;type:text"`
+	ChunkSize    int    `gorm:"column:chunk_size"`
+	ChunkOverlap int    `gorm:"column:chunk_overlap"`
+	Ctime        int64  `gorm:"column:ctime"`
+	Utime        int64  `gorm:"column:utime"`
+}
+
+func (KnowledgeBase) TableName() string {
+	return "knowledge_bases"
+}
+
+type KnowledgeDocument struct {
+	ID       int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	KBID     int64  `gorm:"column:kb_id;index"`
+	Owner    int64  `gorm:"column:owner;index"`
+	Title    string `gorm:"column:title;type:varchar(512)"`
+	Format   string `gorm:"column:format;type:varchar(20)"`
+	Content  string `gorm:"column:content;type:longtext"`
+	Status   string `gorm:"column:status;type:varchar(20)"`
+	Progress int    `gorm:"column:progress"`
+	Chunks   int    `gorm:"column:chunks"`
+	Error    string `gorm:"column:error;type:text"`
+	Ctime    int64  `gorm:"column:ctime"`
+	Utime    int64  `gorm:"column:utime"`
+}
+
+func (KnowledgeDocument) TableName() string {
+	return "knowledge_documents"
+}
+
+// KnowledgeChunk 文档切分出来的片段，冗余了知识库和用户，方便按照用户和知识库检索
+type KnowledgeChunk struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	DocID   int64  `gorm:"column:doc_id;uniqueIndex:uk_doc_idx"`
+	Idx     int    `gorm:"column:idx;uniqueIndex:uk_doc_idx"`
+	KBID    int64  `gorm:"column:kb_id;index"`
+	Owner   int64  `gorm:"column:owner;index"`
+	Content string `gorm:"column:content;type:text"`
+	Ctime   int64  `gorm:"column:ctime"`
+}
+
+func (KnowledgeChunk) TableName() string {
+	return "knowledge_chunks"
+}
+
+type KnowledgeDAO struct {
+	db *gorm.DB
+}
+
+func NewKnowledgeDAO(db *gorm.DB) *KnowledgeDAO {
+	return &KnowledgeDAO{db: db}
+}
+
+// SaveBase ID 为 0 的时候创建，否则更新
+func (dao *KnowledgeDAO) SaveBase(ctx context.Context, kb KnowledgeBase) (int64, error) {
+	now := time.Now().UnixMilli()
+	kb.Utime = now
+	if kb.ID == 0 {
+		kb.Ctime = now
+		err := dao.db.WithContext(ctx).Create(&kb).Error
+		return kb.ID, err
+	}
+	err := dao.db.WithContext(ctx).Model(&KnowledgeBase{}).Where("id = ?", kb.ID).Updates(map[string]any{
+		"name":          kb.Name,
+		"description":   kb.Description,
+		"chunk_size":    kb.ChunkSize,
+		"chunk_overlap": kb.ChunkOverlap,
+		"utime":         now,
+	}).Error
+	return kb.ID, err
+}
+
+func (dao *KnowledgeDAO) GetBase(ctx context.Context, id int64) (KnowledgeBase, error) {
+	var res KnowledgeBase
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+func (dao *KnowledgeDAO) ListBases(ctx context.Context, owner int64) ([]KnowledgeBase, error) {
+	var res []KnowledgeBase
+	err := dao.db.WithContext(ctx).Where("owner = ?", owner).Order("id DESC").Find(&res).Error
+	return res, err
+}
+
+// DeleteBase 同时删除知识库里面的文档和片段。和 DeleteDocument 一样先删除文档
+func (dao *KnowledgeDAO) DeleteBase(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kb_id = ?", id).Delete(&KnowledgeDocument{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("kb_id = ?", id).Delete(&KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&KnowledgeBase{}).Error
+	})
+}
+
+func (dao *KnowledgeDAO) CreateDocument(ctx context.Context, doc KnowledgeDocument) (int64, error) {
+	now := time.Now().UnixMilli()
+	doc.Ctime = now
+	doc.Utime = now
+	err := dao.db.WithContext(ctx).Create(&doc).Error
+	return doc.ID, err
+}
+
+func (dao *KnowledgeDAO) GetDocument(ctx context.Context, id int64) (KnowledgeDocument, error) {
+	var res KnowledgeDocument
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&res).Error
+	return res, err
+}
+
+// ListDocuments 不查询文档的内容，kbID 为 0 的时候查询用户所有的文档
+func (dao *KnowledgeDAO) ListDocuments(ctx context.Context, owner int64, kbID int64, limit int, offset int) ([]KnowledgeDocument, error) {
+	query := dao.db.WithContext(ctx).Omit("content").Where("owner = ?", owner)
+	if kbID > 0 {
+		query = query.Where("kb_id = ?", kbID)
+	}
+	var res []KnowledgeDocument
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&res).Error
+	return res, err
+}
+
+// UpdateProgress 更新导入的状态和进度
+func (dao *KnowledgeDAO) UpdateProgress(ctx context.Context, doc KnowledgeDocument) error {
+	return dao.db.WithContext(ctx).Model(&KnowledgeDocument{}).Where("id = ?", doc.ID).Updates(map[string]any{
+		"status":   doc.Status,
+		"progress": doc.Progress,
+		"chunks":   doc.Chunks,
+		"error":    doc.Error,
+		"utime":    time.Now().UnixMilli(),
+	}).Error
+}
+
+// DeleteDocument 先删除文档，这样会等待正在保存的那一批片段提交，之后再删除片段就不会有遗漏
+func (dao *KnowledgeDAO) DeleteDocument(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", id).Delete(&KnowledgeDocument{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("doc_id = ?", id).Delete(&KnowledgeChunk{}).Error
+	})
+}
+
+// DeleteChunks 重新导入之前删除文档已经导入的片段
+func (dao *KnowledgeDAO) DeleteChunks(ctx context.Context, docID int64) error {
+	return dao.db.WithContext(ctx).Where("doc_id = ?", docID).Delete(&KnowledgeChunk{}).Error
+}
+
+// SaveChunks 保存同一个文档的一批片段。保存的时候锁住文档，文档已经被删除的时候返回 gorm.ErrRecordNotFound，
+// 避免导入的过程中删除文档留下没有文档的片段
+func (dao *KnowledgeDAO) SaveChunks(ctx context.Context, chunks []KnowledgeChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	for i := range chunks {
+		chunks[i].Ctime = now
+	}
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc KnowledgeDocument
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", chunks[0].DocID).First(&doc).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&chunks).Error
+	})
+}
+
+// ListStaleDocuments 查询状态是 statuses 之一，并且在 utime 之前就没有再更新过的文档，不查询文档的内容
+func (dao *KnowledgeDAO) ListStaleDocuments(ctx context.Context, statuses []string, utime int64) ([]KnowledgeDocument, error) {
+	var res []KnowledgeDocument
+	err := dao.db.WithContext(ctx).Omit("content").
+		Where("status IN ? AND utime < ?", statuses, utime).
+		Order("id ASC").Find(&res).Error
+	return res, err
+}
+
+func (dao *KnowledgeDAO) ListChunks(ctx context.Context, docID int64, limit int, offset int) ([]KnowledgeChunk, error) {
+	var res []KnowledgeChunk
+	err := dao.db.WithContext(ctx).Where("doc_id = ?", docID).Order("idx ASC").Limit(limit).Offset(offset).Find(&res).Error
+	return res, err
+}
+
+func InitKnowledgeTable(db *gorm.DB) error {
+	return db.AutoMigrate(&KnowledgeBase{}, &KnowledgeDocument{}, &KnowledgeChunk{})
+}
@@ -17,8 +17,12 @@ package dao
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"gorm.io/gorm"
 )
 
@@ -50,11 +54,113 @@ func (p *PromptDAO) FindByID(ctx context.Context, id int64) (Prompt, []PromptVer
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return res, nil, nil
 	}
+	if err != nil {
+		return res, nil, err
+	}
+	var versions []PromptVersion
+	err = p.db.WithContext(ctx).Model(&PromptVersion{}).Where("prompt_id = ?", res.ID).Find(&versions).Error
+	return res, versions, err
+}
+
+// FindByName 按照名字和 owner 查找没有删除的 prompt 以及它没有删除的版本，找不到的时候返回零值
+func (p *PromptDAO) FindByName(ctx context.Context, owner int64, ownerType string, name string) (Prompt, []PromptVersion, error) {
+	var res Prompt
+	err := p.db.WithContext(ctx).
+		Where("owner = ? AND owner_type = ? AND name = ? AND status != ?", owner, ownerType, name, 0).
+		Order("id").Limit(1).Find(&res).Error
+	if err != nil || res.ID == 0 {
+		return res, nil, err
+	}
 	var versions []PromptVersion
-	p.db.WithContext(ctx).Model(&PromptVersion{}).Where("prompt_id = ?", res.ID).First(&versions)
+	err = p.db.WithContext(ctx).Where("prompt_id = ? AND status != ?", res.ID, 0).Order("id").Find(&versions).Error
 	return res, versions, err
 }
 
+// Save 在一个事务里面保存 prompt 和 versions，ID 为 0 的会新建，否则覆盖更新。
+// active 是发布版本在 versions 中的下标，小于 0 的时候使用 prompt.ActiveVersion
+func (p *PromptDAO) Save(ctx context.Context, prompt Prompt, versions []PromptVersion, active int) (int64, error) {
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		prompt.Utime = now
+		if prompt.ID == 0 {
+			prompt.Ctime = now
+			if err := tx.Create(&prompt).Error; err != nil {
+				return err
+			}
+		}
+		for i := range versions {
+			v := &versions[i]
+			v.PromptID, v.Utime = prompt.ID, now
+			if v.ID == 0 {
+				v.Ctime = now
+				if err := tx.Create(v).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			err := tx.Model(&PromptVersion{}).Where("id = ? AND prompt_id = ?", v.ID, prompt.ID).Updates(map[string]any{
+				"label":          v.Label,
+				"content":        v.Content,
+				"system_content": v.SystemContent,
+				"temperature":    v.Temperature,
+				"top_n":          v.TopN,
+				"max_tokens":     v.MaxTokens,
+				"weight":         v.Weight,
+				"utime":          now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if active >= 0 && active < len(versions) {
+			prompt.ActiveVersion = versions[active].ID
+		}
+		return tx.Model(&Prompt{}).Where("id = ?", prompt.ID).Updates(map[string]any{
+			"description":    prompt.Description,
+			"active_version": prompt.ActiveVersion,
+			"utime":          now,
+		}).Error
+	})
+	return prompt.ID, err
+}
+
+// List 按照条件查询 prompt，使用游标分页，已经删除的 prompt 不会被返回
+func (p *PromptDAO) List(ctx context.Context, q PromptQuery) ([]Prompt, error) {
+	db := p.db.WithContext(ctx).Model(&Prompt{}).Where("status != ?", 0)
+	if q.Owner > 0 {
+		db = db.Where("owner = ?", q.Owner)
+	}
+	if q.OwnerType != "" {
+		db = db.Where("owner_type = ?", q.OwnerType)
+	}
+	if q.Status > 0 {
+		db = db.Where("status = ?", q.Status)
+	}
+	if q.Keyword != "" {
+		like := "%" + escapeLike(q.Keyword) + "%"
+		db = db.Where("(name LIKE ? OR description LIKE ?)", like, like)
+	}
+	if q.HasPublished != nil {
+		if *q.HasPublished {
+			db = db.Where("active_version > ?", 0)
+		} else {
+			db = db.Where("active_version = ?", 0)
+		}
+	}
+	op, order := "<", "DESC"
+	if q.Asc {
+		op, order = ">", "ASC"
+	}
+	// SortBy 只能是白名单里面的字段，由上层保证
+	if q.CursorID > 0 {
+		db = db.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", q.SortBy, op, q.SortBy, op),
+			q.CursorValue, q.CursorValue, q.CursorID)
+	}
+	var res []Prompt
+	err := db.Order(q.SortBy + " " + order).Order("id " + order).Limit(q.Limit).Find(&res).Error
+	return res, err
+}
+
 func (p *PromptDAO) UpdatePrompt(ctx context.Context, value Prompt) error {
 	// 更新非零值
 	value.Utime = time.Now().UnixMilli()
@@ -114,6 +220,55 @@ func (p *PromptDAO) UpdateActiveVersion(ctx context.Context, versionID int64, la
 	})
 }
 
+// UpdateWeights 重新设置 prompt 下各个版本的流量权重，未出现在 weights 里面的版本权重会被清零。
+// weights 里面有不属于这个 prompt 的版本的时候返回 ErrInvalidParam，什么也不修改
+func (p *PromptDAO) UpdateWeights(ctx context.Context, promptID int64, weights map[int64]int) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []int64
+		err := tx.Model(&PromptVersion{}).Where("prompt_id = ?", promptID).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		for versionID := range weights {
+			if !slices.Contains(ids, versionID) {
+				return fmt.Errorf("%w: 版本 %d 不属于 prompt %d", errs.ErrInvalidParam, versionID, promptID)
+			}
+		}
+		now := time.Now().UnixMilli()
+		err = tx.Model(&PromptVersion{}).Where("prompt_id = ?", promptID).Updates(map[string]any{
+			"weight": 0,
+			"utime":  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		for versionID, weight := range weights {
+			err = tx.Model(&PromptVersion{}).
+				Where("id = ? AND prompt_id = ?", versionID, promptID).
+				Updates(map[string]any{
+					"weight": weight,
+					"utime":  now,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Prompt{}).Where("id = ?", promptID).Update("utime", now).Error
+	})
+}
+
+// VersionStats 按照版本聚合 prompt 的线上使用情况
+func (p *PromptDAO) VersionStats(ctx context.Context, promptID int64) ([]PromptVersionStats, error) {
+	var res []PromptVersionStats
+	err := p.db.WithContext(ctx).Model(&Message{}).
+		Select("prompt_version_id AS version_id, COUNT(*) AS count, AVG(latency) AS avg_latency, SUM(tokens) AS tokens, "+
+			"SUM(CASE WHEN feedback > 0 THEN 1 ELSE 0 END) AS up, SUM(CASE WHEN feedback < 0 THEN 1 ELSE 0 END) AS down").
+		Where("prompt_version_id IN (?)", p.db.Model(&PromptVersion{}).Select("id").Where("prompt_id = ?", promptID)).
+		Group("prompt_version_id").
+		Scan(&res).Error
+	return res, err
+}
+
 func (p *PromptDAO) InsertVersion(ctx context.Context, version PromptVersion) error {
 	now := time.Now().UnixMilli()
 	version.Ctime = now
@@ -153,6 +308,7 @@ type PromptVersion struct {
 	TopN          float32 `gorm:"column:top_n"`
 	MaxTokens     int     `gorm:"column:max_tokens"`
 	Status        uint8   `gorm:"column:status;default:1"`
+	Weight        int     `gorm:"column:weight;default:0"`
 	Ctime         int64   `gorm:"column:ctime"`
 	Utime         int64   `gorm:"column:utime"`
 }
@@ -161,6 +317,35 @@ func (PromptVersion) TableName() string {
 	return "prompt_versions"
 }
 
+type PromptQuery struct {
+	Owner        int64
+	OwnerType    string
+	Keyword      string
+	Status       uint8
+	HasPublished *bool
+	SortBy       string
+	Asc          bool
+	// 游标，也就是上一页最后一条记录排序字段的值和 id
+	CursorValue int64
+	CursorID    int64
+	Limit       int
+}
+
+type PromptVersionStats struct {
+	VersionID  int64
+	Count      int64
+	AvgLatency float64
+	Tokens     int64
+	Up         int64
+	Down       int64
+}
+
 func InitTable(db *gorm.DB) error {
-	return db.AutoMigrate(&Prompt{}, &PromptVersion{})
+	return db.AutoMigrate(&Prompt{}, &PromptVersion{}, &PromptACL{})
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
 }
@@ -0,0 +1,78 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PromptACLDAO struct {
+	db *gorm.DB
+}
+
+func NewPromptACLDAO(db *gorm.DB) *PromptACLDAO {
+	return &PromptACLDAO{db: db}
+}
+
+// Upsert 同一个用户在同一个范围内只有一个角色，重复授权会覆盖原来的角色
+func (d *PromptACLDAO) Upsert(ctx context.Context, acl PromptACL) error {
+	now := time.Now().UnixMilli()
+	acl.Ctime, acl.Utime = now, now
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "scope_id"}, {Name: "uid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "utime"}),
+	}).Create(&acl).Error
+}
+
+func (d *PromptACLDAO) Delete(ctx context.Context, scope string, scopeID int64, uid int64) error {
+	return d.db.WithContext(ctx).
+		Where("scope = ? AND scope_id = ? AND uid = ?", scope, scopeID, uid).
+		Delete(&PromptACL{}).Error
+}
+
+// Find 查询用户在某个范围内的授权，没有授权的时候返回零值
+func (d *PromptACLDAO) Find(ctx context.Context, scope string, scopeID int64, uid int64) (PromptACL, error) {
+	var res PromptACL
+	err := d.db.WithContext(ctx).
+		Where("scope = ? AND scope_id = ? AND uid = ?", scope, scopeID, uid).
+		Limit(1).Find(&res).Error
+	return res, err
+}
+
+func (d *PromptACLDAO) List(ctx context.Context, scope string, scopeID int64) ([]PromptACL, error) {
+	var res []PromptACL
+	err := d.db.WithContext(ctx).
+		Where("scope = ? AND scope_id = ?", scope, scopeID).
+		Order("id").Find(&res).Error
+	return res, err
+}
+
+type PromptACL struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement"`
+	Scope   string `gorm:"column:scope;type:ENUM('prompt','organization');uniqueIndex:uniq_scope_uid"`
+	ScopeID int64  `gorm:"column:scope_id;uniqueIndex:uniq_scope_uid"`
+	Uid     int64  `gorm:"column:uid;uniqueIndex:uniq_scope_uid"`
+	Role    uint8  `gorm:"column:role"`
+	Ctime   int64  `gorm:"column:ctime"`
+	Utime   int64  `gorm:"column:utime"`
+}
+
+func (PromptACL) TableName() string {
+	return "prompt_acls"
+}
@@ -151,6 +151,28 @@ func (dao *QuotaDao) Deduct(ctx context.Context, uid int64, amount int64, key st
 	})
 }
 
+// GetRecord 按照 key 查询扣费记录
+func (dao *QuotaDao) GetRecord(ctx context.Context, key string) (QuotaRecord, error) {
+	var record QuotaRecord
+	err := dao.db.WithContext(ctx).Where("`key` = ?", key).First(&record).Error
+	return record, err
+}
+
+// Balance 可以扣减的额度，和 deduct 一样包括主额度和还有余额的临时额度
+func (dao *QuotaDao) Balance(ctx context.Context, uid int64) (int64, error) {
+	var quota, temp int64
+	err := dao.db.WithContext(ctx).Model(&Quota{}).
+		Where("uid = ?", uid).
+		Select("COALESCE(SUM(amount), 0)").Scan(&quota).Error
+	if err != nil {
+		return 0, err
+	}
+	err = dao.db.WithContext(ctx).Model(&TempQuota{}).
+		Where("uid = ? AND amount > ?", uid, 0).
+		Select("COALESCE(SUM(amount), 0)").Scan(&temp).Error
+	return quota + temp, err
+}
+
 func (dao *QuotaDao) deduct(tx *gorm.DB, uid int64, amount int64, now int64) error {
 	deductAmount := amount
 	for {
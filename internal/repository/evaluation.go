@@ -0,0 +1,183 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
+)
+
+type EvaluationRepo struct {
+	dao *dao.EvaluationDAO
+}
+
+func NewEvaluationRepo(d *dao.EvaluationDAO) *EvaluationRepo {
+	return &EvaluationRepo{dao: d}
+}
+
+func (r *EvaluationRepo) CreateDataset(ctx context.Context, dataset domain.EvalDataset) (int64, error) {
+	cases, err := r.toDaoCases(dataset.Cases)
+	if err != nil {
+		return 0, err
+	}
+	return r.dao.CreateDataset(ctx, dao.EvalDataset{
+		Name:        dataset.Name,
+		Owner:       dataset.Owner,
+		Description: dataset.Description,
+	}, cases)
+}
+
+func (r *EvaluationRepo) AddCases(ctx context.Context, datasetID int64, cases []domain.EvalCase) error {
+	res, err := r.toDaoCases(cases)
+	if err != nil {
+		return err
+	}
+	return r.dao.AddCases(ctx, datasetID, res)
+}
+
+func (r *EvaluationRepo) GetDataset(ctx context.Context, id int64) (domain.EvalDataset, error) {
+	dataset, cases, err := r.dao.GetDataset(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.EvalDataset{}, fmt.Errorf("%w: 数据集 %d", errs.ErrEvaluationNotFound, id)
+	}
+	if err != nil {
+		return domain.EvalDataset{}, err
+	}
+	domainCases := make([]domain.EvalCase, 0, len(cases))
+	for _, c := range cases {
+		dc := domain.EvalCase{
+			ID:        c.ID,
+			DatasetID: c.DatasetID,
+			Expected:  c.Expected,
+		}
+		if c.Variables != "" {
+			if err = json.Unmarshal([]byte(c.Variables), &dc.Variables); err != nil {
+				return domain.EvalDataset{}, err
+			}
+		}
+		if c.Assertions != "" {
+			if err = json.Unmarshal([]byte(c.Assertions), &dc.Assertions); err != nil {
+				return domain.EvalDataset{}, err
+			}
+		}
+		domainCases = append(domainCases, dc)
+	}
+	return domain.EvalDataset{
+		ID:          dataset.ID,
+		Name:        dataset.Name,
+		Owner:       dataset.Owner,
+		Description: dataset.Description,
+		Cases:       domainCases,
+		Ctime:       time.UnixMilli(dataset.Ctime),
+		Utime:       time.UnixMilli(dataset.Utime),
+	}, nil
+}
+
+func (r *EvaluationRepo) CreateRun(ctx context.Context, run domain.EvalRun) (int64, error) {
+	return r.dao.CreateRun(ctx, dao.EvalRun{
+		Uid:       run.Uid,
+		DatasetID: run.DatasetID,
+		VersionID: run.VersionID,
+		Status:    string(run.Status),
+		Total:     run.Total,
+	})
+}
+
+func (r *EvaluationRepo) FinishRun(ctx context.Context, run domain.EvalRun) error {
+	return r.dao.FinishRun(ctx, dao.EvalRun{
+		ID:     run.ID,
+		Status: string(run.Status),
+		Total:  run.Total,
+		Passed: run.Passed,
+		Score:  run.Score,
+	})
+}
+
+func (r *EvaluationRepo) AddResult(ctx context.Context, result domain.EvalResult) error {
+	return r.dao.AddResult(ctx, dao.EvalResult{
+		RunID:   result.RunID,
+		CaseID:  result.CaseID,
+		Output:  result.Output,
+		Passed:  result.Passed,
+		Score:   result.Score,
+		Reason:  result.Reason,
+		Latency: result.Latency,
+		Tokens:  result.Tokens,
+	})
+}
+
+func (r *EvaluationRepo) GetRun(ctx context.Context, id int64) (domain.EvalRun, error) {
+	run, results, err := r.dao.GetRun(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.EvalRun{}, fmt.Errorf("%w: 评测 %d", errs.ErrEvaluationNotFound, id)
+	}
+	if err != nil {
+		return domain.EvalRun{}, err
+	}
+	return domain.EvalRun{
+		ID:        run.ID,
+		Uid:       run.Uid,
+		DatasetID: run.DatasetID,
+		VersionID: run.VersionID,
+		Status:    domain.EvalRunStatus(run.Status),
+		Total:     run.Total,
+		Passed:    run.Passed,
+		Score:     run.Score,
+		Results: slice.Map(results, func(idx int, src dao.EvalResult) domain.EvalResult {
+			return domain.EvalResult{
+				ID:      src.ID,
+				RunID:   src.RunID,
+				CaseID:  src.CaseID,
+				Output:  src.Output,
+				Passed:  src.Passed,
+				Score:   src.Score,
+				Reason:  src.Reason,
+				Latency: src.Latency,
+				Tokens:  src.Tokens,
+			}
+		}),
+		Ctime: time.UnixMilli(run.Ctime),
+		Utime: time.UnixMilli(run.Utime),
+	}, nil
+}
+
+func (r *EvaluationRepo) toDaoCases(cases []domain.EvalCase) ([]dao.EvalCase, error) {
+	res := make([]dao.EvalCase, 0, len(cases))
+	for _, c := range cases {
+		vars, err := json.Marshal(c.Variables)
+		if err != nil {
+			return nil, err
+		}
+		assertions, err := json.Marshal(c.Assertions)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, dao.EvalCase{
+			Variables:  string(vars),
+			Expected:   c.Expected,
+			Assertions: string(assertions),
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type FeedbackRepo struct {
+	dao *dao.FeedbackDAO
+}
+
+func NewFeedbackRepo(d *dao.FeedbackDAO) *FeedbackRepo {
+	return &FeedbackRepo{dao: d}
+}
+
+func (r *FeedbackRepo) Save(ctx context.Context, feedback domain.MessageFeedback) error {
+	return r.dao.Save(ctx, dao.MessageFeedback{
+		MessageID:       feedback.MessageID,
+		Sn:              feedback.Sn,
+		Uid:             feedback.Uid,
+		Rating:          int8(feedback.Rating),
+		Reason:          string(feedback.Reason),
+		Comment:         feedback.Comment,
+		Provider:        feedback.Provider,
+		Model:           feedback.Model,
+		PromptVersionID: feedback.PromptVersionID,
+	})
+}
+
+func (r *FeedbackRepo) Delete(ctx context.Context, messageID int64) error {
+	return r.dao.Delete(ctx, messageID)
+}
+
+// Stats 聚合评价，结果的顺序和数据库返回的顺序一致
+func (r *FeedbackRepo) Stats(ctx context.Context, q domain.FeedbackStatsQuery) ([]domain.FeedbackStats, error) {
+	rows, err := r.dao.Stats(ctx, string(q.GroupBy), dao.FeedbackQuery{
+		PromptID: q.PromptID,
+		Start:    q.Start,
+		End:      q.End,
+	})
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		provider, model string
+		versionID       int64
+	}
+	index := make(map[key]int, len(rows))
+	res := make([]domain.FeedbackStats, 0, len(rows))
+	for _, row := range rows {
+		k := key{provider: row.Provider, model: row.Model, versionID: row.PromptVersionID}
+		i, ok := index[k]
+		if !ok {
+			i = len(res)
+			index[k] = i
+			res = append(res, domain.FeedbackStats{
+				Provider:        row.Provider,
+				Model:           row.Model,
+				PromptVersionID: row.PromptVersionID,
+				Reasons:         map[domain.FeedbackReason]int64{},
+			})
+		}
+		switch {
+		case row.Rating > 0:
+			res[i].Up += row.Cnt
+		case row.Rating < 0:
+			res[i].Down += row.Cnt
+			if row.Reason != "" {
+				res[i].Reasons[domain.FeedbackReason(row.Reason)] += row.Cnt
+			}
+		}
+	}
+	return res, nil
+}
+
+// Reviews 查询评价，同时带上被评价的回答和它回答的问题
+func (r *FeedbackRepo) Reviews(ctx context.Context, q domain.FeedbackQuery) ([]domain.FeedbackReview, error) {
+	feedbacks, err := r.dao.List(ctx, dao.FeedbackQuery{
+		Rating:   int8(q.Rating),
+		Reason:   string(q.Reason),
+		PromptID: q.PromptID,
+		Provider: q.Provider,
+		Model:    q.Model,
+		Start:    q.Start,
+		End:      q.End,
+		Limit:    q.Limit,
+	})
+	if err != nil || len(feedbacks) == 0 {
+		return nil, err
+	}
+	answers, err := r.dao.GetMessages(ctx, slice.Map(feedbacks, func(idx int, src dao.MessageFeedback) int64 {
+		return src.MessageID
+	}))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]dao.Message, len(answers)*2)
+	for _, msg := range answers {
+		byID[msg.ID] = msg
+	}
+	// 引入分支之前的消息没有 ParentID，这些回答就不带问题了
+	questions, err := r.dao.GetMessages(ctx, slice.FilterMap(answers, func(idx int, src dao.Message) (int64, bool) {
+		return src.ParentID, src.ParentID > 0
+	}))
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range questions {
+		byID[msg.ID] = msg
+	}
+	return slice.Map(feedbacks, func(idx int, src dao.MessageFeedback) domain.FeedbackReview {
+		answer := byID[src.MessageID]
+		review := domain.FeedbackReview{
+			Feedback: r.toDomain(src),
+			Answer:   answer.Content,
+		}
+		if answer.ParentID > 0 {
+			review.Question = byID[answer.ParentID].Content
+		}
+		return review
+	}), nil
+}
+
+func (r *FeedbackRepo) toDomain(src dao.MessageFeedback) domain.MessageFeedback {
+	return domain.MessageFeedback{
+		ID:              src.ID,
+		MessageID:       src.MessageID,
+		Sn:              src.Sn,
+		Uid:             src.Uid,
+		Rating:          domain.FeedbackRating(src.Rating),
+		Reason:          domain.FeedbackReason(src.Reason),
+		Comment:         src.Comment,
+		Provider:        src.Provider,
+		Model:           src.Model,
+		PromptVersionID: src.PromptVersionID,
+		Ctime:           src.Ctime,
+		Utime:           src.Utime,
+	}
+}
@@ -16,11 +16,16 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ekit"
 	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
 )
 
 type NodeRepo struct {
@@ -31,52 +36,74 @@ func NewGraphRepo(graph *dao.GraphDAO) *NodeRepo {
 	return &NodeRepo{graph: graph}
 }
 
-func (n *NodeRepo) SaveGraph(ctx context.Context, graph domain.Graph) (int64, error) {
+// SaveGraph 整体保存图并且生成新的版本，返回保存之后的图
+func (n *NodeRepo) SaveGraph(ctx context.Context, graph domain.Graph) (domain.Graph, error) {
 	str, _ := graph.Metadata.AsString()
-
-	return n.graph.SaveGraph(ctx, dao.Graph{
+	nodes := slice.Map(graph.Steps, func(idx int, src domain.Node) dao.Node {
+		m, _ := src.Metadata.AsString()
+		return dao.Node{ID: src.ID, Type: src.Type, Status: src.Status, Metadata: m}
+	})
+	edges := slice.Map(graph.Edges, func(idx int, src domain.Edge) dao.Edge {
+		m, _ := src.Metadata.AsString()
+		return dao.Edge{ID: src.ID, SourceID: src.SourceID, TargetID: src.TargetID, Metadata: m}
+	})
+	version, err := n.graph.SaveFullGraph(ctx, dao.Graph{
 		ID:       graph.ID,
 		Metadata: str,
-	})
+		Version:  graph.Version,
+	}, nodes, edges)
+	if err != nil {
+		return domain.Graph{}, err
+	}
+	res, err := n.toDomainVersion(version)
+	return res.Graph, err
 }
 
-func (n *NodeRepo) SaveNode(ctx context.Context, node domain.Node) (int64, error) {
-	str, _ := node.Metadata.AsString()
-	return n.graph.SaveNode(ctx, dao.Node{
-		ID:       node.ID,
-		Type:     node.Type,
-		GraphID:  node.GraphID,
-		Status:   node.Status,
-		Metadata: str,
-	})
+func (n *NodeRepo) ListVersions(ctx context.Context, graphID int64) ([]domain.GraphVersion, error) {
+	versions, err := n.graph.ListVersions(ctx, graphID)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(versions, func(idx int, src dao.GraphVersion) domain.GraphVersion {
+		return domain.GraphVersion{GraphID: src.GraphID, Version: src.Version, Ctime: src.Ctime}
+	}), nil
 }
 
-func (n *NodeRepo) SaveEdge(ctx context.Context, edge domain.Edge) (int64, error) {
-	str, _ := edge.Metadata.AsString()
+func (n *NodeRepo) GetVersion(ctx context.Context, graphID int64, version int64) (domain.GraphVersion, error) {
+	res, err := n.graph.GetVersion(ctx, graphID, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.GraphVersion{}, fmt.Errorf("%w: %d 版本 %d", errs.ErrGraphNotFound, graphID, version)
+	}
+	if err != nil {
+		return domain.GraphVersion{}, err
+	}
+	return n.toDomainVersion(res)
+}
 
-	return n.graph.SaveEdge(ctx, dao.Edge{
-		ID:       edge.ID,
-		GraphID:  edge.GraphID,
-		SourceID: edge.SourceID,
-		TargetID: edge.TargetID,
-		Metadata: str,
-	})
+func (n *NodeRepo) toDomainVersion(version dao.GraphVersion) (domain.GraphVersion, error) {
+	var snapshot dao.GraphSnapshot
+	if err := json.Unmarshal([]byte(version.Snapshot), &snapshot); err != nil {
+		return domain.GraphVersion{}, err
+	}
+	graph := n.daoToDomain(dao.Graph{ID: version.GraphID, Metadata: snapshot.Metadata, Version: version.Version},
+		snapshot.Edges, snapshot.Nodes)
+	return domain.GraphVersion{
+		GraphID: version.GraphID,
+		Version: version.Version,
+		Graph:   graph,
+		Ctime:   version.Ctime,
+	}, nil
 }
 
 func (n *NodeRepo) DeleteGraph(ctx context.Context, id int64) error {
 	return n.graph.DeleteGraph(ctx, id)
 }
 
-func (n *NodeRepo) DeleteNode(ctx context.Context, id int64) error {
-	return n.graph.DeleteNode(ctx, id)
-}
-
-func (n *NodeRepo) DeleteEdge(ctx context.Context, id int64) error {
-	return n.graph.DeleteEdge(ctx, id)
-}
-
 func (n *NodeRepo) GetGraph(ctx context.Context, id int64) (domain.Graph, error) {
 	graph, err := n.graph.GetGraph(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Graph{}, fmt.Errorf("%w: %d", errs.ErrGraphNotFound, id)
+	}
 	if err != nil {
 		return domain.Graph{}, err
 	}
@@ -91,32 +118,66 @@ func (n *NodeRepo) GetGraph(ctx context.Context, id int64) (domain.Graph, error)
 	return n.daoToDomain(graph, edges, nodes), nil
 }
 
+func (n *NodeRepo) GetNodesByIDs(ctx context.Context, ids []int64) ([]domain.Node, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	nodes, err := n.graph.GetNodesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(nodes, func(idx int, src dao.Node) domain.Node {
+		return n.toDomainNode(src)
+	}), nil
+}
+
+func (n *NodeRepo) GetEdgesByIDs(ctx context.Context, ids []int64) ([]domain.Edge, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	edges, err := n.graph.GetEdgesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(edges, func(idx int, src dao.Edge) domain.Edge {
+		return n.toDomainEdge(src)
+	}), nil
+}
+
 func (n *NodeRepo) daoToDomain(graph dao.Graph, edges []dao.Edge, nodes []dao.Node) domain.Graph {
 	var plan domain.Graph
 	plan.ID = graph.ID
+	plan.Version = graph.Version
+	plan.Metadata = ekit.AnyValue{Val: graph.Metadata}
 	steps := slice.Map[dao.Node, domain.Node](nodes, func(idx int, src dao.Node) domain.Node {
-		metaData := src.Metadata
-		return domain.Node{
-			GraphID:  src.GraphID,
-			ID:       src.ID,
-			Type:     src.Type,
-			Status:   src.Status,
-			Metadata: ekit.AnyValue{Val: metaData},
-		}
+		return n.toDomainNode(src)
 	})
 	plan.Steps = steps
 
 	domainEdges := slice.Map[dao.Edge, domain.Edge](edges, func(idx int, src dao.Edge) domain.Edge {
-		metaData := src.Metadata
-		return domain.Edge{
-			GraphID:  src.GraphID,
-			ID:       src.ID,
-			SourceID: src.SourceID,
-			TargetID: src.TargetID,
-			Metadata: ekit.AnyValue{Val: metaData},
-		}
+		return n.toDomainEdge(src)
 	})
 
 	plan.Edges = domainEdges
 	return plan
 }
+
+func (n *NodeRepo) toDomainNode(src dao.Node) domain.Node {
+	return domain.Node{
+		GraphID:  src.GraphID,
+		ID:       src.ID,
+		Type:     src.Type,
+		Status:   src.Status,
+		Metadata: ekit.AnyValue{Val: src.Metadata},
+	}
+}
+
+func (n *NodeRepo) toDomainEdge(src dao.Edge) domain.Edge {
+	return domain.Edge{
+		GraphID:  src.GraphID,
+		ID:       src.ID,
+		SourceID: src.SourceID,
+		TargetID: src.TargetID,
+		Metadata: ekit.AnyValue{Val: src.Metadata},
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
+)
+
+type GraphRunRepo struct {
+	dao *dao.GraphRunDAO
+}
+
+func NewGraphRunRepo(d *dao.GraphRunDAO) *GraphRunRepo {
+	return &GraphRunRepo{dao: d}
+}
+
+// CreateRun 创建执行记录，run.Nodes 是所有节点的初始状态
+func (r *GraphRunRepo) CreateRun(ctx context.Context, run domain.GraphRun) (int64, error) {
+	return r.dao.CreateRun(ctx, dao.GraphRun{
+		GraphID: run.GraphID,
+		Version: run.Version,
+		Uid:     run.Uid,
+		Status:  string(run.Status),
+		Input:   r.marshal(run.Input),
+	}, slice.Map(run.Nodes, func(idx int, src domain.NodeRun) dao.NodeRun {
+		return r.toDaoNodeRun(src)
+	}))
+}
+
+func (r *GraphRunRepo) SaveNodeRun(ctx context.Context, node domain.NodeRun) error {
+	return r.dao.SaveNodeRun(ctx, r.toDaoNodeRun(node))
+}
+
+func (r *GraphRunRepo) UpdateRun(ctx context.Context, run domain.GraphRun) error {
+	return r.dao.UpdateRun(ctx, dao.GraphRun{
+		ID:     run.ID,
+		Status: string(run.Status),
+		Output: r.marshal(run.Output),
+		Error:  run.Error,
+	})
+}
+
+func (r *GraphRunRepo) GetRun(ctx context.Context, id int64) (domain.GraphRun, error) {
+	run, nodes, err := r.dao.GetRun(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.GraphRun{}, fmt.Errorf("%w: 执行记录 %d 不存在", errs.ErrInvalidParam, id)
+	}
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	res := r.toDomain(run)
+	res.Nodes = slice.Map(nodes, func(idx int, src dao.NodeRun) domain.NodeRun {
+		return r.toDomainNodeRun(src)
+	})
+	return res, nil
+}
+
+// ListWaitingNodeRuns 等待审批的节点，uid 大于 0 的时候只返回这个用户的，before 大于 0 的时候只返回已经超时的节点
+func (r *GraphRunRepo) ListWaitingNodeRuns(ctx context.Context, uid int64, before int64, limit int, offset int) ([]domain.NodeRun, error) {
+	nodes, err := r.dao.ListWaitingNodeRuns(ctx, uid, before, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(nodes, func(idx int, src dao.NodeRun) domain.NodeRun {
+		return r.toDomainNodeRun(src)
+	}), nil
+}
+
+func (r *GraphRunRepo) toDomainNodeRun(src dao.NodeRun) domain.NodeRun {
+	res := domain.NodeRun{
+		RunID:    src.RunID,
+		NodeID:   src.NodeID,
+		Status:   domain.NodeRunStatus(src.Status),
+		Input:    r.unmarshal(src.Input),
+		Output:   r.unmarshal(src.Output),
+		Error:    src.Error,
+		Branch:   src.Branch,
+		Tokens:   src.Tokens,
+		Latency:  src.Latency,
+		Attempts: src.Attempts,
+		Deadline: src.Deadline,
+	}
+	if src.Approval != "" {
+		var approval domain.NodeApproval
+		if err := json.Unmarshal([]byte(src.Approval), &approval); err == nil {
+			res.Approval = &approval
+		}
+	}
+	return res
+}
+
+func (r *GraphRunRepo) ListRuns(ctx context.Context, q domain.GraphRunQuery) ([]domain.GraphRun, error) {
+	runs, err := r.dao.ListRuns(ctx, q.Uid, q.GraphID, string(q.Status), q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(runs, func(idx int, src dao.GraphRun) domain.GraphRun {
+		return r.toDomain(src)
+	}), nil
+}
+
+// Restart 把状态是 from 之一的执行改成执行中，返回 false 表示执行的状态已经不是 from 了
+func (r *GraphRunRepo) Restart(ctx context.Context, id int64, from ...domain.GraphRunStatus) (bool, error) {
+	return r.dao.Restart(ctx, id, slice.Map(from, func(idx int, src domain.GraphRunStatus) string {
+		return string(src)
+	}))
+}
+
+func (r *GraphRunRepo) toDomain(run dao.GraphRun) domain.GraphRun {
+	return domain.GraphRun{
+		ID:      run.ID,
+		GraphID: run.GraphID,
+		Version: run.Version,
+		Uid:     run.Uid,
+		Status:  domain.GraphRunStatus(run.Status),
+		Input:   r.unmarshal(run.Input),
+		Output:  r.unmarshal(run.Output),
+		Error:   run.Error,
+		Ctime:   run.Ctime,
+		Utime:   run.Utime,
+	}
+}
+
+func (r *GraphRunRepo) toDaoNodeRun(src domain.NodeRun) dao.NodeRun {
+	var approval string
+	if src.Approval != nil {
+		approval = r.marshal(src.Approval)
+	}
+	return dao.NodeRun{
+		RunID:    src.RunID,
+		NodeID:   src.NodeID,
+		Status:   string(src.Status),
+		Input:    r.marshal(src.Input),
+		Output:   r.marshal(src.Output),
+		Error:    src.Error,
+		Branch:   src.Branch,
+		Tokens:   src.Tokens,
+		Latency:  src.Latency,
+		Attempts: src.Attempts,
+		Deadline: src.Deadline,
+		Approval: approval,
+	}
+}
+
+// marshal nil 保存为空字符串
+func (r *GraphRunRepo) marshal(val any) string {
+	if val == nil {
+		return ""
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (r *GraphRunRepo) unmarshal(val string) any {
+	if val == "" {
+		return nil
+	}
+	var res any
+	if err := json.Unmarshal([]byte(val), &res); err != nil {
+		return val
+	}
+	return res
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
+)
+
+type GraphTriggerRepo struct {
+	dao *dao.GraphTriggerDAO
+}
+
+func NewGraphTriggerRepo(d *dao.GraphTriggerDAO) *GraphTriggerRepo {
+	return &GraphTriggerRepo{dao: d}
+}
+
+func (r *GraphTriggerRepo) SaveTrigger(ctx context.Context, trigger domain.GraphTrigger) (int64, error) {
+	return r.dao.SaveTrigger(ctx, dao.GraphTrigger{
+		ID:       trigger.ID,
+		GraphID:  trigger.GraphID,
+		Uid:      trigger.Uid,
+		Type:     string(trigger.Type),
+		Cron:     trigger.Cron,
+		Secret:   trigger.Secret,
+		Enabled:  trigger.Enabled,
+		NextTime: trigger.NextTime,
+	})
+}
+
+func (r *GraphTriggerRepo) GetTrigger(ctx context.Context, id int64) (domain.GraphTrigger, error) {
+	trigger, err := r.dao.GetTrigger(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.GraphTrigger{}, fmt.Errorf("%w: %d", errs.ErrGraphTriggerNotFound, id)
+	}
+	if err != nil {
+		return domain.GraphTrigger{}, err
+	}
+	return r.toDomain(trigger), nil
+}
+
+func (r *GraphTriggerRepo) ListTriggers(ctx context.Context, graphID int64) ([]domain.GraphTrigger, error) {
+	triggers, err := r.dao.ListTriggers(ctx, graphID)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(triggers, func(idx int, src dao.GraphTrigger) domain.GraphTrigger {
+		return r.toDomain(src)
+	}), nil
+}
+
+func (r *GraphTriggerRepo) DeleteTrigger(ctx context.Context, id int64) error {
+	return r.dao.DeleteTrigger(ctx, id)
+}
+
+func (r *GraphTriggerRepo) ListDueTriggers(ctx context.Context, now int64, limit int) ([]domain.GraphTrigger, error) {
+	triggers, err := r.dao.ListDueTriggers(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(triggers, func(idx int, src dao.GraphTrigger) domain.GraphTrigger {
+		return r.toDomain(src)
+	}), nil
+}
+
+// Claim 抢占定时触发器的一次执行，返回 false 表示已经被别的实例抢走了
+func (r *GraphTriggerRepo) Claim(ctx context.Context, id int64, prev int64, next int64) (bool, error) {
+	return r.dao.Claim(ctx, id, prev, next)
+}
+
+func (r *GraphTriggerRepo) CreateRecord(ctx context.Context, record domain.GraphTriggerRecord) (int64, error) {
+	payload, _ := json.Marshal(record.Payload)
+	return r.dao.CreateRecord(ctx, dao.GraphTriggerRecord{
+		TriggerID: record.TriggerID,
+		GraphID:   record.GraphID,
+		Uid:       record.Uid,
+		Type:      string(record.Type),
+		Payload:   string(payload),
+		RunID:     record.RunID,
+		Status:    string(record.Status),
+		Error:     record.Error,
+		FireTime:  record.FireTime,
+	})
+}
+
+func (r *GraphTriggerRepo) ListRecords(ctx context.Context, q domain.GraphTriggerQuery) ([]domain.GraphTriggerRecord, error) {
+	records, err := r.dao.ListRecords(ctx, q.Uid, q.GraphID, q.TriggerID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(records, func(idx int, src dao.GraphTriggerRecord) domain.GraphTriggerRecord {
+		var payload any
+		_ = json.Unmarshal([]byte(src.Payload), &payload)
+		return domain.GraphTriggerRecord{
+			ID:        src.ID,
+			TriggerID: src.TriggerID,
+			GraphID:   src.GraphID,
+			Uid:       src.Uid,
+			Type:      domain.GraphTriggerType(src.Type),
+			Payload:   payload,
+			RunID:     src.RunID,
+			Status:    domain.GraphTriggerRecordStatus(src.Status),
+			Error:     src.Error,
+			FireTime:  src.FireTime,
+			Ctime:     src.Ctime,
+		}
+	}), nil
+}
+
+func (r *GraphTriggerRepo) toDomain(src dao.GraphTrigger) domain.GraphTrigger {
+	return domain.GraphTrigger{
+		ID:       src.ID,
+		GraphID:  src.GraphID,
+		Uid:      src.Uid,
+		Type:     domain.GraphTriggerType(src.Type),
+		Cron:     src.Cron,
+		Secret:   src.Secret,
+		Enabled:  src.Enabled,
+		NextTime: src.NextTime,
+		Ctime:    src.Ctime,
+		Utime:    src.Utime,
+	}
+}
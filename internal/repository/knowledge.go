@@ -0,0 +1,198 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+	"gorm.io/gorm"
+)
+
+type KnowledgeRepo struct {
+	dao *dao.KnowledgeDAO
+}
+
+func NewKnowledgeRepo(d *dao.KnowledgeDAO) *KnowledgeRepo {
+	return &KnowledgeRepo{dao: d}
+}
+
+func (r *KnowledgeRepo) SaveBase(ctx context.Context, kb domain.KnowledgeBase) (int64, error) {
+	return r.dao.SaveBase(ctx, dao.KnowledgeBase{
+		ID:           kb.ID,
+		Owner:        kb.Owner,
+		Name:         kb.Name,
+		Description:  kb.Description,
+		ChunkSize:    kb.ChunkSize,
+		ChunkOverlap: kb.ChunkOverlap,
+	})
+}
+
+func (r *KnowledgeRepo) GetBase(ctx context.Context, id int64) (domain.KnowledgeBase, error) {
+	kb, err := r.dao.GetBase(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.KnowledgeBase{}, fmt.Errorf("%w: 知识库 %d", errs.ErrKnowledgeNotFound, id)
+	}
+	if err != nil {
+		return domain.KnowledgeBase{}, err
+	}
+	return r.toDomainBase(kb), nil
+}
+
+func (r *KnowledgeRepo) ListBases(ctx context.Context, owner int64) ([]domain.KnowledgeBase, error) {
+	bases, err := r.dao.ListBases(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(bases, func(idx int, src dao.KnowledgeBase) domain.KnowledgeBase {
+		return r.toDomainBase(src)
+	}), nil
+}
+
+func (r *KnowledgeRepo) DeleteBase(ctx context.Context, id int64) error {
+	return r.dao.DeleteBase(ctx, id)
+}
+
+func (r *KnowledgeRepo) CreateDocument(ctx context.Context, doc domain.KnowledgeDocument) (int64, error) {
+	return r.dao.CreateDocument(ctx, dao.KnowledgeDocument{
+		KBID:    doc.KBID,
+		Owner:   doc.Owner,
+		Title:   doc.Title,
+		Format:  string(doc.Format),
+		Content: doc.Content,
+		Status:  string(doc.Status),
+	})
+}
+
+func (r *KnowledgeRepo) GetDocument(ctx context.Context, id int64) (domain.KnowledgeDocument, error) {
+	doc, err := r.dao.GetDocument(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.KnowledgeDocument{}, fmt.Errorf("%w: 文档 %d", errs.ErrKnowledgeNotFound, id)
+	}
+	if err != nil {
+		return domain.KnowledgeDocument{}, err
+	}
+	return r.toDomainDocument(doc), nil
+}
+
+func (r *KnowledgeRepo) ListDocuments(ctx context.Context, q domain.KnowledgeDocumentQuery) ([]domain.KnowledgeDocument, error) {
+	docs, err := r.dao.ListDocuments(ctx, q.Owner, q.KBID, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(docs, func(idx int, src dao.KnowledgeDocument) domain.KnowledgeDocument {
+		return r.toDomainDocument(src)
+	}), nil
+}
+
+func (r *KnowledgeRepo) UpdateProgress(ctx context.Context, doc domain.KnowledgeDocument) error {
+	return r.dao.UpdateProgress(ctx, dao.KnowledgeDocument{
+		ID:       doc.ID,
+		Status:   string(doc.Status),
+		Progress: doc.Progress,
+		Chunks:   doc.Chunks,
+		Error:    doc.Error,
+	})
+}
+
+func (r *KnowledgeRepo) DeleteDocument(ctx context.Context, id int64) error {
+	return r.dao.DeleteDocument(ctx, id)
+}
+
+func (r *KnowledgeRepo) DeleteChunks(ctx context.Context, docID int64) error {
+	return r.dao.DeleteChunks(ctx, docID)
+}
+
+// SaveChunks 保存同一个文档的一批片段，文档已经被删除的时候返回 ErrKnowledgeNotFound
+func (r *KnowledgeRepo) SaveChunks(ctx context.Context, chunks []domain.KnowledgeChunk) error {
+	err := r.dao.SaveChunks(ctx, slice.Map(chunks, func(idx int, src domain.KnowledgeChunk) dao.KnowledgeChunk {
+		return dao.KnowledgeChunk{
+			DocID:   src.DocID,
+			Idx:     src.Index,
+			KBID:    src.KBID,
+			Owner:   src.Owner,
+			Content: src.Content,
+		}
+	}))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: 文档 %d", errs.ErrKnowledgeNotFound, chunks[0].DocID)
+	}
+	return err
+}
+
+// ListStaleDocuments 还没有导入完，但是在 utime 之前就没有更新过进度的文档
+func (r *KnowledgeRepo) ListStaleDocuments(ctx context.Context, utime int64) ([]domain.KnowledgeDocument, error) {
+	docs, err := r.dao.ListStaleDocuments(ctx,
+		[]string{string(domain.DocumentStatusPending), string(domain.DocumentStatusProcessing)}, utime)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(docs, func(idx int, src dao.KnowledgeDocument) domain.KnowledgeDocument {
+		return r.toDomainDocument(src)
+	}), nil
+}
+
+func (r *KnowledgeRepo) ListChunks(ctx context.Context, docID int64, limit int, offset int) ([]domain.KnowledgeChunk, error) {
+	chunks, err := r.dao.ListChunks(ctx, docID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(chunks, func(idx int, src dao.KnowledgeChunk) domain.KnowledgeChunk {
+		return domain.KnowledgeChunk{
+			ID:      src.ID,
+			DocID:   src.DocID,
+			KBID:    src.KBID,
+			Owner:   src.Owner,
+			Index:   src.Idx,
+			Content: src.Content,
+			Ctime:   src.Ctime,
+		}
+	}), nil
+}
+
+func (r *KnowledgeRepo) toDomainBase(src dao.KnowledgeBase) domain.KnowledgeBase {
+	return domain.KnowledgeBase{
+		ID:           src.ID,
+		Owner:        src.Owner,
+		Name:         src.Name,
+		Description:  src.Description,
+		ChunkSize:    src.ChunkSize,
+		ChunkOverlap: src.ChunkOverlap,
+		Ctime:        src.Ctime,
+		Utime:        src.Utime,
+	}
+}
+
+func (r *KnowledgeRepo) toDomainDocument(src dao.KnowledgeDocument) domain.KnowledgeDocument {
+	return domain.KnowledgeDocument{
+		ID:       src.ID,
+		KBID:     src.KBID,
+		Owner:    src.Owner,
+		Title:    src.Title,
+		Format:   domain.DocumentFormat(src.Format),
+		Content:  src.Content,
+		Status:   domain.DocumentStatus(src.Status),
+		Progress: src.Progress,
+		Chunks:   src.Chunks,
+		Error:    src.Error,
+		Ctime:    src.Ctime,
+		Utime:    src.Utime,
+	}
+}
@@ -16,10 +16,16 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
 )
 
 type PromptRepo struct {
@@ -54,18 +60,7 @@ func (p *PromptRepo) Get(ctx context.Context, id int64) (domain.Prompt, error) {
 	}
 	versions := make([]domain.PromptVersion, 0, len(dVersions))
 	for _, v := range dVersions {
-		versions = append(versions, domain.PromptVersion{
-			ID:            v.ID,
-			Label:         v.Label,
-			Content:       v.Content,
-			SystemContent: v.SystemContent,
-			Temperature:   v.Temperature,
-			TopN:          v.TopN,
-			MaxTokens:     v.MaxTokens,
-			Status:        v.Status,
-			Ctime:         time.UnixMilli(v.Ctime),
-			Utime:         time.UnixMilli(v.Utime),
-		})
+		versions = append(versions, p.toDomainVersion(v))
 	}
 	return domain.Prompt{
 		ID:            prompt.ID,
@@ -75,11 +70,165 @@ func (p *PromptRepo) Get(ctx context.Context, id int64) (domain.Prompt, error) {
 		ActiveVersion: prompt.ActiveVersion,
 		Versions:      versions,
 		Description:   prompt.Description,
+		Status:        prompt.Status,
 		Ctime:         time.UnixMilli(prompt.Ctime),
 		Utime:         time.UnixMilli(prompt.Utime),
 	}, nil
 }
 
+// FindByName 按照名字和 owner 查找 prompt，找不到的时候返回零值
+func (p *PromptRepo) FindByName(ctx context.Context, owner int64, ownerType domain.OwnerType, name string) (domain.Prompt, error) {
+	prompt, versions, err := p.dao.FindByName(ctx, owner, string(ownerType), name)
+	if err != nil || prompt.ID == 0 {
+		return domain.Prompt{}, err
+	}
+	res := p.toDomain(prompt)
+	res.Versions = slice.Map(versions, func(idx int, src dao.PromptVersion) domain.PromptVersion {
+		return p.toDomainVersion(src)
+	})
+	return res, nil
+}
+
+// Save 保存 prompt 和 prompt.Versions，ID 为 0 的会新建，返回 prompt 的 ID。
+// active 是发布版本在 prompt.Versions 中的下标，小于 0 表示使用 prompt.ActiveVersion
+func (p *PromptRepo) Save(ctx context.Context, prompt domain.Prompt, active int) (int64, error) {
+	return p.dao.Save(ctx, dao.Prompt{
+		ID:            prompt.ID,
+		Name:          prompt.Name,
+		Owner:         prompt.Owner,
+		OwnerType:     string(prompt.OwnerType),
+		Description:   prompt.Description,
+		ActiveVersion: prompt.ActiveVersion,
+		Status:        1,
+	}, slice.Map(prompt.Versions, func(idx int, src domain.PromptVersion) dao.PromptVersion {
+		return dao.PromptVersion{
+			ID:            src.ID,
+			Label:         src.Label,
+			Content:       src.Content,
+			SystemContent: src.SystemContent,
+			Temperature:   src.Temperature,
+			TopN:          src.TopN,
+			MaxTokens:     src.MaxTokens,
+			Status:        1,
+			Weight:        src.Weight,
+		}
+	}), active)
+}
+
+// List 查询 prompt 列表，不会查询版本信息
+func (p *PromptRepo) List(ctx context.Context, q domain.PromptQuery) (domain.PromptPage, error) {
+	cursorValue, cursorID, err := decodePromptCursor(q.Cursor, q.SortBy, q.Asc)
+	if err != nil {
+		return domain.PromptPage{}, err
+	}
+	prompts, err := p.dao.List(ctx, dao.PromptQuery{
+		Owner:        q.Owner,
+		OwnerType:    string(q.OwnerType),
+		Keyword:      q.Keyword,
+		Status:       q.Status,
+		HasPublished: q.HasPublished,
+		SortBy:       q.SortBy,
+		Asc:          q.Asc,
+		CursorValue:  cursorValue,
+		CursorID:     cursorID,
+		Limit:        q.Limit,
+	})
+	if err != nil {
+		return domain.PromptPage{}, err
+	}
+	page := domain.PromptPage{
+		Prompts: slice.Map(prompts, func(idx int, src dao.Prompt) domain.Prompt {
+			return p.toDomain(src)
+		}),
+	}
+	// 不满一页说明已经没有数据了
+	if len(prompts) == q.Limit && q.Limit > 0 {
+		last := prompts[len(prompts)-1]
+		page.NextCursor = encodePromptCursor(q.SortBy, q.Asc, promptSortValue(last, q.SortBy), last.ID)
+	}
+	return page, nil
+}
+
+func (p *PromptRepo) toDomain(prompt dao.Prompt) domain.Prompt {
+	return domain.Prompt{
+		ID:            prompt.ID,
+		Name:          prompt.Name,
+		Owner:         prompt.Owner,
+		OwnerType:     domain.OwnerType(prompt.OwnerType),
+		ActiveVersion: prompt.ActiveVersion,
+		Description:   prompt.Description,
+		Status:        prompt.Status,
+		Ctime:         time.UnixMilli(prompt.Ctime),
+		Utime:         time.UnixMilli(prompt.Utime),
+	}
+}
+
+func (p *PromptRepo) toDomainVersion(v dao.PromptVersion) domain.PromptVersion {
+	return domain.PromptVersion{
+		ID:            v.ID,
+		Label:         v.Label,
+		Content:       v.Content,
+		SystemContent: v.SystemContent,
+		Temperature:   v.Temperature,
+		TopN:          v.TopN,
+		MaxTokens:     v.MaxTokens,
+		Status:        v.Status,
+		Weight:        v.Weight,
+		Ctime:         time.UnixMilli(v.Ctime),
+		Utime:         time.UnixMilli(v.Utime),
+	}
+}
+
+func promptSortValue(prompt dao.Prompt, sortBy string) int64 {
+	switch sortBy {
+	case "id":
+		return prompt.ID
+	case "ctime":
+		return prompt.Ctime
+	default:
+		return prompt.Utime
+	}
+}
+
+// 游标是排序方式加上上一页最后一条记录的排序字段的值和 id，对调用者来说是不透明的
+func encodePromptCursor(sortBy string, asc bool, value int64, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s_%s_%d_%d", sortBy, promptOrder(asc), value, id)))
+}
+
+// decodePromptCursor 游标的排序方式必须和这一次查询一致，否则排序字段的值没有意义
+func decodePromptCursor(cursor string, sortBy string, asc bool) (int64, int64, error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: 非法的游标", errs.ErrInvalidParam)
+	}
+	parts := strings.Split(string(raw), "_")
+	if len(parts) != 4 {
+		return 0, 0, fmt.Errorf("%w: 非法的游标", errs.ErrInvalidParam)
+	}
+	if parts[0] != sortBy || parts[1] != promptOrder(asc) {
+		return 0, 0, fmt.Errorf("%w: 游标和排序方式不一致", errs.ErrInvalidParam)
+	}
+	value, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: 非法的游标", errs.ErrInvalidParam)
+	}
+	id, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, 0, fmt.Errorf("%w: 非法的游标", errs.ErrInvalidParam)
+	}
+	return value, id, nil
+}
+
+func promptOrder(asc bool) string {
+	if asc {
+		return "asc"
+	}
+	return "desc"
+}
+
 func (p *PromptRepo) Delete(ctx context.Context, id int64) error {
 	return p.dao.Delete(ctx, id)
 }
@@ -111,6 +260,27 @@ func (p *PromptRepo) UpdateActiveVersion(ctx context.Context, versionID int64, l
 	return p.dao.UpdateActiveVersion(ctx, versionID, label)
 }
 
+func (p *PromptRepo) UpdateWeights(ctx context.Context, promptID int64, weights map[int64]int) error {
+	return p.dao.UpdateWeights(ctx, promptID, weights)
+}
+
+func (p *PromptRepo) VersionStats(ctx context.Context, promptID int64) ([]domain.PromptVersionStats, error) {
+	res, err := p.dao.VersionStats(ctx, promptID)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.PromptVersionStats) domain.PromptVersionStats {
+		return domain.PromptVersionStats{
+			VersionID:  src.VersionID,
+			Count:      src.Count,
+			AvgLatency: int64(src.AvgLatency),
+			Tokens:     src.Tokens,
+			Up:         src.Up,
+			Down:       src.Down,
+		}
+	}), nil
+}
+
 func (p *PromptRepo) InsertVersion(ctx context.Context, id int64, version domain.PromptVersion) error {
 	return p.dao.InsertVersion(ctx, dao.PromptVersion{
 		PromptID:      id,
@@ -136,6 +306,7 @@ func (p *PromptRepo) GetByVersionID(ctx context.Context, id int64) (domain.Promp
 		TopN:          res.TopN,
 		MaxTokens:     res.MaxTokens,
 		Status:        res.Status,
+		Weight:        res.Weight,
 		Ctime:         time.UnixMilli(res.Ctime),
 		Utime:         time.UnixMilli(res.Utime),
 	}
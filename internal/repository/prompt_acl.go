@@ -0,0 +1,69 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type PromptACLRepo struct {
+	dao *dao.PromptACLDAO
+}
+
+func NewPromptACLRepo(dao *dao.PromptACLDAO) *PromptACLRepo {
+	return &PromptACLRepo{dao: dao}
+}
+
+func (r *PromptACLRepo) Save(ctx context.Context, acl domain.PromptACL) error {
+	return r.dao.Upsert(ctx, dao.PromptACL{
+		Scope:   string(acl.Scope),
+		ScopeID: acl.ScopeID,
+		Uid:     acl.Uid,
+		Role:    uint8(acl.Role),
+	})
+}
+
+func (r *PromptACLRepo) Delete(ctx context.Context, scope domain.ACLScope, scopeID int64, uid int64) error {
+	return r.dao.Delete(ctx, string(scope), scopeID, uid)
+}
+
+// Role 查询用户在某个范围内的角色，没有授权返回 PromptRoleNone
+func (r *PromptACLRepo) Role(ctx context.Context, scope domain.ACLScope, scopeID int64, uid int64) (domain.PromptRole, error) {
+	res, err := r.dao.Find(ctx, string(scope), scopeID, uid)
+	return domain.PromptRole(res.Role), err
+}
+
+func (r *PromptACLRepo) List(ctx context.Context, scope domain.ACLScope, scopeID int64) ([]domain.PromptACL, error) {
+	res, err := r.dao.List(ctx, string(scope), scopeID)
+	if err != nil {
+		return nil, err
+	}
+	return slice.Map(res, func(idx int, src dao.PromptACL) domain.PromptACL {
+		return domain.PromptACL{
+			ID:      src.ID,
+			Scope:   domain.ACLScope(src.Scope),
+			ScopeID: src.ScopeID,
+			Uid:     src.Uid,
+			Role:    domain.PromptRole(src.Role),
+			Ctime:   time.UnixMilli(src.Ctime),
+			Utime:   time.UnixMilli(src.Utime),
+		}
+	}), nil
+}
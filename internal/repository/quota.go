@@ -58,6 +58,18 @@ func (q *QuotaRepo) Deduct(ctx context.Context, uid int64, amount int64, key str
 	return q.dao.Deduct(ctx, uid, amount, key)
 }
 
+func (q *QuotaRepo) GetRecord(ctx context.Context, key string) (domain.Record, error) {
+	record, err := q.dao.GetRecord(ctx, key)
+	if err != nil {
+		return domain.Record{}, err
+	}
+	return domain.Record{Uid: record.Uid, Key: record.Key, Amount: record.Amount}, nil
+}
+
+func (q *QuotaRepo) Balance(ctx context.Context, uid int64) (int64, error) {
+	return q.dao.Balance(ctx, uid)
+}
+
 func (q *QuotaRepo) toDomainTempQuota(tmpQuotaList []dao.TempQuota) []domain.TempQuota {
 	return slice.Map[dao.TempQuota, domain.TempQuota](tmpQuotaList, func(idx int, src dao.TempQuota) domain.TempQuota {
 		return domain.TempQuota{
@@ -0,0 +1,356 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// MemoryVectorStore 在内存里面逐个计算相似度，用于测试或者数据量很小的场景
+type MemoryVectorStore struct {
+	mu         sync.RWMutex
+	dimensions int
+	records    map[string]domain.VectorRecord
+}
+
+func NewMemoryVectorStore(dimensions int) *MemoryVectorStore {
+	return &MemoryVectorStore{dimensions: dimensions, records: make(map[string]domain.VectorRecord)}
+}
+
+func (s *MemoryVectorStore) Upsert(ctx context.Context, records []domain.VectorRecord) error {
+	for _, record := range records {
+		if err := checkVectorRecord(record, s.dimensions); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		record.Vector = slices.Clone(record.Vector)
+		record.Metadata = maps.Clone(record.Metadata)
+		s.records[record.ID] = record
+	}
+	return nil
+}
+
+func (s *MemoryVectorStore) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+func (s *MemoryVectorStore) Search(ctx context.Context, q domain.VectorQuery) ([]domain.VectorMatch, error) {
+	if err := checkVectorQuery(q, s.dimensions); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]domain.VectorMatch, 0, min(q.TopK, len(s.records)))
+	for id, record := range s.records {
+		if !matchFilter(record.Metadata, q.Filter) {
+			continue
+		}
+		res = append(res, domain.VectorMatch{
+			ID:       id,
+			Score:    cosine(q.Vector, record.Vector),
+			Metadata: maps.Clone(record.Metadata),
+		})
+	}
+	slices.SortFunc(res, func(a, b domain.VectorMatch) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+	})
+	if len(res) > q.TopK {
+		res = res[:q.TopK]
+	}
+	return res, nil
+}
+
+const (
+	vectorField   = "vector"
+	metadataField = "metadata"
+	scoreField    = "vector_score"
+)
+
+// RedisVectorStore 基于 RediSearch 的向量检索，需要 Redis Stack 或者加载了 RediSearch 模块的 Redis。
+// 每条记录是一个 hash，Metadata 里面用来过滤的字段需要在创建的时候通过 tags 声明
+type RedisVectorStore struct {
+	rdb        redis.UniversalClient
+	index      string
+	prefix     string
+	dimensions int
+	tags       []string
+}
+
+func NewRedisVectorStore(rdb redis.UniversalClient, index string, dimensions int, tags ...string) *RedisVectorStore {
+	return &RedisVectorStore{
+		rdb:        rdb,
+		index:      index,
+		prefix:     fmt.Sprintf("vector:%s:", index),
+		dimensions: dimensions,
+		tags:       tags,
+	}
+}
+
+// CreateIndex 创建索引，索引已经存在的时候什么也不做
+func (s *RedisVectorStore) CreateIndex(ctx context.Context) error {
+	args := []any{"FT.CREATE", s.index, "ON", "HASH", "PREFIX", 1, s.prefix, "SCHEMA",
+		vectorField, "VECTOR", "FLAT", 6, "TYPE", "FLOAT32", "DIM", s.dimensions, "DISTANCE_METRIC", "COSINE"}
+	for _, tag := range s.tags {
+		args = append(args, tag, "TAG")
+	}
+	err := s.rdb.Do(ctx, args...).Err()
+	if err != nil && strings.Contains(err.Error(), "Index already exists") {
+		return nil
+	}
+	return err
+}
+
+// Upsert 先删除旧的记录，避免旧的 tag 字段留下来
+func (s *RedisVectorStore) Upsert(ctx context.Context, records []domain.VectorRecord) error {
+	for _, record := range records {
+		if err := checkVectorRecord(record, s.dimensions); err != nil {
+			return err
+		}
+		for key := range record.Metadata {
+			if key == vectorField || key == metadataField || key == scoreField {
+				return fmt.Errorf("%w: metadata 不能使用保留的字段 %s", errs.ErrInvalidParam, key)
+			}
+		}
+	}
+	pipe := s.rdb.TxPipeline()
+	for _, record := range records {
+		metadata, err := json.Marshal(record.Metadata)
+		if err != nil {
+			return err
+		}
+		fields := map[string]any{
+			vectorField:   encodeVector(record.Vector),
+			metadataField: metadata,
+		}
+		for _, tag := range s.tags {
+			if val, ok := record.Metadata[tag]; ok {
+				fields[tag] = val
+			}
+		}
+		key := s.prefix + record.ID
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisVectorStore) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, s.prefix+id)
+	}
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+func (s *RedisVectorStore) Search(ctx context.Context, q domain.VectorQuery) ([]domain.VectorMatch, error) {
+	if err := checkVectorQuery(q, s.dimensions); err != nil {
+		return nil, err
+	}
+	filter := "*"
+	if len(q.Filter) > 0 {
+		conditions := make([]string, 0, len(q.Filter))
+		for _, key := range slices.Sorted(maps.Keys(q.Filter)) {
+			if !slices.Contains(s.tags, key) {
+				return nil, fmt.Errorf("%w: %s 不能用来过滤", errs.ErrInvalidParam, key)
+			}
+			conditions = append(conditions, fmt.Sprintf("@%s:{%s}", key, escapeTag(q.Filter[key])))
+		}
+		filter = "(" + strings.Join(conditions, " ") + ")"
+	}
+	query := fmt.Sprintf("%s=>[KNN %d @%s $vec AS %s]", filter, q.TopK, vectorField, scoreField)
+	reply, err := s.rdb.Do(ctx, "FT.SEARCH", s.index, query,
+		"PARAMS", 2, "vec", encodeVector(q.Vector),
+		"SORTBY", scoreField, "ASC",
+		"RETURN", 2, scoreField, metadataField,
+		"LIMIT", 0, q.TopK,
+		"DIALECT", 2).Result()
+	if err != nil {
+		return nil, err
+	}
+	docs, err := parseSearchReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.VectorMatch, 0, len(docs))
+	for _, doc := range docs {
+		match, err := s.toMatch(doc)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, match)
+	}
+	return res, nil
+}
+
+// searchDoc FT.SEARCH 返回的一条记录
+type searchDoc struct {
+	key    string
+	fields map[string]string
+}
+
+func (s *RedisVectorStore) toMatch(doc searchDoc) (domain.VectorMatch, error) {
+	// 余弦距离是 1 - 余弦相似度
+	distance, err := strconv.ParseFloat(doc.fields[scoreField], 32)
+	if err != nil {
+		return domain.VectorMatch{}, fmt.Errorf("解析 %s 的距离失败：%w", doc.key, err)
+	}
+	var metadata map[string]string
+	if raw := doc.fields[metadataField]; raw != "" {
+		if err = json.Unmarshal([]byte(raw), &metadata); err != nil {
+			return domain.VectorMatch{}, fmt.Errorf("解析 %s 的 metadata 失败：%w", doc.key, err)
+		}
+	}
+	return domain.VectorMatch{
+		ID:       strings.TrimPrefix(doc.key, s.prefix),
+		Score:    float32(1 - distance),
+		Metadata: metadata,
+	}, nil
+}
+
+// parseSearchReply 兼容 RESP2 和 RESP3 两种格式。
+// RESP2 是 [总数, key, [字段, 值, ...], ...]，RESP3 是 {results: [{id: key, extra_attributes: {字段: 值}}]}
+func parseSearchReply(reply any) ([]searchDoc, error) {
+	switch val := reply.(type) {
+	case []any:
+		if len(val) == 0 {
+			return nil, nil
+		}
+		docs := make([]searchDoc, 0, len(val)/2)
+		for i := 1; i+1 < len(val); i += 2 {
+			key, ok := val[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("无法解析 FT.SEARCH 的结果 %v", val[i])
+			}
+			pairs, ok := val[i+1].([]any)
+			if !ok {
+				return nil, fmt.Errorf("无法解析 FT.SEARCH 的结果 %v", val[i+1])
+			}
+			fields := make(map[string]string, len(pairs)/2)
+			for j := 0; j+1 < len(pairs); j += 2 {
+				fields[fmt.Sprint(pairs[j])] = fmt.Sprint(pairs[j+1])
+			}
+			docs = append(docs, searchDoc{key: key, fields: fields})
+		}
+		return docs, nil
+	case map[any]any:
+		results, _ := val["results"].([]any)
+		docs := make([]searchDoc, 0, len(results))
+		for _, result := range results {
+			item, ok := result.(map[any]any)
+			if !ok {
+				return nil, fmt.Errorf("无法解析 FT.SEARCH 的结果 %v", result)
+			}
+			attrs, _ := item["extra_attributes"].(map[any]any)
+			fields := make(map[string]string, len(attrs))
+			for k, v := range attrs {
+				fields[fmt.Sprint(k)] = fmt.Sprint(v)
+			}
+			docs = append(docs, searchDoc{key: fmt.Sprint(item["id"]), fields: fields})
+		}
+		return docs, nil
+	default:
+		return nil, fmt.Errorf("无法解析 FT.SEARCH 的结果 %T", reply)
+	}
+}
+
+// escapeTag TAG 查询里面的标点和空格需要转义
+func escapeTag(val string) string {
+	var sb strings.Builder
+	for _, r := range val {
+		if r < 128 && !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// encodeVector RediSearch 要求 FLOAT32 的向量是小端序的字节
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func checkVectorRecord(record domain.VectorRecord, dimensions int) error {
+	if record.ID == "" {
+		return fmt.Errorf("%w: 向量的 ID 不能为空", errs.ErrInvalidParam)
+	}
+	if len(record.Vector) != dimensions {
+		return fmt.Errorf("%w: 向量 %s 是 %d 维，需要 %d 维", errs.ErrInvalidParam, record.ID, len(record.Vector), dimensions)
+	}
+	return nil
+}
+
+func checkVectorQuery(q domain.VectorQuery, dimensions int) error {
+	if q.TopK <= 0 {
+		return fmt.Errorf("%w: top_k 必须大于 0", errs.ErrInvalidParam)
+	}
+	if len(q.Vector) != dimensions {
+		return fmt.Errorf("%w: 检索的向量是 %d 维，需要 %d 维", errs.ErrInvalidParam, len(q.Vector), dimensions)
+	}
+	return nil
+}
+
+func matchFilter(metadata map[string]string, filter map[string]string) bool {
+	for key, val := range filter {
+		if v, ok := metadata[key]; !ok || v != val {
+			return false
+		}
+	}
+	return true
+}
+
+// cosine 有一个是零向量的时候返回 0
+func cosine(a, b []float32) float32 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
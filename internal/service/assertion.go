@@ -0,0 +1,145 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+// checkAssertion 校验不需要大模型参与的断言，返回是否通过以及失败原因
+func checkAssertion(a domain.Assertion, output string) (bool, string) {
+	switch a.Type {
+	case domain.AssertionContains:
+		if strings.Contains(output, a.Value) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("输出不包含 %q", a.Value)
+	case domain.AssertionExact:
+		if strings.TrimSpace(output) == strings.TrimSpace(a.Value) {
+			return true, ""
+		}
+		return false, "输出与期望不一致"
+	case domain.AssertionRegex:
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return false, fmt.Sprintf("正则表达式错误: %s", err)
+		}
+		if re.MatchString(output) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("输出不匹配 %s", a.Value)
+	case domain.AssertionJSONSchema:
+		var schema map[string]any
+		if err := json.Unmarshal([]byte(a.Value), &schema); err != nil {
+			return false, fmt.Sprintf("JSON schema 错误: %s", err)
+		}
+		var val any
+		if err := json.Unmarshal([]byte(output), &val); err != nil {
+			return false, "输出不是合法的 JSON"
+		}
+		if err := validateJSONSchema(schema, val, "$"); err != nil {
+			return false, err.Error()
+		}
+		return true, ""
+	default:
+		return false, fmt.Sprintf("未知的断言类型 %s", a.Type)
+	}
+}
+
+// validateJSONSchema 只支持 JSON schema 中最常用的 type、enum、required、properties 和 items
+func validateJSONSchema(schema map[string]any, val any, path string) error {
+	if typ, ok := schema["type"].(string); ok && !matchJSONType(typ, val) {
+		return fmt.Errorf("%s 的类型应该是 %s", path, typ)
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s 不在可选值范围内", path)
+		}
+	}
+	switch v := val.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				key, _ := r.(string)
+				if _, exist := v[key]; !exist {
+					return fmt.Errorf("%s 缺少字段 %s", path, key)
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for key, sub := range props {
+			subSchema, ok := sub.(map[string]any)
+			field, exist := v[key]
+			if !ok || !exist {
+				continue
+			}
+			if err := validateJSONSchema(subSchema, field, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func matchJSONType(typ string, val any) bool {
+	switch typ {
+	case "object":
+		_, ok := val.(map[string]any)
+		return ok
+	case "array":
+		_, ok := val.([]any)
+		return ok
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		f, ok := val.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "null":
+		return val == nil
+	default:
+		return true
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAssertion(t *testing.T) {
+	const schema = `{
+  "type": "object",
+  "required": ["name", "tags"],
+  "properties": {
+    "name": {"type": "string"},
+    "age": {"type": "integer"},
+    "level": {"enum": ["low", "high"]},
+    "tags": {"type": "array", "items": {"type": "string"}}
+  }
+}`
+	testCases := []struct {
+		name      string
+		assertion domain.Assertion
+		output    string
+		wantOk    bool
+	}{
+		{
+			name:      "包含",
+			assertion: domain.Assertion{Type: domain.AssertionContains, Value: "world"},
+			output:    "hello world",
+			wantOk:    true,
+		},
+		{
+			name:      "不包含",
+			assertion: domain.Assertion{Type: domain.AssertionContains, Value: "golang"},
+			output:    "hello world",
+		},
+		{
+			name:      "完全匹配忽略首尾空白",
+			assertion: domain.Assertion{Type: domain.AssertionExact, Value: "42"},
+			output:    " 42\n",
+			wantOk:    true,
+		},
+		{
+			name:      "正则匹配",
+			assertion: domain.Assertion{Type: domain.AssertionRegex, Value: `^\d{3}-\d{4}$`},
+			output:    "123-4567",
+			wantOk:    true,
+		},
+		{
+			name:      "非法正则",
+			assertion: domain.Assertion{Type: domain.AssertionRegex, Value: `(`},
+			output:    "(",
+		},
+		{
+			name:      "JSON schema 通过",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `{"name": "Tom", "age": 18, "level": "low", "tags": ["a"]}`,
+			wantOk:    true,
+		},
+		{
+			name:      "JSON schema 缺少字段",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `{"name": "Tom"}`,
+		},
+		{
+			name:      "JSON schema 类型错误",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `{"name": "Tom", "age": 1.5, "tags": []}`,
+		},
+		{
+			name:      "JSON schema 枚举错误",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `{"name": "Tom", "level": "mid", "tags": []}`,
+		},
+		{
+			name:      "JSON schema 数组元素错误",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `{"name": "Tom", "tags": [1]}`,
+		},
+		{
+			name:      "输出不是 JSON",
+			assertion: domain.Assertion{Type: domain.AssertionJSONSchema, Value: schema},
+			output:    `name: Tom`,
+		},
+		{
+			name:      "未知类型",
+			assertion: domain.Assertion{Type: "unknown"},
+			output:    "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, reason := checkAssertion(tc.assertion, tc.output)
+			assert.Equal(t, tc.wantOk, ok)
+			if !ok {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
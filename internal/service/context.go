@@ -0,0 +1,158 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+)
+
+// defaultContextWindow Handler 没有实现 llm.Tokenizer 的时候使用的窗口大小
+const defaultContextWindow = 32 * 1024
+
+var defaultContextConfig = domain.ContextConfig{
+	Strategy:       domain.ContextStrategyTokens,
+	ReservedTokens: 4096,
+	LastN:          20,
+	MaxHistory:     200,
+}
+
+// ContextBuilder 根据配置把历史消息裁剪成模型能够接受的上下文
+type ContextBuilder struct {
+	// 可能为 nil，这时候使用粗略的估算
+	tokenizer llm.Tokenizer
+}
+
+func NewContextBuilder(handler llm.Handler) *ContextBuilder {
+	tokenizer, _ := handler.(llm.Tokenizer)
+	return &ContextBuilder{tokenizer: tokenizer}
+}
+
+// Build 系统消息和最新的一轮对话总是保留，更早的对话按照轮次从新到旧加入，直到超出限制。
+// 一轮对话从用户消息开始，包含之后模型的回复，裁剪的时候不会把一轮对话拆开。
+// 返回最终的上下文以及被裁剪掉的消息
+func (b *ContextBuilder) Build(cfg domain.ContextConfig, system []domain.Message, history []domain.Message) ([]domain.Message, []domain.Message) {
+	cfg = cfg.Merge(defaultContextConfig)
+	pinned := make([]domain.Message, 0, len(system))
+	pinned = append(pinned, system...)
+	others := make([]domain.Message, 0, len(history))
+	for _, msg := range history {
+		if msg.Role == domain.SYSTEM {
+			pinned = append(pinned, msg)
+			continue
+		}
+		others = append(others, msg)
+	}
+	turns := splitTurns(others)
+	if len(turns) == 0 {
+		return pinned, nil
+	}
+
+	start := len(turns) - 1
+	switch cfg.Strategy {
+	case domain.ContextStrategyLastN:
+		count := len(turns[start])
+		for start > 0 && count+len(turns[start-1]) <= cfg.LastN {
+			start--
+			count += len(turns[start])
+		}
+	default:
+		budget := b.window(cfg) - cfg.ReservedTokens
+		used := b.count(pinned) + b.count(turns[start])
+		for start > 0 {
+			tokens := b.count(turns[start-1])
+			if used+tokens > budget {
+				break
+			}
+			start--
+			used += tokens
+		}
+	}
+
+	res := pinned
+	for _, turn := range turns[start:] {
+		res = append(res, turn...)
+	}
+	var dropped []domain.Message
+	for _, turn := range turns[:start] {
+		dropped = append(dropped, turn...)
+	}
+	return res, dropped
+}
+
+func (b *ContextBuilder) window(cfg domain.ContextConfig) int64 {
+	if cfg.WindowTokens > 0 {
+		return cfg.WindowTokens
+	}
+	if b.tokenizer != nil {
+		return b.tokenizer.ContextWindow()
+	}
+	return defaultContextWindow
+}
+
+func (b *ContextBuilder) count(messages []domain.Message) int64 {
+	var total int64
+	for _, msg := range messages {
+		if b.tokenizer != nil {
+			total += b.tokenizer.CountTokens(msg)
+			continue
+		}
+		// 不知道模型怎么分词的时候按照一个字符一个 token 估算，宁可多裁剪也不要超出窗口
+		total += int64(utf8.RuneCountInString(msg.Content)) + 2
+	}
+	return total
+}
+
+// splitTurns 按照用户消息把消息切分成多轮对话
+func splitTurns(messages []domain.Message) [][]domain.Message {
+	var turns [][]domain.Message
+	for _, msg := range messages {
+		if msg.Role == domain.USER || len(turns) == 0 {
+			turns = append(turns, []domain.Message{msg})
+			continue
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+	}
+	return turns
+}
+
+// parseBizContextConfig 从业务配置中读取 context 字段，例如 {"context": {"strategy": "last_n", "last_n": 10}}
+func parseBizContextConfig(config string) (domain.ContextConfig, error) {
+	var val struct {
+		Context struct {
+			Strategy       string `json:"strategy"`
+			WindowTokens   int64  `json:"window_tokens"`
+			ReservedTokens int64  `json:"reserved_tokens"`
+			LastN          int    `json:"last_n"`
+			MaxHistory     int    `json:"max_history"`
+		} `json:"context"`
+	}
+	if config == "" {
+		return domain.ContextConfig{}, nil
+	}
+	if err := json.Unmarshal([]byte(config), &val); err != nil {
+		return domain.ContextConfig{}, err
+	}
+	return domain.ContextConfig{
+		Strategy:       domain.ContextStrategy(val.Context.Strategy),
+		WindowTokens:   val.Context.WindowTokens,
+		ReservedTokens: val.Context.ReservedTokens,
+		LastN:          val.Context.LastN,
+		MaxHistory:     val.Context.MaxHistory,
+	}, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenizer 每个字符算一个 token
+type fakeTokenizer struct {
+	window int64
+}
+
+func (f fakeTokenizer) CountTokens(msg domain.Message) int64 {
+	return int64(len(msg.Content))
+}
+
+func (f fakeTokenizer) ContextWindow() int64 {
+	return f.window
+}
+
+func TestContextBuilder_Build(t *testing.T) {
+	system := []domain.Message{{Role: domain.SYSTEM, Content: "sys"}}
+	history := []domain.Message{
+		{Role: domain.USER, Content: "u1"},
+		{Role: domain.ASSISTANT, Content: "a1"},
+		{Role: domain.USER, Content: "u2"},
+		{Role: domain.ASSISTANT, Content: "a2"},
+		{Role: domain.USER, Content: "u3-long-question"},
+	}
+	testCases := []struct {
+		name    string
+		cfg     domain.ContextConfig
+		history []domain.Message
+		want    []string
+		dropped int
+	}{
+		{
+			name: "窗口足够保留全部",
+			cfg:  domain.ContextConfig{WindowTokens: 100, ReservedTokens: 10},
+			want: []string{"sys", "u1", "a1", "u2", "a2", "u3-long-question"},
+		},
+		{
+			name: "按照轮次裁剪",
+			// 3 + 16 + 4 = 23
+			cfg:     domain.ContextConfig{WindowTokens: 33, ReservedTokens: 10},
+			want:    []string{"sys", "u2", "a2", "u3-long-question"},
+			dropped: 2,
+		},
+		{
+			name:    "放不下也保留最新一轮",
+			cfg:     domain.ContextConfig{WindowTokens: 10, ReservedTokens: 5},
+			want:    []string{"sys", "u3-long-question"},
+			dropped: 4,
+		},
+		{
+			name:    "保留最近 N 条",
+			cfg:     domain.ContextConfig{Strategy: domain.ContextStrategyLastN, LastN: 3},
+			want:    []string{"sys", "u2", "a2", "u3-long-question"},
+			dropped: 2,
+		},
+		{
+			name: "N 太小也保留最新一轮",
+			cfg:  domain.ContextConfig{Strategy: domain.ContextStrategyLastN, LastN: 1},
+			history: []domain.Message{
+				{Role: domain.USER, Content: "u1"},
+				{Role: domain.USER, Content: "u2"},
+				{Role: domain.ASSISTANT, Content: "a2"},
+			},
+			want:    []string{"sys", "u2", "a2"},
+			dropped: 1,
+		},
+		{
+			name: "历史中的系统消息总是保留",
+			cfg:  domain.ContextConfig{WindowTokens: 18, ReservedTokens: 1},
+			history: []domain.Message{
+				{Role: domain.SYSTEM, Content: "history-sys"},
+				{Role: domain.USER, Content: "u1"},
+				{Role: domain.USER, Content: "u2"},
+			},
+			want:    []string{"sys", "history-sys", "u2"},
+			dropped: 1,
+		},
+	}
+	builder := &ContextBuilder{tokenizer: fakeTokenizer{window: 1000}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := tc.history
+			if h == nil {
+				h = history
+			}
+			res, dropped := builder.Build(tc.cfg, system, h)
+			assert.Len(t, dropped, tc.dropped)
+			contents := make([]string, 0, len(res))
+			for _, msg := range res {
+				contents = append(contents, msg.Content)
+			}
+			assert.Equal(t, tc.want, contents)
+		})
+	}
+}
+
+func TestContextBuilder_Window(t *testing.T) {
+	assert.Equal(t, int64(1000), (&ContextBuilder{tokenizer: fakeTokenizer{window: 1000}}).window(domain.ContextConfig{}))
+	assert.Equal(t, int64(10), (&ContextBuilder{tokenizer: fakeTokenizer{window: 1000}}).window(domain.ContextConfig{WindowTokens: 10}))
+	assert.Equal(t, int64(defaultContextWindow), (&ContextBuilder{}).window(domain.ContextConfig{}))
+}
+
+func TestParseBizContextConfig(t *testing.T) {
+	cfg, err := parseBizContextConfig(`{"context": {"strategy": "last_n", "last_n": 10}, "other": 1}`)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ContextConfig{Strategy: domain.ContextStrategyLastN, LastN: 10}, cfg)
+
+	cfg, err = parseBizContextConfig("")
+	require.NoError(t, err)
+	assert.True(t, cfg.IsZero())
+
+	_, err = parseBizContextConfig("{")
+	assert.Error(t, err)
+}
@@ -16,104 +16,423 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/gotomicro/ego/core/elog"
 )
 
 type ConversationService struct {
-	repo   *repository.ConversationRepo
-	handle llm.Handler
+	repo      *repository.ConversationRepo
+	feedback  *repository.FeedbackRepo
+	prompt    *PromptService
+	promptACL *PromptACLService
+	bizConfig BizConfigService
+	// 用于对摘要消耗的 token 计费，为 nil 的时候不计费
+	quota   *QuotaService
+	handle  llm.Handler
+	builder *ContextBuilder
+	// 生成标题使用的模型
+	titleHandle llm.Handler
+	searcher    ConversationSearcher
+	// 本实例上正在生成的消息，消息 ID 到 context.CancelCauseFunc
+	generating       sync.Map
+	listenCancelOnce sync.Once
+	// 续传的时候最多等待多久没有新的事件
+	streamIdleTimeout time.Duration
 }
 
-func NewConversationService(repo *repository.ConversationRepo, handler llm.Handler) *ConversationService {
-	return &ConversationService{repo: repo, handle: handler}
+func NewConversationService(repo *repository.ConversationRepo, feedback *repository.FeedbackRepo, prompt *PromptService,
+	promptACL *PromptACLService, bizConfig BizConfigService, quota *QuotaService, handler llm.Handler, opts ...ConversationOption) *ConversationService {
+	res := &ConversationService{
+		repo:              repo,
+		feedback:          feedback,
+		prompt:            prompt,
+		promptACL:         promptACL,
+		bizConfig:         bizConfig,
+		quota:             quota,
+		handle:            handler,
+		builder:           NewContextBuilder(handler),
+		titleHandle:       handler,
+		searcher:          repo,
+		streamIdleTimeout: defaultStreamIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
 }
 
+// Create 创建对话，指定了 prompt 的时候 uid 至少需要有 viewer 权限
 func (c *ConversationService) Create(ctx context.Context, conversation domain.Conversation) (string, error) {
+	if conversation.PromptID != 0 {
+		if err := c.checkPromptViewer(ctx, conversation.Uid, conversation.PromptID); err != nil {
+			return "", err
+		}
+	}
 	return c.repo.Create(ctx, conversation)
 }
 
-func (c *ConversationService) List(ctx context.Context, uid string, limit int64, offset int64) ([]domain.Conversation, error) {
-	return c.repo.GetByUid(ctx, uid, limit, offset)
+func (c *ConversationService) List(ctx context.Context, q domain.ConversationQuery) ([]domain.Conversation, error) {
+	return c.repo.List(ctx, q)
+}
+
+// Update 修改对话的标题
+func (c *ConversationService) Update(ctx context.Context, sn string, uid string, title string) (domain.Conversation, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || utf8.RuneCountInString(title) > maxTitleLength {
+		return domain.Conversation{}, fmt.Errorf("%w: 标题不能为空，并且不能超过 %d 个字", errs.ErrInvalidParam, maxTitleLength)
+	}
+	if err := c.repo.Rename(ctx, sn, uid, title); err != nil {
+		return domain.Conversation{}, err
+	}
+	return c.repo.GetBySn(ctx, sn)
+}
+
+func (c *ConversationService) Archive(ctx context.Context, sn string, uid string) error {
+	return c.repo.SetArchived(ctx, sn, uid, true)
+}
+
+func (c *ConversationService) Unarchive(ctx context.Context, sn string, uid string) error {
+	return c.repo.SetArchived(ctx, sn, uid, false)
+}
+
+func (c *ConversationService) Pin(ctx context.Context, sn string, uid string, pinned bool) error {
+	return c.repo.SetPinned(ctx, sn, uid, pinned)
+}
+
+// Delete 软删除，删除之后对话不会出现在列表里面，也不能继续对话
+func (c *ConversationService) Delete(ctx context.Context, sn string, uid string) error {
+	return c.repo.Delete(ctx, sn, uid)
 }
 
+// Purge 彻底删除对话和所有的消息，无法恢复
+func (c *ConversationService) Purge(ctx context.Context, sn string, uid string) error {
+	return c.repo.Purge(ctx, sn, uid)
+}
+
+// Detail 返回当前分支上的消息，每条消息都带有兄弟消息的数量，用于切换分支
 func (c *ConversationService) Detail(ctx context.Context, sn string) ([]domain.Message, error) {
-	return c.repo.GetMessageList(ctx, sn, -1, 0)
+	return c.repo.GetActivePath(ctx, sn)
 }
 
+// SwitchBranch 切换到 messageID 所在的分支，返回新的分支上的消息
+func (c *ConversationService) SwitchBranch(ctx context.Context, uid string, sn string, messageID int64) ([]domain.Message, error) {
+	if _, err := c.ownedConversation(ctx, sn, uid); err != nil {
+		return nil, err
+	}
+	if err := c.repo.LinkLegacyMessages(ctx, sn); err != nil {
+		return nil, err
+	}
+	return c.repo.SwitchBranch(ctx, sn, messageID)
+}
+
+// Chat 先保存问题再调用模型。已经删除的对话在保存问题的时候就会返回 ErrConversationNotFound，不会调用模型
 func (c *ConversationService) Chat(ctx context.Context, sn string, messages []domain.Message) (domain.ChatResponse, error) {
-	err := c.repo.AddMessages(ctx, sn, messages)
+	saved, err := c.repo.AddMessages(ctx, sn, messages)
 	if err != nil {
 		return domain.ChatResponse{}, err
 	}
+	return c.reply(ctx, sn, saved)
+}
 
-	messageList, err := c.repo.GetHistoryMessageList(ctx, sn, 20, 0)
+// Regenerate 针对同一个问题重新生成回答，新的回答和原来的回答是兄弟关系
+func (c *ConversationService) Regenerate(ctx context.Context, uid string, messageID int64) (domain.ChatResponse, error) {
+	msg, sn, err := c.branchMessage(ctx, uid, messageID)
 	if err != nil {
 		return domain.ChatResponse{}, err
 	}
+	if msg.Role != domain.ASSISTANT || msg.ParentID == 0 {
+		return domain.ChatResponse{}, fmt.Errorf("%w: 只能重新生成模型的回答", errs.ErrInvalidParam)
+	}
+	path, err := c.repo.SetLeaf(ctx, sn, msg.ParentID)
+	if err != nil {
+		return domain.ChatResponse{}, err
+	}
+	return c.reply(ctx, sn, path[len(path)-1:])
+}
 
+// EditAndResend 修改之前的某个问题并且重新发送，修改之后的问题和原来的问题是兄弟关系
+func (c *ConversationService) EditAndResend(ctx context.Context, uid string, messageID int64, content string) (domain.ChatResponse, error) {
+	msg, sn, err := c.branchMessage(ctx, uid, messageID)
+	if err != nil {
+		return domain.ChatResponse{}, err
+	}
+	if msg.Role != domain.USER {
+		return domain.ChatResponse{}, fmt.Errorf("%w: 只能编辑用户的消息", errs.ErrInvalidParam)
+	}
+	saved, err := c.repo.AddBranch(ctx, sn, msg.ParentID, []domain.Message{{Role: domain.USER, Content: content}})
+	if err != nil {
+		return domain.ChatResponse{}, err
+	}
+	return c.reply(ctx, sn, saved)
+}
+
+// branchMessage 读取要在上面创建分支的消息。
+// 引入分支之前的消息 ParentID 都是 0，先把它们串起来再重新读取，否则会被当成第一条消息
+func (c *ConversationService) branchMessage(ctx context.Context, uid string, messageID int64) (domain.Message, string, error) {
+	msg, sn, err := c.ownedMessage(ctx, messageID, uid)
+	if err != nil || msg.ParentID > 0 {
+		return msg, sn, err
+	}
+	if err = c.repo.LinkLegacyMessages(ctx, sn); err != nil {
+		return domain.Message{}, "", err
+	}
+	return c.repo.GetMessage(ctx, messageID)
+}
+
+// reply 基于当前分支调用模型，把回答追加到当前分支的末尾。messages 是已经保存的问题，用来判断是不是第一轮对话
+func (c *ConversationService) reply(ctx context.Context, sn string, messages []domain.Message) (domain.ChatResponse, error) {
+	version, messageList, err := c.buildContext(ctx, sn)
+	if err != nil {
+		return domain.ChatResponse{}, err
+	}
+
+	start := time.Now()
 	response, err := c.handle.Handle(ctx, messageList)
 	if err != nil {
 		return domain.ChatResponse{}, err
 	}
 
-	resp := domain.ChatResponse{Sn: sn, Response: response.Response}
+	msg := response.Response
+	msg.PromptVersionID = version.ID
+	msg.Provider, msg.Model = c.model()
+	msg.Latency = time.Since(start).Milliseconds()
+	msg.Tokens = response.Usage.TotalTokens
 
 	// 将返回结果写入repo
-	err = c.repo.AddMessages(ctx, sn, []domain.Message{response.Response})
+	res, err := c.repo.AddMessages(ctx, sn, []domain.Message{msg})
 	if err != nil {
 		return domain.ChatResponse{}, err
 	}
+	c.autoTitle(ctx, sn, append(slices.Clip(messages), res[0]))
 
-	return resp, nil
+	return domain.ChatResponse{Sn: sn, Response: res[0], Usage: response.Usage}, nil
 }
 
+// Stream 流式生成回答。生成和客户端的连接是解耦的，客户端断开之后还会继续生成并且保存，
+// 客户端可以通过 ResumeStream 重新接上。和 Chat 一样，已经删除的对话不会调用模型
 func (c *ConversationService) Stream(ctx context.Context, sn string, messages []domain.Message) (chan domain.StreamEvent, error) {
 	ch := make(chan domain.StreamEvent, 10)
 
-	err := c.repo.AddMessages(ctx, sn, messages)
+	saved, err := c.repo.AddMessages(ctx, sn, messages)
 	if err != nil {
 		return ch, err
 	}
 
-	cs, err := c.repo.GetHistoryMessageList(ctx, sn, 20, 0)
+	version, cs, err := c.buildContext(ctx, sn)
 	if err != nil {
 		return ch, err
 	}
 
-	event, err := c.handle.StreamHandle(ctx, cs)
+	genCtx, stop := context.WithTimeout(context.WithoutCancel(ctx), maxGenerateDuration)
+	genCtx, cancel := context.WithCancelCause(genCtx)
+	start := time.Now()
+	event, err := c.handle.StreamHandle(genCtx, cs)
 	if err != nil {
+		cancel(err)
+		stop()
+		return ch, err
+	}
+	provider, model := c.model()
+	reply, err := c.repo.StartMessage(ctx, sn, domain.Message{
+		Role:            domain.ASSISTANT,
+		PromptVersionID: version.ID,
+		Provider:        provider,
+		Model:           model,
+		Status:          domain.MessageStatusStreaming,
+	})
+	if err != nil {
+		cancel(err)
+		stop()
 		return ch, err
 	}
 
+	c.listenCancelOnce.Do(func() {
+		go c.listenCancel()
+	})
+	c.generating.Store(reply.ID, cancel)
 	go func() {
-		conent := ""
-		reasoningContent := ""
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case value, ok := <-event:
-				if !ok || value.Done {
-					err1 := c.repo.AddMessages(ctx, sn, []domain.Message{{
-						Content:          conent,
-						ReasoningContent: reasoningContent,
-					}})
-					if err1 != nil {
-						elog.Error("写入数据库失败", elog.FieldErr(err))
-					}
-					ch <- domain.StreamEvent{Done: true}
-					return
-				}
-
-				reasoningContent += value.ReasoningContent
-				conent += value.Content
-				ch <- value
-			}
-		}
+		defer stop()
+		defer cancel(nil)
+		defer c.generating.Delete(reply.ID)
+		c.generate(genCtx, ctx, generation{
+			sn:       sn,
+			reply:    reply,
+			start:    start,
+			prompt:   cs,
+			exchange: saved,
+		}, event, ch)
 	}()
-	return ch, err
+	return ch, nil
+}
+
+// Feedback 记录用户对某条回答的评价，Rating 为 0 表示取消评价。只能评价自己的对话
+func (c *ConversationService) Feedback(ctx context.Context, feedback domain.MessageFeedback) error {
+	if feedback.Uid == "" {
+		return fmt.Errorf("%w: 缺少 uid", errs.ErrInvalidParam)
+	}
+	if !feedback.Reason.Valid() {
+		return fmt.Errorf("%w: 不支持的原因 %s", errs.ErrInvalidParam, feedback.Reason)
+	}
+	if utf8.RuneCountInString(feedback.Comment) > maxFeedbackCommentLength {
+		return fmt.Errorf("%w: 补充说明最多 %d 个字", errs.ErrInvalidParam, maxFeedbackCommentLength)
+	}
+	msg, sn, err := c.repo.GetMessage(ctx, feedback.MessageID)
+	if err != nil {
+		return err
+	}
+	if msg.Role != domain.ASSISTANT {
+		return fmt.Errorf("%w: 只能评价模型的回答", errs.ErrInvalidParam)
+	}
+	conversation, err := c.repo.GetBySn(ctx, sn)
+	if err != nil {
+		return err
+	}
+	if conversation.Uid != feedback.Uid {
+		return fmt.Errorf("%w: 消息 %d 不属于用户 %s", errs.ErrPermissionDenied, feedback.MessageID, feedback.Uid)
+	}
+	switch {
+	case feedback.Rating > 0:
+		feedback.Rating = domain.FeedbackUp
+	case feedback.Rating < 0:
+		feedback.Rating = domain.FeedbackDown
+	default:
+		return c.feedback.Delete(ctx, feedback.MessageID)
+	}
+	feedback.Sn = sn
+	feedback.Provider, feedback.Model = msg.Provider, msg.Model
+	feedback.PromptVersionID = msg.PromptVersionID
+	return c.feedback.Save(ctx, feedback)
+}
+
+// checkPromptViewer 检查 uid 至少是 prompt 的 viewer，不是数字的 uid 没有任何 prompt 的权限
+func (c *ConversationService) checkPromptViewer(ctx context.Context, uid string, promptID int64) error {
+	id, err := strconv.ParseInt(uid, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: 用户 %s 不能使用 prompt %d", errs.ErrPermissionDenied, uid, promptID)
+	}
+	return c.promptACL.Check(ctx, id, promptID, domain.PromptRoleViewer)
+}
+
+// ownedConversation 对话不存在或者不属于 uid 的时候都返回 ErrConversationNotFound
+func (c *ConversationService) ownedConversation(ctx context.Context, sn string, uid string) (domain.Conversation, error) {
+	conversation, err := c.repo.GetBySn(ctx, sn)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	// 对话不存在的时候 Uid 也是空的
+	if conversation.Uid == "" || conversation.Uid != uid {
+		return domain.Conversation{}, fmt.Errorf("%w: %s", errs.ErrConversationNotFound, sn)
+	}
+	return conversation, nil
+}
+
+// ownedMessage 读取消息，并且检查消息所在的对话属于 uid
+func (c *ConversationService) ownedMessage(ctx context.Context, messageID int64, uid string) (domain.Message, string, error) {
+	msg, sn, err := c.repo.GetMessage(ctx, messageID)
+	if err != nil {
+		return domain.Message{}, "", err
+	}
+	if _, err = c.ownedConversation(ctx, sn, uid); err != nil {
+		return domain.Message{}, "", err
+	}
+	return msg, sn, nil
+}
+
+// model 当前使用的模型，Handler 没有提供的时候为空
+func (c *ConversationService) model() (string, string) {
+	describer, ok := c.handle.(llm.ModelDescriber)
+	if !ok {
+		return "", ""
+	}
+	return describer.Provider(), describer.Model()
+}
+
+// buildContext 读取历史消息，加上 prompt 的系统提示词和早期对话的摘要，然后按照上下文配置裁剪。
+// 裁剪掉的消息会被合并到摘要里面，而不是直接丢弃
+func (c *ConversationService) buildContext(ctx context.Context, sn string) (domain.PromptVersion, []domain.Message, error) {
+	conversation, err := c.repo.GetBySn(ctx, sn)
+	if err != nil {
+		return domain.PromptVersion{}, nil, err
+	}
+	cfg := c.contextConfig(ctx, conversation)
+	history, err := c.repo.GetHistoryMessageList(ctx, sn, int64(cfg.MaxHistory), 0)
+	if err != nil {
+		return domain.PromptVersion{}, nil, err
+	}
+	// 已经进入摘要的消息不需要再放进上下文
+	history = slice.FilterDelete(history, func(idx int, src domain.Message) bool {
+		return src.ID > 0 && src.ID <= conversation.SummarizedID
+	})
+	version, system, err := c.withPrompt(ctx, conversation)
+	if err != nil {
+		return domain.PromptVersion{}, nil, err
+	}
+	pinned := system
+	if conversation.Summary != "" {
+		pinned = append(slices.Clip(system), summaryMessage(conversation.Summary))
+	}
+	messages, dropped := c.builder.Build(cfg, pinned, history)
+	if len(dropped) == 0 {
+		return version, messages, nil
+	}
+	summary, err := c.summarize(ctx, conversation, dropped)
+	if err != nil {
+		// 摘要失败不影响这一次对话，下一次还会再尝试
+		elog.Error("生成对话摘要失败", elog.String("sn", sn), elog.FieldErr(err))
+		return version, messages, nil
+	}
+	res := make([]domain.Message, 0, len(messages)+1)
+	res = append(res, system...)
+	res = append(res, summaryMessage(summary))
+	return version, append(res, messages[len(pinned):]...), nil
+}
+
+// contextConfig 对话自己的配置优先，其次是业务配置，最后是默认配置
+func (c *ConversationService) contextConfig(ctx context.Context, conversation domain.Conversation) domain.ContextConfig {
+	cfg := conversation.Context
+	if conversation.BizID > 0 && c.bizConfig != nil {
+		biz, err := c.bizConfig.GetByID(ctx, conversation.BizID)
+		if err == nil {
+			var bizCfg domain.ContextConfig
+			bizCfg, err = parseBizContextConfig(biz.Config)
+			cfg = cfg.Merge(bizCfg)
+		}
+		if err != nil {
+			// 业务配置有问题不影响对话，使用默认配置
+			elog.Warn("读取业务上下文配置失败", elog.Int64("biz", conversation.BizID), elog.FieldErr(err))
+		}
+	}
+	return cfg.Merge(defaultContextConfig)
+}
+
+// withPrompt 如果对话绑定了 prompt，那么按照分流规则选出一个版本，返回它的系统提示词
+func (c *ConversationService) withPrompt(ctx context.Context, conversation domain.Conversation) (domain.PromptVersion, []domain.Message, error) {
+	if conversation.PromptID == 0 {
+		return domain.PromptVersion{}, nil, nil
+	}
+	// 优先按照用户分流，保证同一个用户看到的总是同一个版本
+	key := conversation.Uid
+	if key == "" {
+		key = conversation.Sn
+	}
+	version, err := c.prompt.Pick(ctx, conversation.PromptID, key)
+	if err != nil {
+		return domain.PromptVersion{}, nil, err
+	}
+	if version.SystemContent == "" {
+		return version, nil, nil
+	}
+	return version, []domain.Message{{Role: domain.SYSTEM, Content: version.SystemContent}}, nil
 }
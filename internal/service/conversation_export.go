@@ -0,0 +1,236 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// 一次最多导出的对话数量，更多的对话需要缩小时间范围分批导出
+const maxExportConversations = 1000
+
+// exportConversation 导出的 JSON 格式
+type exportConversation struct {
+	Sn         string          `json:"sn"`
+	Title      string          `json:"title"`
+	CreateTime int64           `json:"create_time"`
+	Messages   []exportMessage `json:"messages"`
+}
+
+type exportMessage struct {
+	ID               int64  `json:"id,omitempty"`
+	Role             string `json:"role"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// Export 导出对话，只会导出当前分支上的消息，正在生成的消息不会被导出
+func (c *ConversationService) Export(ctx context.Context, q domain.ConversationExportQuery) ([]byte, error) {
+	switch q.Format {
+	case domain.ExportFormatMarkdown, domain.ExportFormatJSON, domain.ExportFormatJSONL:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的导出格式 %s", errs.ErrInvalidParam, q.Format)
+	}
+	conversations, err := c.exportConversations(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conversations {
+		path, err := c.repo.GetActivePath(ctx, conversations[i].Sn)
+		if err != nil {
+			return nil, err
+		}
+		conversations[i].Messages = slice.FilterDelete(path, func(idx int, src domain.Message) bool {
+			return src.Status == domain.MessageStatusStreaming
+		})
+	}
+
+	switch q.Format {
+	case domain.ExportFormatMarkdown:
+		return exportMarkdown(conversations, q.IncludeReasoning), nil
+	case domain.ExportFormatJSON:
+		return exportJSON(conversations, q.IncludeReasoning)
+	default:
+		return exportJSONL(conversations, c.systemPrompts(ctx, q.Uid, conversations), q.IncludeReasoning)
+	}
+}
+
+func (c *ConversationService) exportConversations(ctx context.Context, q domain.ConversationExportQuery) ([]domain.Conversation, error) {
+	if q.Sn == "" {
+		return c.repo.ListByCtime(ctx, q.Uid, q.Start, q.End, maxExportConversations)
+	}
+	conversation, err := c.repo.GetBySn(ctx, q.Sn)
+	if err != nil {
+		return nil, err
+	}
+	// 对话不存在的时候 Uid 也是空的
+	if conversation.Uid == "" || conversation.Uid != q.Uid {
+		return nil, fmt.Errorf("%w: %s", errs.ErrConversationNotFound, q.Sn)
+	}
+	return []domain.Conversation{conversation}, nil
+}
+
+// systemPrompts 微调数据需要带上生成回答的时候使用的系统提示词，key 是 prompt 版本的 ID。
+// uid 已经没有权限查看的 prompt 不会导出系统提示词
+func (c *ConversationService) systemPrompts(ctx context.Context, uid string, conversations []domain.Conversation) map[int64]string {
+	res := make(map[int64]string)
+	if c.prompt == nil {
+		return res
+	}
+	loaded := make(map[int64]bool)
+	for _, conversation := range conversations {
+		if conversation.PromptID == 0 || loaded[conversation.PromptID] {
+			continue
+		}
+		loaded[conversation.PromptID] = true
+		if err := c.checkPromptViewer(ctx, uid, conversation.PromptID); err != nil {
+			elog.Warn("没有 prompt 的权限，导出的数据不带系统提示词", elog.String("uid", uid),
+				elog.Int64("prompt", conversation.PromptID), elog.FieldErr(err))
+			continue
+		}
+		prompt, err := c.prompt.Get(ctx, conversation.PromptID)
+		if err != nil {
+			elog.Warn("读取 prompt 失败，导出的数据不带系统提示词", elog.Int64("prompt", conversation.PromptID), elog.FieldErr(err))
+			continue
+		}
+		for _, version := range prompt.Versions {
+			res[version.ID] = version.SystemContent
+		}
+	}
+	return res
+}
+
+func exportMarkdown(conversations []domain.Conversation, includeReasoning bool) []byte {
+	var buf bytes.Buffer
+	for i, conversation := range conversations {
+		if i > 0 {
+			buf.WriteString("\n---\n\n")
+		}
+		title := conversation.Title
+		if title == "" {
+			title = "未命名对话"
+		}
+		fmt.Fprintf(&buf, "# %s\n\n", title)
+		fmt.Fprintf(&buf, "> %s · %s\n\n", conversation.Sn, time.Unix(conversation.Ctime, 0).Format(time.DateTime))
+		for _, msg := range conversation.Messages {
+			fmt.Fprintf(&buf, "### %s\n\n", roleName(msg.Role))
+			if includeReasoning && msg.ReasoningContent != "" {
+				buf.WriteString("> 思考过程\n>\n")
+				for _, line := range strings.Split(strings.TrimSpace(msg.ReasoningContent), "\n") {
+					buf.WriteString(strings.TrimRight("> "+line, " "))
+					buf.WriteString("\n")
+				}
+				buf.WriteString("\n")
+			}
+			buf.WriteString(strings.TrimSpace(msg.Content))
+			buf.WriteString("\n\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+func exportJSON(conversations []domain.Conversation, includeReasoning bool) ([]byte, error) {
+	res := slice.Map(conversations, func(idx int, src domain.Conversation) exportConversation {
+		return exportConversation{
+			Sn:         src.Sn,
+			Title:      src.Title,
+			CreateTime: src.Ctime,
+			Messages: slice.Map(src.Messages, func(idx int, msg domain.Message) exportMessage {
+				return toExportMessage(msg, includeReasoning)
+			}),
+		}
+	})
+	return json.MarshalIndent(res, "", "  ")
+}
+
+// exportJSONL 每个对话一行 {"messages": [...]}。只保留正常生成完毕的消息，并且最后一条必须是模型的回答
+func exportJSONL(conversations []domain.Conversation, systemPrompts map[int64]string, includeReasoning bool) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, conversation := range conversations {
+		messages := slice.FilterDelete(conversation.Messages, func(idx int, src domain.Message) bool {
+			return src.Status != domain.MessageStatusCompleted
+		})
+		last := len(messages) - 1
+		for last >= 0 && messages[last].Role != domain.ASSISTANT {
+			last--
+		}
+		if last < 0 {
+			continue
+		}
+		messages = messages[:last+1]
+
+		record := make([]exportMessage, 0, len(messages)+1)
+		if system := systemPrompts[firstReplyVersion(messages)]; system != "" {
+			record = append(record, exportMessage{Role: roleKey(domain.SYSTEM), Content: system})
+		}
+		for _, msg := range messages {
+			m := toExportMessage(msg, includeReasoning)
+			// 训练数据不需要消息 ID
+			m.ID = 0
+			record = append(record, m)
+		}
+		line, err := json.Marshal(map[string]any{"messages": record})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// firstReplyVersion 第一条回答使用的 prompt 版本
+func firstReplyVersion(messages []domain.Message) int64 {
+	for _, msg := range messages {
+		if msg.Role == domain.ASSISTANT {
+			return msg.PromptVersionID
+		}
+	}
+	return 0
+}
+
+func toExportMessage(msg domain.Message, includeReasoning bool) exportMessage {
+	res := exportMessage{ID: msg.ID, Role: roleKey(msg.Role), Content: msg.Content}
+	if includeReasoning {
+		res.ReasoningContent = msg.ReasoningContent
+	}
+	return res
+}
+
+// roleKey OpenAI 格式里面的角色
+func roleKey(role int32) string {
+	switch role {
+	case domain.USER:
+		return "user"
+	case domain.ASSISTANT:
+		return "assistant"
+	case domain.SYSTEM:
+		return "system"
+	case domain.TOOL:
+		return "tool"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	conversations := []domain.Conversation{
+		{
+			Sn: "a", Title: "缓存", Ctime: 0,
+			Messages: []domain.Message{
+				{Role: domain.USER, Content: "缓存穿透怎么处理"},
+				{Role: domain.ASSISTANT, Content: "可以缓存空值", ReasoningContent: "先想想\n再回答"},
+			},
+		},
+		{Sn: "b", Messages: []domain.Message{{Role: domain.USER, Content: "你好"}}},
+	}
+	testCases := []struct {
+		name             string
+		includeReasoning bool
+		want             string
+	}{
+		{
+			name: "不带思考过程",
+			want: "# 缓存\n\n> a · " + timeString(0) + "\n\n### 用户\n\n缓存穿透怎么处理\n\n### 助手\n\n可以缓存空值\n\n" +
+				"\n---\n\n# 未命名对话\n\n> b · " + timeString(0) + "\n\n### 用户\n\n你好\n\n",
+		},
+		{
+			name:             "带思考过程",
+			includeReasoning: true,
+			want: "# 缓存\n\n> a · " + timeString(0) + "\n\n### 用户\n\n缓存穿透怎么处理\n\n### 助手\n\n> 思考过程\n>\n> 先想想\n> 再回答\n\n可以缓存空值\n\n" +
+				"\n---\n\n# 未命名对话\n\n> b · " + timeString(0) + "\n\n### 用户\n\n你好\n\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, string(exportMarkdown(conversations, tc.includeReasoning)))
+		})
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	testCases := []struct {
+		name          string
+		conversations []domain.Conversation
+		systemPrompts map[int64]string
+		want          string
+	}{
+		{
+			name: "带系统提示词",
+			conversations: []domain.Conversation{{Messages: []domain.Message{
+				{ID: 1, Role: domain.USER, Content: "你好"},
+				{ID: 2, Role: domain.ASSISTANT, Content: "你好呀", PromptVersionID: 3},
+			}}},
+			systemPrompts: map[int64]string{3: "你是助手"},
+			want:          `{"messages":[{"role":"system","content":"你是助手"},{"role":"user","content":"你好"},{"role":"assistant","content":"你好呀"}]}` + "\n",
+		},
+		{
+			name: "去掉没有回答的结尾和没有完成的消息",
+			conversations: []domain.Conversation{{Messages: []domain.Message{
+				{ID: 1, Role: domain.USER, Content: "你好"},
+				{ID: 2, Role: domain.ASSISTANT, Content: "你好呀"},
+				{ID: 3, Role: domain.USER, Content: "再见"},
+				{ID: 4, Role: domain.ASSISTANT, Content: "再", Status: domain.MessageStatusCancelled},
+			}}},
+			want: `{"messages":[{"role":"user","content":"你好"},{"role":"assistant","content":"你好呀"}]}` + "\n",
+		},
+		{
+			name: "没有回答的对话",
+			conversations: []domain.Conversation{
+				{Messages: []domain.Message{{ID: 1, Role: domain.USER, Content: "你好"}}},
+				{Messages: []domain.Message{
+					{ID: 2, Role: domain.USER, Content: "在吗"},
+					{ID: 3, Role: domain.ASSISTANT, Content: "在"},
+				}},
+			},
+			want: `{"messages":[{"role":"user","content":"在吗"},{"role":"assistant","content":"在"}]}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := exportJSONL(tc.conversations, tc.systemPrompts, false)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(res))
+		})
+	}
+}
+
+func timeString(sec int64) string {
+	return time.Unix(sec, 0).Format(time.DateTime)
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/google/uuid"
+)
+
+// CreateShare 为对话创建分享链接，MessageID 为 0 的时候分享到当前分支的最后一条消息
+func (c *ConversationService) CreateShare(ctx context.Context, share domain.ConversationShare) (domain.ConversationShare, error) {
+	conversation, err := c.repo.GetBySn(ctx, share.Sn)
+	if err != nil {
+		return domain.ConversationShare{}, err
+	}
+	if conversation.Uid == "" || conversation.Uid != share.Uid {
+		return domain.ConversationShare{}, fmt.Errorf("%w: %s", errs.ErrConversationNotFound, share.Sn)
+	}
+	msg, err := c.shareMessage(ctx, share.Sn, share.MessageID)
+	if err != nil {
+		return domain.ConversationShare{}, err
+	}
+	if msg.Status == domain.MessageStatusStreaming {
+		return domain.ConversationShare{}, fmt.Errorf("%w: 消息 %d 还在生成", errs.ErrInvalidParam, msg.ID)
+	}
+	share.MessageID = msg.ID
+	share.Title = conversation.Title
+	share.Token = uuid.New().String()
+	return c.repo.CreateShare(ctx, share)
+}
+
+func (c *ConversationService) shareMessage(ctx context.Context, sn string, messageID int64) (domain.Message, error) {
+	if messageID == 0 {
+		path, err := c.repo.GetActivePath(ctx, sn)
+		if err != nil {
+			return domain.Message{}, err
+		}
+		if len(path) == 0 {
+			return domain.Message{}, fmt.Errorf("%w: 对话还没有消息", errs.ErrInvalidParam)
+		}
+		return path[len(path)-1], nil
+	}
+	msg, msgSn, err := c.repo.GetMessage(ctx, messageID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if msgSn != sn {
+		return domain.Message{}, fmt.Errorf("%w: 消息 %d 不属于对话 %s", errs.ErrInvalidParam, messageID, sn)
+	}
+	return msg, nil
+}
+
+// GetShare 通过分享链接查看对话，不需要登录。对话被删除之后分享也就失效了
+func (c *ConversationService) GetShare(ctx context.Context, token string) (domain.SharedConversation, error) {
+	share, err := c.repo.GetShare(ctx, token)
+	if err != nil {
+		return domain.SharedConversation{}, err
+	}
+	conversation, err := c.repo.GetBySn(ctx, share.Sn)
+	if err != nil {
+		return domain.SharedConversation{}, err
+	}
+	if conversation.Uid == "" {
+		return domain.SharedConversation{}, fmt.Errorf("%w: %s", errs.ErrShareNotFound, token)
+	}
+	path, err := c.repo.GetPathTo(ctx, share.Sn, share.MessageID)
+	if err != nil {
+		return domain.SharedConversation{}, err
+	}
+	return domain.SharedConversation{
+		Title: share.Title,
+		Ctime: share.Ctime,
+		// 只保留展示需要的字段，token 消耗、prompt 版本这些不对外公开
+		Messages: slice.Map(path, func(idx int, src domain.Message) domain.Message {
+			msg := domain.Message{ID: src.ID, Role: src.Role, Content: src.Content}
+			if share.IncludeReasoning {
+				msg.ReasoningContent = src.ReasoningContent
+			}
+			return msg
+		}),
+	}, nil
+}
+
+// ListShares 对话上还有效的分享
+func (c *ConversationService) ListShares(ctx context.Context, sn string, uid string) ([]domain.ConversationShare, error) {
+	return c.repo.ListShares(ctx, sn, uid)
+}
+
+// RevokeShare 撤销分享，只有创建分享的人可以撤销
+func (c *ConversationService) RevokeShare(ctx context.Context, token string, uid string) error {
+	return c.repo.RevokeShare(ctx, token, uid)
+}
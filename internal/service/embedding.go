@@ -0,0 +1,113 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/google/uuid"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// maxEmbeddingInputs 一次请求最多的文本数量
+const maxEmbeddingInputs = 256
+
+// VectorStore 保存向量并且按照余弦相似度检索
+type VectorStore interface {
+	// Upsert 写入向量，ID 相同的记录会被覆盖
+	Upsert(ctx context.Context, records []domain.VectorRecord) error
+	Delete(ctx context.Context, ids []string) error
+	// Search 按照相似度从高到低返回最多 q.TopK 条记录
+	Search(ctx context.Context, q domain.VectorQuery) ([]domain.VectorMatch, error)
+}
+
+// EmbeddingService 网关对外的 embeddings 接口，按照消耗的 token 扣减额度
+type EmbeddingService struct {
+	embedder llm.Embedder
+	quota    *QuotaService
+}
+
+// NewEmbeddingService quota 为 nil 的时候不计费
+func NewEmbeddingService(embedder llm.Embedder, quota *QuotaService) *EmbeddingService {
+	return &EmbeddingService{embedder: embedder, quota: quota}
+}
+
+// Embed 额度不够的时候返回 errs.ErrInsufficientBalance，不返回向量
+func (s *EmbeddingService) Embed(ctx context.Context, req domain.EmbeddingRequest) (domain.EmbeddingResponse, error) {
+	if len(req.Input) == 0 || len(req.Input) > maxEmbeddingInputs {
+		return domain.EmbeddingResponse{}, fmt.Errorf("%w: 文本的数量需要在 1 到 %d 之间", errs.ErrInvalidParam, maxEmbeddingInputs)
+	}
+	for i, text := range req.Input {
+		if strings.TrimSpace(text) == "" {
+			return domain.EmbeddingResponse{}, fmt.Errorf("%w: 第 %d 个文本为空", errs.ErrInvalidParam, i)
+		}
+	}
+	if s.quota != nil {
+		if req.Uid == 0 {
+			return domain.EmbeddingResponse{}, fmt.Errorf("%w: 缺少 uid", errs.ErrInvalidParam)
+		}
+		// 没有额度的时候不调用模型，避免白白消耗平台的 token
+		balance, err := s.quota.Balance(ctx, req.Uid)
+		if err != nil {
+			return domain.EmbeddingResponse{}, err
+		}
+		if balance <= 0 {
+			return domain.EmbeddingResponse{}, errs.ErrInsufficientBalance
+		}
+	}
+
+	resp, err := s.embedder.Embed(ctx, req.Input)
+	if err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+	if err = s.bill(ctx, req, resp.Usage); err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+	return resp, nil
+}
+
+// bill 相同的 key 重复扣费会因为唯一索引失败，只有之前的记录是同一个用户同样的消耗的时候才认为是重试，
+// 否则 request_id 被其他请求用过了，返回错误，不返回向量
+func (s *EmbeddingService) bill(ctx context.Context, req domain.EmbeddingRequest, usage domain.Usage) error {
+	if s.quota == nil || usage.TotalTokens == 0 {
+		return nil
+	}
+	key := req.Key
+	if key == "" {
+		key = uuid.New().String()
+	}
+	key = "embedding:" + key
+	ctx = context.WithoutCancel(ctx)
+	err := s.quota.Deduct(ctx, req.Uid, usage.TotalTokens, key)
+	if err == nil || errors.Is(err, errs.ErrInsufficientBalance) {
+		return err
+	}
+	record, err1 := s.quota.GetRecord(ctx, key)
+	if err1 != nil {
+		elog.Error("embeddings 计费失败", elog.Int64("uid", req.Uid), elog.String("key", key),
+			elog.Int64("tokens", usage.TotalTokens), elog.FieldErr(err))
+		return err
+	}
+	if record.Uid != req.Uid || record.Amount != usage.TotalTokens {
+		return fmt.Errorf("%w: request_id %s 已经被其他请求使用", errs.ErrInvalidParam, req.Key)
+	}
+	return nil
+}
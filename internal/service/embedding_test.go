@@ -0,0 +1,76 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm/platform/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddingService_Embed(t *testing.T) {
+	svc := NewEmbeddingService(fake.NewEmbedder(64), nil)
+	testCases := []struct {
+		name       string
+		input      []string
+		wantErr    error
+		wantTokens int64
+	}{
+		{
+			name:       "多个文本",
+			input:      []string{"hello world", "你好"},
+			wantTokens: 4,
+		},
+		{
+			name:    "没有文本",
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "有空的文本",
+			input:   []string{"hello", " "},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "文本太多",
+			input:   strings.Split(strings.Repeat("a,", maxEmbeddingInputs), ","),
+			wantErr: errs.ErrInvalidParam,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := svc.Embed(context.Background(), domain.EmbeddingRequest{Input: tc.input})
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, resp.Vectors, len(tc.input))
+			assert.Equal(t, tc.wantTokens, resp.Usage.TotalTokens)
+		})
+	}
+}
+
+// 计费的时候必须知道扣谁的额度
+func TestEmbeddingService_EmbedWithoutUid(t *testing.T) {
+	svc := NewEmbeddingService(fake.NewEmbedder(64), &QuotaService{})
+	_, err := svc.Embed(context.Background(), domain.EmbeddingRequest{Input: []string{"hello"}})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+}
@@ -0,0 +1,265 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/gotomicro/ego/core/elog"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultEvalConcurrency = 4
+	maxEvalConcurrency     = 16
+)
+
+const judgePrompt = `你是一个严格的评测员。请根据评判标准判断模型的输出是否合格。
+只允许回答一行，合格回答 PASS，不合格回答 FAIL，然后空格给出简短的理由。`
+
+type EvaluationService struct {
+	repo      *repository.EvaluationRepo
+	prompt    *repository.PromptRepo
+	promptACL *PromptACLService
+	handler   llm.Handler
+}
+
+func NewEvaluationService(repo *repository.EvaluationRepo, prompt *repository.PromptRepo, promptACL *PromptACLService,
+	handler llm.Handler) *EvaluationService {
+	return &EvaluationService{repo: repo, prompt: prompt, promptACL: promptACL, handler: handler}
+}
+
+func (s *EvaluationService) CreateDataset(ctx context.Context, dataset domain.EvalDataset) (int64, error) {
+	return s.repo.CreateDataset(ctx, dataset)
+}
+
+// AddCases 只能往自己的数据集里面添加用例
+func (s *EvaluationService) AddCases(ctx context.Context, uid int64, datasetID int64, cases []domain.EvalCase) error {
+	if _, err := s.GetDataset(ctx, datasetID, uid); err != nil {
+		return err
+	}
+	return s.repo.AddCases(ctx, datasetID, cases)
+}
+
+// GetDataset 数据集不属于 uid 的时候返回 ErrPermissionDenied
+func (s *EvaluationService) GetDataset(ctx context.Context, id int64, uid int64) (domain.EvalDataset, error) {
+	dataset, err := s.repo.GetDataset(ctx, id)
+	if err != nil {
+		return domain.EvalDataset{}, err
+	}
+	if dataset.Owner != uid {
+		return domain.EvalDataset{}, fmt.Errorf("%w: 数据集 %d 不属于用户 %d", errs.ErrPermissionDenied, id, uid)
+	}
+	return dataset, nil
+}
+
+// GetRun 评测不是 uid 发起的时候返回 ErrPermissionDenied
+func (s *EvaluationService) GetRun(ctx context.Context, id int64, uid int64) (domain.EvalRun, error) {
+	run, err := s.repo.GetRun(ctx, id)
+	if err != nil {
+		return domain.EvalRun{}, err
+	}
+	if run.Uid != uid {
+		return domain.EvalRun{}, fmt.Errorf("%w: 评测 %d 不属于用户 %d", errs.ErrPermissionDenied, id, uid)
+	}
+	return run, nil
+}
+
+// Run 在自己的数据集上评测某个版本，uid 至少需要是 prompt 的 viewer。评测在后台执行，返回评测的 ID
+func (s *EvaluationService) Run(ctx context.Context, uid int64, datasetID int64, versionID int64, concurrency int) (int64, error) {
+	dataset, err := s.GetDataset(ctx, datasetID, uid)
+	if err != nil {
+		return 0, err
+	}
+	if len(dataset.Cases) == 0 {
+		return 0, fmt.Errorf("%w: 数据集没有用例", errs.ErrInvalidParam)
+	}
+	if err = s.promptACL.CheckVersion(ctx, uid, versionID, domain.PromptRoleViewer); err != nil {
+		return 0, err
+	}
+	prompt, err := s.prompt.GetByVersionID(ctx, versionID)
+	if err != nil {
+		return 0, err
+	}
+	run := domain.EvalRun{
+		Uid:       uid,
+		DatasetID: datasetID,
+		VersionID: versionID,
+		Status:    domain.EvalRunStatusRunning,
+		Total:     int64(len(dataset.Cases)),
+	}
+	run.ID, err = s.repo.CreateRun(ctx, run)
+	if err != nil {
+		return 0, err
+	}
+	if concurrency <= 0 {
+		concurrency = defaultEvalConcurrency
+	}
+	concurrency = min(concurrency, maxEvalConcurrency)
+	// 评测可能持续很久，不能跟随请求的 ctx 一起结束
+	go s.execute(context.WithoutCancel(ctx), run, prompt.Versions[0], dataset.Cases, concurrency)
+	return run.ID, nil
+}
+
+// Compare 按照用例对比两次评测的结果，两次评测都需要是 uid 发起的
+func (s *EvaluationService) Compare(ctx context.Context, uid int64, a int64, b int64) (domain.EvalComparison, error) {
+	runA, err := s.GetRun(ctx, a, uid)
+	if err != nil {
+		return domain.EvalComparison{}, err
+	}
+	runB, err := s.GetRun(ctx, b, uid)
+	if err != nil {
+		return domain.EvalComparison{}, err
+	}
+	if runA.DatasetID != runB.DatasetID {
+		return domain.EvalComparison{}, fmt.Errorf("%w: 只能对比同一个数据集上的评测", errs.ErrInvalidParam)
+	}
+	resultB := make(map[int64]domain.EvalResult, len(runB.Results))
+	for _, r := range runB.Results {
+		resultB[r.CaseID] = r
+	}
+	cases := make([]domain.EvalCaseComparison, 0, len(runA.Results))
+	for _, r := range runA.Results {
+		cases = append(cases, domain.EvalCaseComparison{
+			CaseID: r.CaseID,
+			A:      r,
+			B:      resultB[r.CaseID],
+		})
+	}
+	return domain.EvalComparison{A: runA, B: runB, Cases: cases}, nil
+}
+
+// execute 执行全部的用例，有用例没能执行完的时候评测的状态是 EvalRunStatusFailed
+func (s *EvaluationService) execute(ctx context.Context, run domain.EvalRun, version domain.PromptVersion,
+	cases []domain.EvalCase, concurrency int) {
+	var (
+		eg     errgroup.Group
+		mu     sync.Mutex
+		passed int64
+		failed int64
+		score  float64
+	)
+	eg.SetLimit(concurrency)
+	for _, c := range cases {
+		eg.Go(func() error {
+			res, err := s.evalCase(ctx, version, c)
+			if err != nil {
+				elog.Warn("执行评测用例失败", elog.Int64("run", run.ID), elog.Int64("case", c.ID), elog.FieldErr(err))
+			}
+			res.RunID = run.ID
+			saveErr := s.repo.AddResult(ctx, res)
+			if saveErr != nil {
+				elog.Error("保存评测结果失败", elog.Int64("run", run.ID), elog.Int64("case", c.ID), elog.FieldErr(saveErr))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil || saveErr != nil {
+				failed++
+			}
+			score += res.Score
+			if res.Passed {
+				passed++
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	run.Status = domain.EvalRunStatusSuccess
+	if failed > 0 {
+		run.Status = domain.EvalRunStatusFailed
+	}
+	run.Passed = passed
+	run.Score = score / float64(len(cases))
+	if err := s.repo.FinishRun(ctx, run); err != nil {
+		elog.Error("更新评测状态失败", elog.Int64("run", run.ID), elog.FieldErr(err))
+	}
+}
+
+// evalCase 执行一条用例。调用模型失败的时候返回 error，这条用例按照不合格计算
+func (s *EvaluationService) evalCase(ctx context.Context, version domain.PromptVersion, c domain.EvalCase) (domain.EvalResult, error) {
+	res := domain.EvalResult{CaseID: c.ID}
+	messages := make([]domain.Message, 0, 2)
+	if version.SystemContent != "" {
+		messages = append(messages, domain.Message{Role: domain.SYSTEM, Content: version.SystemContent})
+	}
+	messages = append(messages, domain.Message{Role: domain.USER, Content: version.Render(c.Variables)})
+
+	start := time.Now()
+	resp, err := s.handler.Handle(ctx, messages)
+	res.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Reason = err.Error()
+		return res, err
+	}
+	res.Output = resp.Response.Content
+	res.Tokens = resp.Usage.TotalTokens
+
+	assertions := c.Assertions
+	if len(assertions) == 0 {
+		assertions = []domain.Assertion{{Type: domain.AssertionExact, Value: c.Expected}}
+	}
+	reasons := make([]string, 0, len(assertions))
+	passed := 0
+	var judgeErr error
+	for _, a := range assertions {
+		var (
+			ok     bool
+			reason string
+		)
+		if a.Type == domain.AssertionLLMJudge {
+			ok, reason, err = s.judge(ctx, a.Value, c.Expected, res.Output)
+			if err != nil {
+				judgeErr = err
+			}
+		} else {
+			ok, reason = checkAssertion(a, res.Output)
+		}
+		if ok {
+			passed++
+			continue
+		}
+		reasons = append(reasons, reason)
+	}
+	res.Score = float64(passed) / float64(len(assertions))
+	res.Passed = passed == len(assertions)
+	res.Reason = strings.Join(reasons, "; ")
+	return res, judgeErr
+}
+
+// judge 让大模型按照 criteria 判断输出是否合格，调用模型失败的时候返回 error
+func (s *EvaluationService) judge(ctx context.Context, criteria string, expected string, output string) (bool, string, error) {
+	content := fmt.Sprintf("评判标准：%s\n参考答案：%s\n模型输出：%s", criteria, expected, output)
+	resp, err := s.handler.Handle(ctx, []domain.Message{
+		{Role: domain.SYSTEM, Content: judgePrompt},
+		{Role: domain.USER, Content: content},
+	})
+	if err != nil {
+		return false, fmt.Sprintf("评测模型调用失败: %s", err), err
+	}
+	answer := strings.TrimSpace(resp.Response.Content)
+	if strings.HasPrefix(strings.ToUpper(answer), "PASS") {
+		return true, "", nil
+	}
+	return false, answer, nil
+}
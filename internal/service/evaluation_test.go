@@ -0,0 +1,121 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHandler 第一次调用是被评测的版本，后面的调用是评测模型
+type fakeHandler struct {
+	outputs []string
+	errs    []error
+	calls   int
+}
+
+func (f *fakeHandler) StreamHandle(ctx context.Context, req []domain.Message) (chan domain.StreamEvent, error) {
+	return nil, errors.New("不支持")
+}
+
+func (f *fakeHandler) Handle(ctx context.Context, req []domain.Message) (domain.ChatResponse, error) {
+	idx := f.calls
+	f.calls++
+	if idx < len(f.errs) && f.errs[idx] != nil {
+		return domain.ChatResponse{}, f.errs[idx]
+	}
+	return domain.ChatResponse{
+		Response: domain.Message{Role: domain.ASSISTANT, Content: f.outputs[idx]},
+		Usage:    domain.Usage{TotalTokens: 10},
+	}, nil
+}
+
+func TestEvaluationService_evalCase(t *testing.T) {
+	version := domain.PromptVersion{SystemContent: "你是一个计算器", Content: "{{question}}"}
+	testCases := []struct {
+		name    string
+		handler *fakeHandler
+		c       domain.EvalCase
+		wantErr bool
+		want    domain.EvalResult
+	}{
+		{
+			name:    "没有断言的时候完全匹配参考答案",
+			handler: &fakeHandler{outputs: []string{" 2\n"}},
+			c:       domain.EvalCase{ID: 1, Variables: map[string]string{"question": "1+1"}, Expected: "2"},
+			want:    domain.EvalResult{CaseID: 1, Output: " 2\n", Tokens: 10, Score: 1, Passed: true},
+		},
+		{
+			name:    "部分断言通过",
+			handler: &fakeHandler{outputs: []string{"答案是 3"}},
+			c: domain.EvalCase{ID: 2, Assertions: []domain.Assertion{
+				{Type: domain.AssertionContains, Value: "答案"},
+				{Type: domain.AssertionContains, Value: "2"},
+			}},
+			want: domain.EvalResult{CaseID: 2, Output: "答案是 3", Tokens: 10, Score: 0.5,
+				Reason: `输出不包含 "2"`},
+		},
+		{
+			name:    "调用模型失败",
+			handler: &fakeHandler{errs: []error{errors.New("模型超时")}},
+			c:       domain.EvalCase{ID: 3, Expected: "2"},
+			wantErr: true,
+			want:    domain.EvalResult{CaseID: 3, Reason: "模型超时"},
+		},
+		{
+			name:    "评测模型判定合格",
+			handler: &fakeHandler{outputs: []string{"2", "PASS 答案正确"}},
+			c: domain.EvalCase{ID: 4, Expected: "2", Assertions: []domain.Assertion{
+				{Type: domain.AssertionLLMJudge, Value: "结果正确"},
+			}},
+			want: domain.EvalResult{CaseID: 4, Output: "2", Tokens: 10, Score: 1, Passed: true},
+		},
+		{
+			name:    "评测模型判定不合格",
+			handler: &fakeHandler{outputs: []string{"3", "FAIL 结果错误"}},
+			c: domain.EvalCase{ID: 5, Expected: "2", Assertions: []domain.Assertion{
+				{Type: domain.AssertionLLMJudge, Value: "结果正确"},
+			}},
+			want: domain.EvalResult{CaseID: 5, Output: "3", Tokens: 10, Reason: "FAIL 结果错误"},
+		},
+		{
+			name:    "评测模型调用失败",
+			handler: &fakeHandler{outputs: []string{"2"}, errs: []error{nil, errors.New("模型超时")}},
+			c: domain.EvalCase{ID: 6, Expected: "2", Assertions: []domain.Assertion{
+				{Type: domain.AssertionLLMJudge, Value: "结果正确"},
+			}},
+			wantErr: true,
+			want:    domain.EvalResult{CaseID: 6, Output: "2", Tokens: 10, Reason: "评测模型调用失败: 模型超时"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewEvaluationService(nil, nil, nil, tc.handler)
+			res, err := svc.evalCase(context.Background(), version, tc.c)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			res.Latency = 0
+			assert.Equal(t, tc.want, res)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+)
+
+const (
+	maxFeedbackCommentLength = 500
+	// 一次最多导出的评价
+	maxFeedbackReviews     = 5000
+	defaultFeedbackReviews = 1000
+)
+
+// FeedbackService 给管理后台使用，聚合和导出用户的评价。评价本身由 ConversationService.Feedback 写入
+type FeedbackService struct {
+	repo *repository.FeedbackRepo
+}
+
+func NewFeedbackService(repo *repository.FeedbackRepo) *FeedbackService {
+	return &FeedbackService{repo: repo}
+}
+
+// Stats 按照模型或者 prompt 版本聚合评价
+func (s *FeedbackService) Stats(ctx context.Context, q domain.FeedbackStatsQuery) ([]domain.FeedbackStats, error) {
+	switch q.GroupBy {
+	case domain.FeedbackGroupByModel, domain.FeedbackGroupByPromptVersion:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的分组 %s", errs.ErrInvalidParam, q.GroupBy)
+	}
+	return s.repo.Stats(ctx, q)
+}
+
+// Reviews 查询需要复核的评价，默认只查询点踩的
+func (s *FeedbackService) Reviews(ctx context.Context, q domain.FeedbackQuery) ([]domain.FeedbackReview, error) {
+	if q.Rating == domain.FeedbackNone {
+		q.Rating = domain.FeedbackDown
+	}
+	if !q.Reason.Valid() {
+		return nil, fmt.Errorf("%w: 不支持的原因 %s", errs.ErrInvalidParam, q.Reason)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultFeedbackReviews
+	}
+	q.Limit = min(q.Limit, maxFeedbackReviews)
+	return s.repo.Reviews(ctx, q)
+}
+
+// ExportReviews 把需要复核的评价导出为 JSONL，每一行是一条评价
+func (s *FeedbackService) ExportReviews(ctx context.Context, q domain.FeedbackQuery) ([]byte, error) {
+	reviews, err := s.Reviews(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return marshalFeedbackReviews(reviews)
+}
+
+type feedbackReviewRecord struct {
+	MessageID       int64  `json:"message_id"`
+	Sn              string `json:"sn"`
+	Rating          int8   `json:"rating"`
+	Reason          string `json:"reason,omitempty"`
+	Comment         string `json:"comment,omitempty"`
+	Provider        string `json:"provider,omitempty"`
+	Model           string `json:"model,omitempty"`
+	PromptVersionID int64  `json:"prompt_version_id,omitempty"`
+	Question        string `json:"question"`
+	Answer          string `json:"answer"`
+	Time            int64  `json:"time"`
+}
+
+func marshalFeedbackReviews(reviews []domain.FeedbackReview) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	for _, review := range reviews {
+		fb := review.Feedback
+		err := encoder.Encode(feedbackReviewRecord{
+			MessageID:       fb.MessageID,
+			Sn:              fb.Sn,
+			Rating:          int8(fb.Rating),
+			Reason:          string(fb.Reason),
+			Comment:         fb.Comment,
+			Provider:        fb.Provider,
+			Model:           fb.Model,
+			PromptVersionID: fb.PromptVersionID,
+			Question:        review.Question,
+			Answer:          review.Answer,
+			Time:            fb.Utime,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalFeedbackReviews(t *testing.T) {
+	testCases := []struct {
+		name    string
+		reviews []domain.FeedbackReview
+		want    string
+	}{
+		{
+			name: "没有评价",
+			want: "",
+		},
+		{
+			name: "多条评价",
+			reviews: []domain.FeedbackReview{
+				{
+					Feedback: domain.MessageFeedback{
+						MessageID: 2, Sn: "a", Rating: domain.FeedbackDown, Reason: domain.FeedbackReasonInaccurate,
+						Comment: "<b>不对</b>", Provider: "deepseek", Model: "deepseek-chat", PromptVersionID: 3, Utime: 100,
+					},
+					Question: "1+1", Answer: "3",
+				},
+				{
+					Feedback: domain.MessageFeedback{MessageID: 4, Sn: "b", Rating: domain.FeedbackDown, Utime: 200},
+					Answer:   "不知道",
+				},
+			},
+			want: `{"message_id":2,"sn":"a","rating":-1,"reason":"inaccurate","comment":"<b>不对</b>","provider":"deepseek","model":"deepseek-chat","prompt_version_id":3,"question":"1+1","answer":"3","time":100}` + "\n" +
+				`{"message_id":4,"sn":"b","rating":-1,"question":"","answer":"不知道","time":200}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := marshalFeedbackReviews(tc.reviews)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(res))
+		})
+	}
+}
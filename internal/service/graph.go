@@ -16,41 +16,211 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 )
 
 type NodeService struct {
-	repo *repository.NodeRepo
+	repo      *repository.NodeRepo
+	validator *GraphValidator
 }
 
-func NewGraphService(repo *repository.NodeRepo) *NodeService {
-	return &NodeService{repo: repo}
+// NewGraphService validator 需要和 GraphRunService 共用，否则自定义的节点能执行但是不能保存
+func NewGraphService(repo *repository.NodeRepo, validator *GraphValidator) *NodeService {
+	return &NodeService{repo: repo, validator: validator}
 }
 
 func (svc *NodeService) GetGraph(ctx context.Context, id int64) (domain.Graph, error) {
 	return svc.repo.GetGraph(ctx, id)
 }
 
-func (svc *NodeService) SaveGraph(ctx context.Context, graph domain.Graph) (int64, error) {
+// SaveGraph 在一个事务里面保存整个图并且生成新的版本，返回保存之后的图。
+// graph.Version 是编辑之前读到的版本，图已经被其他人保存过的时候返回 ErrGraphVersionConflict。
+// 新的节点的 ID 可以是负数的临时 ID，边通过临时 ID 引用新的节点
+func (svc *NodeService) SaveGraph(ctx context.Context, graph domain.Graph) (domain.Graph, error) {
+	return svc.save(ctx, graph, func(domain.GraphIssue) bool { return true })
+}
+
+// save 是所有修改图的操作共用的保存路径，每次保存都会生成新的版本。
+// blocking 决定哪些问题会拒绝保存
+func (svc *NodeService) save(ctx context.Context, graph domain.Graph, blocking func(domain.GraphIssue) bool) (domain.Graph, error) {
+	ids := make(map[int64]bool, len(graph.Steps))
+	for i := range graph.Steps {
+		node := &graph.Steps[i]
+		node.GraphID = graph.ID
+		if node.ID == 0 {
+			continue
+		}
+		if ids[node.ID] {
+			return domain.Graph{}, fmt.Errorf("%w: 节点 %d 重复", errs.ErrInvalidParam, node.ID)
+		}
+		ids[node.ID] = true
+	}
+	// 没有临时 ID 的新节点不会被边引用，分配一个临时 ID 方便检查
+	var tmp int64
+	for i := range graph.Steps {
+		if graph.Steps[i].ID != 0 {
+			continue
+		}
+		for tmp--; ids[tmp]; tmp-- {
+		}
+		graph.Steps[i].ID = tmp
+	}
+	for i := range graph.Edges {
+		graph.Edges[i].GraphID = graph.ID
+	}
+	issues, err := svc.validate(ctx, graph)
+	if err != nil {
+		return domain.Graph{}, err
+	}
+	if err = checkIssues(issues, blocking); err != nil {
+		return domain.Graph{}, err
+	}
 	return svc.repo.SaveGraph(ctx, graph)
 }
 
+func (svc *NodeService) ListVersions(ctx context.Context, graphID int64) ([]domain.GraphVersion, error) {
+	return svc.repo.ListVersions(ctx, graphID)
+}
+
+func (svc *NodeService) GetVersion(ctx context.Context, graphID int64, version int64) (domain.GraphVersion, error) {
+	return svc.repo.GetVersion(ctx, graphID, version)
+}
+
+// SaveNode 把节点放到所属的图里面整体保存，会生成新的图版本。
+// 节点的类型和配置不合法的时候返回 GraphValidationError，图里面其他地方已经存在的问题不影响保存。
+// 已经存在的节点不能换到别的图
 func (svc *NodeService) SaveNode(ctx context.Context, step domain.Node) (int64, error) {
-	return svc.repo.SaveNode(ctx, step)
+	graph, err := svc.repo.GetGraph(ctx, step.GraphID)
+	if err != nil {
+		return 0, err
+	}
+	if step.ID > 0 {
+		idx := slices.IndexFunc(graph.Steps, func(n domain.Node) bool { return n.ID == step.ID })
+		if idx < 0 {
+			return 0, fmt.Errorf("%w: 节点 %d 不属于图 %d", errs.ErrInvalidParam, step.ID, graph.ID)
+		}
+		graph.Steps[idx] = step
+	} else {
+		step.ID = -1
+		graph.Steps = append(graph.Steps, step)
+	}
+	saved, err := svc.save(ctx, graph, func(issue domain.GraphIssue) bool {
+		return issue.NodeID == step.ID
+	})
+	if err != nil {
+		return 0, err
+	}
+	if step.ID > 0 {
+		return step.ID, nil
+	}
+	return newID(graph.Steps, saved.Steps, func(n domain.Node) int64 { return n.ID }), nil
 }
 
+// SaveEdge 把边放到图里面整体保存，会生成新的图版本。
+// 只有和这条边有关的问题或者形成了环才会拒绝保存，图里面其他地方已经存在的问题不影响保存
 func (svc *NodeService) SaveEdge(ctx context.Context, edge domain.Edge) (int64, error) {
-	return svc.repo.SaveEdge(ctx, edge)
+	graph, err := svc.repo.GetGraph(ctx, edge.GraphID)
+	if err != nil {
+		return 0, err
+	}
+	if edge.ID > 0 {
+		idx := slices.IndexFunc(graph.Edges, func(e domain.Edge) bool { return e.ID == edge.ID })
+		if idx < 0 {
+			return 0, fmt.Errorf("%w: 边 %d 不属于图 %d", errs.ErrInvalidParam, edge.ID, graph.ID)
+		}
+		graph.Edges[idx] = edge
+	} else {
+		// 临时 ID 让检查结果只命中这条新的边
+		edge.ID = -1
+		graph.Edges = append(graph.Edges, edge)
+	}
+	saved, err := svc.save(ctx, graph, func(issue domain.GraphIssue) bool {
+		return issue.EdgeID == edge.ID || issue.Code == domain.GraphIssueCycle
+	})
+	if err != nil {
+		return 0, err
+	}
+	if edge.ID > 0 {
+		return edge.ID, nil
+	}
+	return newID(graph.Edges, saved.Edges, func(e domain.Edge) int64 { return e.ID }), nil
+}
+
+// newID 找到保存之后才出现的 ID，也就是新建的节点或者边的 ID
+func newID[T any](before, after []T, id func(T) int64) int64 {
+	for _, item := range after {
+		if !slices.ContainsFunc(before, func(old T) bool { return id(old) == id(item) }) {
+			return id(item)
+		}
+	}
+	return 0
+}
+
+// Validate 检查已经保存的图，返回所有的问题，包括警告
+func (svc *NodeService) Validate(ctx context.Context, id int64) ([]domain.GraphIssue, error) {
+	graph, err := svc.repo.GetGraph(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return svc.validate(ctx, graph)
+}
+
+func (svc *NodeService) validate(ctx context.Context, graph domain.Graph) ([]domain.GraphIssue, error) {
+	inGraph := make(map[int64]bool, len(graph.Steps))
+	for _, node := range graph.Steps {
+		inGraph[node.ID] = true
+	}
+	var missing []int64
+	for _, edge := range graph.Edges {
+		for _, id := range []int64{edge.SourceID, edge.TargetID} {
+			if id > 0 && !inGraph[id] && !slices.Contains(missing, id) {
+				missing = append(missing, id)
+			}
+		}
+	}
+	foreign, err := svc.repo.GetNodesByIDs(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return svc.validator.Validate(graph, foreign...), nil
 }
 
+// DeleteEdge 从所属的图里面去掉这条边并且生成新的版本，边不存在的时候什么也不做
 func (svc *NodeService) DeleteEdge(ctx context.Context, id int64) error {
-	return svc.repo.DeleteEdge(ctx, id)
+	edges, err := svc.repo.GetEdgesByIDs(ctx, []int64{id})
+	if err != nil || len(edges) == 0 {
+		return err
+	}
+	graph, err := svc.repo.GetGraph(ctx, edges[0].GraphID)
+	if err != nil {
+		return err
+	}
+	graph.Edges = slices.DeleteFunc(graph.Edges, func(e domain.Edge) bool { return e.ID == id })
+	_, err = svc.save(ctx, graph, func(domain.GraphIssue) bool { return false })
+	return err
 }
 
+// DeleteNode 从所属的图里面去掉这个节点和连着它的边并且生成新的版本，节点不存在的时候什么也不做
 func (svc *NodeService) DeleteNode(ctx context.Context, id int64) error {
-	return svc.repo.DeleteNode(ctx, id)
+	nodes, err := svc.repo.GetNodesByIDs(ctx, []int64{id})
+	if err != nil || len(nodes) == 0 {
+		return err
+	}
+	graph, err := svc.repo.GetGraph(ctx, nodes[0].GraphID)
+	if err != nil {
+		return err
+	}
+	graph.Steps = slices.DeleteFunc(graph.Steps, func(n domain.Node) bool { return n.ID == id })
+	graph.Edges = slices.DeleteFunc(graph.Edges, func(e domain.Edge) bool {
+		return e.SourceID == id || e.TargetID == id
+	})
+	_, err = svc.save(ctx, graph, func(domain.GraphIssue) bool { return false })
+	return err
 }
 
 func (svc *NodeService) DeleteGraph(ctx context.Context, id int64) error {
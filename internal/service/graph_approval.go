@@ -0,0 +1,177 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+const (
+	defaultApprovalTimeout = 24 * time.Hour
+	expireApprovalBatch    = 100
+)
+
+// errNodeWaiting 审批节点开始等待审批，执行在这里暂停
+var errNodeWaiting = errors.New("节点等待审批")
+
+// waitApproval 记录审批的截止时间，节点的输入就是等待审批的内容
+func (s *GraphRunService) waitApproval(ctx context.Context, node domain.Node, run *domain.GraphRun,
+	nodeRun *domain.NodeRun, emit func(domain.GraphRunEvent)) error {
+	var cfg domain.ApprovalNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	timeout := defaultApprovalTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	nodeRun.Status = domain.NodeRunStatusWaiting
+	nodeRun.Deadline = time.Now().Add(timeout).UnixMilli()
+	nodeRun.Approval = nil
+	s.saveNodeRun(ctx, *nodeRun)
+	emit(s.event(domain.GraphRunEventNodeWaiting, *run, *nodeRun))
+	return errNodeWaiting
+}
+
+// Approve 审批一个等待中的节点，然后继续执行。通过的时候走 approved 分支，拒绝的时候走 rejected 分支。
+// 只有发起执行的用户可以审批
+func (s *GraphRunService) Approve(ctx context.Context, req domain.GraphApproval) (domain.GraphRun, error) {
+	run, err := s.GetRun(ctx, req.RunID, req.Uid)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	idx := slices.IndexFunc(run.Nodes, func(node domain.NodeRun) bool {
+		return node.NodeID == req.NodeID
+	})
+	if idx < 0 || run.Nodes[idx].Status != domain.NodeRunStatusWaiting {
+		return domain.GraphRun{}, fmt.Errorf("%w: 节点 %d 没有在等待审批", errs.ErrInvalidParam, req.NodeID)
+	}
+	if time.Now().UnixMilli() > run.Nodes[idx].Deadline {
+		return domain.GraphRun{}, fmt.Errorf("%w: 节点 %d 的审批已经超时", errs.ErrInvalidParam, req.NodeID)
+	}
+	plan, run, results, err := s.restore(ctx, run)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	return s.decide(ctx, plan, run, results, req.NodeID, domain.NodeApproval{
+		Approved: req.Approved,
+		Uid:      req.Uid,
+		Comment:  req.Comment,
+		Edited:   req.Approved && req.Payload != nil,
+	}, req.Payload)
+}
+
+// decide 记录审批的结果并且继续执行，payload 不为 nil 的时候替换节点的输出
+func (s *GraphRunService) decide(ctx context.Context, plan graphPlan, run domain.GraphRun, results map[int64]NodeResult,
+	nodeID int64, approval domain.NodeApproval, payload any) (domain.GraphRun, error) {
+	if err := s.restart(ctx, &run, domain.GraphRunStatusWaiting); err != nil {
+		return domain.GraphRun{}, err
+	}
+	idx := slices.IndexFunc(plan.order, func(node domain.Node) bool {
+		return node.ID == nodeID
+	})
+	nodeRun := &run.Nodes[idx]
+	approval.Time = time.Now().UnixMilli()
+	nodeRun.Approval = &approval
+	nodeRun.Status = domain.NodeRunStatusSucceeded
+	nodeRun.Output = nodeRun.Input
+	nodeRun.Branch = domain.ApprovalBranchRejected
+	if approval.Approved {
+		nodeRun.Branch = domain.ApprovalBranchApproved
+		if approval.Edited {
+			nodeRun.Output = payload
+		}
+	}
+	s.saveNodeRun(ctx, *nodeRun)
+	results[nodeID] = NodeResult{Output: nodeRun.Output, Branch: nodeRun.Branch}
+	return s.execute(ctx, plan, run, results, func(domain.GraphRunEvent) {}), nil
+}
+
+// ListApprovals 用户发起的执行里面等待审批的节点，截止时间早的排在前面
+func (s *GraphRunService) ListApprovals(ctx context.Context, uid int64, limit int, offset int) ([]domain.NodeRun, error) {
+	if uid <= 0 {
+		return nil, fmt.Errorf("%w: 缺少 uid", errs.ErrInvalidParam)
+	}
+	if limit <= 0 {
+		limit = defaultGraphRunLimit
+	}
+	return s.runs.ListWaitingNodeRuns(ctx, uid, 0, min(limit, maxGraphRunLimit), offset)
+}
+
+// ExpireApprovals 按照节点配置的 on_timeout 处理已经超时的审批，返回处理的数量。
+// 同时被审批或者被别的实例处理掉的节点会被忽略
+func (s *GraphRunService) ExpireApprovals(ctx context.Context) (int, error) {
+	nodes, err := s.runs.ListWaitingNodeRuns(ctx, 0, time.Now().UnixMilli(), expireApprovalBatch, 0)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, node := range nodes {
+		err = s.expire(ctx, node)
+		if err != nil {
+			elog.Warn("处理审批超时失败", elog.Int64("run", node.RunID), elog.Int64("node", node.NodeID), elog.FieldErr(err))
+			continue
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+func (s *GraphRunService) expire(ctx context.Context, node domain.NodeRun) error {
+	run, err := s.runs.GetRun(ctx, node.RunID)
+	if err != nil {
+		return err
+	}
+	plan, run, results, err := s.restore(ctx, run)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(plan.order, func(n domain.Node) bool {
+		return n.ID == node.NodeID
+	})
+	var cfg domain.ApprovalNodeConfig
+	if err = domain.ParseNodeConfig(plan.order[idx], &cfg); err != nil {
+		return err
+	}
+	_, err = s.decide(ctx, plan, run, results, node.NodeID, domain.NodeApproval{
+		Approved: cfg.OnTimeout == "approve",
+		Timeout:  true,
+	}, nil)
+	return err
+}
+
+// WatchApprovalTimeouts 定时处理超时的审批，直到 ctx 被取消
+func (s *GraphRunService) WatchApprovalTimeouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireApprovals(ctx); err != nil {
+				elog.Error("处理审批超时失败", elog.FieldErr(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit"
+)
+
+// graphDocumentFormat 导出文档的格式，格式不兼容的时候升级版本号
+const graphDocumentFormat = "ai-gateway/graph@v1"
+
+// graphDocument 可以在不同环境之间迁移的图。节点用文档内部的 ref 互相引用，不包含数据库的 ID。
+// 节点和边的配置是 JSON 对象，图的 metadata 是原样保存的字符串
+type graphDocument struct {
+	Format   string              `json:"format"`
+	Metadata string              `json:"metadata,omitempty"`
+	Nodes    []graphDocumentNode `json:"nodes"`
+	Edges    []graphDocumentEdge `json:"edges"`
+}
+
+type graphDocumentNode struct {
+	Ref      string          `json:"ref"`
+	Type     string          `json:"type"`
+	Status   string          `json:"status,omitempty"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+type graphDocumentEdge struct {
+	Source   string          `json:"source"`
+	Target   string          `json:"target"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// Export 把图导出成 JSON 文档，节点的 ref 就是节点的 key。
+// 没有 key 的节点会补上默认的 key node_<id>，这样模板里面的 {{nodes.node_<id>}} 在导入之后仍然有效。
+// 大模型节点引用的 prompt 保持原来的 ID，导入到别的环境之后需要修改
+func (svc *NodeService) Export(ctx context.Context, id int64) ([]byte, error) {
+	graph, err := svc.repo.GetGraph(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(graph.Steps, func(a, b domain.Node) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	slices.SortFunc(graph.Edges, func(a, b domain.Edge) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	meta, _ := graph.Metadata.AsString()
+	doc := graphDocument{
+		Format:   graphDocumentFormat,
+		Metadata: meta,
+		Nodes:    make([]graphDocumentNode, 0, len(graph.Steps)),
+		Edges:    make([]graphDocumentEdge, 0, len(graph.Edges)),
+	}
+	refs := make(map[int64]string, len(graph.Steps))
+	used := make(map[string]bool, len(graph.Steps))
+	for _, node := range graph.Steps {
+		ref := nodeKey(node)
+		if used[ref] {
+			return nil, fmt.Errorf("%w: 节点 %d 的 key %q 重复", errs.ErrInvalidParam, node.ID, ref)
+		}
+		used[ref] = true
+		refs[node.ID] = ref
+		cfg, err := svc.documentConfig(node.Metadata, map[string]any{"key": ref})
+		if err != nil {
+			return nil, fmt.Errorf("%w: 节点 %d 的配置不合法: %s", errs.ErrInvalidParam, node.ID, err)
+		}
+		doc.Nodes = append(doc.Nodes, graphDocumentNode{Ref: ref, Type: node.Type, Status: node.Status, Metadata: cfg})
+	}
+	for _, edge := range graph.Edges {
+		source, ok1 := refs[edge.SourceID]
+		target, ok2 := refs[edge.TargetID]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: 边 %d 连接的节点不在图 %d 里面", errs.ErrInvalidParam, edge.ID, id)
+		}
+		cfg, err := svc.documentConfig(edge.Metadata, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 边 %d 的配置不合法: %s", errs.ErrInvalidParam, edge.ID, err)
+		}
+		doc.Edges = append(doc.Edges, graphDocumentEdge{Source: source, Target: target, Metadata: cfg})
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// documentConfig 把节点或者边的配置转成 JSON 对象，defaults 里面的字段只在配置里面没有的时候补上
+func (svc *NodeService) documentConfig(metadata ekit.AnyValue, defaults map[string]any) (json.RawMessage, error) {
+	cfg := make(map[string]any, len(defaults))
+	if str, _ := metadata.AsString(); str != "" {
+		if err := json.Unmarshal([]byte(str), &cfg); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range defaults {
+		if _, ok := cfg[k]; !ok {
+			cfg[k] = v
+		}
+	}
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(cfg)
+}
+
+// Import 用导出的文档创建一个新的图，节点和边的 ID 由数据库重新分配。
+// 文档里面的图不合法的时候返回 GraphValidationError，问题里面的节点 ID 是按照文档顺序分配的临时 ID -1、-2...
+func (svc *NodeService) Import(ctx context.Context, data []byte) (domain.Graph, error) {
+	return svc.importDocument(ctx, data, nil)
+}
+
+func (svc *NodeService) importDocument(ctx context.Context, data []byte, overrides map[string]map[string]any) (domain.Graph, error) {
+	graph, err := parseGraphDocument(data, overrides)
+	if err != nil {
+		return domain.Graph{}, err
+	}
+	return svc.SaveGraph(ctx, graph)
+}
+
+// parseGraphDocument 把文档转成新的图，节点使用临时 ID。overrides 按照节点的 ref 覆盖节点配置里面的字段
+func parseGraphDocument(data []byte, overrides map[string]map[string]any) (domain.Graph, error) {
+	var doc graphDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return domain.Graph{}, fmt.Errorf("%w: 文档不是合法的 JSON: %s", errs.ErrInvalidParam, err)
+	}
+	if doc.Format != graphDocumentFormat {
+		return domain.Graph{}, fmt.Errorf("%w: 不支持的文档格式 %q", errs.ErrInvalidParam, doc.Format)
+	}
+	for ref := range overrides {
+		if !slices.ContainsFunc(doc.Nodes, func(node graphDocumentNode) bool { return node.Ref == ref }) {
+			return domain.Graph{}, fmt.Errorf("%w: 节点 %q 不存在", errs.ErrInvalidParam, ref)
+		}
+	}
+	graph := domain.Graph{
+		Metadata: ekit.AnyValue{Val: doc.Metadata},
+		Steps:    make([]domain.Node, 0, len(doc.Nodes)),
+		Edges:    make([]domain.Edge, 0, len(doc.Edges)),
+	}
+	ids := make(map[string]int64, len(doc.Nodes))
+	for i, node := range doc.Nodes {
+		if node.Ref == "" {
+			return domain.Graph{}, fmt.Errorf("%w: 第 %d 个节点没有 ref", errs.ErrInvalidParam, i+1)
+		}
+		if _, ok := ids[node.Ref]; ok {
+			return domain.Graph{}, fmt.Errorf("%w: 节点 %q 重复", errs.ErrInvalidParam, node.Ref)
+		}
+		id := -int64(i + 1)
+		ids[node.Ref] = id
+		cfg, err := overrideConfig(node.Metadata, overrides[node.Ref])
+		if err != nil {
+			return domain.Graph{}, fmt.Errorf("%w: 节点 %q 的配置不合法: %s", errs.ErrInvalidParam, node.Ref, err)
+		}
+		graph.Steps = append(graph.Steps, domain.Node{ID: id, Type: node.Type, Status: node.Status, Metadata: ekit.AnyValue{Val: cfg}})
+	}
+	for i, edge := range doc.Edges {
+		source, ok1 := ids[edge.Source]
+		target, ok2 := ids[edge.Target]
+		if !ok1 || !ok2 {
+			return domain.Graph{}, fmt.Errorf("%w: 第 %d 条边连接的节点 %q -> %q 不存在", errs.ErrInvalidParam, i+1, edge.Source, edge.Target)
+		}
+		graph.Edges = append(graph.Edges, domain.Edge{SourceID: source, TargetID: target, Metadata: ekit.AnyValue{Val: string(edge.Metadata)}})
+	}
+	return graph, nil
+}
+
+func overrideConfig(cfg json.RawMessage, overrides map[string]any) (string, error) {
+	if len(overrides) == 0 {
+		return string(cfg), nil
+	}
+	res := make(map[string]any, len(overrides))
+	if len(cfg) > 0 {
+		if err := json.Unmarshal(cfg, &res); err != nil {
+			return "", err
+		}
+	}
+	for k, v := range overrides {
+		res[k] = v
+	}
+	data, err := json.Marshal(res)
+	return string(data), err
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGraphDocument(t *testing.T) {
+	testCases := []struct {
+		name      string
+		doc       string
+		overrides map[string]map[string]any
+		wantNodes []string
+		wantEdges [][2]int64
+		wantErr   error
+	}{
+		{
+			name: "用临时 ID 替换 ref",
+			doc: `{"format": "ai-gateway/graph@v1", "metadata": "客服", "nodes": [
+				{"ref": "a", "type": "template", "metadata": {"key": "a", "template": "{{input}}"}},
+				{"ref": "b", "type": "llm", "metadata": {"key": "b", "prompt_id": 0}}
+			], "edges": [{"source": "a", "target": "b"}]}`,
+			overrides: map[string]map[string]any{"b": {"prompt_id": 3}},
+			wantNodes: []string{`{"key": "a", "template": "{{input}}"}`, `{"key":"b","prompt_id":3}`},
+			wantEdges: [][2]int64{{-1, -2}},
+		},
+		{
+			name:    "格式不对",
+			doc:     `{"format": "other", "nodes": []}`,
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "ref 重复",
+			doc:     `{"format": "ai-gateway/graph@v1", "nodes": [{"ref": "a", "type": "template"}, {"ref": "a", "type": "template"}]}`,
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "边引用的节点不存在",
+			doc:     `{"format": "ai-gateway/graph@v1", "nodes": [{"ref": "a", "type": "template"}], "edges": [{"source": "a", "target": "b"}]}`,
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:      "覆盖的节点不存在",
+			doc:       `{"format": "ai-gateway/graph@v1", "nodes": [{"ref": "a", "type": "template"}]}`,
+			overrides: map[string]map[string]any{"b": {"prompt_id": 3}},
+			wantErr:   errs.ErrInvalidParam,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			graph, err := parseGraphDocument([]byte(tc.doc), tc.overrides)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantNodes, slice.Map(graph.Steps, func(idx int, src domain.Node) string {
+				return src.Metadata.Val.(string)
+			}))
+			assert.Equal(t, tc.wantEdges, slice.Map(graph.Edges, func(idx int, src domain.Edge) [2]int64 {
+				return [2]int64{src.SourceID, src.TargetID}
+			}))
+		})
+	}
+}
+
+// 所有的模板覆盖了大模型节点的 prompt_id 之后都是合法的图
+func TestGraphTemplates(t *testing.T) {
+	validator := NewGraphValidator()
+	for _, tpl := range graphTemplates {
+		t.Run(tpl.Name, func(t *testing.T) {
+			var doc graphDocument
+			require.NoError(t, json.Unmarshal(tpl.Document, &doc))
+			overrides := make(map[string]map[string]any)
+			for _, node := range doc.Nodes {
+				if node.Type == domain.NodeTypeLLM {
+					overrides[node.Ref] = map[string]any{"prompt_id": 1}
+				}
+			}
+			graph, err := parseGraphDocument(tpl.Document, overrides)
+			require.NoError(t, err)
+			assert.Empty(t, validator.Validate(graph))
+		})
+	}
+}
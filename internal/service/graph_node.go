@@ -0,0 +1,323 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+)
+
+const (
+	defaultHTTPNodeTimeout = 10 * time.Second
+	maxHTTPNodeTimeout     = time.Minute
+	// HTTP 节点最多跟随的重定向次数
+	maxHTTPNodeRedirects = 5
+	// HTTP 节点最多读取的响应大小
+	maxHTTPNodeResponse = 1 << 20
+)
+
+// NodeExecutor 执行某一种类型的节点
+type NodeExecutor interface {
+	Execute(ctx context.Context, nc NodeContext) (NodeResult, error)
+}
+
+// NodeContext 节点执行的时候可以使用的数据
+type NodeContext struct {
+	Run  domain.GraphRun
+	Node domain.Node
+	// 被执行的上游的输出，按照上游节点的 ID 排序
+	Upstreams []NodeOutput
+	// 没有上游的时候是执行的输入，一个上游的时候是它的输出，多个上游的时候按照 Key 组成对象
+	Input any
+	// 模板和条件里面可以使用的变量：input 是 Input，run 是执行的输入，nodes 是已经执行完的节点按照 Key 组成的对象
+	Scope map[string]any
+}
+
+type NodeOutput struct {
+	NodeID int64
+	Key    string
+	Output any
+}
+
+type NodeResult struct {
+	Output any
+	Usage  domain.Usage
+	// 条件节点选中的分支，只有 Branch 相同或者没有声明分支的出边会被执行
+	Branch string
+}
+
+// llmNode 使用 prompt 调用大模型，输入是对象的时候每个字段都可以作为 prompt 的变量，另外 input 是整个输入。
+// 发起执行的用户至少需要是 prompt 的 viewer，图里面的配置不能绕开 prompt 的权限
+type llmNode struct {
+	prompt    *PromptService
+	promptACL *PromptACLService
+	handler   llm.Handler
+}
+
+func (n *llmNode) Execute(ctx context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.LLMNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	if n.prompt == nil || n.promptACL == nil || n.handler == nil {
+		return NodeResult{}, fmt.Errorf("没有配置大模型")
+	}
+	if err := n.promptACL.Check(ctx, nc.Run.Uid, cfg.PromptID, domain.PromptRoleViewer); err != nil {
+		return NodeResult{}, err
+	}
+	version, err := n.version(ctx, cfg, nc.Run.ID)
+	if err != nil {
+		return NodeResult{}, err
+	}
+	vars := map[string]string{"input": domain.Stringify(nc.Input)}
+	if fields, ok := nc.Input.(map[string]any); ok {
+		for key, val := range fields {
+			vars[key] = domain.Stringify(val)
+		}
+	}
+	messages := make([]domain.Message, 0, 2)
+	if version.SystemContent != "" {
+		messages = append(messages, domain.Message{Role: domain.SYSTEM, Content: version.SystemContent})
+	}
+	messages = append(messages, domain.Message{Role: domain.USER, Content: version.Render(vars)})
+	resp, err := n.handler.Handle(ctx, messages)
+	if err != nil {
+		return NodeResult{}, err
+	}
+	return NodeResult{Output: resp.Response.Content, Usage: resp.Usage}, nil
+}
+
+func (n *llmNode) version(ctx context.Context, cfg domain.LLMNodeConfig, runID int64) (domain.PromptVersion, error) {
+	if cfg.VersionID == 0 {
+		return n.prompt.Pick(ctx, cfg.PromptID, strconv.FormatInt(runID, 10))
+	}
+	prompt, err := n.prompt.Get(ctx, cfg.PromptID)
+	if err != nil {
+		return domain.PromptVersion{}, err
+	}
+	for _, v := range prompt.Versions {
+		if v.ID == cfg.VersionID {
+			return v, nil
+		}
+	}
+	return domain.PromptVersion{}, fmt.Errorf("prompt %d 没有版本 %d", cfg.PromptID, cfg.VersionID)
+}
+
+type templateNode struct{}
+
+func (templateNode) Execute(_ context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.TemplateNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	return NodeResult{Output: domain.RenderTemplate(cfg.Template, nc.Scope)}, nil
+}
+
+// errForbiddenAddress HTTP 节点不允许访问内网、本机以及云厂商的元数据地址
+var errForbiddenAddress = errors.New("不允许访问内网地址")
+
+// metadataAddress 云厂商的元数据服务，虽然已经属于 link-local，这里还是明确禁止
+var metadataAddress = netip.MustParseAddr("169.254.169.254")
+
+// newHTTPNodeClient HTTP 节点的 URL 可以来自执行的输入，例如 webhook 的请求体，
+// 所以只允许 http 和 https，并且在 DNS 解析之后检查真正连接的地址，重定向也一样。
+// 不使用代理，否则检查的是代理的地址
+func newHTTPNodeClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: checkDialAddress}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConnsPerHost: 10,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxHTTPNodeRedirects {
+				return fmt.Errorf("重定向超过 %d 次", maxHTTPNodeRedirects)
+			}
+			return checkHTTPScheme(req)
+		},
+	}
+}
+
+func checkDialAddress(_ string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !allowedAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w %s", errForbiddenAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+func allowedAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() && addr != metadataAddress
+}
+
+func checkHTTPScheme(req *http.Request) error {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("只支持 http 和 https，不支持 %q", req.URL.Scheme)
+	}
+	return nil
+}
+
+// httpNode URL、请求头和请求体都可以使用模板。响应是 JSON 的时候输出解析之后的对象，否则输出字符串
+type httpNode struct {
+	client *http.Client
+}
+
+func (n *httpNode) Execute(ctx context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.HTTPNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	timeout := defaultHTTPNodeTimeout
+	if cfg.TimeoutMs > 0 {
+		timeout = min(time.Duration(cfg.TimeoutMs)*time.Millisecond, maxHTTPNodeTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(domain.RenderTemplate(cfg.Body, nc.Scope))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, domain.RenderTemplate(cfg.URL, nc.Scope), body)
+	if err != nil {
+		return NodeResult{}, err
+	}
+	if err = checkHTTPScheme(req); err != nil {
+		return NodeResult{}, err
+	}
+	for key, val := range cfg.Headers {
+		req.Header.Set(key, domain.RenderTemplate(val, nc.Scope))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return NodeResult{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPNodeResponse+1))
+	if err != nil {
+		return NodeResult{}, err
+	}
+	if len(data) > maxHTTPNodeResponse {
+		return NodeResult{}, fmt.Errorf("响应超过 %dKB", maxHTTPNodeResponse>>10)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return NodeResult{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+	var output any
+	if json.Valid(data) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if err = decoder.Decode(&output); err == nil {
+			return NodeResult{Output: output}, nil
+		}
+	}
+	return NodeResult{Output: string(data)}, nil
+}
+
+// conditionNode 输出原样传递输入
+type conditionNode struct{}
+
+func (conditionNode) Execute(_ context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.ConditionNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	branch := cfg.Default
+	for _, c := range cfg.Cases {
+		if c.Match(nc.Scope) {
+			branch = c.Branch
+			break
+		}
+	}
+	return NodeResult{Output: nc.Input, Branch: branch}, nil
+}
+
+type mergeNode struct{}
+
+func (mergeNode) Execute(_ context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.MergeNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	switch cfg.Mode {
+	case "array":
+		res := make([]any, 0, len(nc.Upstreams))
+		for _, up := range nc.Upstreams {
+			res = append(res, up.Output)
+		}
+		return NodeResult{Output: res}, nil
+	case "first":
+		for _, up := range nc.Upstreams {
+			if up.Output != nil {
+				return NodeResult{Output: up.Output}, nil
+			}
+		}
+		return NodeResult{}, nil
+	case "", "object":
+		res := make(map[string]any, len(nc.Upstreams))
+		for _, up := range nc.Upstreams {
+			res[up.Key] = up.Output
+		}
+		return NodeResult{Output: res}, nil
+	default:
+		return NodeResult{}, fmt.Errorf("不支持的合并方式 %s", cfg.Mode)
+	}
+}
+
+// transformNode 按照路径从变量里面挑选字段，保留原来的类型
+type transformNode struct{}
+
+func (transformNode) Execute(_ context.Context, nc NodeContext) (NodeResult, error) {
+	var cfg domain.TransformNodeConfig
+	if err := domain.ParseNodeConfig(nc.Node, &cfg); err != nil {
+		return NodeResult{}, err
+	}
+	res := make(map[string]any, len(cfg.Fields))
+	for field, path := range cfg.Fields {
+		val, _ := domain.LookupPath(nc.Scope, path)
+		res[field] = val
+	}
+	return NodeResult{Output: res}, nil
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
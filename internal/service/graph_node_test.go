@@ -0,0 +1,254 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeExecutors(t *testing.T) {
+	scope := func(input any) map[string]any {
+		return map[string]any{"input": input, "run": map[string]any{"lang": "en"}, "nodes": map[string]any{"a": "A"}}
+	}
+	upstreams := []NodeOutput{{NodeID: 1, Key: "a", Output: "A"}, {NodeID: 2, Key: "b", Output: nil}, {NodeID: 3, Key: "c", Output: "C"}}
+	testCases := []struct {
+		name       string
+		executor   NodeExecutor
+		metadata   string
+		input      any
+		upstreams  []NodeOutput
+		wantOutput any
+		wantBranch string
+		wantErr    string
+	}{
+		{
+			name:       "模板",
+			executor:   templateNode{},
+			metadata:   `{"template": "{{input.q}} -> {{run.lang}} {{nodes.a}}"}`,
+			input:      map[string]any{"q": "你好"},
+			wantOutput: "你好 -> en A",
+		},
+		{
+			name:       "条件命中",
+			executor:   conditionNode{},
+			metadata:   `{"cases": [{"path": "input.score", "op": "gt", "value": 0.5, "branch": "high"}], "default": "low"}`,
+			input:      map[string]any{"score": 0.8},
+			wantOutput: map[string]any{"score": 0.8},
+			wantBranch: "high",
+		},
+		{
+			name:       "条件默认分支",
+			executor:   conditionNode{},
+			metadata:   `{"cases": [{"path": "input.score", "op": "gt", "value": 0.5, "branch": "high"}], "default": "low"}`,
+			input:      map[string]any{"score": 0.1},
+			wantOutput: map[string]any{"score": 0.1},
+			wantBranch: "low",
+		},
+		{
+			name:       "合并成对象",
+			executor:   mergeNode{},
+			upstreams:  upstreams,
+			wantOutput: map[string]any{"a": "A", "b": nil, "c": "C"},
+		},
+		{
+			name:       "合并成数组",
+			executor:   mergeNode{},
+			metadata:   `{"mode": "array"}`,
+			upstreams:  upstreams,
+			wantOutput: []any{"A", nil, "C"},
+		},
+		{
+			name:       "取第一个",
+			executor:   mergeNode{},
+			metadata:   `{"mode": "first"}`,
+			upstreams:  upstreams[1:],
+			wantOutput: "C",
+		},
+		{
+			name:      "不支持的合并方式",
+			executor:  mergeNode{},
+			metadata:  `{"mode": "zip"}`,
+			upstreams: upstreams,
+			wantErr:   "不支持的合并方式 zip",
+		},
+		{
+			name:       "挑选字段",
+			executor:   transformNode{},
+			metadata:   `{"fields": {"title": "input.items.0.title", "lang": "run.lang", "missing": "input.x"}}`,
+			input:      map[string]any{"items": []any{map[string]any{"title": "t"}}},
+			wantOutput: map[string]any{"title": "t", "lang": "en", "missing": nil},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.executor.Execute(context.Background(), NodeContext{
+				Node:      domain.Node{Metadata: ekit.AnyValue{Val: tc.metadata}},
+				Upstreams: tc.upstreams,
+				Input:     tc.input,
+				Scope:     scope(tc.input),
+			})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, res.Output)
+			assert.Equal(t, tc.wantBranch, res.Branch)
+		})
+	}
+}
+
+func TestHTTPNode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"method":"` + r.Method + `","token":"` + r.Header.Get("X-Token") + `","body":` + string(body) + `}`))
+		case "/text":
+			_, _ = w.Write([]byte("hello " + r.URL.Query().Get("name")))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("boom"))
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name       string
+		metadata   string
+		wantOutput any
+		wantErr    string
+	}{
+		{
+			name:       "JSON 响应",
+			metadata:   `{"method": "post", "url": "` + server.URL + `/json", "headers": {"X-Token": "{{input.token}}"}, "body": "{\"q\": \"{{input.q}}\"}"}`,
+			wantOutput: map[string]any{"method": "POST", "token": "secret", "body": map[string]any{"q": "hi"}},
+		},
+		{
+			name:       "文本响应",
+			metadata:   `{"url": "` + server.URL + `/text?name={{input.q}}"}`,
+			wantOutput: "hello hi",
+		},
+		{
+			name:     "错误的状态码",
+			metadata: `{"url": "` + server.URL + `/error"}`,
+			wantErr:  "HTTP 500: boom",
+		},
+	}
+	node := &httpNode{client: server.Client()}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := map[string]any{"q": "hi", "token": "secret"}
+			res, err := node.Execute(context.Background(), NodeContext{
+				Node:  domain.Node{Metadata: ekit.AnyValue{Val: tc.metadata}},
+				Input: input,
+				Scope: map[string]any{"input": input},
+			})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, res.Output)
+		})
+	}
+}
+
+// 默认的客户端不允许访问内网地址，URL 来自执行的输入的时候也一样
+func TestHTTPNode_Forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name     string
+		metadata string
+		input    any
+		wantErr  string
+	}{
+		{
+			name:     "本机地址",
+			metadata: `{"url": "` + server.URL + `"}`,
+			wantErr:  "不允许访问内网地址 127.0.0.1",
+		},
+		{
+			name:     "输入里面的元数据地址",
+			metadata: `{"url": "{{input.url}}"}`,
+			input:    map[string]any{"url": "http://169.254.169.254/latest/meta-data/"},
+			wantErr:  "不允许访问内网地址 169.254.169.254",
+		},
+		{
+			name:     "解析到本机的域名",
+			metadata: `{"url": "http://localhost:` + server.URL[strings.LastIndex(server.URL, ":")+1:] + `"}`,
+			wantErr:  "不允许访问内网地址",
+		},
+		{
+			name:     "不支持的协议",
+			metadata: `{"url": "file:///etc/passwd"}`,
+			wantErr:  "只支持 http 和 https",
+		},
+	}
+	node := &httpNode{client: newHTTPNodeClient()}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := node.Execute(context.Background(), NodeContext{
+				Node:  domain.Node{Metadata: ekit.AnyValue{Val: tc.metadata}},
+				Input: tc.input,
+				Scope: map[string]any{"input": tc.input},
+			})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
+
+func TestAllowedAddress(t *testing.T) {
+	testCases := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "8.8.8.8", want: true},
+		{addr: "2606:4700:4700::1111", want: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.1"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "fd00:ec2::254"},
+		{addr: "0.0.0.0"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "224.0.0.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			assert.Equal(t, tc.want, allowedAddress(netip.MustParseAddr(tc.addr)))
+		})
+	}
+}
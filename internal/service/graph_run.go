@@ -0,0 +1,423 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// 客户端断开之后执行还会继续，需要一个上限
+const maxGraphRunDuration = 30 * time.Minute
+
+// GraphRunService 执行图。节点按照拓扑顺序依次执行，上游的输出沿着边传递给下游
+type GraphRunService struct {
+	graph     *repository.NodeRepo
+	runs      *repository.GraphRunRepo
+	quota     *QuotaService
+	executors map[string]NodeExecutor
+	validator *GraphValidator
+}
+
+type GraphRunOption func(s *GraphRunService)
+
+// WithNodeExecutor 注册或者替换某种类型的节点的执行器，schema 为 nil 的时候不检查节点的配置。
+// schema 注册到共享的 GraphValidator 里面，所以使用同一个 validator 的 NodeService 也可以保存这种节点
+func WithNodeExecutor(typ string, executor NodeExecutor, schema NodeSchema) GraphRunOption {
+	return func(s *GraphRunService) {
+		s.executors[typ] = executor
+		s.validator.Register(typ, schema)
+	}
+}
+
+// WithHTTPNodeClient 替换 HTTP 节点使用的客户端，默认的客户端不允许访问内网地址
+func WithHTTPNodeClient(client *http.Client) GraphRunOption {
+	return func(s *GraphRunService) {
+		s.executors[domain.NodeTypeHTTP] = &httpNode{client: client}
+	}
+}
+
+// NewGraphRunService validator 需要和 NodeService 共用，quota 为 nil 的时候大模型节点不计费
+func NewGraphRunService(graph *repository.NodeRepo, runs *repository.GraphRunRepo, validator *GraphValidator,
+	prompt *PromptService, promptACL *PromptACLService, handler llm.Handler, quota *QuotaService, opts ...GraphRunOption) *GraphRunService {
+	res := &GraphRunService{
+		graph: graph,
+		runs:  runs,
+		quota: quota,
+		executors: map[string]NodeExecutor{
+			domain.NodeTypeLLM:       &llmNode{prompt: prompt, promptACL: promptACL, handler: handler},
+			domain.NodeTypeTemplate:  templateNode{},
+			domain.NodeTypeHTTP:      &httpNode{client: newHTTPNodeClient()},
+			domain.NodeTypeCondition: conditionNode{},
+			domain.NodeTypeMerge:     mergeNode{},
+			domain.NodeTypeTransform: transformNode{},
+		},
+		validator: validator,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// Run 同步执行图，返回执行的结果。节点执行失败的时候返回的 error 为 nil，结果看 GraphRun.Status
+func (s *GraphRunService) Run(ctx context.Context, req domain.GraphRunRequest) (domain.GraphRun, error) {
+	plan, run, err := s.start(ctx, req)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	return s.execute(ctx, plan, run, make(map[int64]NodeResult), func(domain.GraphRunEvent) {}), nil
+}
+
+// Stream 异步执行图，通过 channel 返回执行的进度，最后一个事件是 GraphRunEventRunFinished 或者 GraphRunEventRunWaiting。
+// 客户端断开之后执行还会继续，结果可以通过 GetRun 查询
+func (s *GraphRunService) Stream(ctx context.Context, req domain.GraphRunRequest) (<-chan domain.GraphRunEvent, error) {
+	plan, run, err := s.start(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan domain.GraphRunEvent, 10)
+	go func() {
+		defer close(ch)
+		runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), maxGraphRunDuration)
+		defer cancel()
+		s.execute(runCtx, plan, run, make(map[int64]NodeResult), func(event domain.GraphRunEvent) {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return ch, nil
+}
+
+// Start 在后台执行图，返回刚创建的执行记录，执行的结果通过 GetRun 查询
+func (s *GraphRunService) Start(ctx context.Context, req domain.GraphRunRequest) (domain.GraphRun, error) {
+	plan, run, err := s.start(ctx, req)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	res := run
+	res.Nodes = slices.Clone(run.Nodes)
+	go func() {
+		runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), maxGraphRunDuration)
+		defer cancel()
+		s.execute(runCtx, plan, run, make(map[int64]NodeResult), func(domain.GraphRunEvent) {})
+	}()
+	return res, nil
+}
+
+// start 检查图并且创建执行记录
+func (s *GraphRunService) start(ctx context.Context, req domain.GraphRunRequest) (graphPlan, domain.GraphRun, error) {
+	graph, err := s.load(ctx, req.GraphID, req.Version)
+	if err != nil {
+		return graphPlan{}, domain.GraphRun{}, err
+	}
+	plan, err := s.plan(graph)
+	if err != nil {
+		return graphPlan{}, domain.GraphRun{}, err
+	}
+	run := domain.GraphRun{
+		GraphID: req.GraphID,
+		Version: graph.Version,
+		Uid:     req.Uid,
+		Status:  domain.GraphRunStatusRunning,
+		Input:   req.Input,
+		Nodes:   make([]domain.NodeRun, 0, len(plan.order)),
+	}
+	for _, node := range plan.order {
+		run.Nodes = append(run.Nodes, domain.NodeRun{NodeID: node.ID, Status: domain.NodeRunStatusPending})
+	}
+	run.ID, err = s.runs.CreateRun(ctx, run)
+	if err != nil {
+		return graphPlan{}, domain.GraphRun{}, err
+	}
+	for i := range run.Nodes {
+		run.Nodes[i].RunID = run.ID
+	}
+	return plan, run, nil
+}
+
+// load 指定了版本的时候使用版本的快照，否则使用图当前的状态
+func (s *GraphRunService) load(ctx context.Context, graphID int64, version int64) (domain.Graph, error) {
+	if version <= 0 {
+		return s.graph.GetGraph(ctx, graphID)
+	}
+	v, err := s.graph.GetVersion(ctx, graphID, version)
+	return v.Graph, err
+}
+
+// graphPlan 排好序的节点和它们之间的边
+type graphPlan struct {
+	order    []domain.Node
+	keys     map[int64]string
+	incoming map[int64][]planEdge
+	outgoing map[int64][]planEdge
+}
+
+type planEdge struct {
+	source int64
+	target int64
+	branch string
+}
+
+// plan 检查节点和边，然后按照拓扑顺序排列节点，同一层的节点按照 ID 排序
+func (s *GraphRunService) plan(graph domain.Graph) (graphPlan, error) {
+	err := checkIssues(s.validator.Validate(graph), func(domain.GraphIssue) bool { return true })
+	if err != nil {
+		return graphPlan{}, err
+	}
+	plan := graphPlan{
+		keys:     make(map[int64]string, len(graph.Steps)),
+		incoming: make(map[int64][]planEdge, len(graph.Steps)),
+		outgoing: make(map[int64][]planEdge, len(graph.Steps)),
+	}
+	nodes := make(map[int64]domain.Node, len(graph.Steps))
+	for _, node := range graph.Steps {
+		plan.keys[node.ID] = nodeKey(node)
+		nodes[node.ID] = node
+	}
+	indegree := make(map[int64]int, len(nodes))
+	for _, edge := range graph.Edges {
+		// 边的配置已经检查过了
+		cfg, _ := domain.ParseEdgeConfig(edge)
+		if cfg.Branch == "" && nodes[edge.SourceID].Type == domain.NodeTypeApproval {
+			cfg.Branch = domain.ApprovalBranchApproved
+		}
+		e := planEdge{source: edge.SourceID, target: edge.TargetID, branch: cfg.Branch}
+		plan.incoming[e.target] = append(plan.incoming[e.target], e)
+		plan.outgoing[e.source] = append(plan.outgoing[e.source], e)
+		indegree[e.target]++
+	}
+	for id := range plan.incoming {
+		slices.SortFunc(plan.incoming[id], func(a, b planEdge) int {
+			return cmp.Compare(a.source, b.source)
+		})
+	}
+
+	var ready []int64
+	for id := range nodes {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for len(ready) > 0 {
+		slices.Sort(ready)
+		id := ready[0]
+		ready = ready[1:]
+		plan.order = append(plan.order, nodes[id])
+		for _, e := range plan.outgoing[id] {
+			indegree[e.target]--
+			if indegree[e.target] == 0 {
+				ready = append(ready, e.target)
+			}
+		}
+	}
+	if len(plan.order) != len(nodes) {
+		return graphPlan{}, fmt.Errorf("%w: 图里面有环", errs.ErrInvalidParam)
+	}
+	return plan, nil
+}
+
+// execute 依次执行节点，任何一个节点失败都会结束执行。
+// results 是已经执行成功的节点的结果，继续执行的时候这些节点不会再执行
+func (s *GraphRunService) execute(ctx context.Context, plan graphPlan, run domain.GraphRun,
+	results map[int64]NodeResult, emit func(domain.GraphRunEvent)) domain.GraphRun {
+	emit(s.event(domain.GraphRunEventRunStarted, run, domain.NodeRun{}))
+	outputs := s.outputs(plan, results)
+	for i, node := range plan.order {
+		if _, ok := results[node.ID]; ok {
+			continue
+		}
+		err := s.executeNode(ctx, plan, &run, i, results, outputs, emit)
+		if errors.Is(err, errNodeWaiting) {
+			run.Status = domain.GraphRunStatusWaiting
+			return s.finish(ctx, run, emit)
+		}
+		if err != nil {
+			run.Status = domain.GraphRunStatusFailed
+			run.Error = fmt.Sprintf("节点 %d 执行失败: %s", node.ID, err)
+			return s.finish(ctx, run, emit)
+		}
+	}
+	run.Status = domain.GraphRunStatusSucceeded
+	run.Output = s.runOutput(plan, results)
+	run.Error = ""
+	return s.finish(ctx, run, emit)
+}
+
+// executeNode 执行第 i 个节点，所有入边都没有被激活的节点会被跳过。执行成功的结果会放进 results 和 outputs
+func (s *GraphRunService) executeNode(ctx context.Context, plan graphPlan, run *domain.GraphRun, i int,
+	results map[int64]NodeResult, outputs map[string]any, emit func(domain.GraphRunEvent)) error {
+	node := plan.order[i]
+	nodeRun := &run.Nodes[i]
+	upstreams, active := s.upstreams(plan, node.ID, results)
+	if !active {
+		nodeRun.Status = domain.NodeRunStatusSkipped
+		s.saveNodeRun(ctx, *nodeRun)
+		emit(s.event(domain.GraphRunEventNodeFinished, *run, *nodeRun))
+		return nil
+	}
+	nc := NodeContext{Run: *run, Node: node, Upstreams: upstreams, Input: s.nodeInput(run.Input, upstreams)}
+	nc.Scope = map[string]any{"input": nc.Input, "run": run.Input, "nodes": outputs}
+	nodeRun.Input = nc.Input
+	nodeRun.Output = nil
+	nodeRun.Error = ""
+	nodeRun.Branch = ""
+	nodeRun.Attempts++
+	if node.Type == domain.NodeTypeApproval {
+		return s.waitApproval(ctx, node, run, nodeRun, emit)
+	}
+	nodeRun.Status = domain.NodeRunStatusRunning
+	s.saveNodeRun(ctx, *nodeRun)
+	emit(s.event(domain.GraphRunEventNodeStarted, *run, *nodeRun))
+
+	start := time.Now()
+	res, err := s.executors[node.Type].Execute(ctx, nc)
+	nodeRun.Latency = time.Since(start).Milliseconds()
+	nodeRun.Tokens += res.Usage.TotalTokens
+	s.bill(ctx, *run, *nodeRun, res.Usage)
+	if err != nil {
+		nodeRun.Status = domain.NodeRunStatusFailed
+		nodeRun.Error = err.Error()
+		s.saveNodeRun(ctx, *nodeRun)
+		emit(s.event(domain.GraphRunEventNodeFinished, *run, *nodeRun))
+		return err
+	}
+	nodeRun.Status = domain.NodeRunStatusSucceeded
+	nodeRun.Output = res.Output
+	nodeRun.Branch = res.Branch
+	results[node.ID] = res
+	outputs[plan.keys[node.ID]] = res.Output
+	s.saveNodeRun(ctx, *nodeRun)
+	emit(s.event(domain.GraphRunEventNodeFinished, *run, *nodeRun))
+	return nil
+}
+
+// outputs 模板里面通过 nodes.<key> 引用的节点输出
+func (s *GraphRunService) outputs(plan graphPlan, results map[int64]NodeResult) map[string]any {
+	res := make(map[string]any, len(plan.order))
+	for id, r := range results {
+		res[plan.keys[id]] = r.Output
+	}
+	return res
+}
+
+// upstreams 返回被执行的上游的输出。没有入边的节点总是会被执行，
+// 有入边的节点至少要有一条入边的上游执行成功，并且这条边在上游选中的分支上
+func (s *GraphRunService) upstreams(plan graphPlan, id int64, results map[int64]NodeResult) ([]NodeOutput, bool) {
+	incoming := plan.incoming[id]
+	if len(incoming) == 0 {
+		return nil, true
+	}
+	res := make([]NodeOutput, 0, len(incoming))
+	for _, e := range incoming {
+		up, ok := results[e.source]
+		if !ok || (e.branch != "" && e.branch != up.Branch) {
+			continue
+		}
+		res = append(res, NodeOutput{NodeID: e.source, Key: plan.keys[e.source], Output: up.Output})
+	}
+	return res, len(res) > 0
+}
+
+func (s *GraphRunService) nodeInput(runInput any, upstreams []NodeOutput) any {
+	switch len(upstreams) {
+	case 0:
+		return runInput
+	case 1:
+		return upstreams[0].Output
+	default:
+		res := make(map[string]any, len(upstreams))
+		for _, up := range upstreams {
+			res[up.Key] = up.Output
+		}
+		return res
+	}
+}
+
+// runOutput 没有出边并且执行成功的节点的输出
+func (s *GraphRunService) runOutput(plan graphPlan, results map[int64]NodeResult) any {
+	var sinks []int64
+	for _, node := range plan.order {
+		if _, ok := results[node.ID]; ok && len(plan.outgoing[node.ID]) == 0 {
+			sinks = append(sinks, node.ID)
+		}
+	}
+	switch len(sinks) {
+	case 0:
+		return nil
+	case 1:
+		return results[sinks[0]].Output
+	default:
+		res := make(map[string]any, len(sinks))
+		for _, id := range sinks {
+			res[plan.keys[id]] = results[id].Output
+		}
+		return res
+	}
+}
+
+// finish 保存执行的状态，等待审批的时候最后一个事件是 GraphRunEventRunWaiting
+func (s *GraphRunService) finish(ctx context.Context, run domain.GraphRun, emit func(domain.GraphRunEvent)) domain.GraphRun {
+	if err := s.runs.UpdateRun(context.WithoutCancel(ctx), run); err != nil {
+		elog.Error("保存执行结果失败", elog.Int64("run", run.ID), elog.FieldErr(err))
+	}
+	typ := domain.GraphRunEventRunFinished
+	if run.Status == domain.GraphRunStatusWaiting {
+		typ = domain.GraphRunEventRunWaiting
+	}
+	emit(s.event(typ, run, domain.NodeRun{}))
+	return run
+}
+
+// event 事件会被别的 goroutine 读取，所以复制一份节点的状态
+func (s *GraphRunService) event(typ domain.GraphRunEventType, run domain.GraphRun, node domain.NodeRun) domain.GraphRunEvent {
+	run.Nodes = slices.Clone(run.Nodes)
+	return domain.GraphRunEvent{Type: typ, Run: run, Node: node}
+}
+
+// saveNodeRun 状态保存失败不影响执行
+func (s *GraphRunService) saveNodeRun(ctx context.Context, node domain.NodeRun) {
+	if err := s.runs.SaveNodeRun(context.WithoutCancel(ctx), node); err != nil {
+		elog.Error("保存节点状态失败", elog.Int64("run", node.RunID), elog.Int64("node", node.NodeID), elog.FieldErr(err))
+	}
+}
+
+// bill 大模型节点按照消耗的 token 计费，key 保证同一个节点的同一次尝试不会被重复扣费
+func (s *GraphRunService) bill(ctx context.Context, run domain.GraphRun, node domain.NodeRun, usage domain.Usage) {
+	if s.quota == nil || run.Uid == 0 || usage.TotalTokens == 0 {
+		return
+	}
+	key := fmt.Sprintf("graph:run:%d:node:%d", run.ID, node.NodeID)
+	if node.Attempts > 1 {
+		key = fmt.Sprintf("%s:attempt:%d", key, node.Attempts)
+	}
+	if err := s.quota.Deduct(context.WithoutCancel(ctx), run.Uid, usage.TotalTokens, key); err != nil {
+		elog.Error("节点计费失败", elog.Int64("run", run.ID), elog.Int64("node", node.NodeID),
+			elog.Int64("tokens", usage.TotalTokens), elog.FieldErr(err))
+	}
+}
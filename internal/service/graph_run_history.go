@@ -0,0 +1,144 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+const (
+	defaultGraphRunLimit = 20
+	maxGraphRunLimit     = 100
+)
+
+func (s *GraphRunService) ListRuns(ctx context.Context, q domain.GraphRunQuery) ([]domain.GraphRun, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultGraphRunLimit
+	}
+	q.Limit = min(q.Limit, maxGraphRunLimit)
+	return s.runs.ListRuns(ctx, q)
+}
+
+// GetRun 只能查看自己发起的执行
+func (s *GraphRunService) GetRun(ctx context.Context, id int64, uid int64) (domain.GraphRun, error) {
+	run, err := s.runs.GetRun(ctx, id)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	if run.Uid != uid {
+		return domain.GraphRun{}, fmt.Errorf("%w: 执行记录 %d 不属于用户 %d", errs.ErrPermissionDenied, id, uid)
+	}
+	return run, nil
+}
+
+// RetryNode 单独重试一个失败的节点，上游的输出使用这次执行里面记录的输出。
+// 重试成功之后执行变成 GraphRunStatusPaused，下游的节点需要调用 Resume 继续执行
+func (s *GraphRunService) RetryNode(ctx context.Context, id int64, uid int64, nodeID int64) (domain.GraphRun, error) {
+	run, err := s.GetRun(ctx, id, uid)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	plan, run, results, err := s.restore(ctx, run)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	idx := slices.IndexFunc(plan.order, func(node domain.Node) bool {
+		return node.ID == nodeID
+	})
+	if idx < 0 || run.Nodes[idx].Status != domain.NodeRunStatusFailed {
+		return domain.GraphRun{}, fmt.Errorf("%w: 节点 %d 没有执行失败", errs.ErrInvalidParam, nodeID)
+	}
+	if err = s.restart(ctx, &run, domain.GraphRunStatusFailed); err != nil {
+		return domain.GraphRun{}, err
+	}
+	noop := func(domain.GraphRunEvent) {}
+	err = s.executeNode(ctx, plan, &run, idx, results, s.outputs(plan, results), noop)
+	if err != nil {
+		run.Status = domain.GraphRunStatusFailed
+		run.Error = fmt.Sprintf("节点 %d 执行失败: %s", nodeID, err)
+	} else {
+		run.Status = domain.GraphRunStatusPaused
+		run.Error = ""
+	}
+	return s.finish(ctx, run, noop), nil
+}
+
+// Resume 从失败或者暂停的地方继续执行。已经执行成功的节点直接使用记录的输出，不会再执行，也不会再计费
+func (s *GraphRunService) Resume(ctx context.Context, id int64, uid int64) (domain.GraphRun, error) {
+	run, err := s.GetRun(ctx, id, uid)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	plan, run, results, err := s.restore(ctx, run)
+	if err != nil {
+		return domain.GraphRun{}, err
+	}
+	if err = s.restart(ctx, &run, domain.GraphRunStatusFailed, domain.GraphRunStatusPaused); err != nil {
+		return domain.GraphRun{}, err
+	}
+	return s.execute(ctx, plan, run, results, func(domain.GraphRunEvent) {}), nil
+}
+
+// restore 重新加载执行时使用的图，把节点的状态按照执行的顺序排列，返回执行成功的节点的结果。
+// 执行的是图当前的状态的时候，加载的是执行时记录的版本，所以之后单独修改的节点或者边不会生效
+func (s *GraphRunService) restore(ctx context.Context, run domain.GraphRun) (graphPlan, domain.GraphRun, map[int64]NodeResult, error) {
+	graph, err := s.load(ctx, run.GraphID, run.Version)
+	if err != nil {
+		return graphPlan{}, domain.GraphRun{}, nil, err
+	}
+	plan, err := s.plan(graph)
+	if err != nil {
+		return graphPlan{}, domain.GraphRun{}, nil, err
+	}
+	nodes := make(map[int64]domain.NodeRun, len(run.Nodes))
+	for _, node := range run.Nodes {
+		nodes[node.NodeID] = node
+	}
+	if len(nodes) != len(plan.order) {
+		return graphPlan{}, domain.GraphRun{}, nil, fmt.Errorf("%w: 图已经被修改，执行 %d 不能继续", errs.ErrInvalidParam, run.ID)
+	}
+	run.Nodes = make([]domain.NodeRun, 0, len(plan.order))
+	results := make(map[int64]NodeResult, len(plan.order))
+	for _, node := range plan.order {
+		nodeRun, ok := nodes[node.ID]
+		if !ok {
+			return graphPlan{}, domain.GraphRun{}, nil, fmt.Errorf("%w: 图已经被修改，执行 %d 不能继续", errs.ErrInvalidParam, run.ID)
+		}
+		if nodeRun.Status == domain.NodeRunStatusSucceeded {
+			results[node.ID] = NodeResult{Output: nodeRun.Output, Branch: nodeRun.Branch}
+		}
+		run.Nodes = append(run.Nodes, nodeRun)
+	}
+	return plan, run, results, nil
+}
+
+// restart 通过数据库的状态保证同一个执行同时只会被继续一次
+func (s *GraphRunService) restart(ctx context.Context, run *domain.GraphRun, from ...domain.GraphRunStatus) error {
+	ok, err := s.runs.Restart(ctx, run.ID, from...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: 执行 %d 的状态是 %s，不能继续", errs.ErrInvalidParam, run.ID, run.Status)
+	}
+	run.Status = domain.GraphRunStatusRunning
+	run.Error = ""
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphRunService_plan(t *testing.T) {
+	node := func(id int64, typ string) domain.Node {
+		if typ == domain.NodeTypeTemplate {
+			return domain.Node{ID: id, Type: typ, Metadata: ekit.AnyValue{Val: `{"template": "{{input}}"}`}}
+		}
+		return domain.Node{ID: id, Type: typ}
+	}
+	edge := func(id, source, target int64) domain.Edge {
+		return domain.Edge{ID: id, SourceID: source, TargetID: target}
+	}
+	testCases := []struct {
+		name      string
+		graph     domain.Graph
+		wantOrder []int64
+		wantErr   error
+	}{
+		{
+			name: "拓扑排序",
+			graph: domain.Graph{
+				Steps: []domain.Node{node(4, "merge"), node(3, "template"), node(2, "template"), node(1, "condition")},
+				Edges: []domain.Edge{edge(1, 1, 3), edge(2, 1, 2), edge(3, 2, 4), edge(4, 3, 4)},
+			},
+			wantOrder: []int64{1, 2, 3, 4},
+		},
+		{
+			name: "多个起点",
+			graph: domain.Graph{
+				Steps: []domain.Node{node(3, "merge"), node(2, "template"), node(1, "template")},
+				Edges: []domain.Edge{edge(1, 2, 3), edge(2, 1, 3)},
+			},
+			wantOrder: []int64{1, 2, 3},
+		},
+		{
+			name: "有环",
+			graph: domain.Graph{
+				Steps: []domain.Node{node(1, "template"), node(2, "template"), node(3, "template")},
+				Edges: []domain.Edge{edge(1, 1, 2), edge(2, 2, 3), edge(3, 3, 2)},
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name: "边连接的节点不存在",
+			graph: domain.Graph{
+				Steps: []domain.Node{node(1, "template")},
+				Edges: []domain.Edge{edge(1, 1, 2)},
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "不支持的类型",
+			graph:   domain.Graph{Steps: []domain.Node{node(1, "shell")}},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "配置不合法",
+			graph:   domain.Graph{Steps: []domain.Node{{ID: 1, Type: "template", Metadata: ekit.AnyValue{Val: "{"}}}},
+			wantErr: errs.ErrInvalidParam,
+		},
+	}
+	svc := NewGraphRunService(nil, nil, NewGraphValidator(), nil, nil, nil, nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := svc.plan(tc.graph)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantOrder, slice.Map(plan.order, func(idx int, src domain.Node) int64 {
+				return src.ID
+			}))
+		})
+	}
+}
+
+func TestGraphRunService_upstreams(t *testing.T) {
+	svc := NewGraphRunService(nil, nil, NewGraphValidator(), nil, nil, nil, nil)
+	plan, err := svc.plan(domain.Graph{
+		Steps: []domain.Node{
+			{ID: 1, Type: "condition", Metadata: ekit.AnyValue{Val: `{"cases": [{"path": "input", "op": "eq", "value": "in", "branch": "high"}], "default": "low"}`}},
+			{ID: 2, Type: "template", Metadata: ekit.AnyValue{Val: `{"key": "high", "template": "{{input}}"}`}},
+			{ID: 3, Type: "template", Metadata: ekit.AnyValue{Val: `{"template": "{{input}}"}`}},
+			{ID: 4, Type: "merge"},
+		},
+		Edges: []domain.Edge{
+			{ID: 1, SourceID: 1, TargetID: 2, Metadata: ekit.AnyValue{Val: `{"branch": "high"}`}},
+			{ID: 2, SourceID: 1, TargetID: 3, Metadata: ekit.AnyValue{Val: `{"branch": "low"}`}},
+			{ID: 3, SourceID: 2, TargetID: 4},
+			{ID: 4, SourceID: 3, TargetID: 4},
+		},
+	})
+	require.NoError(t, err)
+	results := map[int64]NodeResult{1: {Output: "in", Branch: "high"}}
+
+	ups, active := svc.upstreams(plan, 2, results)
+	assert.True(t, active)
+	assert.Equal(t, []NodeOutput{{NodeID: 1, Key: "node_1", Output: "in"}}, ups)
+	_, active = svc.upstreams(plan, 3, results)
+	assert.False(t, active)
+
+	// 节点 3 被跳过了，合并节点只拿到节点 2 的输出
+	results[2] = NodeResult{Output: "high answer"}
+	ups, active = svc.upstreams(plan, 4, results)
+	assert.True(t, active)
+	assert.Equal(t, []NodeOutput{{NodeID: 2, Key: "high", Output: "high answer"}}, ups)
+	assert.Equal(t, "high answer", svc.nodeInput("in", ups))
+	// 只有没有出边的节点的输出才是执行的输出
+	results[4] = NodeResult{Output: "merged"}
+	assert.Equal(t, "merged", svc.runOutput(plan, results))
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+// graphTemplates 内置的模板，大模型节点的 prompt_id 和 HTTP 节点的地址需要在创建的时候覆盖
+var graphTemplates = []domain.GraphTemplate{
+	{
+		Name:  "classify-then-route",
+		Title: "分类之后分流",
+		Description: "先用大模型给问题分类，然后按照分类交给不同的大模型回答，无法分类的问题转人工。" +
+			"输入 {\"question\": \"...\"}，需要覆盖 classify、billing、technical 的 prompt_id",
+		Document: []byte(`{
+  "format": "ai-gateway/graph@v1",
+  "nodes": [
+    {"ref": "classify", "type": "llm", "metadata": {"key": "classify", "prompt_id": 0}},
+    {"ref": "prepare", "type": "transform", "metadata": {"key": "prepare", "fields": {"question": "run.question", "category": "input"}}},
+    {"ref": "route", "type": "condition", "metadata": {"key": "route", "cases": [
+      {"path": "input.category", "op": "contains", "value": "billing", "branch": "billing"},
+      {"path": "input.category", "op": "contains", "value": "technical", "branch": "technical"}
+    ], "default": "other"}},
+    {"ref": "billing", "type": "llm", "metadata": {"key": "billing", "prompt_id": 0}},
+    {"ref": "technical", "type": "llm", "metadata": {"key": "technical", "prompt_id": 0}},
+    {"ref": "other", "type": "template", "metadata": {"key": "other", "template": "你的问题已经转给人工客服: {{input.question}}"}},
+    {"ref": "answer", "type": "merge", "metadata": {"key": "answer", "mode": "first"}}
+  ],
+  "edges": [
+    {"source": "classify", "target": "prepare"},
+    {"source": "prepare", "target": "route"},
+    {"source": "route", "target": "billing", "metadata": {"branch": "billing"}},
+    {"source": "route", "target": "technical", "metadata": {"branch": "technical"}},
+    {"source": "route", "target": "other", "metadata": {"branch": "other"}},
+    {"source": "billing", "target": "answer"},
+    {"source": "technical", "target": "answer"},
+    {"source": "other", "target": "answer"}
+  ]
+}`),
+	},
+	{
+		Name:  "rag-answer",
+		Title: "检索增强回答",
+		Description: "调用检索服务查找相关的文档，然后让大模型根据文档回答问题。" +
+			"输入 {\"question\": \"...\"}，需要覆盖 retrieve 的 url 和 answer 的 prompt_id，prompt 里面可以使用 question 和 documents 变量",
+		Document: []byte(`{
+  "format": "ai-gateway/graph@v1",
+  "nodes": [
+    {"ref": "retrieve", "type": "http", "metadata": {"key": "retrieve", "method": "POST", "url": "http://localhost/search",
+      "headers": {"Content-Type": "application/json"}, "body": "{\"query\": \"{{input.question}}\"}"}},
+    {"ref": "context", "type": "transform", "metadata": {"key": "context", "fields": {"question": "run.question", "documents": "input"}}},
+    {"ref": "answer", "type": "llm", "metadata": {"key": "answer", "prompt_id": 0}}
+  ],
+  "edges": [
+    {"source": "retrieve", "target": "context"},
+    {"source": "context", "target": "answer"}
+  ]
+}`),
+	},
+	{
+		Name:  "summarize-and-translate",
+		Title: "总结之后翻译",
+		Description: "先总结文本，再把总结翻译成指定的语言。" +
+			"输入 {\"text\": \"...\", \"language\": \"English\"}，需要覆盖 summarize 和 translate 的 prompt_id，翻译的 prompt 里面可以使用 summary 和 language 变量",
+		Document: []byte(`{
+  "format": "ai-gateway/graph@v1",
+  "nodes": [
+    {"ref": "summarize", "type": "llm", "metadata": {"key": "summarize", "prompt_id": 0}},
+    {"ref": "prepare", "type": "transform", "metadata": {"key": "prepare", "fields": {"summary": "input", "language": "run.language"}}},
+    {"ref": "translate", "type": "llm", "metadata": {"key": "translate", "prompt_id": 0}}
+  ],
+  "edges": [
+    {"source": "summarize", "target": "prepare"},
+    {"source": "prepare", "target": "translate"}
+  ]
+}`),
+	},
+}
+
+// ListTemplates 内置的图模板
+func (svc *NodeService) ListTemplates() []domain.GraphTemplate {
+	return graphTemplates
+}
+
+// Instantiate 用模板创建一个新的图，overrides 按照节点的 ref 覆盖节点配置里面的字段，比如 {"classify": {"prompt_id": 1}}
+func (svc *NodeService) Instantiate(ctx context.Context, name string, overrides map[string]map[string]any) (domain.Graph, error) {
+	idx := slices.IndexFunc(graphTemplates, func(tpl domain.GraphTemplate) bool {
+		return tpl.Name == name
+	})
+	if idx < 0 {
+		return domain.Graph{}, fmt.Errorf("%w: 模板 %q 不存在", errs.ErrInvalidParam, name)
+	}
+	return svc.importDocument(ctx, graphTemplates[idx].Document, overrides)
+}
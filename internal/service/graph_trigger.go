@@ -0,0 +1,279 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	scheduleBatch = 100
+	// webhook 的时间戳和服务器时间最多相差多少，超过的请求认为是重放
+	webhookTolerance = 5 * time.Minute
+)
+
+// GraphTriggerService 管理图的触发器，定时、webhook 或者手动触发之后在后台执行图，并且记录触发的历史
+type GraphTriggerService struct {
+	repo *repository.GraphTriggerRepo
+	runs *GraphRunService
+}
+
+func NewGraphTriggerService(repo *repository.GraphTriggerRepo, runs *GraphRunService) *GraphTriggerService {
+	return &GraphTriggerService{repo: repo, runs: runs}
+}
+
+// SaveTrigger ID 为 0 的时候创建触发器，否则修改自己的触发器。图和类型创建之后不能修改
+func (s *GraphTriggerService) SaveTrigger(ctx context.Context, trigger domain.GraphTrigger) (domain.GraphTrigger, error) {
+	if trigger.ID > 0 {
+		old, err := s.GetTrigger(ctx, trigger.ID, trigger.Uid)
+		if err != nil {
+			return domain.GraphTrigger{}, err
+		}
+		trigger.GraphID = old.GraphID
+		trigger.Type = old.Type
+		if trigger.Secret == "" {
+			trigger.Secret = old.Secret
+		}
+	} else if _, err := s.runs.load(ctx, trigger.GraphID, 0); err != nil {
+		return domain.GraphTrigger{}, err
+	}
+	trigger.NextTime = 0
+	switch trigger.Type {
+	case domain.GraphTriggerCron:
+		schedule, err := cron.ParseStandard(trigger.Cron)
+		if err != nil {
+			return domain.GraphTrigger{}, fmt.Errorf("%w: cron 表达式 %q 不合法: %s", errs.ErrInvalidParam, trigger.Cron, err)
+		}
+		if trigger.Enabled {
+			trigger.NextTime = schedule.Next(time.Now()).UnixMilli()
+		}
+		trigger.Secret = ""
+	case domain.GraphTriggerWebhook:
+		if trigger.Secret == "" {
+			secret, err := s.secret()
+			if err != nil {
+				return domain.GraphTrigger{}, err
+			}
+			trigger.Secret = secret
+		}
+		trigger.Cron = ""
+	case domain.GraphTriggerManual:
+		trigger.Cron = ""
+		trigger.Secret = ""
+	default:
+		return domain.GraphTrigger{}, fmt.Errorf("%w: 不支持的触发器类型 %q", errs.ErrInvalidParam, trigger.Type)
+	}
+	id, err := s.repo.SaveTrigger(ctx, trigger)
+	if err != nil {
+		return domain.GraphTrigger{}, err
+	}
+	return s.repo.GetTrigger(ctx, id)
+}
+
+func (s *GraphTriggerService) secret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// GetTrigger 只能查看自己创建的触发器
+func (s *GraphTriggerService) GetTrigger(ctx context.Context, id int64, uid int64) (domain.GraphTrigger, error) {
+	trigger, err := s.repo.GetTrigger(ctx, id)
+	if err != nil {
+		return domain.GraphTrigger{}, err
+	}
+	if trigger.Uid != uid {
+		return domain.GraphTrigger{}, fmt.Errorf("%w: 触发器 %d 不属于用户 %d", errs.ErrPermissionDenied, id, uid)
+	}
+	return trigger, nil
+}
+
+// ListTriggers 图上面用户自己创建的触发器
+func (s *GraphTriggerService) ListTriggers(ctx context.Context, graphID int64, uid int64) ([]domain.GraphTrigger, error) {
+	triggers, err := s.repo.ListTriggers(ctx, graphID)
+	if err != nil {
+		return nil, err
+	}
+	return slice.FilterMap(triggers, func(idx int, src domain.GraphTrigger) (domain.GraphTrigger, bool) {
+		return src, src.Uid == uid
+	}), nil
+}
+
+func (s *GraphTriggerService) DeleteTrigger(ctx context.Context, id int64, uid int64) error {
+	if _, err := s.GetTrigger(ctx, id, uid); err != nil {
+		return err
+	}
+	return s.repo.DeleteTrigger(ctx, id)
+}
+
+func (s *GraphTriggerService) ListRecords(ctx context.Context, q domain.GraphTriggerQuery) ([]domain.GraphTriggerRecord, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultGraphRunLimit
+	}
+	q.Limit = min(q.Limit, maxGraphRunLimit)
+	return s.repo.ListRecords(ctx, q)
+}
+
+// Fire 手动触发，payload 是图的输入
+func (s *GraphTriggerService) Fire(ctx context.Context, id int64, uid int64, payload any) (domain.GraphTriggerRecord, error) {
+	trigger, err := s.GetTrigger(ctx, id, uid)
+	if err != nil {
+		return domain.GraphTriggerRecord{}, err
+	}
+	if trigger.Type != domain.GraphTriggerManual || !trigger.Enabled {
+		return domain.GraphTriggerRecord{}, fmt.Errorf("%w: 触发器 %d 不能手动触发", errs.ErrInvalidParam, id)
+	}
+	return s.fire(ctx, trigger, payload, time.Now().UnixMilli())
+}
+
+// Webhook 外部系统触发，timestamp 是发送请求时的 Unix 时间戳，单位是秒，
+// signature 是用触发器的密钥对 timestamp + "." + body 计算的 HMAC-SHA256，十六进制编码。
+// body 是 JSON 格式的图的输入，可以为空
+func (s *GraphTriggerService) Webhook(ctx context.Context, id int64, body []byte, timestamp string, signature string) (domain.GraphTriggerRecord, error) {
+	trigger, err := s.repo.GetTrigger(ctx, id)
+	if err != nil {
+		return domain.GraphTriggerRecord{}, err
+	}
+	if trigger.Type != domain.GraphTriggerWebhook || !trigger.Enabled {
+		return domain.GraphTriggerRecord{}, fmt.Errorf("%w: %d", errs.ErrGraphTriggerNotFound, id)
+	}
+	if err = s.verify(trigger.Secret, timestamp, body, signature, time.Now()); err != nil {
+		return domain.GraphTriggerRecord{}, err
+	}
+	var payload any
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &payload); err != nil {
+			return domain.GraphTriggerRecord{}, fmt.Errorf("%w: 请求体不是合法的 JSON", errs.ErrInvalidParam)
+		}
+	}
+	return s.fire(ctx, trigger, payload, time.Now().UnixMilli())
+}
+
+// verify 时间戳和 now 相差超过 webhookTolerance 的请求直接拒绝，避免签名被截获之后重放。
+// 兼容带 sha256= 前缀的签名
+func (s *GraphTriggerService) verify(secret string, timestamp string, body []byte, signature string, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: 时间戳不合法", errs.ErrPermissionDenied)
+	}
+	if diff := now.Sub(time.Unix(ts, 0)); diff > webhookTolerance || diff < -webhookTolerance {
+		return fmt.Errorf("%w: 请求已经过期", errs.ErrPermissionDenied)
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return fmt.Errorf("%w: 签名不正确", errs.ErrPermissionDenied)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("%w: 签名不正确", errs.ErrPermissionDenied)
+	}
+	return nil
+}
+
+// Schedule 执行所有到期的定时触发器，返回触发的数量。
+// 每个实例都可以调用，先把 next_time 改成下一次的时间，改成功的实例负责这一次执行，所以同一次只会执行一次。
+// 停机期间错过的多次执行只会补一次
+func (s *GraphTriggerService) Schedule(ctx context.Context) (int, error) {
+	now := time.Now()
+	triggers, err := s.repo.ListDueTriggers(ctx, now.UnixMilli(), scheduleBatch)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, trigger := range triggers {
+		// 保存的时候检查过了，这里出错说明数据被直接修改过，不再调度
+		var next int64
+		schedule, err1 := cron.ParseStandard(trigger.Cron)
+		if err1 == nil {
+			next = schedule.Next(now).UnixMilli()
+		}
+		ok, err1 := s.repo.Claim(ctx, trigger.ID, trigger.NextTime, next)
+		if err1 != nil {
+			elog.Error("抢占定时触发器失败", elog.Int64("trigger", trigger.ID), elog.FieldErr(err1))
+			continue
+		}
+		if !ok || next == 0 {
+			continue
+		}
+		payload := map[string]any{"trigger_id": trigger.ID, "fire_time": trigger.NextTime}
+		_, err1 = s.fire(ctx, trigger, payload, trigger.NextTime)
+		if err1 != nil {
+			elog.Warn("定时触发执行图失败", elog.Int64("trigger", trigger.ID), elog.FieldErr(err1))
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+// RunScheduler 定时调用 Schedule，直到 ctx 被取消
+func (s *GraphTriggerService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Schedule(ctx); err != nil {
+				elog.Error("调度定时触发器失败", elog.FieldErr(err))
+			}
+		}
+	}
+}
+
+// fire 在后台执行图并且记录触发的历史，图没能开始执行的时候也会记录
+func (s *GraphTriggerService) fire(ctx context.Context, trigger domain.GraphTrigger, payload any, fireTime int64) (domain.GraphTriggerRecord, error) {
+	record := domain.GraphTriggerRecord{
+		TriggerID: trigger.ID,
+		GraphID:   trigger.GraphID,
+		Uid:       trigger.Uid,
+		Type:      trigger.Type,
+		Payload:   payload,
+		Status:    domain.GraphTriggerRecordStarted,
+		FireTime:  fireTime,
+	}
+	run, err := s.runs.Start(ctx, domain.GraphRunRequest{GraphID: trigger.GraphID, Uid: trigger.Uid, Input: payload})
+	if err != nil {
+		record.Status = domain.GraphTriggerRecordFailed
+		record.Error = err.Error()
+	}
+	record.RunID = run.ID
+	var err1 error
+	record.ID, err1 = s.repo.CreateRecord(context.WithoutCancel(ctx), record)
+	if err1 != nil {
+		elog.Error("保存触发记录失败", elog.Int64("trigger", trigger.ID), elog.Int64("run", run.ID), elog.FieldErr(err1))
+	}
+	return record, err
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphTriggerService_verify(t *testing.T) {
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"order_id": 1}`)
+	sign := func(timestamp string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	signature := sign(timestamp, body)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	future := strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10)
+	testCases := []struct {
+		name      string
+		timestamp string
+		body      []byte
+		signature string
+		wantErr   error
+	}{
+		{name: "签名正确", timestamp: timestamp, body: body, signature: signature},
+		{name: "带 sha256= 前缀", timestamp: timestamp, body: body, signature: "sha256=" + signature},
+		{name: "请求体被修改", timestamp: timestamp, body: []byte(`{"order_id": 2}`), signature: signature, wantErr: errs.ErrPermissionDenied},
+		{name: "时间戳被修改", timestamp: strconv.FormatInt(now.Unix()-1, 10), body: body, signature: signature, wantErr: errs.ErrPermissionDenied},
+		{name: "只对请求体签名", timestamp: timestamp, body: body, signature: func() string {
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write(body)
+			return hex.EncodeToString(mac.Sum(nil))
+		}(), wantErr: errs.ErrPermissionDenied},
+		{name: "没有签名", timestamp: timestamp, body: body, wantErr: errs.ErrPermissionDenied},
+		{name: "签名不是十六进制", timestamp: timestamp, body: body, signature: "not-hex", wantErr: errs.ErrPermissionDenied},
+		{name: "没有时间戳", body: body, signature: signature, wantErr: errs.ErrPermissionDenied},
+		{name: "过期的请求", timestamp: stale, body: body, signature: sign(stale, body), wantErr: errs.ErrPermissionDenied},
+		{name: "时间戳在未来", timestamp: future, body: body, signature: sign(future, body), wantErr: errs.ErrPermissionDenied},
+	}
+	svc := NewGraphTriggerService(nil, nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := svc.verify("secret", tc.timestamp, tc.body, tc.signature, now)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+// NodeSchema 检查某种类型的节点的配置
+type NodeSchema func(node domain.Node) error
+
+// GraphValidator 检查图的结构以及节点的配置，不会访问数据库
+type GraphValidator struct {
+	schemas map[string]NodeSchema
+}
+
+func NewGraphValidator() *GraphValidator {
+	return &GraphValidator{
+		schemas: map[string]NodeSchema{
+			domain.NodeTypeLLM:       llmSchema,
+			domain.NodeTypeTemplate:  templateSchema,
+			domain.NodeTypeHTTP:      httpSchema,
+			domain.NodeTypeCondition: conditionSchema,
+			domain.NodeTypeMerge:     mergeSchema,
+			domain.NodeTypeTransform: transformSchema,
+			domain.NodeTypeApproval:  approvalSchema,
+		},
+	}
+}
+
+// Register 注册或者替换某种类型的节点的 schema，schema 为 nil 的时候只检查配置是不是合法的 JSON
+func (v *GraphValidator) Register(typ string, schema NodeSchema) {
+	v.schemas[typ] = schema
+}
+
+// ValidateNode 只检查节点自己的类型和配置
+func (v *GraphValidator) ValidateNode(node domain.Node) []domain.GraphIssue {
+	schema, ok := v.schemas[node.Type]
+	if !ok {
+		return []domain.GraphIssue{nodeIssue(domain.GraphIssueUnknownType, node.ID,
+			fmt.Sprintf("节点 %d 的类型 %q 不支持", node.ID, node.Type))}
+	}
+	var cfg domain.NodeConfig
+	err := domain.ParseNodeConfig(node, &cfg)
+	if err == nil && schema != nil {
+		err = schema(node)
+	}
+	if err != nil {
+		return []domain.GraphIssue{nodeIssue(domain.GraphIssueInvalidMetadata, node.ID,
+			fmt.Sprintf("节点 %d 的配置不合法: %s", node.ID, err))}
+	}
+	return nil
+}
+
+// Validate 检查整个图。foreign 是边引用了、但是不在图里面的节点，用来区分跨图的边和悬空的边
+func (v *GraphValidator) Validate(graph domain.Graph, foreign ...domain.Node) []domain.GraphIssue {
+	var issues []domain.GraphIssue
+	nodes := make(map[int64]domain.Node, len(graph.Steps))
+	keys := make(map[string]int64, len(graph.Steps))
+	for _, node := range graph.Steps {
+		nodes[node.ID] = node
+		nodeIssues := v.ValidateNode(node)
+		issues = append(issues, nodeIssues...)
+		if len(nodeIssues) > 0 {
+			continue
+		}
+		key := nodeKey(node)
+		if other, ok := keys[key]; ok {
+			issues = append(issues, nodeIssue(domain.GraphIssueDuplicateKey, node.ID,
+				fmt.Sprintf("节点 %d 和节点 %d 的 key 都是 %q", node.ID, other, key)))
+			continue
+		}
+		keys[key] = node.ID
+	}
+	others := make(map[int64]domain.Node, len(foreign))
+	for _, node := range foreign {
+		others[node.ID] = node
+	}
+
+	// valid 是两端都在图里面的边，只有它们参与环的检查
+	valid := make([]domain.Edge, 0, len(graph.Edges))
+	linked := make(map[int64]bool, len(nodes))
+	for _, edge := range graph.Edges {
+		if edge.GraphID != 0 && edge.GraphID != graph.ID {
+			issues = append(issues, edgeIssue(domain.GraphIssueCrossGraphEdge, edge.ID,
+				fmt.Sprintf("边 %d 属于图 %d", edge.ID, edge.GraphID)))
+			continue
+		}
+		ok := true
+		for _, id := range []int64{edge.SourceID, edge.TargetID} {
+			if _, inGraph := nodes[id]; inGraph {
+				linked[id] = true
+				continue
+			}
+			ok = false
+			if other, exist := others[id]; exist {
+				issues = append(issues, edgeIssue(domain.GraphIssueCrossGraphEdge, edge.ID,
+					fmt.Sprintf("边 %d 连接了图 %d 的节点 %d", edge.ID, other.GraphID, id)))
+			} else {
+				issues = append(issues, edgeIssue(domain.GraphIssueDanglingEdge, edge.ID,
+					fmt.Sprintf("边 %d 连接的节点 %d 不存在", edge.ID, id)))
+			}
+		}
+		if !ok {
+			continue
+		}
+		if issue, bad := v.validateBranch(edge, nodes[edge.SourceID]); bad {
+			issues = append(issues, issue)
+		}
+		valid = append(valid, edge)
+	}
+	issues = append(issues, v.cycles(nodes, valid)...)
+	if len(nodes) > 1 {
+		for _, node := range graph.Steps {
+			if !linked[node.ID] {
+				issues = append(issues, domain.GraphIssue{
+					Level:   domain.GraphIssueLevelWarning,
+					Code:    domain.GraphIssueOrphanedNode,
+					NodeID:  node.ID,
+					Message: fmt.Sprintf("节点 %d 没有连接任何节点", node.ID),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// validateBranch 只有条件节点和审批节点的出边可以声明分支，并且分支必须是节点会选中的分支
+func (v *GraphValidator) validateBranch(edge domain.Edge, source domain.Node) (domain.GraphIssue, bool) {
+	cfg, err := domain.ParseEdgeConfig(edge)
+	if err != nil {
+		return edgeIssue(domain.GraphIssueInvalidMetadata, edge.ID,
+			fmt.Sprintf("边 %d 的配置不合法: %s", edge.ID, err)), true
+	}
+	if cfg.Branch == "" {
+		return domain.GraphIssue{}, false
+	}
+	switch source.Type {
+	case domain.NodeTypeCondition:
+		var cond domain.ConditionNodeConfig
+		// 节点的配置已经检查过了，这里不会出错
+		_ = domain.ParseNodeConfig(source, &cond)
+		if cond.Default == cfg.Branch || slices.ContainsFunc(cond.Cases, func(c domain.ConditionCase) bool {
+			return c.Branch == cfg.Branch
+		}) {
+			return domain.GraphIssue{}, false
+		}
+		return edgeIssue(domain.GraphIssueInvalidBranch, edge.ID,
+			fmt.Sprintf("条件节点 %d 没有分支 %q", source.ID, cfg.Branch)), true
+	case domain.NodeTypeApproval:
+		if cfg.Branch == domain.ApprovalBranchApproved || cfg.Branch == domain.ApprovalBranchRejected {
+			return domain.GraphIssue{}, false
+		}
+		return edgeIssue(domain.GraphIssueInvalidBranch, edge.ID,
+			fmt.Sprintf("审批节点 %d 只有 approved 和 rejected 两个分支，没有 %q", source.ID, cfg.Branch)), true
+	default:
+		return edgeIssue(domain.GraphIssueInvalidBranch, edge.ID,
+			fmt.Sprintf("边 %d 声明了分支 %q，但是节点 %d 不是条件节点或者审批节点", edge.ID, cfg.Branch, source.ID)), true
+	}
+}
+
+// cycles 拓扑排序之后剩下的节点都在环上或者在环的下游，每一个环只报告一次
+func (v *GraphValidator) cycles(nodes map[int64]domain.Node, edges []domain.Edge) []domain.GraphIssue {
+	indegree := make(map[int64]int, len(nodes))
+	incoming := make(map[int64][]int64, len(nodes))
+	outgoing := make(map[int64][]int64, len(nodes))
+	for _, edge := range edges {
+		incoming[edge.TargetID] = append(incoming[edge.TargetID], edge.SourceID)
+		outgoing[edge.SourceID] = append(outgoing[edge.SourceID], edge.TargetID)
+		indegree[edge.TargetID]++
+	}
+	var ready []int64
+	for id := range nodes {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	sorted := make(map[int64]bool, len(nodes))
+	for len(ready) > 0 {
+		id := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		sorted[id] = true
+		for _, target := range outgoing[id] {
+			indegree[target]--
+			if indegree[target] == 0 {
+				ready = append(ready, target)
+			}
+		}
+	}
+	if len(sorted) == len(nodes) {
+		return nil
+	}
+	remain := make([]int64, 0, len(nodes)-len(sorted))
+	for id := range nodes {
+		if !sorted[id] {
+			remain = append(remain, id)
+		}
+	}
+	slices.Sort(remain)
+	// 剩下的节点至少有一条来自剩下的节点的入边，沿着入边往回走，一定会回到走过的节点
+	var issues []domain.GraphIssue
+	reported := make(map[int64]bool, len(remain))
+	for _, start := range remain {
+		var path []int64
+		visited := make(map[int64]int)
+		cur := start
+		for !reported[cur] {
+			if idx, ok := visited[cur]; ok {
+				cycle := slices.Clone(path[idx:])
+				slices.Reverse(cycle)
+				// 从 ID 最小的节点开始描述这个环
+				first := slices.Index(cycle, slices.Min(cycle))
+				cycle = append(cycle[first:], cycle[:first]...)
+				issues = append(issues, nodeIssue(domain.GraphIssueCycle, cycle[0],
+					fmt.Sprintf("节点 %s 组成了环", joinIDs(cycle))))
+				break
+			}
+			visited[cur] = len(path)
+			path = append(path, cur)
+			prev := slices.IndexFunc(incoming[cur], func(id int64) bool {
+				return !sorted[id]
+			})
+			cur = incoming[cur][prev]
+		}
+		for _, id := range path {
+			reported[id] = true
+		}
+	}
+	return issues
+}
+
+func nodeIssue(code domain.GraphIssueCode, nodeID int64, msg string) domain.GraphIssue {
+	return domain.GraphIssue{Level: domain.GraphIssueLevelError, Code: code, NodeID: nodeID, Message: msg}
+}
+
+func edgeIssue(code domain.GraphIssueCode, edgeID int64, msg string) domain.GraphIssue {
+	return domain.GraphIssue{Level: domain.GraphIssueLevelError, Code: code, EdgeID: edgeID, Message: msg}
+}
+
+func nodeKey(node domain.Node) string {
+	var cfg domain.NodeConfig
+	_ = domain.ParseNodeConfig(node, &cfg)
+	return cmp.Or(cfg.Key, "node_"+strconv.FormatInt(node.ID, 10))
+}
+
+func joinIDs(ids []int64) string {
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(strs, " -> ")
+}
+
+// GraphValidationError 保存的时候检查不通过，Issues 里面只有错误级别的问题
+type GraphValidationError struct {
+	Issues []domain.GraphIssue
+}
+
+func (e *GraphValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		msgs = append(msgs, issue.Message)
+	}
+	return "图不合法: " + strings.Join(msgs, "; ")
+}
+
+func (e *GraphValidationError) Unwrap() error {
+	return errs.ErrInvalidParam
+}
+
+// checkIssues 有错误级别的问题的时候返回 GraphValidationError
+func checkIssues(issues []domain.GraphIssue, filter func(issue domain.GraphIssue) bool) error {
+	var bad []domain.GraphIssue
+	for _, issue := range issues {
+		if issue.Level == domain.GraphIssueLevelError && filter(issue) {
+			bad = append(bad, issue)
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return &GraphValidationError{Issues: bad}
+}
+
+func llmSchema(node domain.Node) error {
+	var cfg domain.LLMNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	if cfg.PromptID <= 0 {
+		return errors.New("prompt_id 不能为空")
+	}
+	if cfg.VersionID < 0 {
+		return errors.New("version_id 不能小于 0")
+	}
+	return nil
+}
+
+func templateSchema(node domain.Node) error {
+	var cfg domain.TemplateNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	if cfg.Template == "" {
+		return errors.New("template 不能为空")
+	}
+	return nil
+}
+
+func httpSchema(node domain.Node) error {
+	var cfg domain.HTTPNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	if cfg.URL == "" {
+		return errors.New("url 不能为空")
+	}
+	switch strings.ToUpper(cfg.Method) {
+	case "", "GET", "POST", "PUT", "PATCH", "DELETE", "HEAD":
+	default:
+		return fmt.Errorf("不支持的 method %q", cfg.Method)
+	}
+	if cfg.TimeoutMs < 0 || cfg.TimeoutMs > maxHTTPNodeTimeout.Milliseconds() {
+		return fmt.Errorf("timeout_ms 需要在 0 到 %d 之间", maxHTTPNodeTimeout.Milliseconds())
+	}
+	return nil
+}
+
+func conditionSchema(node domain.Node) error {
+	var cfg domain.ConditionNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	for i, c := range cfg.Cases {
+		if c.Path == "" || c.Branch == "" {
+			return fmt.Errorf("第 %d 个 case 的 path 和 branch 不能为空", i+1)
+		}
+		switch c.Op {
+		case "exists":
+		case "eq", "ne", "contains", "gt", "gte", "lt", "lte":
+			if c.Value == nil {
+				return fmt.Errorf("第 %d 个 case 缺少 value", i+1)
+			}
+		default:
+			return fmt.Errorf("第 %d 个 case 的 op %q 不支持", i+1, c.Op)
+		}
+	}
+	return nil
+}
+
+func mergeSchema(node domain.Node) error {
+	var cfg domain.MergeNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	switch cfg.Mode {
+	case "", "object", "array", "first":
+		return nil
+	default:
+		return fmt.Errorf("不支持的 mode %q", cfg.Mode)
+	}
+}
+
+func transformSchema(node domain.Node) error {
+	var cfg domain.TransformNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Fields) == 0 {
+		return errors.New("fields 不能为空")
+	}
+	for field, path := range cfg.Fields {
+		if path == "" {
+			return fmt.Errorf("字段 %s 的路径不能为空", field)
+		}
+	}
+	return nil
+}
+
+func approvalSchema(node domain.Node) error {
+	var cfg domain.ApprovalNodeConfig
+	if err := domain.ParseNodeConfig(node, &cfg); err != nil {
+		return err
+	}
+	if cfg.TimeoutSeconds < 0 {
+		return errors.New("timeout_seconds 不能小于 0")
+	}
+	switch cfg.OnTimeout {
+	case "", "approve", "reject":
+		return nil
+	default:
+		return fmt.Errorf("不支持的 on_timeout %q", cfg.OnTimeout)
+	}
+}
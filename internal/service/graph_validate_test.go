@@ -0,0 +1,181 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphValidator_Validate(t *testing.T) {
+	node := func(id int64, typ string, metadata string) domain.Node {
+		return domain.Node{ID: id, GraphID: 1, Type: typ, Metadata: ekit.AnyValue{Val: metadata}}
+	}
+	tpl := func(id int64) domain.Node {
+		return node(id, domain.NodeTypeTemplate, `{"template": "{{input}}"}`)
+	}
+	edge := func(id, source, target int64) domain.Edge {
+		return domain.Edge{ID: id, GraphID: 1, SourceID: source, TargetID: target}
+	}
+	branchEdge := func(id, source, target int64, branch string) domain.Edge {
+		e := edge(id, source, target)
+		e.Metadata = ekit.AnyValue{Val: `{"branch": "` + branch + `"}`}
+		return e
+	}
+	condition := node(1, domain.NodeTypeCondition,
+		`{"cases": [{"path": "input.score", "op": "gt", "value": 60, "branch": "pass"}], "default": "fail"}`)
+	testCases := []struct {
+		name       string
+		graph      domain.Graph
+		foreign    []domain.Node
+		wantIssues []domain.GraphIssue
+	}{
+		{
+			name: "合法的图",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{condition, tpl(2), tpl(3)},
+				Edges: []domain.Edge{branchEdge(1, 1, 2, "pass"), branchEdge(2, 1, 3, "fail")},
+			},
+		},
+		{
+			name:  "只有一个节点不算孤立",
+			graph: domain.Graph{ID: 1, Steps: []domain.Node{tpl(1)}},
+		},
+		{
+			name: "不支持的类型和不合法的配置",
+			graph: domain.Graph{
+				ID: 1,
+				Steps: []domain.Node{
+					node(1, "shell", ""),
+					node(2, domain.NodeTypeLLM, `{"version_id": 1}`),
+					node(3, domain.NodeTypeHTTP, `{"url": "http://localhost", "method": "CONNECT"}`),
+					node(4, domain.NodeTypeMerge, `{"mode": "zip"}`),
+					node(5, domain.NodeTypeTransform, `{`),
+				},
+				Edges: []domain.Edge{edge(1, 1, 2), edge(2, 2, 3), edge(3, 3, 4), edge(4, 4, 5)},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueUnknownType, NodeID: 1, Message: `节点 1 的类型 "shell" 不支持`},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 2, Message: "节点 2 的配置不合法: prompt_id 不能为空"},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 3, Message: `节点 3 的配置不合法: 不支持的 method "CONNECT"`},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 4, Message: `节点 4 的配置不合法: 不支持的 mode "zip"`},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 5, Message: "节点 5 的配置不合法: unexpected end of JSON input"},
+			},
+		},
+		{
+			name: "HTTP 节点的超时太长",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{node(1, domain.NodeTypeHTTP, `{"url": "https://example.com", "timeout_ms": 600000}`)},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 1, Message: "节点 1 的配置不合法: timeout_ms 需要在 0 到 60000 之间"},
+			},
+		},
+		{
+			name: "key 重复",
+			graph: domain.Graph{
+				ID: 1,
+				Steps: []domain.Node{
+					node(1, domain.NodeTypeTemplate, `{"key": "answer", "template": "a"}`),
+					node(2, domain.NodeTypeTemplate, `{"key": "answer", "template": "b"}`),
+				},
+				Edges: []domain.Edge{edge(1, 1, 2)},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueDuplicateKey, NodeID: 2, Message: `节点 2 和节点 1 的 key 都是 "answer"`},
+			},
+		},
+		{
+			name: "悬空的边和跨图的边",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{tpl(1), tpl(2)},
+				Edges: []domain.Edge{edge(1, 1, 2), edge(2, 1, 3), edge(3, 2, 4), {ID: 4, GraphID: 2, SourceID: 5, TargetID: 6}},
+			},
+			foreign: []domain.Node{{ID: 4, GraphID: 2, Type: domain.NodeTypeTemplate}},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueDanglingEdge, EdgeID: 2, Message: "边 2 连接的节点 3 不存在"},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueCrossGraphEdge, EdgeID: 3, Message: "边 3 连接了图 2 的节点 4"},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueCrossGraphEdge, EdgeID: 4, Message: "边 4 属于图 2"},
+			},
+		},
+		{
+			name: "分支不合法",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{condition, tpl(2), tpl(3)},
+				Edges: []domain.Edge{branchEdge(1, 1, 2, "retry"), branchEdge(2, 2, 3, "pass")},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidBranch, EdgeID: 1, Message: `条件节点 1 没有分支 "retry"`},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidBranch, EdgeID: 2, Message: `边 2 声明了分支 "pass"，但是节点 2 不是条件节点或者审批节点`},
+			},
+		},
+		{
+			name: "审批节点的分支和配置",
+			graph: domain.Graph{
+				ID: 1,
+				Steps: []domain.Node{
+					node(1, domain.NodeTypeApproval, `{"timeout_seconds": 3600, "on_timeout": "approve"}`),
+					tpl(2), tpl(3),
+					node(4, domain.NodeTypeApproval, `{"on_timeout": "ignore"}`),
+				},
+				Edges: []domain.Edge{
+					branchEdge(1, 1, 2, domain.ApprovalBranchApproved),
+					branchEdge(2, 1, 3, domain.ApprovalBranchRejected),
+					branchEdge(3, 1, 4, "pass"),
+				},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidMetadata, NodeID: 4, Message: `节点 4 的配置不合法: 不支持的 on_timeout "ignore"`},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueInvalidBranch, EdgeID: 3, Message: `审批节点 1 只有 approved 和 rejected 两个分支，没有 "pass"`},
+			},
+		},
+		{
+			name: "环和环的下游",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{tpl(1), tpl(2), tpl(3), tpl(4), tpl(5)},
+				Edges: []domain.Edge{edge(1, 1, 2), edge(2, 2, 3), edge(3, 3, 2), edge(4, 3, 4), edge(5, 5, 5)},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueCycle, NodeID: 2, Message: "节点 2 -> 3 组成了环"},
+				{Level: domain.GraphIssueLevelError, Code: domain.GraphIssueCycle, NodeID: 5, Message: "节点 5 组成了环"},
+			},
+		},
+		{
+			name: "孤立的节点",
+			graph: domain.Graph{
+				ID:    1,
+				Steps: []domain.Node{tpl(1), tpl(2), tpl(3)},
+				Edges: []domain.Edge{edge(1, 1, 2)},
+			},
+			wantIssues: []domain.GraphIssue{
+				{Level: domain.GraphIssueLevelWarning, Code: domain.GraphIssueOrphanedNode, NodeID: 3, Message: "节点 3 没有连接任何节点"},
+			},
+		},
+	}
+	v := NewGraphValidator()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantIssues, v.Validate(tc.graph, tc.foreign...))
+		})
+	}
+}
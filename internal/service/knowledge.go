@@ -0,0 +1,263 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+const (
+	defaultChunkSize      = 500
+	defaultChunkOverlap   = 50
+	defaultKnowledgeLimit = 20
+	maxKnowledgeLimit     = 100
+	maxChunkSize          = 8000
+	// 文档最大 10MB
+	maxDocumentSize = 10 << 20
+	// 每保存一批片段更新一次进度
+	chunkBatchSize = 100
+	// 提取文本和切分完成之后的进度，剩下的是保存片段的进度
+	extractedProgress = 10
+	// 导入中的文档超过这个时间没有更新进度，就认为导入它的实例已经退出了
+	staleIngestDuration = 10 * time.Minute
+)
+
+// KnowledgeService 用户的知识库，文档在后台提取文本并且切分成片段。
+// 导入是在当前进程的 goroutine 里面执行的，进程退出之后不会继续，启动的时候需要调用 FailInterrupted
+type KnowledgeService struct {
+	repo *repository.KnowledgeRepo
+}
+
+func NewKnowledgeService(repo *repository.KnowledgeRepo) *KnowledgeService {
+	return &KnowledgeService{repo: repo}
+}
+
+// SaveBase ID 为 0 的时候创建知识库，没有配置切分的时候使用默认的配置。修改切分的配置只影响之后导入的文档
+func (s *KnowledgeService) SaveBase(ctx context.Context, kb domain.KnowledgeBase) (domain.KnowledgeBase, error) {
+	if strings.TrimSpace(kb.Name) == "" {
+		return domain.KnowledgeBase{}, fmt.Errorf("%w: 知识库的名字不能为空", errs.ErrInvalidParam)
+	}
+	if kb.ChunkSize == 0 && kb.ChunkOverlap == 0 {
+		kb.ChunkSize = defaultChunkSize
+		kb.ChunkOverlap = defaultChunkOverlap
+	}
+	if kb.ChunkSize <= 0 || kb.ChunkSize > maxChunkSize {
+		return domain.KnowledgeBase{}, fmt.Errorf("%w: chunk_size 必须在 1 到 %d 之间", errs.ErrInvalidParam, maxChunkSize)
+	}
+	if kb.ChunkOverlap < 0 || kb.ChunkOverlap >= kb.ChunkSize {
+		return domain.KnowledgeBase{}, fmt.Errorf("%w: chunk_overlap 必须大于等于 0 并且小于 chunk_size", errs.ErrInvalidParam)
+	}
+	if kb.ID > 0 {
+		if _, err := s.GetBase(ctx, kb.ID, kb.Owner); err != nil {
+			return domain.KnowledgeBase{}, err
+		}
+	}
+	id, err := s.repo.SaveBase(ctx, kb)
+	if err != nil {
+		return domain.KnowledgeBase{}, err
+	}
+	return s.repo.GetBase(ctx, id)
+}
+
+// GetBase 只能查看自己的知识库
+func (s *KnowledgeService) GetBase(ctx context.Context, id int64, owner int64) (domain.KnowledgeBase, error) {
+	kb, err := s.repo.GetBase(ctx, id)
+	if err != nil {
+		return domain.KnowledgeBase{}, err
+	}
+	if kb.Owner != owner {
+		return domain.KnowledgeBase{}, fmt.Errorf("%w: 知识库 %d 不属于用户 %d", errs.ErrPermissionDenied, id, owner)
+	}
+	return kb, nil
+}
+
+func (s *KnowledgeService) ListBases(ctx context.Context, owner int64) ([]domain.KnowledgeBase, error) {
+	return s.repo.ListBases(ctx, owner)
+}
+
+// DeleteBase 同时删除里面的文档和片段
+func (s *KnowledgeService) DeleteBase(ctx context.Context, id int64, owner int64) error {
+	if _, err := s.GetBase(ctx, id, owner); err != nil {
+		return err
+	}
+	return s.repo.DeleteBase(ctx, id)
+}
+
+// Ingest 把文档加入知识库，返回刚创建的文档。提取文本和切分在后台执行，进度通过 GetDocument 查询
+func (s *KnowledgeService) Ingest(ctx context.Context, doc domain.KnowledgeDocument) (domain.KnowledgeDocument, error) {
+	kb, err := s.GetBase(ctx, doc.KBID, doc.Owner)
+	if err != nil {
+		return domain.KnowledgeDocument{}, err
+	}
+	switch doc.Format {
+	case domain.DocumentFormatText, domain.DocumentFormatMarkdown, domain.DocumentFormatHTML, domain.DocumentFormatPDF:
+	case "":
+		doc.Format = domain.DocumentFormatText
+	default:
+		return domain.KnowledgeDocument{}, fmt.Errorf("%w: 不支持的文档格式 %q", errs.ErrInvalidParam, doc.Format)
+	}
+	if strings.TrimSpace(doc.Content) == "" {
+		return domain.KnowledgeDocument{}, fmt.Errorf("%w: 文档的内容不能为空", errs.ErrInvalidParam)
+	}
+	if len(doc.Content) > maxDocumentSize {
+		return domain.KnowledgeDocument{}, fmt.Errorf("%w: 文档不能超过 %dMB", errs.ErrInvalidParam, maxDocumentSize>>20)
+	}
+	doc.Status = domain.DocumentStatusPending
+	doc.ID, err = s.repo.CreateDocument(ctx, doc)
+	if err != nil {
+		return domain.KnowledgeDocument{}, err
+	}
+	// 大文档的导入可能比请求更久，不能跟随请求的 ctx 一起结束
+	go s.ingest(context.WithoutCancel(ctx), kb, doc)
+	return s.repo.GetDocument(ctx, doc.ID)
+}
+
+// ingest 提取文本，切分之后分批保存片段，每一批保存之后更新进度。失败的时候删除已经保存的片段
+func (s *KnowledgeService) ingest(ctx context.Context, kb domain.KnowledgeBase, doc domain.KnowledgeDocument) {
+	doc.Status = domain.DocumentStatusProcessing
+	s.updateProgress(ctx, doc)
+
+	chunks, err := s.chunk(kb, doc)
+	if err == nil {
+		doc.Progress = extractedProgress
+		s.updateProgress(ctx, doc)
+		err = s.saveChunks(ctx, &doc, chunks)
+	}
+	if err != nil {
+		if err1 := s.repo.DeleteChunks(ctx, doc.ID); err1 != nil {
+			elog.Error("删除文档的片段失败", elog.Int64("doc", doc.ID), elog.FieldErr(err1))
+		}
+		// 导入的过程中文档被删除了，不需要再更新状态
+		if errors.Is(err, errs.ErrKnowledgeNotFound) {
+			elog.Info("文档已经被删除，停止导入", elog.Int64("doc", doc.ID))
+			return
+		}
+		doc.Status = domain.DocumentStatusFailed
+		doc.Chunks = 0
+		doc.Error = err.Error()
+		s.updateProgress(ctx, doc)
+		return
+	}
+	doc.Status = domain.DocumentStatusSucceeded
+	doc.Progress = 100
+	s.updateProgress(ctx, doc)
+}
+
+func (s *KnowledgeService) chunk(kb domain.KnowledgeBase, doc domain.KnowledgeDocument) ([]domain.KnowledgeChunk, error) {
+	text, err := extractText(doc.Format, doc.Content)
+	if err != nil {
+		return nil, err
+	}
+	contents := splitText(text, kb.ChunkSize, kb.ChunkOverlap)
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("文档里面没有文字")
+	}
+	res := make([]domain.KnowledgeChunk, 0, len(contents))
+	for i, content := range contents {
+		res = append(res, domain.KnowledgeChunk{DocID: doc.ID, KBID: doc.KBID, Owner: doc.Owner, Index: i, Content: content})
+	}
+	return res, nil
+}
+
+func (s *KnowledgeService) saveChunks(ctx context.Context, doc *domain.KnowledgeDocument, chunks []domain.KnowledgeChunk) error {
+	for start := 0; start < len(chunks); start += chunkBatchSize {
+		end := min(start+chunkBatchSize, len(chunks))
+		if err := s.repo.SaveChunks(ctx, chunks[start:end]); err != nil {
+			return err
+		}
+		doc.Chunks = end
+		doc.Progress = extractedProgress + (100-extractedProgress)*end/len(chunks)
+		if end < len(chunks) {
+			s.updateProgress(ctx, *doc)
+		}
+	}
+	return nil
+}
+
+// FailInterrupted 把导入被中断的文档标记为失败并且删除已经保存的片段，用户可以重新导入。
+// 只处理超过 staleIngestDuration 没有更新进度的文档，避免影响其他实例正在导入的文档。返回处理的文档数量
+func (s *KnowledgeService) FailInterrupted(ctx context.Context) (int, error) {
+	docs, err := s.repo.ListStaleDocuments(ctx, time.Now().Add(-staleIngestDuration).UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	for _, doc := range docs {
+		if err = s.repo.DeleteChunks(ctx, doc.ID); err != nil {
+			return 0, err
+		}
+		doc.Status = domain.DocumentStatusFailed
+		doc.Chunks = 0
+		doc.Error = "导入被中断，请重新导入"
+		if err = s.repo.UpdateProgress(ctx, doc); err != nil {
+			return 0, err
+		}
+	}
+	return len(docs), nil
+}
+
+// updateProgress 进度保存失败不影响导入
+func (s *KnowledgeService) updateProgress(ctx context.Context, doc domain.KnowledgeDocument) {
+	if err := s.repo.UpdateProgress(ctx, doc); err != nil {
+		elog.Error("更新文档的导入进度失败", elog.Int64("doc", doc.ID), elog.FieldErr(err))
+	}
+}
+
+// GetDocument 只能查看自己的文档
+func (s *KnowledgeService) GetDocument(ctx context.Context, id int64, owner int64) (domain.KnowledgeDocument, error) {
+	doc, err := s.repo.GetDocument(ctx, id)
+	if err != nil {
+		return domain.KnowledgeDocument{}, err
+	}
+	if doc.Owner != owner {
+		return domain.KnowledgeDocument{}, fmt.Errorf("%w: 文档 %d 不属于用户 %d", errs.ErrPermissionDenied, id, owner)
+	}
+	return doc, nil
+}
+
+func (s *KnowledgeService) ListDocuments(ctx context.Context, q domain.KnowledgeDocumentQuery) ([]domain.KnowledgeDocument, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultKnowledgeLimit
+	}
+	q.Limit = min(q.Limit, maxKnowledgeLimit)
+	return s.repo.ListDocuments(ctx, q)
+}
+
+// DeleteDocument 同时删除文档的片段
+func (s *KnowledgeService) DeleteDocument(ctx context.Context, id int64, owner int64) error {
+	if _, err := s.GetDocument(ctx, id, owner); err != nil {
+		return err
+	}
+	return s.repo.DeleteDocument(ctx, id)
+}
+
+// ListChunks 按照顺序返回文档的片段
+func (s *KnowledgeService) ListChunks(ctx context.Context, docID int64, owner int64, limit int, offset int) ([]domain.KnowledgeChunk, error) {
+	if _, err := s.GetDocument(ctx, docID, owner); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultKnowledgeLimit
+	}
+	return s.repo.ListChunks(ctx, docID, min(limit, maxKnowledgeLimit), offset)
+}
@@ -0,0 +1,254 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"golang.org/x/net/html"
+)
+
+var (
+	mdFence      = regexp.MustCompile("^\\s*(```|~~~)")
+	mdHeading    = regexp.MustCompile(`^\s{0,3}#{1,6}\s+`)
+	mdQuote      = regexp.MustCompile(`^\s*>\s?`)
+	mdList       = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+	mdRule       = regexp.MustCompile(`^\s*([-*_]\s*){3,}$`)
+	mdTableRule  = regexp.MustCompile(`^\s*\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdEmphasis   = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	mdInlineCode = regexp.MustCompile("`([^`]*)`")
+	mdTag        = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	pdfHyphen    = regexp.MustCompile(`(\p{L})-\n(\p{L})`)
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+	// 句子结束的标点，英文的句号后面要有空白，避免切开小数和缩写
+	sentenceEnd = regexp.MustCompile(`[。！？；!?;]+|\.\s`)
+)
+
+// extractText 把文档转成纯文本，段落之间用空行分隔
+func extractText(format domain.DocumentFormat, content string) (string, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var text string
+	switch format {
+	case domain.DocumentFormatText:
+		text = content
+	case domain.DocumentFormatMarkdown:
+		text = extractMarkdown(content)
+	case domain.DocumentFormatHTML:
+		text = extractHTML(content)
+	case domain.DocumentFormatPDF:
+		text = extractPDF(content)
+	default:
+		return "", fmt.Errorf("不支持的文档格式 %q", format)
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")), nil
+}
+
+// extractMarkdown 去掉 Markdown 的标记，保留文字和代码
+func extractMarkdown(content string) string {
+	lines := strings.Split(content, "\n")
+	res := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		if mdFence.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			res = append(res, line)
+			continue
+		}
+		if mdRule.MatchString(line) || mdTableRule.MatchString(line) {
+			res = append(res, "")
+			continue
+		}
+		line = mdQuote.ReplaceAllString(line, "")
+		line = mdHeading.ReplaceAllString(line, "")
+		line = mdList.ReplaceAllString(line, "")
+		line = mdImage.ReplaceAllString(line, "$1")
+		line = mdLink.ReplaceAllString(line, "$1")
+		line = mdEmphasis.ReplaceAllString(line, "$2")
+		line = mdInlineCode.ReplaceAllString(line, "$1")
+		line = mdTag.ReplaceAllString(line, "")
+		res = append(res, line)
+	}
+	return strings.Join(res, "\n")
+}
+
+// htmlBlocks 这些元素的前后需要换行
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true,
+	"section": true, "article": true, "header": true, "footer": true, "hr": true, "title": true,
+}
+
+// htmlSkipped 这些元素的内容不是正文
+var htmlSkipped = map[string]bool{"script": true, "style": true, "noscript": true, "template": true}
+
+// extractHTML 提取 HTML 里面的文字，块级元素之间换行，实体会被解码
+func extractHTML(content string) string {
+	var sb strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(content))
+	skip := ""
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if htmlSkipped[tag] && skip == "" {
+				skip = tag
+			}
+			if htmlBlocks[tag] {
+				sb.WriteString("\n\n")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if tag == skip {
+				skip = ""
+			}
+			if htmlBlocks[tag] {
+				sb.WriteString("\n\n")
+			}
+		case html.TextToken:
+			if skip != "" {
+				continue
+			}
+			sb.WriteString(strings.Join(strings.Fields(string(tokenizer.Text())), " "))
+		}
+	}
+}
+
+// extractPDF PDF 提取出来的文本每一行都会换行，换页是 \f。
+// 把被连字符断开的单词接起来，段落里面的换行换成空格，中文之间的换行直接去掉
+func extractPDF(content string) string {
+	content = strings.ReplaceAll(content, "\f", "\n\n")
+	content = pdfHyphen.ReplaceAllString(content, "$1$2")
+	paragraphs := strings.Split(content, "\n\n")
+	for i, p := range paragraphs {
+		lines := strings.Split(p, "\n")
+		var sb strings.Builder
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			if sb.Len() > 0 {
+				last, _ := utf8.DecodeLastRuneInString(sb.String())
+				first, _ := utf8.DecodeRuneInString(line)
+				if !unicode.Is(unicode.Han, last) || !unicode.Is(unicode.Han, first) {
+					sb.WriteByte(' ')
+				}
+			}
+			sb.WriteString(line)
+		}
+		paragraphs[i] = sb.String()
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// chunkUnit 切分的最小单位，sep 是和前一个单位拼接的时候使用的分隔符
+type chunkUnit struct {
+	sep  string
+	text []rune
+}
+
+// splitText 按照段落和句子切分文本，每个片段最多 size 个字符，相邻的片段重叠 overlap 个字符。
+// 超过长度的句子会被直接截断
+func splitText(text string, size int, overlap int) []string {
+	units := splitUnits(text, size-overlap)
+	var (
+		res []string
+		cur []rune
+	)
+	for _, u := range units {
+		sep := []rune(u.sep)
+		if len(cur) == 0 {
+			cur = append(cur, u.text...)
+			continue
+		}
+		if len(cur)+len(sep)+len(u.text) <= size {
+			cur = append(append(cur, sep...), u.text...)
+			continue
+		}
+		res = append(res, strings.TrimSpace(string(cur)))
+		tail := cur[max(len(cur)-overlap, 0):]
+		tail = []rune(strings.TrimLeftFunc(string(tail), unicode.IsSpace))
+		if extra := len(tail) + len(sep) + len(u.text) - size; extra > 0 {
+			tail = tail[min(extra, len(tail)):]
+		}
+		cur = append([]rune{}, tail...)
+		if len(cur) > 0 {
+			cur = append(cur, sep...)
+		}
+		cur = append(cur, u.text...)
+	}
+	if last := strings.TrimSpace(string(cur)); last != "" {
+		res = append(res, last)
+	}
+	return res
+}
+
+// splitUnits 先按照段落切分，太长的段落再按照句子切分，太长的句子按照 limit 截断
+func splitUnits(text string, limit int) []chunkUnit {
+	var res []chunkUnit
+	for _, p := range strings.Split(text, "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		sep := "\n\n"
+		if utf8.RuneCountInString(p) <= limit {
+			res = append(res, chunkUnit{sep: sep, text: []rune(p)})
+			continue
+		}
+		for _, sentence := range splitSentences(p) {
+			runes := []rune(sentence)
+			for len(runes) > 0 {
+				n := min(limit, len(runes))
+				res = append(res, chunkUnit{sep: sep, text: runes[:n]})
+				runes = runes[n:]
+				sep = ""
+			}
+		}
+	}
+	return res
+}
+
+// splitSentences 句子保留结尾的标点和空白，拼起来就是原来的段落
+func splitSentences(p string) []string {
+	var res []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(p, -1) {
+		res = append(res, p[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(p) {
+		res = append(res, p[start:])
+	}
+	return res
+}
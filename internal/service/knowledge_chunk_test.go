@@ -0,0 +1,149 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractText(t *testing.T) {
+	testCases := []struct {
+		name    string
+		format  domain.DocumentFormat
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "纯文本",
+			format:  domain.DocumentFormatText,
+			content: "第一段\r\n\r\n\r\n\r\n第二段  \n",
+			want:    "第一段\n\n第二段",
+		},
+		{
+			name:   "Markdown",
+			format: domain.DocumentFormatMarkdown,
+			content: "# 标题\n\n> 引用 **重点** 和 `code`\n\n- 看[文档](http://a.com)\n" +
+				"![图](a.png)\n\n---\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n```go\nfmt.Println(1)\n```",
+			want: "标题\n\n引用 重点 和 code\n\n看文档\n图\n\n| a | b |\n\n| 1 | 2 |\n\nfmt.Println(1)",
+		},
+		{
+			name:   "HTML",
+			format: domain.DocumentFormatHTML,
+			content: `<html><head><title>标题</title><style>p {color: red}</style></head>` +
+				`<body><h1>介绍</h1><p>第一段   &amp; <b>加粗</b></p><script>alert(1)</script><ul><li>一</li><li>二</li></ul></body></html>`,
+			want: "标题\n\n介绍\n\n第一段 &加粗\n\n一\n\n二",
+		},
+		{
+			name:    "PDF",
+			format:  domain.DocumentFormatPDF,
+			content: "This is a docu-\nment that\nwraps lines.\f中文的段落\n会被换行\n\nnext page",
+			want:    "This is a document that wraps lines.\n\n中文的段落会被换行\n\nnext page",
+		},
+		{
+			name:    "不支持的格式",
+			format:  "docx",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := extractText(tc.format, tc.content)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	testCases := []struct {
+		name    string
+		text    string
+		size    int
+		overlap int
+		want    []string
+	}{
+		{
+			name: "短文本是一个片段",
+			text: "第一段\n\n第二段",
+			size: 100,
+			want: []string{"第一段\n\n第二段"},
+		},
+		{
+			name: "按照段落切分",
+			text: "aaaa\n\nbbbb\n\ncccc",
+			size: 10,
+			want: []string{"aaaa\n\nbbbb", "cccc"},
+		},
+		{
+			name:    "相邻的片段重叠",
+			text:    "aaaa\n\nbbbb\n\ncccc",
+			size:    10,
+			overlap: 2,
+			want:    []string{"aaaa\n\nbbbb", "bb\n\ncccc"},
+		},
+		{
+			name: "太长的段落按照句子切分",
+			text: "第一句。第二句！第三句？",
+			size: 8,
+			want: []string{"第一句。第二句！", "第三句？"},
+		},
+		{
+			name: "太长的句子直接截断",
+			text: "abcdefghij",
+			size: 4,
+			want: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name: "空文本",
+			text: "",
+			size: 10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitText(tc.text, tc.size, tc.overlap)
+			assert.Equal(t, tc.want, got)
+			for _, chunk := range got {
+				assert.LessOrEqual(t, utf8.RuneCountInString(chunk), tc.size)
+			}
+		})
+	}
+}
+
+// 不管怎么切分，片段都不会超过长度，并且按照顺序拼起来能覆盖原文
+func TestSplitText_Coverage(t *testing.T) {
+	text := strings.Repeat("这是一个很长的句子，用来测试切分。Another sentence here. ", 50)
+	for _, tc := range []struct{ size, overlap int }{{50, 0}, {50, 10}, {200, 49}, {30, 29}} {
+		chunks := splitText(text, tc.size, tc.overlap)
+		require.NotEmpty(t, chunks)
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, utf8.RuneCountInString(chunk), tc.size)
+		}
+		if tc.overlap == 0 {
+			assert.Equal(t, strings.Join(strings.Fields(text), ""), strings.Join(strings.Fields(strings.Join(chunks, "")), ""))
+		}
+	}
+}
@@ -24,3 +24,26 @@ type Handler interface {
 	StreamHandle(ctx context.Context, req []domain.Message) (chan domain.StreamEvent, error)
 	Handle(ctx context.Context, req []domain.Message) (domain.ChatResponse, error)
 }
+
+// Embedder 把文本转换成向量，和 Handler 一样由各个平台实现
+type Embedder interface {
+	// Embed 返回的向量和 input 一一对应
+	Embed(ctx context.Context, input []string) (domain.EmbeddingResponse, error)
+	// Dimensions 向量的维度
+	Dimensions() int
+}
+
+// ModelDescriber 由 Handler 按需实现，用于记录回答是哪个模型生成的
+type ModelDescriber interface {
+	// Provider 模型的提供方，例如 deepseek
+	Provider() string
+	Model() string
+}
+
+// Tokenizer 由 Handler 按需实现，用于按照模型自己的分词方式估算上下文的大小
+type Tokenizer interface {
+	// CountTokens 估算一条消息占用的 token 数
+	CountTokens(msg domain.Message) int64
+	// ContextWindow 模型的上下文窗口大小
+	ContextWindow() int64
+}
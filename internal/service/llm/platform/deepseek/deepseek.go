@@ -25,6 +25,9 @@ import (
 	"github.com/ecodeclub/ekit/slice"
 )
 
+// contextWindow deepseek-chat 的上下文窗口大小
+const contextWindow = 64 * 1024
+
 type Handler struct {
 	client *deepseek.Client
 }
@@ -33,6 +36,23 @@ func NewHandler(client *deepseek.Client) *Handler {
 	return &Handler{client: client}
 }
 
+// CountTokens 每条消息额外算上角色占用的 token
+func (h *Handler) CountTokens(msg domain.Message) int64 {
+	return int64(deepseek.EstimateTokenCount(msg.Content).EstimatedTokens) + 2
+}
+
+func (h *Handler) ContextWindow() int64 {
+	return contextWindow
+}
+
+func (h *Handler) Provider() string {
+	return "deepseek"
+}
+
+func (h *Handler) Model() string {
+	return deepseek.DeepSeekChat
+}
+
 func (h *Handler) Handle(ctx context.Context, req []domain.Message) (domain.ChatResponse, error) {
 	request := &deepseek.ChatCompletionRequest{
 		Model:    deepseek.DeepSeekChat,
@@ -49,7 +69,11 @@ func (h *Handler) Handle(ctx context.Context, req []domain.Message) (domain.Chat
 		ReasoningContent: response.Choices[0].Message.ReasoningContent,
 	}
 
-	return domain.ChatResponse{Response: message}, nil
+	return domain.ChatResponse{Response: message, Usage: domain.Usage{
+		PromptTokens:     int64(response.Usage.PromptTokens),
+		CompletionTokens: int64(response.Usage.CompletionTokens),
+		TotalTokens:      int64(response.Usage.TotalTokens),
+	}}, nil
 }
 
 func (h *Handler) StreamHandle(ctx context.Context, req []domain.Message) (chan domain.StreamEvent, error) {
@@ -57,6 +81,9 @@ func (h *Handler) StreamHandle(ctx context.Context, req []domain.Message) (chan
 		Model:    deepseek.DeepSeekChat,
 		Messages: h.ToMessage(req),
 		Stream:   true,
+		StreamOptions: deepseek.StreamOptions{
+			IncludeUsage: true,
+		},
 	}
 
 	events := make(chan domain.StreamEvent, 10)
@@ -88,8 +115,21 @@ func (h *Handler) recv(eventCh chan domain.StreamEvent, stream deepseek.ChatComp
 				break
 			}
 			eventCh <- domain.StreamEvent{Error: err}
+			return
+		}
+		var event domain.StreamEvent
+		if chunk.Usage != nil {
+			event.Usage = domain.Usage{
+				PromptTokens:     int64(chunk.Usage.PromptTokens),
+				CompletionTokens: int64(chunk.Usage.CompletionTokens),
+				TotalTokens:      int64(chunk.Usage.TotalTokens),
+			}
+		}
+		if len(chunk.Choices) > 0 {
+			event.Content = chunk.Choices[0].Delta.Content
+			event.ReasoningContent = chunk.Choices[0].Delta.ReasoningContent
 		}
-		eventCh <- domain.StreamEvent{Content: chunk.Choices[0].Delta.Content, ReasoningContent: chunk.Choices[0].Delta.ReasoningContent, Error: nil}
+		eventCh <- event
 	}
 }
 
@@ -0,0 +1,29 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deepseek
+
+import (
+	"github.com/cohesion-org/deepseek-go"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm/platform/openai"
+)
+
+// NewEmbedder deepseek 的 embeddings 接口和 OpenAI 兼容，复用 client 的地址、token 和 HTTP 客户端
+func NewEmbedder(client *deepseek.Client, model string, dimensions int) *openai.Embedder {
+	opts := []openai.EmbedderOption{openai.WithProvider("deepseek")}
+	if client.HTTPClient != nil {
+		opts = append(opts, openai.WithHTTPClient(client.HTTPClient))
+	}
+	return openai.NewEmbedder(client.BaseURL, client.AuthToken, model, dimensions, opts...)
+}
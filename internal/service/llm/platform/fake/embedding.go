@@ -0,0 +1,113 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+const model = "fake-embedding"
+
+// Embedder 用于测试，不调用任何平台。
+// 把文本里面的词哈希到向量的某一维，相同的文本得到相同的向量，共同的词越多越相似
+type Embedder struct {
+	dimensions int
+}
+
+func NewEmbedder(dimensions int) *Embedder {
+	return &Embedder{dimensions: dimensions}
+}
+
+func (e *Embedder) Provider() string {
+	return "fake"
+}
+
+func (e *Embedder) Model() string {
+	return model
+}
+
+func (e *Embedder) Dimensions() int {
+	return e.dimensions
+}
+
+// Embed 每个词算一个 token
+func (e *Embedder) Embed(ctx context.Context, input []string) (domain.EmbeddingResponse, error) {
+	res := domain.EmbeddingResponse{Model: model, Vectors: make([][]float32, 0, len(input))}
+	for _, text := range input {
+		words := tokenize(text)
+		res.Vectors = append(res.Vectors, e.vector(words))
+		res.Usage.PromptTokens += int64(len(words))
+	}
+	res.Usage.TotalTokens = res.Usage.PromptTokens
+	return res, nil
+}
+
+func (e *Embedder) vector(words []string) []float32 {
+	vec := make([]float32, e.dimensions)
+	for _, word := range words {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		// 用高位决定符号，减少不同的词哈希到同一维之后互相抵消的影响
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vec[sum%uint64(e.dimensions)] += sign
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] = float32(float64(vec[i]) / norm)
+	}
+	return vec
+}
+
+// tokenize 英文和数字按照单词切分，不区分大小写，中文每个字是一个词
+func tokenize(text string) []string {
+	var words []string
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			words = append(words, sb.String())
+			sb.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
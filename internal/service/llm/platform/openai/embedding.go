@@ -0,0 +1,170 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+// HTTPDoer 发送 HTTP 请求，*http.Client 满足这个接口
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Embedder 调用和 OpenAI 兼容的 /embeddings 接口，也可以用于其他兼容的平台
+type Embedder struct {
+	client     HTTPDoer
+	baseURL    string
+	token      string
+	model      string
+	dimensions int
+	provider   string
+}
+
+type EmbedderOption func(e *Embedder)
+
+// WithHTTPClient 默认使用 http.DefaultClient
+func WithHTTPClient(client HTTPDoer) EmbedderOption {
+	return func(e *Embedder) {
+		e.client = client
+	}
+}
+
+// WithProvider 兼容 OpenAI 接口的其他平台用它记录模型的提供方
+func WithProvider(provider string) EmbedderOption {
+	return func(e *Embedder) {
+		e.provider = provider
+	}
+}
+
+// NewEmbedder baseURL 例如 https://api.openai.com/v1，dimensions 是模型输出的向量维度
+func NewEmbedder(baseURL string, token string, model string, dimensions int, opts ...EmbedderOption) *Embedder {
+	e := &Embedder{
+		client:     http.DefaultClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		model:      model,
+		dimensions: dimensions,
+		provider:   "openai",
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *Embedder) Provider() string {
+	return e.provider
+}
+
+func (e *Embedder) Model() string {
+	return e.model
+}
+
+func (e *Embedder) Dimensions() int {
+	return e.dimensions
+}
+
+type embeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format"`
+}
+
+type embeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type embeddingResponse struct {
+	Model string          `json:"model"`
+	Data  []embeddingData `json:"data"`
+	Usage struct {
+		PromptTokens int64 `json:"prompt_tokens"`
+		TotalTokens  int64 `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e *Embedder) Embed(ctx context.Context, input []string) (domain.EmbeddingResponse, error) {
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: input, EncodingFormat: "float"})
+	if err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.token)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return domain.EmbeddingResponse{}, err
+	}
+
+	var res embeddingResponse
+	if err = json.Unmarshal(data, &res); err != nil {
+		return domain.EmbeddingResponse{}, fmt.Errorf("解析 %s 的响应失败，状态码 %d：%w", e.provider, resp.StatusCode, err)
+	}
+	if res.Error != nil {
+		return domain.EmbeddingResponse{}, fmt.Errorf("%s 返回错误，状态码 %d：%s", e.provider, resp.StatusCode, res.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return domain.EmbeddingResponse{}, fmt.Errorf("%s 返回错误，状态码 %d", e.provider, resp.StatusCode)
+	}
+	if len(res.Data) != len(input) {
+		return domain.EmbeddingResponse{}, fmt.Errorf("%s 返回了 %d 个向量，请求的是 %d 个", e.provider, len(res.Data), len(input))
+	}
+
+	// 接口不保证按照输入的顺序返回
+	slices.SortFunc(res.Data, func(a, b embeddingData) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	vectors := make([][]float32, 0, len(res.Data))
+	for i, item := range res.Data {
+		if item.Index != i {
+			return domain.EmbeddingResponse{}, fmt.Errorf("%s 返回的向量序号不连续", e.provider)
+		}
+		if e.dimensions > 0 && len(item.Embedding) != e.dimensions {
+			return domain.EmbeddingResponse{}, fmt.Errorf("%s 返回的向量是 %d 维，配置的是 %d 维", e.provider, len(item.Embedding), e.dimensions)
+		}
+		vectors = append(vectors, item.Embedding)
+	}
+	return domain.EmbeddingResponse{
+		Model:   cmp.Or(res.Model, e.model),
+		Vectors: vectors,
+		Usage: domain.Usage{
+			PromptTokens: res.Usage.PromptTokens,
+			TotalTokens:  res.Usage.TotalTokens,
+		},
+	}, nil
+}
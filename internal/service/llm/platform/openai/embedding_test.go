@@ -0,0 +1,96 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedder_Embed(t *testing.T) {
+	testCases := []struct {
+		name       string
+		dimensions int
+		status     int
+		body       string
+		want       domain.EmbeddingResponse
+		wantErr    string
+	}{
+		{
+			name:       "按照序号排列",
+			dimensions: 2,
+			status:     http.StatusOK,
+			body: `{"model": "text-embedding-3-small", "data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}],
+				"usage": {"prompt_tokens": 3, "total_tokens": 3}}`,
+			want: domain.EmbeddingResponse{
+				Model:   "text-embedding-3-small",
+				Vectors: [][]float32{{1, 0}, {0, 1}},
+				Usage:   domain.Usage{PromptTokens: 3, TotalTokens: 3},
+			},
+		},
+		{
+			name:       "平台返回错误",
+			dimensions: 2,
+			status:     http.StatusUnauthorized,
+			body:       `{"error": {"message": "invalid api key"}}`,
+			wantErr:    "openai 返回错误，状态码 401：invalid api key",
+		},
+		{
+			name:       "向量的数量不对",
+			dimensions: 2,
+			status:     http.StatusOK,
+			body:       `{"data": [{"index": 0, "embedding": [1, 0]}]}`,
+			wantErr:    "openai 返回了 1 个向量，请求的是 2 个",
+		},
+		{
+			name:       "向量的维度不对",
+			dimensions: 3,
+			status:     http.StatusOK,
+			body:       `{"data": [{"index": 0, "embedding": [1, 0]}, {"index": 1, "embedding": [0, 1]}]}`,
+			wantErr:    "openai 返回的向量是 2 维，配置的是 3 维",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/embeddings", r.URL.Path)
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				var req embeddingRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "text-embedding-3-small", req.Model)
+				assert.Equal(t, []string{"hello", "world"}, req.Input)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			embedder := NewEmbedder(server.URL+"/v1/", "token", "text-embedding-3-small", tc.dimensions)
+			resp, err := embedder.Embed(context.Background(), []string{"hello", "world"})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, resp)
+		})
+	}
+}
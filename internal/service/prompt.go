@@ -16,11 +16,18 @@ package service
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 )
 
+const (
+	defaultPromptPageSize = 20
+	maxPromptPageSize     = 100
+)
+
 type PromptService struct {
 	repo *repository.PromptRepo
 }
@@ -37,6 +44,22 @@ func (s *PromptService) Get(ctx context.Context, id int64) (domain.Prompt, error
 	return s.repo.Get(ctx, id)
 }
 
+// List 查询 prompt 列表，Limit 不合法的时候使用默认值
+func (s *PromptService) List(ctx context.Context, q domain.PromptQuery) (domain.PromptPage, error) {
+	switch q.SortBy {
+	case "":
+		q.SortBy = "utime"
+	case "id", "ctime", "utime":
+	default:
+		return domain.PromptPage{}, fmt.Errorf("%w: 不支持的排序字段 %s", errs.ErrInvalidParam, q.SortBy)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultPromptPageSize
+	}
+	q.Limit = min(q.Limit, maxPromptPageSize)
+	return s.repo.List(ctx, q)
+}
+
 func (s *PromptService) Delete(ctx context.Context, id int64) error {
 	return s.repo.Delete(ctx, id)
 }
@@ -57,6 +80,38 @@ func (s *PromptService) Publish(ctx context.Context, versionID int64, label stri
 	return s.repo.UpdateActiveVersion(ctx, versionID, label)
 }
 
+// PublishWeights 按照权重同时发布多个版本，用于 A/B 测试
+func (s *PromptService) PublishWeights(ctx context.Context, promptID int64, weights map[int64]int) error {
+	total := 0
+	for _, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("%w: 权重不能为负数", errs.ErrInvalidParam)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: 权重之和必须大于 0", errs.ErrInvalidParam)
+	}
+	return s.repo.UpdateWeights(ctx, promptID, weights)
+}
+
+// Pick 为 key（用户或者对话）选出本次要使用的版本
+func (s *PromptService) Pick(ctx context.Context, promptID int64, key string) (domain.PromptVersion, error) {
+	prompt, err := s.repo.Get(ctx, promptID)
+	if err != nil {
+		return domain.PromptVersion{}, err
+	}
+	version, ok := prompt.Pick(key)
+	if !ok {
+		return domain.PromptVersion{}, fmt.Errorf("prompt %d 没有可用的版本", promptID)
+	}
+	return version, nil
+}
+
+func (s *PromptService) Stats(ctx context.Context, promptID int64) ([]domain.PromptVersionStats, error) {
+	return s.repo.VersionStats(ctx, promptID)
+}
+
 func (s *PromptService) Fork(ctx context.Context, versionID int64) error {
 	prompt, err := s.repo.GetByVersionID(ctx, versionID)
 	if err != nil {
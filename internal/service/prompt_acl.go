@@ -0,0 +1,144 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+)
+
+// PromptACLService 负责 prompt 的权限。
+// 个人 prompt 的 owner 永远是 publisher。组织的 prompt 的 owner 是组织 ID，和用户 ID 不是同一个空间，
+// 组织内的授权对组织下所有的 prompt 生效，组织的管理员也是通过组织内的 publisher 授权来表达的。
+// 单个 prompt 上的授权只对这个 prompt 生效，最终的角色取两者中较大的那个。
+type PromptACLService struct {
+	repo   *repository.PromptACLRepo
+	prompt *repository.PromptRepo
+}
+
+func NewPromptACLService(repo *repository.PromptACLRepo, prompt *repository.PromptRepo) *PromptACLService {
+	return &PromptACLService{repo: repo, prompt: prompt}
+}
+
+// Check 检查 uid 在 prompt 上是否至少拥有 need 角色
+func (s *PromptACLService) Check(ctx context.Context, uid int64, promptID int64, need domain.PromptRole) error {
+	prompt, err := s.prompt.Get(ctx, promptID)
+	if err != nil {
+		return err
+	}
+	return s.check(ctx, uid, prompt, need)
+}
+
+// CheckVersion 和 Check 一样，只不过是通过版本找到 prompt
+func (s *PromptACLService) CheckVersion(ctx context.Context, uid int64, versionID int64, need domain.PromptRole) error {
+	prompt, err := s.prompt.GetByVersionID(ctx, versionID)
+	if err != nil {
+		return err
+	}
+	return s.Check(ctx, uid, prompt.ID, need)
+}
+
+// CheckOrganization 检查 uid 在组织内是否至少拥有 need 角色
+func (s *PromptACLService) CheckOrganization(ctx context.Context, uid int64, orgID int64, need domain.PromptRole) error {
+	role, err := s.organizationRole(ctx, uid, orgID)
+	if err != nil {
+		return err
+	}
+	return allow(role, need)
+}
+
+// Role 计算 uid 在 prompt 上最终的角色
+func (s *PromptACLService) Role(ctx context.Context, uid int64, prompt domain.Prompt) (domain.PromptRole, error) {
+	if prompt.OwnerType == domain.OwnerTypePersonal && prompt.Owner == uid {
+		return domain.PromptRolePublisher, nil
+	}
+	role, err := s.repo.Role(ctx, domain.ACLScopePrompt, prompt.ID, uid)
+	if err != nil {
+		return domain.PromptRoleNone, err
+	}
+	if prompt.OwnerType != domain.OwnerTypeOrganization {
+		return role, nil
+	}
+	orgRole, err := s.organizationRole(ctx, uid, prompt.Owner)
+	if err != nil {
+		return domain.PromptRoleNone, err
+	}
+	return max(role, orgRole), nil
+}
+
+// Grant 授权，operator 必须是对应范围内的 publisher
+func (s *PromptACLService) Grant(ctx context.Context, operator int64, acl domain.PromptACL) error {
+	if acl.Role == domain.PromptRoleNone || acl.Uid <= 0 {
+		return fmt.Errorf("%w: 非法的授权", errs.ErrInvalidParam)
+	}
+	if err := s.checkScope(ctx, operator, acl.Scope, acl.ScopeID, domain.PromptRolePublisher); err != nil {
+		return err
+	}
+	return s.repo.Save(ctx, acl)
+}
+
+// Revoke 撤销授权，operator 必须是对应范围内的 publisher
+func (s *PromptACLService) Revoke(ctx context.Context, operator int64, scope domain.ACLScope, scopeID int64, uid int64) error {
+	if err := s.checkScope(ctx, operator, scope, scopeID, domain.PromptRolePublisher); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, scope, scopeID, uid)
+}
+
+// List 查询某个范围内的全部授权，operator 至少需要是 viewer
+func (s *PromptACLService) List(ctx context.Context, operator int64, scope domain.ACLScope, scopeID int64) ([]domain.PromptACL, error) {
+	if err := s.checkScope(ctx, operator, scope, scopeID, domain.PromptRoleViewer); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, scope, scopeID)
+}
+
+func (s *PromptACLService) checkScope(ctx context.Context, uid int64, scope domain.ACLScope, scopeID int64, need domain.PromptRole) error {
+	switch scope {
+	case domain.ACLScopePrompt:
+		return s.Check(ctx, uid, scopeID, need)
+	case domain.ACLScopeOrganization:
+		return s.CheckOrganization(ctx, uid, scopeID, need)
+	default:
+		return fmt.Errorf("%w: 未知的授权范围 %s", errs.ErrInvalidParam, scope)
+	}
+}
+
+func (s *PromptACLService) check(ctx context.Context, uid int64, prompt domain.Prompt, need domain.PromptRole) error {
+	if prompt.ID == 0 {
+		return fmt.Errorf("%w: prompt 不存在", errs.ErrInvalidParam)
+	}
+	role, err := s.Role(ctx, uid, prompt)
+	if err != nil {
+		return err
+	}
+	return allow(role, need)
+}
+
+// organizationRole 只看组织内的授权，组织的第一个 publisher 需要在创建组织的时候写入
+func (s *PromptACLService) organizationRole(ctx context.Context, uid int64, orgID int64) (domain.PromptRole, error) {
+	return s.repo.Role(ctx, domain.ACLScopeOrganization, orgID, uid)
+}
+
+func allow(role domain.PromptRole, need domain.PromptRole) error {
+	if role.Allow(need) {
+		return nil
+	}
+	return fmt.Errorf("%w: 需要 %s 角色，当前是 %s", errs.ErrPermissionDenied, need, role)
+}
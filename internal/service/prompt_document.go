@@ -0,0 +1,240 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ekit/slice"
+	"gopkg.in/yaml.v3"
+)
+
+// PromptDocumentVersion 导出文件的格式版本，格式不兼容的时候需要升级
+const PromptDocumentVersion = "v1"
+
+// PromptDocument 可移植的 prompt 文件，不包含 ID 和 owner，导入的时候按照名字和 owner 匹配
+type PromptDocument struct {
+	Version     string                  `json:"version" yaml:"version"`
+	Name        string                  `json:"name" yaml:"name"`
+	Description string                  `json:"description,omitempty" yaml:"description,omitempty"`
+	OwnerType   string                  `json:"owner_type" yaml:"owner_type"`
+	Versions    []PromptVersionDocument `json:"versions" yaml:"versions"`
+}
+
+// PromptVersionDocument 有 label 的版本按照 label 匹配，否则按照内容匹配
+type PromptVersionDocument struct {
+	Label         string  `json:"label,omitempty" yaml:"label,omitempty"`
+	Content       string  `json:"content" yaml:"content"`
+	SystemContent string  `json:"system_content,omitempty" yaml:"system_content,omitempty"`
+	Temperature   float32 `json:"temperature" yaml:"temperature"`
+	TopN          float32 `json:"top_n" yaml:"top_n"`
+	MaxTokens     int     `json:"max_tokens" yaml:"max_tokens"`
+	Weight        int     `json:"weight,omitempty" yaml:"weight,omitempty"`
+	// 是否是发布版本，最多只能有一个
+	Active bool `json:"active,omitempty" yaml:"active,omitempty"`
+}
+
+// MarshalPromptDocument 支持 json 和 yaml 两种格式
+func MarshalPromptDocument(doc PromptDocument, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(doc, "", "  ")
+	case "yaml", "yml":
+		return yaml.Marshal(doc)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的格式 %s", errs.ErrInvalidParam, format)
+	}
+}
+
+func UnmarshalPromptDocument(data []byte, format string) (PromptDocument, error) {
+	var (
+		doc PromptDocument
+		err error
+	)
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &doc)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return doc, fmt.Errorf("%w: 不支持的格式 %s", errs.ErrInvalidParam, format)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("%w: 解析文件失败 %s", errs.ErrInvalidParam, err)
+	}
+	return doc, nil
+}
+
+// Export 导出 prompt 以及所有没有删除的版本
+func (s *PromptService) Export(ctx context.Context, id int64) (PromptDocument, error) {
+	prompt, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return PromptDocument{}, err
+	}
+	if prompt.ID == 0 || prompt.Status == 0 {
+		return PromptDocument{}, fmt.Errorf("%w: prompt 不存在", errs.ErrInvalidParam)
+	}
+	versions := slice.FilterMap(prompt.Versions, func(idx int, src domain.PromptVersion) (PromptVersionDocument, bool) {
+		return PromptVersionDocument{
+			Label:         src.Label,
+			Content:       src.Content,
+			SystemContent: src.SystemContent,
+			Temperature:   src.Temperature,
+			TopN:          src.TopN,
+			MaxTokens:     src.MaxTokens,
+			Weight:        src.Weight,
+			Active:        src.ID == prompt.ActiveVersion,
+		}, src.Status != 0
+	})
+	return PromptDocument{
+		Version:     PromptDocumentVersion,
+		Name:        prompt.Name,
+		Description: prompt.Description,
+		OwnerType:   prompt.OwnerType.String(),
+		Versions:    versions,
+	}, nil
+}
+
+// Import 把 doc 导入到 owner 名下，同名的 prompt 已经存在的时候更新，否则新建。
+// 重复导入同一个文件不会产生任何修改，文件里面没有的版本会保留。dryRun 为 true 的时候只返回将要执行的操作
+func (s *PromptService) Import(ctx context.Context, doc PromptDocument, owner int64, dryRun bool) (domain.PromptImportResult, error) {
+	if err := s.validateDocument(&doc); err != nil {
+		return domain.PromptImportResult{}, err
+	}
+	existing, err := s.repo.FindByName(ctx, owner, domain.OwnerType(doc.OwnerType), doc.Name)
+	if err != nil {
+		return domain.PromptImportResult{}, err
+	}
+	res := domain.PromptImportResult{
+		PromptID: existing.ID,
+		Name:     doc.Name,
+		Action:   domain.PromptImportUnchanged,
+	}
+	if existing.ID == 0 {
+		res.Action = domain.PromptImportCreate
+	} else if existing.Description != doc.Description {
+		res.Action = domain.PromptImportUpdate
+	}
+
+	prompt := domain.Prompt{
+		ID:            existing.ID,
+		Name:          doc.Name,
+		Owner:         owner,
+		OwnerType:     domain.OwnerType(doc.OwnerType),
+		Description:   doc.Description,
+		ActiveVersion: existing.ActiveVersion,
+	}
+	active := -1
+	used := make(map[int64]bool, len(existing.Versions))
+	for _, v := range doc.Versions {
+		version := domain.PromptVersion{
+			Label:         v.Label,
+			Content:       v.Content,
+			SystemContent: v.SystemContent,
+			Temperature:   v.Temperature,
+			TopN:          v.TopN,
+			MaxTokens:     v.MaxTokens,
+			Weight:        v.Weight,
+		}
+		action := domain.PromptImportCreate
+		if old, ok := matchVersion(existing.Versions, used, v); ok {
+			used[old.ID] = true
+			version.ID = old.ID
+			action = domain.PromptImportUnchanged
+			if !sameVersion(old, version) {
+				action = domain.PromptImportUpdate
+			}
+		}
+		res.Versions = append(res.Versions, domain.PromptVersionImportResult{Label: v.Label, Action: action})
+		if action != domain.PromptImportUnchanged {
+			prompt.Versions = append(prompt.Versions, version)
+		}
+		if !v.Active {
+			continue
+		}
+		if action != domain.PromptImportUnchanged {
+			active = len(prompt.Versions) - 1
+		} else {
+			prompt.ActiveVersion = version.ID
+		}
+	}
+	if len(prompt.Versions) > 0 || prompt.ActiveVersion != existing.ActiveVersion {
+		if res.Action == domain.PromptImportUnchanged {
+			res.Action = domain.PromptImportUpdate
+		}
+	}
+	if dryRun || res.Action == domain.PromptImportUnchanged {
+		return res, nil
+	}
+	res.PromptID, err = s.repo.Save(ctx, prompt, active)
+	return res, err
+}
+
+func (s *PromptService) validateDocument(doc *PromptDocument) error {
+	if doc.Version != PromptDocumentVersion {
+		return fmt.Errorf("%w: 不支持的文件版本 %q", errs.ErrInvalidParam, doc.Version)
+	}
+	if doc.Name == "" || len(doc.Versions) == 0 {
+		return fmt.Errorf("%w: 名字和版本不能为空", errs.ErrInvalidParam)
+	}
+	if doc.OwnerType == "" {
+		doc.OwnerType = domain.OwnerTypePersonal.String()
+	}
+	if doc.OwnerType != domain.OwnerTypePersonal.String() && doc.OwnerType != domain.OwnerTypeOrganization.String() {
+		return fmt.Errorf("%w: 未知的 owner_type %s", errs.ErrInvalidParam, doc.OwnerType)
+	}
+	actives, labels := 0, make(map[string]bool, len(doc.Versions))
+	for _, v := range doc.Versions {
+		if v.Active {
+			actives++
+		}
+		if v.Label == "" {
+			continue
+		}
+		if labels[v.Label] {
+			return fmt.Errorf("%w: 重复的 label %s", errs.ErrInvalidParam, v.Label)
+		}
+		labels[v.Label] = true
+	}
+	if actives > 1 {
+		return fmt.Errorf("%w: 最多只能有一个发布版本", errs.ErrInvalidParam)
+	}
+	return nil
+}
+
+// matchVersion 有 label 的按照 label 匹配，没有 label 的按照内容匹配
+func matchVersion(versions []domain.PromptVersion, used map[int64]bool, v PromptVersionDocument) (domain.PromptVersion, bool) {
+	for _, old := range versions {
+		if used[old.ID] {
+			continue
+		}
+		if v.Label != "" && old.Label == v.Label {
+			return old, true
+		}
+		if v.Label == "" && old.Label == "" && old.Content == v.Content && old.SystemContent == v.SystemContent {
+			return old, true
+		}
+	}
+	return domain.PromptVersion{}, false
+}
+
+func sameVersion(a, b domain.PromptVersion) bool {
+	return a.Label == b.Label && a.Content == b.Content && a.SystemContent == b.SystemContent &&
+		a.Temperature == b.Temperature && a.TopN == b.TopN && a.MaxTokens == b.MaxTokens && a.Weight == b.Weight
+}
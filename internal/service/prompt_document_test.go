@@ -0,0 +1,158 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptDocument_Marshal(t *testing.T) {
+	doc := PromptDocument{
+		Version:     PromptDocumentVersion,
+		Name:        "翻译",
+		Description: "中英互译",
+		OwnerType:   "personal",
+		Versions: []PromptVersionDocument{
+			{Label: "v1", Content: "翻译 {{text}}", Temperature: 0.5, TopN: 0.9, MaxTokens: 100, Active: true},
+			{Content: "把 {{text}} 翻译成英文", SystemContent: "你是翻译", Weight: 10},
+		},
+	}
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := MarshalPromptDocument(doc, format)
+			require.NoError(t, err)
+			res, err := UnmarshalPromptDocument(data, format)
+			require.NoError(t, err)
+			assert.Equal(t, doc, res)
+		})
+	}
+	_, err := MarshalPromptDocument(doc, "xml")
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	_, err = UnmarshalPromptDocument([]byte("{"), "json")
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+}
+
+func TestPromptService_validateDocument(t *testing.T) {
+	testCases := []struct {
+		name    string
+		doc     PromptDocument
+		wantErr error
+	}{
+		{
+			name: "默认是个人的",
+			doc: PromptDocument{
+				Version:  PromptDocumentVersion,
+				Name:     "test",
+				Versions: []PromptVersionDocument{{Content: "test"}},
+			},
+		},
+		{
+			name: "不支持的文件版本",
+			doc: PromptDocument{
+				Version:  "v0",
+				Name:     "test",
+				Versions: []PromptVersionDocument{{Content: "test"}},
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name: "没有版本",
+			doc: PromptDocument{
+				Version: PromptDocumentVersion,
+				Name:    "test",
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name: "重复的 label",
+			doc: PromptDocument{
+				Version:  PromptDocumentVersion,
+				Name:     "test",
+				Versions: []PromptVersionDocument{{Label: "v1"}, {Label: "v1"}},
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name: "多个发布版本",
+			doc: PromptDocument{
+				Version:  PromptDocumentVersion,
+				Name:     "test",
+				Versions: []PromptVersionDocument{{Label: "v1", Active: true}, {Label: "v2", Active: true}},
+			},
+			wantErr: errs.ErrInvalidParam,
+		},
+	}
+	svc := &PromptService{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := svc.validateDocument(&tc.doc)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err == nil {
+				assert.Equal(t, domain.OwnerTypePersonal.String(), tc.doc.OwnerType)
+			}
+		})
+	}
+}
+
+func TestMatchVersion(t *testing.T) {
+	versions := []domain.PromptVersion{
+		{ID: 1, Label: "v1", Content: "a"},
+		{ID: 2, Content: "b", SystemContent: "s"},
+		{ID: 3, Content: "b", SystemContent: "s"},
+	}
+	testCases := []struct {
+		name   string
+		used   map[int64]bool
+		doc    PromptVersionDocument
+		wantID int64
+		wantOk bool
+	}{
+		{
+			name:   "按照 label 匹配",
+			doc:    PromptVersionDocument{Label: "v1", Content: "changed"},
+			wantID: 1,
+			wantOk: true,
+		},
+		{
+			name:   "没有 label 按照内容匹配",
+			doc:    PromptVersionDocument{Content: "b", SystemContent: "s"},
+			wantID: 2,
+			wantOk: true,
+		},
+		{
+			name:   "已经匹配过的版本跳过",
+			used:   map[int64]bool{2: true},
+			doc:    PromptVersionDocument{Content: "b", SystemContent: "s"},
+			wantID: 3,
+			wantOk: true,
+		},
+		{
+			name: "内容不同",
+			doc:  PromptVersionDocument{Content: "a"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := matchVersion(versions, tc.used, tc.doc)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantID, v.ID)
+		})
+	}
+}
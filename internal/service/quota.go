@@ -48,3 +48,13 @@ func (q *QuotaService) GetQuota(ctx context.Context, uid int64) (domain.Quota, e
 func (q *QuotaService) Deduct(ctx context.Context, uid int64, amount int64, key string) error {
 	return q.repo.Deduct(ctx, uid, amount, key)
 }
+
+// GetRecord 查询 key 对应的扣费记录，用于判断重复的扣费是不是同一笔消耗
+func (q *QuotaService) GetRecord(ctx context.Context, key string) (domain.Record, error) {
+	return q.repo.GetRecord(ctx, key)
+}
+
+// Balance 主额度和临时额度的总和
+func (q *QuotaService) Balance(ctx context.Context, uid int64) (int64, error) {
+	return q.repo.Balance(ctx, uid)
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	// MySQL 的 ngram 分词默认是两个字一组，一个字搜不出来
+	minKeywordLength = 2
+	maxKeywordLength = 50
+)
+
+// ConversationSearcher 搜索对话的实现，默认使用 MySQL 全文索引
+type ConversationSearcher interface {
+	Search(ctx context.Context, q domain.ConversationSearchQuery) ([]domain.ConversationSearchResult, error)
+}
+
+// WithSearcher 替换默认的搜索实现
+func WithSearcher(searcher ConversationSearcher) ConversationOption {
+	return func(c *ConversationService) {
+		c.searcher = searcher
+	}
+}
+
+// Search 在用户自己的对话里面搜索标题和消息内容
+func (c *ConversationService) Search(ctx context.Context, q domain.ConversationSearchQuery) ([]domain.ConversationSearchResult, error) {
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	length := utf8.RuneCountInString(q.Keyword)
+	if length < minKeywordLength || length > maxKeywordLength {
+		return nil, fmt.Errorf("%w: 关键字的长度需要在 %d 到 %d 之间", errs.ErrInvalidParam, minKeywordLength, maxKeywordLength)
+	}
+	if q.Uid == "" {
+		return nil, fmt.Errorf("%w: 缺少 uid", errs.ErrInvalidParam)
+	}
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultSearchLimit
+	case q.Limit > maxSearchLimit:
+		q.Limit = maxSearchLimit
+	}
+	return c.searcher.Search(ctx, q)
+}
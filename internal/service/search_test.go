@@ -0,0 +1,93 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationService_Search(t *testing.T) {
+	searcher := repository.NewMemoryConversationSearcher()
+	searcher.Save(domain.Conversation{
+		Sn: "a", Uid: "1", Title: "Redis 缓存设计", Utime: 100,
+		Messages: []domain.Message{
+			{ID: 1, Role: domain.USER, Content: "缓存穿透怎么处理"},
+			{ID: 2, Role: domain.ASSISTANT, Content: "可以缓存空值"},
+		},
+	})
+	searcher.Save(domain.Conversation{
+		Sn: "b", Uid: "1", Title: "周末计划", Utime: 200,
+		Messages: []domain.Message{{ID: 3, Role: domain.USER, Content: "要不要给博客加个缓存"}},
+	})
+	searcher.Save(domain.Conversation{
+		Sn: "c", Uid: "2", Title: "别人的缓存",
+		Messages: []domain.Message{{ID: 4, Role: domain.USER, Content: "缓存"}},
+	})
+	svc := NewConversationService(nil, nil, nil, nil, nil, nil, nil, WithSearcher(searcher))
+
+	testCases := []struct {
+		name    string
+		q       domain.ConversationSearchQuery
+		want    []domain.ConversationSearchResult
+		wantErr error
+	}{
+		{
+			name: "标题和消息",
+			q:    domain.ConversationSearchQuery{Uid: "1", Keyword: "缓存"},
+			want: []domain.ConversationSearchResult{
+				{
+					Sn: "b", Title: "周末计划", Utime: 200,
+					Matches: []domain.MessageMatch{{MessageID: 3, Role: domain.USER, Snippet: "要不要给博客加个<em>缓存</em>"}},
+				},
+				{
+					Sn: "a", Title: "Redis 缓存设计", TitleHighlight: "Redis <em>缓存</em>设计", Utime: 100,
+					Matches: []domain.MessageMatch{
+						{MessageID: 2, Role: domain.ASSISTANT, Snippet: "可以<em>缓存</em>空值"},
+						{MessageID: 1, Role: domain.USER, Snippet: "<em>缓存</em>穿透怎么处理"},
+					},
+				},
+			},
+		},
+		{
+			name: "只命中标题",
+			q:    domain.ConversationSearchQuery{Uid: "1", Keyword: "redis", Limit: 1},
+			want: []domain.ConversationSearchResult{
+				{Sn: "a", Title: "Redis 缓存设计", TitleHighlight: "<em>Redis</em> 缓存设计", Utime: 100},
+			},
+		},
+		{
+			name:    "关键字太短",
+			q:       domain.ConversationSearchQuery{Uid: "1", Keyword: " 缓 "},
+			wantErr: errs.ErrInvalidParam,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := svc.Search(context.Background(), tc.q)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			require.Equal(t, tc.want, res)
+		})
+	}
+}
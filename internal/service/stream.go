@@ -0,0 +1,277 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+const (
+	// 客户端断开之后生成还会继续，需要一个上限
+	maxGenerateDuration = 10 * time.Minute
+	// 接收新的事件的时候每次最多等待的时间
+	streamBlockDuration = 5 * time.Second
+	// 超过这个时间没有新的事件，认为生成的实例已经挂了，消息会一直停留在生成中
+	defaultStreamIdleTimeout = time.Minute
+)
+
+var (
+	// errGenerationCancelled 用户主动取消生成
+	errGenerationCancelled = errors.New("用户取消了生成")
+	errStreamIdle          = errors.New("长时间没有新的内容，生成可能已经中断")
+)
+
+// WithStreamIdleTimeout 续传的时候超过 timeout 没有新的事件就结束，并且返回错误
+func WithStreamIdleTimeout(timeout time.Duration) ConversationOption {
+	return func(c *ConversationService) {
+		c.streamIdleTimeout = timeout
+	}
+}
+
+// generation 一次流式生成
+type generation struct {
+	sn    string
+	reply domain.Message
+	start time.Time
+	// 发给模型的消息，取消的时候用来估算消耗的 token
+	prompt []domain.Message
+	// 这一轮用户发送的消息，用于生成标题
+	exchange []domain.Message
+}
+
+// generate 消费模型返回的事件，每个事件都写入 Redis Stream，客户端还连着的时候同时推送给客户端。
+// 无论客户端是否断开，结束的时候都会保存完整的消息
+func (c *ConversationService) generate(ctx context.Context, client context.Context, g generation,
+	events <-chan domain.StreamEvent, ch chan<- domain.StreamEvent) {
+	var content, reasoningContent strings.Builder
+	var usage domain.Usage
+	var seq int64
+	reply := g.reply
+	emit := func(e domain.StreamEvent) {
+		seq++
+		e.MessageID, e.Seq = reply.ID, seq
+		if err := c.repo.AddStreamEvent(context.WithoutCancel(ctx), e); err != nil {
+			elog.Error("写入流式事件失败", elog.Int64("message", reply.ID), elog.FieldErr(err))
+		}
+		// 客户端断开之后就不再推送了
+		select {
+		case ch <- e:
+		case <-client.Done():
+		}
+	}
+
+	var genErr error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			genErr = context.Cause(ctx)
+			break loop
+		case value, ok := <-events:
+			if value.Usage.TotalTokens > 0 {
+				usage = value.Usage
+			}
+			if !ok || value.Done {
+				break loop
+			}
+			if value.Error != nil {
+				genErr = value.Error
+				break loop
+			}
+			reasoningContent.WriteString(value.ReasoningContent)
+			content.WriteString(value.Content)
+			emit(domain.StreamEvent{Content: value.Content, ReasoningContent: value.ReasoningContent})
+		}
+	}
+
+	reply.Content = content.String()
+	reply.ReasoningContent = reasoningContent.String()
+	reply.Latency = time.Since(g.start).Milliseconds()
+	cancelled := errors.Is(genErr, errGenerationCancelled)
+	switch {
+	case cancelled:
+		reply.Status = domain.MessageStatusCancelled
+		// 取消之后模型不会再返回用量，只按照已经生成的内容计算
+		usage = c.estimateUsage(g.prompt, reply)
+	case genErr != nil:
+		reply.Status = domain.MessageStatusFailed
+	default:
+		reply.Status = domain.MessageStatusCompleted
+	}
+	reply.Tokens = usage.TotalTokens
+	// 生成可能是被取消的，保存的时候不能再用这个 ctx
+	saveCtx := context.WithoutCancel(ctx)
+	// 先保存再通知结束，客户端收到结束事件之后就能查到完整的消息
+	if err := c.repo.FinishMessage(saveCtx, g.sn, reply); err != nil {
+		elog.Error("写入数据库失败", elog.Int64("message", reply.ID), elog.FieldErr(err))
+	} else if genErr == nil {
+		c.autoTitle(saveCtx, g.sn, append(slices.Clip(g.exchange), reply))
+	}
+	if cancelled {
+		c.billCancelled(saveCtx, g.sn, reply.ID, usage)
+	}
+	if genErr != nil && !cancelled {
+		emit(domain.StreamEvent{Error: genErr})
+	}
+	emit(domain.StreamEvent{Done: true, Cancelled: cancelled, Usage: usage})
+}
+
+// billCancelled 取消之后调用方拿不到模型返回的用量，所以按照估算的用量扣费，key 由消息 ID 生成
+func (c *ConversationService) billCancelled(ctx context.Context, sn string, messageID int64, usage domain.Usage) {
+	conversation, err := c.repo.GetBySn(ctx, sn)
+	if err != nil {
+		elog.Error("读取对话失败，无法对取消的生成计费", elog.String("sn", sn), elog.FieldErr(err))
+		return
+	}
+	c.bill(ctx, conversation, usage, fmt.Sprintf("conversation:message:%d", messageID))
+}
+
+// Cancel 停止生成，只能停止自己的对话里面的生成。
+// 生成可能在别的实例上，所以本地找不到的时候通过 Redis 通知所有的实例
+func (c *ConversationService) Cancel(ctx context.Context, uid string, messageID int64) error {
+	msg, _, err := c.ownedMessage(ctx, messageID, uid)
+	if err != nil {
+		return err
+	}
+	if msg.Role != domain.ASSISTANT {
+		return fmt.Errorf("%w: 消息 %d 不是模型的回答", errs.ErrInvalidParam, messageID)
+	}
+	// 已经生成完了
+	if msg.Status != domain.MessageStatusStreaming {
+		return nil
+	}
+	if c.cancelLocal(messageID) {
+		return nil
+	}
+	return c.repo.PublishCancel(ctx, messageID)
+}
+
+func (c *ConversationService) cancelLocal(messageID int64) bool {
+	val, ok := c.generating.Load(messageID)
+	if ok {
+		val.(context.CancelCauseFunc)(errGenerationCancelled)
+	}
+	return ok
+}
+
+// listenCancel 接收别的实例发过来的取消通知，订阅断开之后会重新订阅
+func (c *ConversationService) listenCancel() {
+	ctx := context.Background()
+	for {
+		ids, err := c.repo.SubscribeCancel(ctx)
+		if err != nil {
+			elog.Error("订阅取消生成的通知失败", elog.FieldErr(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		for id := range ids {
+			c.cancelLocal(id)
+		}
+	}
+}
+
+// estimateUsage 按照 ContextBuilder 的计算方式估算 token
+func (c *ConversationService) estimateUsage(prompt []domain.Message, reply domain.Message) domain.Usage {
+	usage := domain.Usage{
+		PromptTokens:     c.builder.count(prompt),
+		CompletionTokens: c.builder.count([]domain.Message{{Role: reply.Role, Content: reply.ReasoningContent + reply.Content}}),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// ResumeStream 只能续传 uid 自己的消息，先补发 lastSeq 之后的事件，然后继续接收新的事件，直到生成结束或者 ctx 结束。
+// 缓冲已经过期的时候返回保存下来的完整消息，这个事件的 Seq 为 0
+func (c *ConversationService) ResumeStream(ctx context.Context, uid string, messageID int64, lastSeq int64) (chan domain.StreamEvent, error) {
+	msg, _, err := c.ownedMessage(ctx, messageID, uid)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Role != domain.ASSISTANT {
+		return nil, fmt.Errorf("%w: 消息 %d 不是模型的回答", errs.ErrInvalidParam, messageID)
+	}
+	events, err := c.repo.ReadStreamEvents(ctx, messageID, lastSeq, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan domain.StreamEvent, 10)
+	if len(events) == 0 && msg.Status != domain.MessageStatusStreaming {
+		ch <- domain.StreamEvent{MessageID: messageID, Content: msg.Content, ReasoningContent: msg.ReasoningContent}
+		ch <- domain.StreamEvent{MessageID: messageID, Done: true}
+		return ch, nil
+	}
+	go c.tail(ctx, messageID, lastSeq, events, ch)
+	return ch, nil
+}
+
+// tail 持续接收新的事件，超过 streamIdleTimeout 没有新的事件的时候，
+// 如果消息已经结束了就返回保存下来的消息，否则返回 errStreamIdle
+func (c *ConversationService) tail(ctx context.Context, messageID int64, lastSeq int64,
+	events []domain.StreamEvent, ch chan<- domain.StreamEvent) {
+	send := func(e domain.StreamEvent) bool {
+		select {
+		case ch <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	block := min(streamBlockDuration, c.streamIdleTimeout)
+	active := time.Now()
+	for {
+		if len(events) > 0 {
+			active = time.Now()
+		}
+		for _, e := range events {
+			if !send(e) || e.Done {
+				return
+			}
+			lastSeq = e.Seq
+		}
+		if time.Since(active) >= c.streamIdleTimeout {
+			msg, _, err := c.repo.GetMessage(ctx, messageID)
+			switch {
+			case err != nil:
+				send(domain.StreamEvent{MessageID: messageID, Error: err})
+			case msg.Status != domain.MessageStatusStreaming:
+				// 生成结束了，但是结束事件已经不在缓冲里面了
+				if send(domain.StreamEvent{MessageID: messageID, Content: msg.Content, ReasoningContent: msg.ReasoningContent}) {
+					send(domain.StreamEvent{MessageID: messageID, Done: true})
+				}
+			default:
+				send(domain.StreamEvent{MessageID: messageID, Error: fmt.Errorf("%w: 消息 %d", errStreamIdle, messageID)})
+			}
+			return
+		}
+		var err error
+		events, err = c.repo.ReadStreamEvents(ctx, messageID, lastSeq, block)
+		if err != nil {
+			if ctx.Err() == nil {
+				send(domain.StreamEvent{MessageID: messageID, Error: err})
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+const summaryPrompt = `你负责压缩对话历史。请把已有的摘要和新的对话合并成一份新的摘要，
+保留用户的目标、重要的事实、已经得出的结论以及还没有解决的问题，不超过 500 字，只输出摘要本身。`
+
+// summarize 把被裁剪掉的消息合并到已有的摘要里面，并且保存下来。摘要消耗的 token 记在对话的 owner 名下
+func (c *ConversationService) summarize(ctx context.Context, conversation domain.Conversation, dropped []domain.Message) (string, error) {
+	var lastID int64
+	for _, msg := range dropped {
+		lastID = max(lastID, msg.ID)
+	}
+	// 旧的缓存里面没有消息 ID，没办法记录摘要覆盖到了哪里
+	if lastID == 0 {
+		return "", fmt.Errorf("被裁剪的消息没有 ID")
+	}
+
+	var sb strings.Builder
+	if conversation.Summary != "" {
+		sb.WriteString("已有摘要：\n")
+		sb.WriteString(conversation.Summary)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("新的对话：\n")
+	for _, msg := range dropped {
+		sb.WriteString(roleName(msg.Role))
+		sb.WriteString("：")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+	resp, err := c.handle.Handle(ctx, []domain.Message{
+		{Role: domain.SYSTEM, Content: summaryPrompt},
+		{Role: domain.USER, Content: sb.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(resp.Response.Content)
+	if err = c.repo.UpdateSummary(ctx, conversation.Sn, summary, lastID); err != nil {
+		return "", err
+	}
+	c.bill(ctx, conversation, resp.Usage, fmt.Sprintf("conversation:summary:%s:%d", conversation.Sn, lastID))
+	return summary, nil
+}
+
+// bill 扣减对话所属用户的额度，计费失败只记录日志，key 保证同一笔消耗不会被重复扣费
+func (c *ConversationService) bill(ctx context.Context, conversation domain.Conversation, usage domain.Usage, key string) {
+	if c.quota == nil || usage.TotalTokens == 0 {
+		return
+	}
+	uid, err := strconv.ParseInt(conversation.Uid, 10, 64)
+	if err != nil {
+		elog.Warn("对话的 uid 不合法，无法计费", elog.String("sn", conversation.Sn), elog.String("uid", conversation.Uid))
+		return
+	}
+	if err = c.quota.Deduct(ctx, uid, usage.TotalTokens, key); err != nil {
+		elog.Error("计费失败", elog.String("key", key), elog.Int64("tokens", usage.TotalTokens), elog.FieldErr(err))
+	}
+}
+
+func summaryMessage(summary string) domain.Message {
+	return domain.Message{Role: domain.SYSTEM, Content: "以下是之前对话的摘要：\n" + summary}
+}
+
+func roleName(role int32) string {
+	switch role {
+	case domain.USER:
+		return "用户"
+	case domain.ASSISTANT:
+		return "助手"
+	case domain.SYSTEM:
+		return "系统"
+	default:
+		return "其他"
+	}
+}
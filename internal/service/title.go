@@ -0,0 +1,146 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+const titlePrompt = `请根据下面的对话生成一个简短的标题，概括用户想做的事情，不超过 15 个字，
+不要使用标点符号和引号，只输出标题本身。`
+
+// 标题最多保留的字数，避免模型不听话返回一大段内容
+const maxTitleLength = 30
+
+type ConversationOption func(c *ConversationService)
+
+// WithTitleHandler 使用单独的模型生成标题，一般是更便宜更快的模型。默认使用对话的模型
+func WithTitleHandler(handler llm.Handler) ConversationOption {
+	return func(c *ConversationService) {
+		c.titleHandle = handler
+	}
+}
+
+// RegenerateTitle 根据最近的对话重新生成标题，不受 DisableAutoTitle 的影响，只能修改自己的对话
+func (c *ConversationService) RegenerateTitle(ctx context.Context, uid string, sn string) (domain.Conversation, error) {
+	conversation, err := c.ownedConversation(ctx, sn, uid)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	history, err := c.repo.GetHistoryMessageList(ctx, sn, 6, 0)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	title, err := c.generateTitle(ctx, conversation, history)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	conversation.Title = title
+	return conversation, nil
+}
+
+// Subscribe 订阅用户所有对话的事件，ctx 结束的时候 channel 会被关闭。
+// 事件是按照 uid 推送的，所以 uid 不能为空
+func (c *ConversationService) Subscribe(ctx context.Context, uid string) (<-chan domain.ConversationEvent, error) {
+	if uid == "" {
+		return nil, fmt.Errorf("%w: uid 不能为空", errs.ErrInvalidParam)
+	}
+	return c.repo.SubscribeEvents(ctx, uid)
+}
+
+// autoTitle 在第一轮对话完成之后异步生成标题，不阻塞对话的返回。
+// exchange 是已经保存的这一轮的问题和回答，第一条消息没有 parent 的时候才是第一轮对话
+func (c *ConversationService) autoTitle(ctx context.Context, sn string, exchange []domain.Message) {
+	if len(exchange) == 0 || exchange[0].ParentID != 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		conversation, err := c.repo.GetBySn(ctx, sn)
+		if err != nil {
+			elog.Error("读取对话失败，无法生成标题", elog.String("sn", sn), elog.FieldErr(err))
+			return
+		}
+		// 事件是按照 uid 推送的，找不到对话或者对话没有 owner 的时候不生成
+		if conversation.Uid == "" || conversation.Title != "" || conversation.DisableAutoTitle {
+			return
+		}
+		if _, err = c.generateTitle(ctx, conversation, exchange); err != nil {
+			elog.Error("生成对话标题失败", elog.String("sn", sn), elog.FieldErr(err))
+		}
+	}()
+}
+
+// generateTitle 调用模型生成标题，保存之后发出 title_updated 事件
+func (c *ConversationService) generateTitle(ctx context.Context, conversation domain.Conversation, messages []domain.Message) (string, error) {
+	var sb strings.Builder
+	for _, msg := range messages {
+		if msg.Role == domain.SYSTEM {
+			continue
+		}
+		sb.WriteString(roleName(msg.Role))
+		sb.WriteString("：")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+	resp, err := c.titleHandle.Handle(ctx, []domain.Message{
+		{Role: domain.SYSTEM, Content: titlePrompt},
+		{Role: domain.USER, Content: sb.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+	title := normalizeTitle(resp.Response.Content)
+	if title == "" {
+		return "", fmt.Errorf("模型返回的标题为空")
+	}
+	if err = c.repo.UpdateTitle(ctx, conversation.Sn, title); err != nil {
+		return "", err
+	}
+	if conversation.Uid != "" {
+		err = c.repo.PublishEvent(ctx, conversation.Uid, domain.ConversationEvent{
+			Type:  domain.ConversationEventTitleUpdated,
+			Sn:    conversation.Sn,
+			Title: title,
+		})
+		if err != nil {
+			// 标题已经保存了，客户端下次拉取列表的时候也能看到
+			elog.Warn("发送标题更新事件失败", elog.String("sn", conversation.Sn), elog.FieldErr(err))
+		}
+	}
+	return title, nil
+}
+
+// normalizeTitle 去掉模型经常附带的引号、换行和多余的内容
+func normalizeTitle(title string) string {
+	title = strings.TrimSpace(title)
+	if idx := strings.IndexByte(title, '\n'); idx >= 0 {
+		title = title[:idx]
+	}
+	title = strings.Trim(title, " \t\"'“”‘’《》「」。.")
+	title = strings.TrimPrefix(title, "标题：")
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+	return title
+}
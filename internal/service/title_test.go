@@ -0,0 +1,64 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	testCases := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{
+			name:  "去掉引号和空白",
+			title: "  “Go 并发入门”\n",
+			want:  "Go 并发入门",
+		},
+		{
+			name:  "只保留第一行",
+			title: "标题：数据库选型\n因为用户在问数据库",
+			want:  "数据库选型",
+		},
+		{
+			name:  "超长截断",
+			title: strings.Repeat("长", 40),
+			want:  strings.Repeat("长", maxTitleLength),
+		},
+		{
+			name:  "空标题",
+			title: " \"\" ",
+			want:  "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, normalizeTitle(tc.title))
+		})
+	}
+}
+
+func TestSubscribe_EmptyUid(t *testing.T) {
+	svc := &ConversationService{}
+	_, err := svc.Subscribe(context.Background(), "")
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+}
@@ -16,16 +16,27 @@ package test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	aiv1 "github.com/ecodeclub/ai-gateway-go/api/gen/ai/v1"
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/grpc"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/cache"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
 	"github.com/ecodeclub/ai-gateway-go/internal/test/mocks"
+	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -40,6 +51,7 @@ type ConversationSuite struct {
 	suite.Suite
 	db    *gorm.DB
 	cache redis.Cmdable
+	repo  *repository.ConversationRepo
 }
 
 func NewConversationSuite() *ConversationSuite {
@@ -69,8 +81,22 @@ func (c *ConversationSuite) SetupTest() {
 
 	err = dao.InitConversation(db)
 	require.NoError(c.T(), err)
+	err = dao.InitQuotaTable(db)
+	require.NoError(c.T(), err)
 	c.db = db
 	c.cache = rdb
+	c.repo = repository.NewConversationRepo(dao.NewConversationDao(db), cache.NewConversationCache(rdb))
+}
+
+// newService 每个测试的模型都不一样，其余的依赖都使用真实的实现
+func (c *ConversationSuite) newService(handler llm.Handler, opts ...service.ConversationOption) *service.ConversationService {
+	promptRepo := repository.NewPromptRepo(dao.NewPromptDAO(c.db))
+	promptService := service.NewPromptService(promptRepo)
+	promptACLService := service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(c.db)), promptRepo)
+	bizConfigService := service.NewBizConfigService(repository.NewBizConfigRepository(dao.NewBizConfigDAO(c.db)))
+	quotaService := service.NewQuotaService(repository.NewQuotaRepo(dao.NewQuotaDao(c.db)))
+	feedbackRepo := repository.NewFeedbackRepo(dao.NewFeedbackDAO(c.db))
+	return service.NewConversationService(c.repo, feedbackRepo, promptService, promptACLService, bizConfigService, quotaService, handler, opts...)
 }
 
 func (c *ConversationSuite) TearDownTest() {
@@ -78,17 +104,36 @@ func (c *ConversationSuite) TearDownTest() {
 	require.NoError(c.T(), err)
 	err = c.db.Exec("TRUNCATE TABLE conversations").Error
 	require.NoError(c.T(), err)
+	err = c.db.Exec("TRUNCATE TABLE conversation_shares").Error
+	require.NoError(c.T(), err)
+	err = c.db.Exec("TRUNCATE TABLE message_feedbacks").Error
+	require.NoError(c.T(), err)
+	err = c.db.Exec("TRUNCATE TABLE quotas").Error
+	require.NoError(c.T(), err)
+	err = c.db.Exec("TRUNCATE TABLE quota_records").Error
+	require.NoError(c.T(), err)
 }
 
 func (c *ConversationSuite) TestCreate() {
 	t := c.T()
+	require.NoError(t, dao.InitTable(c.db))
+	mine := dao.Prompt{Name: "自己的", Owner: 123, OwnerType: "personal"}
+	require.NoError(t, c.db.Create(&mine).Error)
+	others := dao.Prompt{Name: "别人的", Owner: 456, OwnerType: "personal"}
+	require.NoError(t, c.db.Create(&others).Error)
+	defer func() {
+		require.NoError(t, c.db.Delete(&dao.Prompt{}, []int64{mine.ID, others.ID}).Error)
+	}()
+
 	testcases := []struct {
-		name   string
-		before func()
-		after  func(sn string)
+		name    string
+		req     *aiv1.Conversation
+		after   func(sn string)
+		wantErr error
 	}{
 		{
 			name: "创建对应的 conversation",
+			req:  &aiv1.Conversation{Title: "test"},
 			after: func(sn string) {
 				var conversation dao.Conversation
 				err := c.db.Where("sn = ?", sn).First(&conversation).Error
@@ -96,20 +141,41 @@ func (c *ConversationSuite) TestCreate() {
 				assert.Equal(t, "test", conversation.Title)
 			},
 		},
+		{
+			name: "使用自己的 prompt",
+			req:  &aiv1.Conversation{Title: "test", Uid: "123", PromptId: mine.ID},
+			after: func(sn string) {
+				var conversation dao.Conversation
+				err := c.db.Where("sn = ?", sn).First(&conversation).Error
+				require.NoError(t, err)
+				assert.Equal(t, mine.ID, conversation.PromptID)
+			},
+		},
+		{
+			name:    "不能使用没有权限的 prompt",
+			req:     &aiv1.Conversation{Title: "test", Uid: "123", PromptId: others.ID},
+			wantErr: errs.ErrPermissionDenied,
+		},
+		{
+			name:    "uid 不合法的时候不能使用 prompt",
+			req:     &aiv1.Conversation{Title: "test", Uid: "abc", PromptId: mine.ID},
+			wantErr: errs.ErrPermissionDenied,
+		},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			conversationDao := dao.NewConversationDao(c.db)
-			conversationCache := cache.NewConversationCache(c.cache)
-			repo := repository.NewConversationRepo(conversationDao, conversationCache)
+			defer c.TearDownTest()
 			ctrl := gomock.NewController(t)
 			handler := mocks.NewMockHandler(ctrl)
-			conversationService := service.NewConversationService(repo, handler)
+			conversationService := c.newService(handler)
 			server := grpc.NewConversationServer(conversationService)
 
-			res, err := server.Create(context.Background(), &aiv1.Conversation{Title: "test"})
-			require.NoError(t, err)
+			res, err := server.Create(context.Background(), tc.req)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr != nil {
+				return
+			}
 			assert.NotEmpty(t, res.Sn)
 			tc.after(res.Sn)
 		})
@@ -137,12 +203,9 @@ func (c *ConversationSuite) TestGetList() {
 		t.Run(tc.name, func(t *testing.T) {
 			sn := uuid.New().String()
 			tc.before(sn)
-			conversationDao := dao.NewConversationDao(c.db)
-			conversationCache := cache.NewConversationCache(c.cache)
-			repo := repository.NewConversationRepo(conversationDao, conversationCache)
 			ctrl := gomock.NewController(t)
 			handler := mocks.NewMockHandler(ctrl)
-			conversationService := service.NewConversationService(repo, handler)
+			conversationService := c.newService(handler)
 			server := grpc.NewConversationServer(conversationService)
 			res, err := server.List(context.Background(), &aiv1.ListReq{Uid: "123", Offset: 0, Limit: 2})
 			require.NoError(t, err)
@@ -174,17 +237,107 @@ func (c *ConversationSuite) TestChat() {
 				assert.Equal(t, 3, len(messages))
 			},
 		},
+		{
+			name: "超出上下文的消息合并到摘要",
+			before: func(handler *mocks.MockHandler, sn string) {
+				err := c.db.Create(&dao.Conversation{
+					Title: "test1", Uid: "123", Sn: sn,
+					ContextConfig: `{"strategy":"last_n","last_n":2}`,
+				}).Error
+				require.NoError(t, err)
+				err = c.db.Create(&dao.Quota{UID: 123, Key: "conversation-summary", Amount: 10000}).Error
+				require.NoError(t, err)
+				err = c.db.Create([]dao.Message{
+					{Sn: sn, Role: domain.USER, Content: "old question"},
+					{Sn: sn, Role: domain.ASSISTANT, Content: "old answer"},
+				}).Error
+				require.NoError(t, err)
+				summary := handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+						assert.Contains(t, msgs[1].Content, "old question")
+						return domain.ChatResponse{
+							Response: domain.Message{Content: "summary"},
+							Usage:    domain.Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30},
+						}, nil
+					})
+				handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+						// 摘要作为系统消息放在最前面
+						assert.Equal(t, int32(domain.SYSTEM), msgs[0].Role)
+						assert.Contains(t, msgs[0].Content, "summary")
+						return domain.ChatResponse{Response: domain.Message{Content: "event1"}}, nil
+					}).After(summary)
+			},
+			after: func(sn string) {
+				var conversation dao.Conversation
+				err := c.db.Where("sn = ?", sn).First(&conversation).Error
+				require.NoError(t, err)
+				assert.Equal(t, "summary", conversation.Summary)
+				assert.Equal(t, int64(2), conversation.SummarizedID)
+				// 生成摘要消耗的 token 记在对话所属的用户上
+				var record dao.QuotaRecord
+				err = c.db.Where("`key` = ?", fmt.Sprintf("conversation:summary:%s:%d", sn, conversation.SummarizedID)).First(&record).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(123), record.Uid)
+				assert.Equal(t, int64(30), record.Amount)
+				var quota dao.Quota
+				require.NoError(t, c.db.Where("uid = ?", 123).First(&quota).Error)
+				assert.Equal(t, int64(10000-30), quota.Amount)
+			},
+		},
+		{
+			name: "第一轮对话之后自动生成标题",
+			before: func(handler *mocks.MockHandler, sn string) {
+				err := c.db.Create(&dao.Conversation{Uid: "123", Sn: sn}).Error
+				require.NoError(t, err)
+				chat := handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					Return(domain.ChatResponse{Response: domain.Message{Content: "event1"}}, nil)
+				handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+						assert.Contains(t, msgs[1].Content, "content2")
+						assert.Contains(t, msgs[1].Content, "event1")
+						return domain.ChatResponse{Response: domain.Message{Content: "“测试标题”"}}, nil
+					}).After(chat)
+			},
+			after: func(sn string) {
+				assert.Eventually(t, func() bool {
+					var conversation dao.Conversation
+					err := c.db.Where("sn = ?", sn).First(&conversation).Error
+					return err == nil && conversation.Title == "测试标题"
+				}, time.Second*3, time.Millisecond*100)
+			},
+		},
+		{
+			name: "不是第一轮对话的时候不生成标题",
+			before: func(handler *mocks.MockHandler, sn string) {
+				err := c.db.Create(&dao.Conversation{Uid: "123", Sn: sn}).Error
+				require.NoError(t, err)
+				_, err = c.repo.AddMessages(context.Background(), sn, []domain.Message{
+					{Role: domain.USER, Content: "old question"},
+					{Role: domain.ASSISTANT, Content: "old answer"},
+				})
+				require.NoError(t, err)
+				// 只会调用一次模型
+				handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					Return(domain.ChatResponse{Response: domain.Message{Content: "event1"}}, nil)
+			},
+			after: func(sn string) {
+				assert.Never(t, func() bool {
+					var conversation dao.Conversation
+					err := c.db.Where("sn = ?", sn).First(&conversation).Error
+					return err != nil || conversation.Title != ""
+				}, time.Millisecond*500, time.Millisecond*100)
+			},
+		},
 	}
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
+			defer c.TearDownTest()
 			sn := uuid.New().String()
-			conversationDao := dao.NewConversationDao(c.db)
-			conversationCache := cache.NewConversationCache(c.cache)
-			repo := repository.NewConversationRepo(conversationDao, conversationCache)
 			ctrl := gomock.NewController(t)
 			handler := mocks.NewMockHandler(ctrl)
-			conversationService := service.NewConversationService(repo, handler)
+			conversationService := c.newService(handler)
 			server := grpc.NewConversationServer(conversationService)
 
 			tc.before(handler, sn)
@@ -203,6 +356,52 @@ func (c *ConversationSuite) TestChat() {
 	}
 }
 
+func (c *ConversationSuite) TestRegenerateTitle() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+	err := c.db.Create(&dao.Conversation{Title: "旧标题", Uid: "123", Sn: sn, Utime: 100}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{Sn: sn, Role: domain.USER, Content: "怎么学 Go"},
+		{Sn: sn, Role: domain.ASSISTANT, Content: "先看官方教程"},
+	}).Error
+	require.NoError(t, err)
+
+	// 别人的对话和没有 uid 的请求都不会调用模型
+	_, err = server.RegenerateTitle(context.Background(), &aiv1.RegenerateTitleRequest{Sn: sn, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	_, err = server.RegenerateTitle(context.Background(), &aiv1.RegenerateTitleRequest{Sn: sn})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	_, err = conversationService.Subscribe(context.Background(), "")
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := conversationService.Subscribe(ctx, "123")
+	require.NoError(t, err)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+		Return(domain.ChatResponse{Response: domain.Message{Content: "学习 Go"}}, nil)
+	res, err := server.RegenerateTitle(context.Background(), &aiv1.RegenerateTitleRequest{Sn: sn, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, "学习 Go", res.Title)
+	select {
+	case event := <-events:
+		assert.Equal(t, domain.ConversationEvent{Type: domain.ConversationEventTitleUpdated, Sn: sn, Title: "学习 Go"}, event)
+	case <-time.After(time.Second * 3):
+		t.Fatal("没有收到标题更新的事件")
+	}
+	// 修改标题不影响对话在列表里面的顺序
+	var conversation dao.Conversation
+	require.NoError(t, c.db.Where("sn = ?", sn).First(&conversation).Error)
+	assert.Equal(t, "学习 Go", conversation.Title)
+	assert.Equal(t, int64(100), conversation.Utime)
+}
+
 func (c *ConversationSuite) TestStream() {
 	t := c.T()
 	testcases := []struct {
@@ -234,12 +433,9 @@ func (c *ConversationSuite) TestStream() {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			conversationDao := dao.NewConversationDao(c.db)
-			conversationCache := cache.NewConversationCache(c.cache)
-			repo := repository.NewConversationRepo(conversationDao, conversationCache)
 			ctrl := gomock.NewController(t)
 			handler := mocks.NewMockHandler(ctrl)
-			conversationService := service.NewConversationService(repo, handler)
+			conversationService := c.newService(handler)
 			server := grpc.NewConversationServer(conversationService)
 			tc.before(handler)
 			mockStream := &mocks.MockStreamServer{Ctx: context.Background()}
@@ -280,20 +476,716 @@ func (c *ConversationSuite) TestDetail() {
 
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			conversationDao := dao.NewConversationDao(c.db)
-			conversationCache := cache.NewConversationCache(c.cache)
-			repo := repository.NewConversationRepo(conversationDao, conversationCache)
 			ctrl := gomock.NewController(t)
 			handler := mocks.NewMockHandler(ctrl)
-			conversationService := service.NewConversationService(repo, handler)
+			conversationService := c.newService(handler)
 			server := grpc.NewConversationServer(conversationService)
 			tc.before()
 			detail, err := server.Detail(context.Background(), &aiv1.DetailRequest{Sn: "1"})
 			require.NoError(t, err)
 			assert.ElementsMatch(t, detail.Message, []*aiv1.Message{
-				{Role: aiv1.Role_USER, Content: "user1"},
-				{Role: aiv1.Role_ASSISTANT, Content: "llm1"},
+				{Id: "1", Role: aiv1.Role_USER, Content: "user1", Siblings: 1},
+				{Id: "2", Role: aiv1.Role_ASSISTANT, Content: "llm1", Siblings: 1},
 			})
 		})
 	}
 }
+
+func (c *ConversationSuite) TestManage() {
+	t := c.T()
+	testcases := []struct {
+		name  string
+		op    func(server *grpc.ConversationServer, sn string) error
+		after func(sn string)
+		// 操作之后 List 能查到的对话
+		wantList   []string
+		wantPinned []string
+		wantErr    error
+	}{
+		{
+			name: "修改标题",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				res, err := server.Update(context.Background(), &aiv1.UpdateConversationRequest{Sn: sn, Uid: "123", Title: " 新标题 "})
+				if err == nil {
+					assert.Equal(t, "新标题", res.Title)
+				}
+				return err
+			},
+			wantList: []string{"other", "新标题"},
+		},
+		{
+			name: "不能修改别人的对话",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				_, err := server.Update(context.Background(), &aiv1.UpdateConversationRequest{Sn: sn, Uid: "456", Title: "新标题"})
+				return err
+			},
+			wantErr: errs.ErrConversationNotFound,
+		},
+		{
+			name: "归档",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				_, err := server.Archive(context.Background(), &aiv1.ConversationOpRequest{Sn: sn, Uid: "123"})
+				return err
+			},
+			wantList: []string{"other"},
+		},
+		{
+			name: "置顶",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				_, err := server.Pin(context.Background(), &aiv1.PinRequest{Sn: sn, Uid: "123", Pinned: true})
+				return err
+			},
+			wantList:   []string{"target", "other"},
+			wantPinned: []string{"target"},
+		},
+		{
+			name: "软删除",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				_, err := server.Delete(context.Background(), &aiv1.ConversationOpRequest{Sn: sn, Uid: "123"})
+				return err
+			},
+			after: func(sn string) {
+				var cnt int64
+				err := c.db.Model(&dao.Message{}).Where("sn = ?", sn).Count(&cnt).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), cnt)
+			},
+			wantList: []string{"other"},
+		},
+		{
+			name: "彻底删除",
+			op: func(server *grpc.ConversationServer, sn string) error {
+				_, err := server.Purge(context.Background(), &aiv1.ConversationOpRequest{Sn: sn, Uid: "123"})
+				return err
+			},
+			after: func(sn string) {
+				var cnt int64
+				err := c.db.Model(&dao.Message{}).Where("sn = ?", sn).Count(&cnt).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), cnt)
+				exists, err := c.cache.Exists(context.Background(), "conversation:"+sn).Result()
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), exists)
+			},
+			wantList: []string{"other"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer c.TearDownTest()
+			sn := uuid.New().String()
+			ctrl := gomock.NewController(t)
+			handler := mocks.NewMockHandler(ctrl)
+			conversationService := c.newService(handler)
+			server := grpc.NewConversationServer(conversationService)
+
+			// target 更早创建，但是 other 最近更活跃
+			err := c.db.Create([]dao.Conversation{
+				{Title: "target", Uid: "123", Sn: sn, Utime: 100},
+				{Title: "other", Uid: "123", Sn: uuid.New().String(), Utime: 200},
+			}).Error
+			require.NoError(t, err)
+			_, err = c.repo.AddMessages(context.Background(), sn, []domain.Message{{Role: domain.USER, Content: "hello"}})
+			require.NoError(t, err)
+			err = c.db.Model(&dao.Conversation{}).Where("sn = ?", sn).Update("utime", 100).Error
+			require.NoError(t, err)
+
+			err = tc.op(server, sn)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if tc.after != nil {
+				tc.after(sn)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			res, err := server.List(context.Background(), &aiv1.ListReq{Uid: "123", Limit: 10})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantList, titles(res.Conversations))
+			res, err = server.List(context.Background(), &aiv1.ListReq{Uid: "123", Limit: 10, PinnedOnly: true})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantPinned, titles(res.Conversations))
+		})
+	}
+}
+
+func (c *ConversationSuite) TestChatDeleted() {
+	t := c.T()
+	testcases := []struct {
+		name string
+		op   func(svc *service.ConversationService, sn string) error
+	}{
+		{
+			name: "删除之后不能继续对话",
+			op: func(svc *service.ConversationService, sn string) error {
+				_, err := svc.Chat(context.Background(), sn, []domain.Message{{Role: domain.USER, Content: "还在吗"}})
+				return err
+			},
+		},
+		{
+			name: "删除之后不能继续流式对话",
+			op: func(svc *service.ConversationService, sn string) error {
+				_, err := svc.Stream(context.Background(), sn, []domain.Message{{Role: domain.USER, Content: "还在吗"}})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer c.TearDownTest()
+			sn := uuid.New().String()
+			ctrl := gomock.NewController(t)
+			// 没有设置任何预期，调用模型会直接失败
+			handler := mocks.NewMockHandler(ctrl)
+			svc := c.newService(handler)
+
+			err := c.db.Create(&dao.Conversation{Title: "target", Uid: "123", Sn: sn}).Error
+			require.NoError(t, err)
+			_, err = c.repo.AddMessages(context.Background(), sn, []domain.Message{{Role: domain.USER, Content: "hello"}})
+			require.NoError(t, err)
+			require.NoError(t, svc.Delete(context.Background(), sn, "123"))
+
+			err = tc.op(svc, sn)
+			assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+			var cnt int64
+			err = c.db.Model(&dao.Message{}).Where("sn = ?", sn).Count(&cnt).Error
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), cnt)
+		})
+	}
+}
+
+func titles(conversations []*aiv1.Conversation) []string {
+	return slice.Map(conversations, func(idx int, src *aiv1.Conversation) string {
+		return src.Title
+	})
+}
+
+func (c *ConversationSuite) TestBranch() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+	err := c.db.Create(&dao.Conversation{Title: "test1", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+
+	// 每次调用模型都返回 answerN，同时记录发给模型的最后一条消息
+	var lastContents []string
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+			lastContents = append(lastContents, msgs[len(msgs)-1].Content)
+			content := "answer" + strconv.Itoa(len(lastContents))
+			return domain.ChatResponse{Response: domain.Message{Role: domain.ASSISTANT, Content: content}}, nil
+		}).Times(3)
+
+	chat, err := server.Chat(context.Background(), &aiv1.LLMRequest{
+		Sn:      sn,
+		Message: []*aiv1.Message{{Content: "question1", Role: aiv1.Role_USER}},
+	})
+	require.NoError(t, err)
+	answer1, err := strconv.ParseInt(chat.Response.Id, 10, 64)
+	require.NoError(t, err)
+
+	// 不能操作别人的对话
+	_, err = server.Regenerate(context.Background(), &aiv1.RegenerateRequest{MessageId: answer1, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	_, err = server.EditAndResend(context.Background(), &aiv1.EditAndResendRequest{MessageId: answer1 - 1, Content: "question2", Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	_, err = server.SwitchBranch(context.Background(), &aiv1.SwitchBranchRequest{Sn: sn, MessageId: answer1, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+
+	chat, err = server.Regenerate(context.Background(), &aiv1.RegenerateRequest{MessageId: answer1, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, "answer2", chat.Response.Content)
+	detail, err := server.Detail(context.Background(), &aiv1.DetailRequest{Sn: sn})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer2"}, contents(detail.Message))
+	assert.Equal(t, int32(2), detail.Message[1].Siblings)
+	assert.Equal(t, int32(1), detail.Message[1].SiblingIndex)
+
+	question1, err := strconv.ParseInt(detail.Message[0].Id, 10, 64)
+	require.NoError(t, err)
+	chat, err = server.EditAndResend(context.Background(), &aiv1.EditAndResendRequest{MessageId: question1, Content: "question2", Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, "answer3", chat.Response.Content)
+	detail, err = server.Detail(context.Background(), &aiv1.DetailRequest{Sn: sn})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question2", "answer3"}, contents(detail.Message))
+	assert.Equal(t, int32(2), detail.Message[0].Siblings)
+	// 模型看到的只有当前分支上的消息
+	assert.Equal(t, []string{"question1", "question1", "question2"}, lastContents)
+
+	detail, err = server.SwitchBranch(context.Background(), &aiv1.SwitchBranchRequest{Sn: sn, MessageId: question1, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer2"}, contents(detail.Message))
+	_, err = server.Regenerate(context.Background(), &aiv1.RegenerateRequest{MessageId: question1, Uid: "123"})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+}
+
+// TestLegacyBranch 引入分支之前的消息 ParentID 都是 0，在上面创建分支的时候按照 id 的顺序处理
+func (c *ConversationSuite) TestLegacyBranch() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+	err := c.db.Create(&dao.Conversation{Title: "legacy", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{ID: 1, Sn: sn, Role: domain.USER, Content: "question1"},
+		{ID: 2, Sn: sn, Role: domain.ASSISTANT, Content: "answer1"},
+		{ID: 3, Sn: sn, Role: domain.USER, Content: "question2"},
+		{ID: 4, Sn: sn, Role: domain.ASSISTANT, Content: "answer2"},
+	}).Error
+	require.NoError(t, err)
+
+	var lastContents []string
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+			lastContents = append(lastContents, msgs[len(msgs)-1].Content)
+			content := "retry" + strconv.Itoa(len(lastContents))
+			return domain.ChatResponse{Response: domain.Message{Role: domain.ASSISTANT, Content: content}}, nil
+		}).Times(2)
+
+	// 重新生成最后一个回答，上一条消息是第二个问题
+	chat, err := server.Regenerate(context.Background(), &aiv1.RegenerateRequest{MessageId: 4, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, "retry1", chat.Response.Content)
+	detail, err := server.Detail(context.Background(), &aiv1.DetailRequest{Sn: sn})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer1", "question2", "retry1"}, contents(detail.Message))
+	assert.Equal(t, int32(2), detail.Message[3].Siblings)
+
+	// 修改第二个问题，新的问题接在第一个回答后面
+	chat, err = server.EditAndResend(context.Background(), &aiv1.EditAndResendRequest{MessageId: 3, Content: "question3", Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, "retry2", chat.Response.Content)
+	detail, err = server.Detail(context.Background(), &aiv1.DetailRequest{Sn: sn})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer1", "question3", "retry2"}, contents(detail.Message))
+	assert.Equal(t, int32(2), detail.Message[2].Siblings)
+	assert.Equal(t, []string{"question2", "question3"}, lastContents)
+
+	// 切换回原来的分支
+	detail, err = server.SwitchBranch(context.Background(), &aiv1.SwitchBranchRequest{Sn: sn, MessageId: 4, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer1", "question2", "answer2"}, contents(detail.Message))
+}
+
+// TestLegacySwitchBranch 还没有创建过分支的旧对话也能直接切换
+func (c *ConversationSuite) TestLegacySwitchBranch() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	server := grpc.NewConversationServer(c.newService(nil))
+	err := c.db.Create(&dao.Conversation{Title: "legacy", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{ID: 1, Sn: sn, Role: domain.USER, Content: "question1"},
+		{ID: 2, Sn: sn, Role: domain.ASSISTANT, Content: "answer1"},
+		{ID: 3, Sn: sn, Role: domain.USER, Content: "question2"},
+	}).Error
+	require.NoError(t, err)
+
+	detail, err := server.SwitchBranch(context.Background(), &aiv1.SwitchBranchRequest{Sn: sn, MessageId: 2, Uid: "123"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"question1", "answer1", "question2"}, contents(detail.Message))
+	var messages []dao.Message
+	require.NoError(t, c.db.Where("sn = ?", sn).Order("id ASC").Find(&messages).Error)
+	assert.Equal(t, []int64{0, 1, 2}, slice.Map(messages, func(idx int, src dao.Message) int64 {
+		return src.ParentID
+	}))
+}
+
+func contents(messages []*aiv1.Message) []string {
+	return slice.Map(messages, func(idx int, src *aiv1.Message) string {
+		return src.Content
+	})
+}
+
+func (c *ConversationSuite) TestResumeStream() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+	err := c.db.Create(&dao.Conversation{Title: "test1", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+
+	streamChan := make(chan domain.StreamEvent)
+	handler.EXPECT().StreamHandle(gomock.Any(), gomock.Any()).Return(streamChan, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Stream(&aiv1.LLMRequest{
+			Sn:      sn,
+			Message: []*aiv1.Message{{Content: "question", Role: aiv1.Role_USER}},
+		}, &mocks.MockStreamServer{Ctx: ctx})
+	}()
+	streamChan <- domain.StreamEvent{Content: "event1"}
+	// 客户端断开之后还会继续生成
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	streamChan <- domain.StreamEvent{Content: "event2", ReasoningContent: "reason2"}
+	close(streamChan)
+
+	var reply dao.Message
+	err = c.db.Where("sn = ? AND role = ?", sn, domain.ASSISTANT).First(&reply).Error
+	require.NoError(t, err)
+	// 不能续传其他用户的消息
+	resumed := &mocks.MockStreamServer{Ctx: context.Background()}
+	err = server.ResumeStream(&aiv1.ResumeStreamRequest{MessageId: reply.ID, Uid: "456"}, resumed)
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	err = server.ResumeStream(&aiv1.ResumeStreamRequest{MessageId: reply.ID}, resumed)
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	assert.Empty(t, resumed.Events)
+
+	err = server.ResumeStream(&aiv1.ResumeStreamRequest{MessageId: reply.ID, Uid: "123"}, resumed)
+	require.NoError(t, err)
+	require.Len(t, resumed.Events, 3)
+	assert.Equal(t, []string{"event1", "event2", ""}, slice.Map(resumed.Events, func(idx int, src *aiv1.StreamEvent) string {
+		return src.Content
+	}))
+	assert.Equal(t, int64(2), resumed.Events[1].Seq)
+	assert.True(t, resumed.Events[2].Final)
+
+	// 从某个序号之后继续
+	resumed = &mocks.MockStreamServer{Ctx: context.Background()}
+	err = server.ResumeStream(&aiv1.ResumeStreamRequest{MessageId: reply.ID, LastSeq: 1, Uid: "123"}, resumed)
+	require.NoError(t, err)
+	require.Len(t, resumed.Events, 2)
+	assert.Equal(t, "event2", resumed.Events[0].Content)
+
+	err = c.db.Where("id = ?", reply.ID).First(&reply).Error
+	require.NoError(t, err)
+	assert.Equal(t, "event1event2", reply.Content)
+	assert.Equal(t, "reason2", reply.ReasonContent)
+	assert.Equal(t, int8(domain.MessageStatusCompleted), reply.Status)
+}
+
+func (c *ConversationSuite) TestResumeStreamIdle() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler,
+		service.WithStreamIdleTimeout(200*time.Millisecond))
+	server := grpc.NewConversationServer(conversationService)
+	err := c.db.Create(&dao.Conversation{Title: "test1", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+	// 生成的实例挂了，消息一直停留在生成中，缓冲里面也没有事件
+	reply := dao.Message{Sn: sn, Role: domain.ASSISTANT, Content: "一半", Status: int8(domain.MessageStatusStreaming)}
+	require.NoError(t, c.db.Create(&reply).Error)
+
+	resumed := &mocks.MockStreamServer{Ctx: context.Background()}
+	start := time.Now()
+	err = server.ResumeStream(&aiv1.ResumeStreamRequest{MessageId: reply.ID, Uid: "123"}, resumed)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, resumed.Events, 1)
+	assert.Contains(t, resumed.Events[0].Err, "生成可能已经中断")
+	assert.False(t, resumed.Events[0].Final)
+}
+
+func (c *ConversationSuite) TestCancel() {
+	t := c.T()
+	defer c.TearDownTest()
+	sn := uuid.New().String()
+	newServer := func(handler *mocks.MockHandler) *grpc.ConversationServer {
+		return grpc.NewConversationServer(c.newService(handler))
+	}
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	server := newServer(handler)
+	// 模拟另外一个实例
+	other := newServer(mocks.NewMockHandler(ctrl))
+	err := c.db.Create(&dao.Conversation{Title: "test1", Uid: "123", Sn: sn}).Error
+	require.NoError(t, err)
+	err = c.db.Create(&dao.Quota{UID: 123, Key: "conversation-cancel", Amount: 10000}).Error
+	require.NoError(t, err)
+
+	streamChan := make(chan domain.StreamEvent)
+	var upstream context.Context
+	handler.EXPECT().StreamHandle(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, msgs []domain.Message) (chan domain.StreamEvent, error) {
+			upstream = ctx
+			return streamChan, nil
+		})
+	mockStream := &mocks.MockStreamServer{Ctx: context.Background()}
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Stream(&aiv1.LLMRequest{
+			Sn:      sn,
+			Message: []*aiv1.Message{{Content: "question", Role: aiv1.Role_USER}},
+		}, mockStream)
+	}()
+	streamChan <- domain.StreamEvent{Content: "partial"}
+
+	var reply dao.Message
+	err = c.db.Where("sn = ? AND role = ?", sn, domain.ASSISTANT).First(&reply).Error
+	require.NoError(t, err)
+	// 不能取消别人的对话里面的生成
+	_, err = other.Cancel(context.Background(), &aiv1.CancelRequest{MessageId: reply.ID, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	// 订阅是异步建立的，所以一直重试到生成被取消
+	var streamErr error
+	assert.Eventually(t, func() bool {
+		_, cancelErr := other.Cancel(context.Background(), &aiv1.CancelRequest{MessageId: reply.ID, Uid: "123"})
+		assert.NoError(t, cancelErr)
+		select {
+		case streamErr = <-done:
+			return true
+		default:
+			return false
+		}
+	}, time.Second*3, time.Millisecond*100)
+	require.NoError(t, streamErr)
+	// 上游的请求也被取消了
+	assert.ErrorIs(t, upstream.Err(), context.Canceled)
+	last := mockStream.Events[len(mockStream.Events)-1]
+	assert.True(t, last.Final)
+	assert.True(t, last.Cancelled)
+
+	err = c.db.Where("id = ?", reply.ID).First(&reply).Error
+	require.NoError(t, err)
+	assert.Equal(t, "partial", reply.Content)
+	assert.Equal(t, int8(domain.MessageStatusCancelled), reply.Status)
+	assert.True(t, reply.Tokens > 0)
+
+	// 按照估算的用量扣费，key 由消息 ID 生成
+	var record dao.QuotaRecord
+	err = c.db.Where("`key` = ?", fmt.Sprintf("conversation:message:%d", reply.ID)).First(&record).Error
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), record.Uid)
+	assert.Equal(t, reply.Tokens, record.Amount)
+	var quota dao.Quota
+	require.NoError(t, c.db.Where("uid = ?", 123).First(&quota).Error)
+	assert.Equal(t, 10000-reply.Tokens, quota.Amount)
+}
+
+func (c *ConversationSuite) TestSearch() {
+	t := c.T()
+	defer c.TearDownTest()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+
+	err := c.db.Create([]dao.Conversation{
+		{Sn: "a", Uid: "123", Title: "数据库索引", Utime: 100},
+		{Sn: "b", Uid: "123", Title: "周末计划", Utime: 200},
+		{Sn: "c", Uid: "456", Title: "别人的数据库"},
+		{Sn: "d", Uid: "123", Title: "删除的数据库", Deleted: true},
+	}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{Sn: "a", Role: domain.USER, Content: "联合索引怎么设计"},
+		{Sn: "b", Role: domain.USER, Content: "周末去图书馆看数据库的书"},
+		{Sn: "c", Role: domain.USER, Content: "数据库"},
+	}).Error
+	require.NoError(t, err)
+
+	res, err := server.Search(context.Background(), &aiv1.SearchRequest{Uid: "123", Keyword: "数据库"})
+	require.NoError(t, err)
+	require.Len(t, res.Results, 2)
+	assert.Equal(t, "b", res.Results[0].Sn)
+	assert.Empty(t, res.Results[0].TitleHighlight)
+	require.Len(t, res.Results[0].Matches, 1)
+	assert.Equal(t, "周末去图书馆看<em>数据库</em>的书", res.Results[0].Matches[0].Snippet)
+	assert.Equal(t, "a", res.Results[1].Sn)
+	assert.Equal(t, "<em>数据库</em>索引", res.Results[1].TitleHighlight)
+	assert.Empty(t, res.Results[1].Matches)
+}
+
+func (c *ConversationSuite) TestExport() {
+	t := c.T()
+	defer c.TearDownTest()
+	ctrl := gomock.NewController(t)
+	handler := mocks.NewMockHandler(ctrl)
+	conversationService := c.newService(handler)
+	server := grpc.NewConversationServer(conversationService)
+
+	err := c.db.Create([]dao.Conversation{
+		{Sn: "a", Uid: "123", Title: "第一个", Ctime: 100},
+		{Sn: "b", Uid: "123", Title: "第二个", Ctime: 200},
+		{Sn: "c", Uid: "456", Title: "别人的", Ctime: 150},
+	}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{Sn: "a", Role: domain.USER, Content: "问题一"},
+		{Sn: "a", Role: domain.ASSISTANT, Content: "回答一"},
+		{Sn: "b", Role: domain.USER, Content: "问题二"},
+		{Sn: "c", Role: domain.USER, Content: "问题三"},
+		{Sn: "c", Role: domain.ASSISTANT, Content: "回答三"},
+	}).Error
+	require.NoError(t, err)
+
+	res, err := server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Start: 0, End: 300, Format: "jsonl"})
+	require.NoError(t, err)
+	// 第二个对话没有回答，不会出现在微调数据里面
+	assert.Equal(t, `{"messages":[{"role":"user","content":"问题一"},{"role":"assistant","content":"回答一"}]}`+"\n", string(res.Content))
+
+	res, err = server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Sn: "b", Format: "markdown"})
+	require.NoError(t, err)
+	assert.Contains(t, string(res.Content), "# 第二个")
+	assert.Contains(t, string(res.Content), "问题二")
+
+	_, err = server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Sn: "c", Format: "json"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+
+	// 对话使用了 prompt 的时候带上生成回答的版本的系统提示词
+	require.NoError(t, dao.InitTable(c.db))
+	prompt := dao.Prompt{Name: "导出", Owner: 123, OwnerType: "personal"}
+	require.NoError(t, c.db.Create(&prompt).Error)
+	version := dao.PromptVersion{PromptID: prompt.ID, SystemContent: "你是一个数学老师"}
+	require.NoError(t, c.db.Create(&version).Error)
+	defer func() {
+		require.NoError(t, c.db.Delete(&dao.PromptVersion{}, version.ID).Error)
+		require.NoError(t, c.db.Delete(&dao.Prompt{}, prompt.ID).Error)
+	}()
+	err = c.db.Create(&dao.Conversation{Sn: "d", Uid: "123", Title: "带 prompt", PromptID: prompt.ID, Ctime: 250}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{Sn: "d", Role: domain.USER, Content: "1+1"},
+		{Sn: "d", Role: domain.ASSISTANT, Content: "2", PromptVersionID: version.ID},
+	}).Error
+	require.NoError(t, err)
+	res, err = server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Start: 220, End: 300, Format: "jsonl"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"messages":[{"role":"system","content":"你是一个数学老师"},{"role":"user","content":"1+1"},{"role":"assistant","content":"2"}]}`+"\n", string(res.Content))
+
+	// 已经没有权限查看的 prompt 不导出系统提示词
+	require.NoError(t, c.db.Model(&dao.Prompt{}).Where("id = ?", prompt.ID).Update("owner", 456).Error)
+	res, err = server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Start: 220, End: 300, Format: "jsonl"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"messages":[{"role":"user","content":"1+1"},{"role":"assistant","content":"2"}]}`+"\n", string(res.Content))
+	_, err = server.Export(context.Background(), &aiv1.ExportRequest{Uid: "123", Format: "csv"})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+}
+
+func (c *ConversationSuite) TestShare() {
+	t := c.T()
+	defer c.TearDownTest()
+	conversationService := c.newService(nil)
+	server := gin.Default()
+	web.NewConversationHandler(conversationService).PublicRoutes(server)
+
+	err := c.db.Create(&dao.Conversation{Sn: "a", Uid: "123", Title: "分享的对话"}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{ID: 1, Sn: "a", Role: domain.USER, Content: "问题一"},
+		{ID: 2, Sn: "a", Role: domain.ASSISTANT, Content: "回答一", ReasonContent: "思考一", Tokens: 10},
+		{ID: 3, Sn: "a", Role: domain.USER, Content: "问题二"},
+	}).Error
+	require.NoError(t, err)
+
+	_, err = conversationService.CreateShare(context.Background(), domain.ConversationShare{Sn: "a", Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrConversationNotFound)
+	share, err := conversationService.CreateShare(context.Background(), domain.ConversationShare{Sn: "a", Uid: "123", MessageID: 2})
+	require.NoError(t, err)
+	assert.NotEmpty(t, share.Token)
+
+	getShare := func(token string) (int, web.SharedConversationVO) {
+		req, err := http.NewRequest(http.MethodGet, "/share/"+token, nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		var res struct {
+			Code int                      `json:"code"`
+			Data web.SharedConversationVO `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &res))
+		return res.Code, res.Data
+	}
+	// 之后的消息和思考过程都看不到
+	code, shared := getShare(share.Token)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "分享的对话", shared.Title)
+	assert.Equal(t, []web.SharedMessageVO{
+		{ID: 1, Role: domain.USER, Content: "问题一"},
+		{ID: 2, Role: domain.ASSISTANT, Content: "回答一"},
+	}, shared.Messages)
+
+	err = conversationService.RevokeShare(context.Background(), share.Token, "456")
+	assert.ErrorIs(t, err, errs.ErrShareNotFound)
+	err = conversationService.RevokeShare(context.Background(), share.Token, "123")
+	require.NoError(t, err)
+	code, _ = getShare(share.Token)
+	assert.Equal(t, 404001, code)
+}
+
+func (c *ConversationSuite) TestFeedback() {
+	t := c.T()
+	defer c.TearDownTest()
+	conversationService := c.newService(nil)
+	server := grpc.NewConversationServer(conversationService)
+	feedbackService := service.NewFeedbackService(repository.NewFeedbackRepo(dao.NewFeedbackDAO(c.db)))
+
+	err := c.db.Create(&dao.Conversation{Sn: "a", Uid: "123", Title: "评价"}).Error
+	require.NoError(t, err)
+	err = c.db.Create([]dao.Message{
+		{ID: 1, Sn: "a", Role: domain.USER, Content: "1+1"},
+		{ID: 2, Sn: "a", Role: domain.ASSISTANT, Content: "3", ParentID: 1, Provider: "deepseek", Model: "deepseek-chat"},
+		{ID: 3, Sn: "a", Role: domain.USER, Content: "2+2", ParentID: 2},
+		{ID: 4, Sn: "a", Role: domain.ASSISTANT, Content: "4", ParentID: 3, Provider: "deepseek", Model: "deepseek-chat"},
+	}).Error
+	require.NoError(t, err)
+
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 1, Score: 1, Uid: "123"})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Score: -1, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrPermissionDenied)
+	// 必须传 uid，不能评价或者取消任意一条消息的评价
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Score: -1})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Score: 1, Uid: "123"})
+	require.NoError(t, err)
+	// 重复评价覆盖之前的评价
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Score: -1, Uid: "123", Reason: "inaccurate", Comment: "算错了"})
+	require.NoError(t, err)
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 4, Score: 1, Uid: "123"})
+	require.NoError(t, err)
+
+	var msg dao.Message
+	require.NoError(t, c.db.Where("id = ?", 2).First(&msg).Error)
+	assert.Equal(t, int8(-1), msg.Feedback)
+
+	stats, err := feedbackService.Stats(context.Background(), domain.FeedbackStatsQuery{GroupBy: domain.FeedbackGroupByModel})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.FeedbackStats{{
+		Provider: "deepseek", Model: "deepseek-chat", Up: 1, Down: 1,
+		Reasons: map[domain.FeedbackReason]int64{domain.FeedbackReasonInaccurate: 1},
+	}}, stats)
+
+	reviews, err := feedbackService.Reviews(context.Background(), domain.FeedbackQuery{})
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.Equal(t, "1+1", reviews[0].Question)
+	assert.Equal(t, "3", reviews[0].Answer)
+	assert.Equal(t, "算错了", reviews[0].Feedback.Comment)
+
+	// 其他用户不能取消评价
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Uid: "456"})
+	assert.ErrorIs(t, err, errs.ErrPermissionDenied)
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	reviews, err = feedbackService.Reviews(context.Background(), domain.FeedbackQuery{})
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+
+	// 取消评价
+	_, err = server.Feedback(context.Background(), &aiv1.FeedbackRequest{MessageId: 2, Uid: "123"})
+	require.NoError(t, err)
+	reviews, err = feedbackService.Reviews(context.Background(), domain.FeedbackQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, reviews)
+}
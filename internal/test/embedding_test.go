@@ -0,0 +1,245 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ai "github.com/ecodeclub/ai-gateway-go/api/gen/ai/v1"
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	igrpc "github.com/ecodeclub/ai-gateway-go/internal/grpc"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm/platform/fake"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/yumosx/got/pkg/config"
+	"gorm.io/gorm"
+)
+
+const testVectorIndex = "test_vectors"
+
+type EmbeddingSuite struct {
+	suite.Suite
+	db  *gorm.DB
+	rdb redis.UniversalClient
+}
+
+func TestEmbedding(t *testing.T) {
+	suite.Run(t, new(EmbeddingSuite))
+}
+
+func (s *EmbeddingSuite) SetupSuite() {
+	dbConfig := config.NewConfig(
+		config.WithDBName("ai_gateway_platform"),
+		config.WithUserName("root"),
+		config.WithPassword("root"),
+		config.WithHost("127.0.0.1"),
+		config.WithPort("13306"),
+	)
+	db, err := config.NewDB(dbConfig)
+	require.NoError(s.T(), err)
+	err = dao.InitQuotaTable(db)
+	require.NoError(s.T(), err)
+	s.db = db
+	s.rdb = config.NewCache(config.NewCacheConfig(config.WithAddr("localhost:6379"))).(redis.UniversalClient)
+}
+
+func (s *EmbeddingSuite) TearDownTest() {
+	err := s.db.Exec("TRUNCATE TABLE quotas").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE quota_records").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE temp_quotas").Error
+	require.NoError(s.T(), err)
+	// DD 连同索引里面的记录一起删除
+	s.rdb.Do(context.Background(), "FT.DROPINDEX", testVectorIndex, "DD")
+}
+
+func (s *EmbeddingSuite) TestEmbed() {
+	t := s.T()
+	ctx := context.Background()
+	now := int64(1)
+	require.NoError(t, s.db.Create(&dao.Quota{UID: 1, Key: "embedding-test", Amount: 5, Ctime: now, Utime: now}).Error)
+
+	quota := service.NewQuotaService(repository.NewQuotaRepo(dao.NewQuotaDao(s.db)))
+	server := igrpc.NewEmbeddingServer(service.NewEmbeddingService(fake.NewEmbedder(64), quota))
+
+	resp, err := server.Embed(ctx, &ai.EmbedRequest{Uid: 1, Input: []string{"hello world", "你好"}, RequestId: "r1"})
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, int32(1), resp.Data[1].Index)
+	assert.Len(t, resp.Data[0].Vector, 64)
+	assert.Equal(t, int64(4), resp.TotalTokens)
+	assert.Equal(t, int64(1), s.balance(1))
+
+	// 相同的 request_id 重试不会重复扣费
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 1, Input: []string{"hello world", "你好"}, RequestId: "r1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), s.balance(1))
+
+	// 额度不够
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 1, Input: []string{"hello world"}, RequestId: "r2"})
+	assert.ErrorIs(t, err, errs.ErrInsufficientBalance)
+	assert.Equal(t, int64(1), s.balance(1))
+
+	// request_id 被其他请求用过了，不能借此免费调用
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 1, Input: []string{"hello"}, RequestId: "r1"})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	require.NoError(t, s.db.Create(&dao.Quota{UID: 2, Key: "embedding-test-2", Amount: 100, Ctime: now, Utime: now}).Error)
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 2, Input: []string{"hello world", "你好"}, RequestId: "r1"})
+	assert.ErrorIs(t, err, errs.ErrInvalidParam)
+	assert.Equal(t, int64(100), s.balance(2))
+}
+
+// countingEmbedder 记录调用模型的次数
+type countingEmbedder struct {
+	llm.Embedder
+	calls int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, input []string) (domain.EmbeddingResponse, error) {
+	e.calls++
+	return e.Embedder.Embed(ctx, input)
+}
+
+func (s *EmbeddingSuite) TestEmbedWithoutBalance() {
+	t := s.T()
+	ctx := context.Background()
+	now := int64(1)
+	require.NoError(t, s.db.Create(&dao.Quota{UID: 3, Key: "embedding-empty", Amount: 0, Ctime: now, Utime: now}).Error)
+	embedder := &countingEmbedder{Embedder: fake.NewEmbedder(64)}
+	quota := service.NewQuotaService(repository.NewQuotaRepo(dao.NewQuotaDao(s.db)))
+	server := igrpc.NewEmbeddingServer(service.NewEmbeddingService(embedder, quota))
+
+	// 余额为 0 或者没有额度的用户不会调用模型
+	_, err := server.Embed(ctx, &ai.EmbedRequest{Uid: 3, Input: []string{"hello"}, RequestId: "r1"})
+	assert.ErrorIs(t, err, errs.ErrInsufficientBalance)
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 4, Input: []string{"hello"}, RequestId: "r2"})
+	assert.ErrorIs(t, err, errs.ErrInsufficientBalance)
+	assert.Equal(t, 0, embedder.calls)
+
+	// 临时额度也可以使用
+	require.NoError(t, s.db.Create(&dao.TempQuota{UID: 3, Key: "embedding-temp", Amount: 10, StartTime: now, EndTime: time.Now().Add(time.Hour).Unix()}).Error)
+	_, err = server.Embed(ctx, &ai.EmbedRequest{Uid: 3, Input: []string{"hello"}, RequestId: "r3"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, embedder.calls)
+}
+
+func (s *EmbeddingSuite) balance(uid int64) int64 {
+	var quota dao.Quota
+	require.NoError(s.T(), s.db.Where("uid = ?", uid).First(&quota).Error)
+	return quota.Amount
+}
+
+func (s *EmbeddingSuite) TestVectorStore() {
+	redisStore := repository.NewRedisVectorStore(s.rdb, testVectorIndex, 3, "kb")
+	require.NoError(s.T(), redisStore.CreateIndex(context.Background()))
+	// 重复创建不报错
+	require.NoError(s.T(), redisStore.CreateIndex(context.Background()))
+
+	stores := map[string]service.VectorStore{
+		"memory": repository.NewMemoryVectorStore(3),
+		"redis":  redisStore,
+	}
+	for name, store := range stores {
+		s.Run(name, func() {
+			s.testVectorStore(store)
+		})
+	}
+}
+
+func (s *EmbeddingSuite) testVectorStore(store service.VectorStore) {
+	t := s.T()
+	ctx := context.Background()
+	err := store.Upsert(ctx, []domain.VectorRecord{
+		{ID: "a", Vector: []float32{1, 0, 0}, Metadata: map[string]string{"kb": "1"}},
+		{ID: "b", Vector: []float32{0.8, 0.6, 0}, Metadata: map[string]string{"kb": "1"}},
+		{ID: "c", Vector: []float32{0, 1, 0}, Metadata: map[string]string{"kb": "2"}},
+	})
+	require.NoError(t, err)
+
+	ids := func(matches []domain.VectorMatch) []string {
+		res := make([]string, 0, len(matches))
+		for _, m := range matches {
+			res = append(res, m.ID)
+		}
+		return res
+	}
+
+	testCases := []struct {
+		name    string
+		query   domain.VectorQuery
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "按照相似度排序",
+			query: domain.VectorQuery{Vector: []float32{1, 0, 0}, TopK: 2},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:  "按照 metadata 过滤",
+			query: domain.VectorQuery{Vector: []float32{1, 0, 0}, TopK: 3, Filter: map[string]string{"kb": "2"}},
+			want:  []string{"c"},
+		},
+		{
+			name:    "维度不对",
+			query:   domain.VectorQuery{Vector: []float32{1, 0}, TopK: 1},
+			wantErr: errs.ErrInvalidParam,
+		},
+		{
+			name:    "top_k 不合法",
+			query:   domain.VectorQuery{Vector: []float32{1, 0, 0}},
+			wantErr: errs.ErrInvalidParam,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := store.Search(ctx, tc.query)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ids(matches))
+		})
+	}
+
+	matches, err := store.Search(ctx, domain.VectorQuery{Vector: []float32{1, 0, 0}, TopK: 2})
+	require.NoError(t, err)
+	assert.InDelta(t, 1, matches[0].Score, 1e-5)
+	assert.InDelta(t, 0.8, matches[1].Score, 1e-5)
+	assert.Equal(t, map[string]string{"kb": "1"}, matches[1].Metadata)
+
+	// 覆盖之后旧的 tag 不再生效
+	err = store.Upsert(ctx, []domain.VectorRecord{{ID: "c", Vector: []float32{1, 0, 0}, Metadata: map[string]string{"kb": "3"}}})
+	require.NoError(t, err)
+	matches, err = store.Search(ctx, domain.VectorQuery{Vector: []float32{1, 0, 0}, TopK: 3, Filter: map[string]string{"kb": "2"}})
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	require.NoError(t, store.Delete(ctx, []string{"a", "c"}))
+	matches, err = store.Search(ctx, domain.VectorQuery{Vector: []float32{1, 0, 0}, TopK: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, ids(matches))
+}
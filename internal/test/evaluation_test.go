@@ -0,0 +1,324 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
+	"github.com/ecodeclub/ai-gateway-go/internal/test/mocks"
+	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/yumosx/got/pkg/config"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+)
+
+type EvaluationTestSuite struct {
+	suite.Suite
+	db *gorm.DB
+	// uid 是当前登录的用户，测试中切换它来模拟其他用户
+	uid     int64
+	version int64
+}
+
+func TestEvaluation(t *testing.T) {
+	suite.Run(t, new(EvaluationTestSuite))
+}
+
+func (s *EvaluationTestSuite) SetupSuite() {
+	dbConfig := config.NewConfig(
+		config.WithDBName("ai_gateway_platform"),
+		config.WithUserName("root"),
+		config.WithPassword("root"),
+		config.WithHost("127.0.0.1"),
+		config.WithPort("13306"),
+	)
+
+	db, err := config.NewDB(dbConfig)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), dao.InitTable(db))
+	require.NoError(s.T(), dao.InitEvaluationTable(db))
+	s.db = db
+}
+
+func (s *EvaluationTestSuite) SetupTest() {
+	t := s.T()
+	s.uid = 1
+	ctrl := gomock.NewController(t)
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().DoAndReturn(func() session.Claims {
+		return session.Claims{Uid: s.uid}
+	}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	prompt := dao.Prompt{Name: "计算器", Owner: s.uid, OwnerType: "personal"}
+	require.NoError(t, s.db.Create(&prompt).Error)
+	version := dao.PromptVersion{PromptID: prompt.ID, SystemContent: "你是一个计算器", Content: "{{question}}"}
+	require.NoError(t, s.db.Create(&version).Error)
+	s.version = version.ID
+}
+
+func (s *EvaluationTestSuite) TearDownTest() {
+	for _, table := range []string{"eval_datasets", "eval_cases", "eval_runs", "eval_results", "prompts", "prompt_versions"} {
+		require.NoError(s.T(), s.db.Exec("TRUNCATE TABLE "+table).Error)
+	}
+}
+
+func (s *EvaluationTestSuite) newServer(handler llm.Handler) *gin.Engine {
+	promptRepo := repository.NewPromptRepo(dao.NewPromptDAO(s.db))
+	svc := service.NewEvaluationService(
+		repository.NewEvaluationRepo(dao.NewEvaluationDAO(s.db)),
+		promptRepo,
+		service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(s.db)), promptRepo),
+		handler,
+	)
+	server := gin.Default()
+	web.NewEvaluationHandler(svc).PrivateRoutes(server)
+	return server
+}
+
+func (s *EvaluationTestSuite) post(server *gin.Engine, path string, body any) Result[json.RawMessage] {
+	t := s.T()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+	var result Result[json.RawMessage]
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (s *EvaluationTestSuite) decode(res Result[json.RawMessage], val any) {
+	require.Equal(s.T(), 0, res.Code, res.Msg)
+	require.NoError(s.T(), json.Unmarshal(res.Data, val))
+}
+
+// createDataset 创建数据集，每个用例的参考答案都是问题本身
+func (s *EvaluationTestSuite) createDataset(server *gin.Engine, questions ...string) int64 {
+	cases := make([]web.EvalCaseVO, 0, len(questions))
+	for _, q := range questions {
+		cases = append(cases, web.EvalCaseVO{Variables: map[string]string{"question": q}, Expected: q})
+	}
+	var id int64
+	s.decode(s.post(server, "/prompt/eval/dataset/create", web.CreateDatasetReq{Name: "回声", Cases: cases}), &id)
+	return id
+}
+
+// waitRun 等待评测在后台执行完
+func (s *EvaluationTestSuite) waitRun(server *gin.Engine, id int64) web.EvalRunVO {
+	var run web.EvalRunVO
+	require.Eventually(s.T(), func() bool {
+		s.decode(s.post(server, "/prompt/eval/run/detail", web.GetReq{ID: id}), &run)
+		return run.Status != string(domain.EvalRunStatusRunning)
+	}, 5*time.Second, 50*time.Millisecond)
+	return run
+}
+
+// echo 原样返回用户消息
+func echo(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+	return domain.ChatResponse{
+		Response: domain.Message{Role: domain.ASSISTANT, Content: msgs[len(msgs)-1].Content},
+		Usage:    domain.Usage{TotalTokens: 10},
+	}, nil
+}
+
+func (s *EvaluationTestSuite) TestOwner() {
+	t := s.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler := mocks.NewMockHandler(ctrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).DoAndReturn(echo).AnyTimes()
+	server := s.newServer(handler)
+
+	dataset := s.createDataset(server, "1")
+	var runID int64
+	s.decode(s.post(server, "/prompt/eval/run", web.RunEvalReq{DatasetID: dataset, VersionID: s.version}), &runID)
+	s.waitRun(server, runID)
+
+	s.uid = 2
+	testCases := []struct {
+		name string
+		path string
+		req  any
+	}{
+		{name: "查看数据集", path: "/prompt/eval/dataset/detail", req: web.GetReq{ID: dataset}},
+		{name: "添加用例", path: "/prompt/eval/dataset/cases/add", req: web.AddCasesReq{DatasetID: dataset, Cases: []web.EvalCaseVO{{Expected: "2"}}}},
+		{name: "发起评测", path: "/prompt/eval/run", req: web.RunEvalReq{DatasetID: dataset, VersionID: s.version}},
+		{name: "查看评测", path: "/prompt/eval/run/detail", req: web.GetReq{ID: runID}},
+		{name: "对比评测", path: "/prompt/eval/compare", req: web.CompareEvalReq{A: runID, B: runID}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := s.post(server, tc.path, tc.req)
+			assert.Equal(t, errs.PermissionDeniedError.Code, res.Code)
+		})
+	}
+
+	// 自己的数据集也不能评测没有权限的 prompt
+	own := s.createDataset(server, "1")
+	res := s.post(server, "/prompt/eval/run", web.RunEvalReq{DatasetID: own, VersionID: s.version})
+	assert.Equal(t, errs.PermissionDeniedError.Code, res.Code)
+
+	s.uid = 1
+	res = s.post(server, "/prompt/eval/dataset/detail", web.GetReq{ID: dataset + 100})
+	assert.Equal(t, errs.NotFoundError.Code, res.Code)
+	res = s.post(server, "/prompt/eval/run/detail", web.GetReq{ID: runID + 100})
+	assert.Equal(t, errs.NotFoundError.Code, res.Code)
+
+	// 其他用户没有添加成功
+	var vo web.EvalDatasetVO
+	s.decode(s.post(server, "/prompt/eval/dataset/detail", web.GetReq{ID: dataset}), &vo)
+	assert.Len(t, vo.Cases, 1)
+}
+
+func (s *EvaluationTestSuite) TestRun() {
+	t := s.T()
+	testCases := []struct {
+		name       string
+		handle     func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error)
+		wantStatus domain.EvalRunStatus
+		wantPassed int64
+		wantScore  float64
+	}{
+		{
+			name:       "全部通过",
+			handle:     echo,
+			wantStatus: domain.EvalRunStatusSuccess,
+			wantPassed: 3,
+			wantScore:  1,
+		},
+		{
+			name: "部分用例调用模型失败",
+			handle: func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+				if msgs[len(msgs)-1].Content == "2" {
+					return domain.ChatResponse{}, errors.New("模型超时")
+				}
+				return echo(ctx, msgs)
+			},
+			wantStatus: domain.EvalRunStatusFailed,
+			wantPassed: 2,
+			wantScore:  2.0 / 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			handler := mocks.NewMockHandler(ctrl)
+			handler.EXPECT().Handle(gomock.Any(), gomock.Any()).DoAndReturn(tc.handle).Times(3)
+			server := s.newServer(handler)
+
+			dataset := s.createDataset(server, "1", "2", "3")
+			var runID int64
+			s.decode(s.post(server, "/prompt/eval/run", web.RunEvalReq{DatasetID: dataset, VersionID: s.version}), &runID)
+			run := s.waitRun(server, runID)
+			assert.Equal(t, string(tc.wantStatus), run.Status)
+			assert.Equal(t, int64(3), run.Total)
+			assert.Equal(t, tc.wantPassed, run.Passed)
+			assert.InDelta(t, tc.wantScore, run.Score, 0.0001)
+			assert.Len(t, run.Results, 3)
+		})
+	}
+}
+
+func (s *EvaluationTestSuite) TestJudge() {
+	t := s.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler := mocks.NewMockHandler(ctrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+			content := msgs[len(msgs)-1].Content
+			if !strings.HasPrefix(content, "评判标准") {
+				return echo(ctx, msgs)
+			}
+			answer := "FAIL 不是数字"
+			if strings.HasSuffix(content, "模型输出：1") {
+				answer = "PASS"
+			}
+			return domain.ChatResponse{Response: domain.Message{Role: domain.ASSISTANT, Content: answer}}, nil
+		}).Times(4)
+	server := s.newServer(handler)
+
+	judge := []web.AssertionVO{{Type: string(domain.AssertionLLMJudge), Value: "输出是一个数字"}}
+	var dataset int64
+	s.decode(s.post(server, "/prompt/eval/dataset/create", web.CreateDatasetReq{Name: "评测模型", Cases: []web.EvalCaseVO{
+		{Variables: map[string]string{"question": "1"}, Assertions: judge},
+		{Variables: map[string]string{"question": "一"}, Assertions: judge},
+	}}), &dataset)
+	var runID int64
+	s.decode(s.post(server, "/prompt/eval/run", web.RunEvalReq{DatasetID: dataset, VersionID: s.version}), &runID)
+	run := s.waitRun(server, runID)
+	assert.Equal(t, string(domain.EvalRunStatusSuccess), run.Status)
+	assert.Equal(t, int64(1), run.Passed)
+	reasons := make(map[string]string, len(run.Results))
+	for _, r := range run.Results {
+		reasons[r.Output] = r.Reason
+	}
+	assert.Equal(t, map[string]string{"1": "", "一": "FAIL 不是数字"}, reasons)
+}
+
+func (s *EvaluationTestSuite) TestConcurrency() {
+	t := s.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	var running, maxRunning atomic.Int64
+	handler := mocks.NewMockHandler(ctrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+			cur := running.Add(1)
+			defer running.Add(-1)
+			for {
+				old := maxRunning.Load()
+				if cur <= old || maxRunning.CompareAndSwap(old, cur) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			return echo(ctx, msgs)
+		}).Times(6)
+	server := s.newServer(handler)
+
+	dataset := s.createDataset(server, "1", "2", "3", "4", "5", "6")
+	var runID int64
+	s.decode(s.post(server, "/prompt/eval/run", web.RunEvalReq{DatasetID: dataset, VersionID: s.version, Concurrency: 2}), &runID)
+	run := s.waitRun(server, runID)
+	assert.Equal(t, string(domain.EvalRunStatusSuccess), run.Status)
+	assert.Equal(t, int64(2), maxRunning.Load())
+}
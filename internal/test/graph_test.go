@@ -16,18 +16,29 @@ package test
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
 	"github.com/ecodeclub/ai-gateway-go/internal/test/mocks"
 	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/ecodeclub/ginx/session"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -42,6 +53,9 @@ type GraphTestSuite struct {
 	suite.Suite
 	db     *gorm.DB
 	server *gin.Engine
+	runSvc *service.GraphRunService
+	// 定时触发的测试直接调用调度
+	triggerSvc *service.GraphTriggerService
 }
 
 func TestNode(t *testing.T) {
@@ -64,11 +78,23 @@ func (n *GraphTestSuite) SetupSuite() {
 	n.db = db
 	d := dao.NewGraphDAO(db)
 	repo := repository.NewGraphRepo(d)
-	svc := service.NewGraphService(repo)
-	handler := web.NewGraphHandler(svc)
+	validator := service.NewGraphValidator()
+	svc := service.NewGraphService(repo, validator)
+	runRepo := repository.NewGraphRunRepo(dao.NewGraphRunDAO(db))
+	// 上游是本机的 httptest 服务，默认的客户端不允许访问
+	runSvc := service.NewGraphRunService(repo, runRepo, validator, nil, nil, nil, nil,
+		service.WithHTTPNodeClient(http.DefaultClient),
+		service.WithNodeExecutor("echo", echoNode{}, nil))
+	handler := web.NewGraphHandler(svc, runSvc)
 	server := gin.Default()
 	handler.PrivateRoutes(server)
+	triggerSvc := service.NewGraphTriggerService(repository.NewGraphTriggerRepo(dao.NewGraphTriggerDAO(db)), runSvc)
+	triggerHandler := web.NewGraphTriggerHandler(triggerSvc)
+	triggerHandler.PrivateRoutes(server)
+	triggerHandler.PublicRoutes(server)
 	n.server = server
+	n.runSvc = runSvc
+	n.triggerSvc = triggerSvc
 }
 
 func (n *GraphTestSuite) TearDownTest() {
@@ -78,6 +104,16 @@ func (n *GraphTestSuite) TearDownTest() {
 	require.NoError(n.T(), err)
 	err = n.db.Exec("TRUNCATE TABLE graphs").Error
 	require.NoError(n.T(), err)
+	err = n.db.Exec("TRUNCATE TABLE graph_versions").Error
+	require.NoError(n.T(), err)
+	err = n.db.Exec("TRUNCATE TABLE graph_runs").Error
+	require.NoError(n.T(), err)
+	err = n.db.Exec("TRUNCATE TABLE graph_node_runs").Error
+	require.NoError(n.T(), err)
+	err = n.db.Exec("TRUNCATE TABLE graph_triggers").Error
+	require.NoError(n.T(), err)
+	err = n.db.Exec("TRUNCATE TABLE graph_trigger_records").Error
+	require.NoError(n.T(), err)
 }
 
 func (n *GraphTestSuite) TestSaveNode() {
@@ -86,25 +122,24 @@ func (n *GraphTestSuite) TestSaveNode() {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	now := time.Now().UnixMilli()
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+
 	testcases := []struct {
 		name     string
-		before   func()
 		after    func()
 		reqBody  string
 		wantCode int
 	}{
 		{
 			name: "创建 node",
-			before: func() {
-				sess := mocks.NewMockSession(ctrl)
-				sess.EXPECT().Claims().Return(session.Claims{
-					Uid:  1,
-					Data: map[string]string{},
-				}).AnyTimes()
-				provider := mocks.NewMockProvider(ctrl)
-				session.SetDefaultProvider(provider)
-				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
-			},
 			after: func() {
 				var node dao.Node
 				err := n.db.Where("id = ?", 1).First(&node).Error
@@ -112,56 +147,104 @@ func (n *GraphTestSuite) TestSaveNode() {
 				assert.Equal(t, int64(1), node.GraphID)
 				assert.True(t, node.Utime > 0)
 				assert.True(t, node.Ctime > 0)
+				n.assertGraphVersion(1, 1)
 			},
-			reqBody:  `{"graph_id": 1}`,
-			wantCode: http.StatusOK,
+			reqBody:  `{"graph_id": 1, "type": "template", "metadata": "{\"template\": \"你好\"}"}`,
+			wantCode: 0,
 		},
 		{
 			name: "更新 node",
-			before: func() {
-				sess := mocks.NewMockSession(ctrl)
-				sess.EXPECT().Claims().Return(session.Claims{
-					Uid:  1,
-					Data: map[string]string{},
-				}).AnyTimes()
-				provider := mocks.NewMockProvider(ctrl)
-				session.SetDefaultProvider(provider)
-				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
-				// 插入一条数据
-				err := n.db.Create(&dao.Node{GraphID: 1, Ctime: time.Now().UnixMilli(), Utime: time.Now().UnixMilli()}).Error
+			after: func() {
+				var node dao.Node
+				err := n.db.Where("id = ?", 1).First(&node).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), node.GraphID)
+				assert.Equal(t, `{"template": "再见"}`, node.Metadata)
+				n.assertGraphVersion(1, 2)
+			},
+			reqBody:  `{"id": 1, "graph_id": 1, "type": "template", "metadata": "{\"template\": \"再见\"}"}`,
+			wantCode: 0,
+		},
+		{
+			name: "换到其他图",
+			after: func() {
+				var node dao.Node
+				err := n.db.Where("id = ?", 1).First(&node).Error
 				require.NoError(t, err)
+				assert.Equal(t, int64(1), node.GraphID)
+				n.assertGraphVersion(2, 0)
 			},
+			reqBody:  `{"id": 1, "graph_id": 2, "type": "template", "metadata": "{\"template\": \"你好\"}"}`,
+			wantCode: 400001,
+		},
+		{
+			name: "配置不合法",
 			after: func() {
 				var node dao.Node
 				err := n.db.Where("id = ?", 1).First(&node).Error
 				require.NoError(t, err)
-				assert.Equal(t, int64(2), node.GraphID)
-				assert.True(t, node.Utime > 0)
-				assert.True(t, node.Ctime > 0)
+				assert.Equal(t, "template", node.Type)
+				n.assertGraphVersion(1, 2)
+			},
+			reqBody:  `{"id": 1, "graph_id": 1, "type": "llm", "metadata": "{}"}`,
+			wantCode: 400001,
+		},
+		{
+			name: "图不存在",
+			after: func() {
+				var cnt int64
+				require.NoError(t, n.db.Model(&dao.Node{}).Count(&cnt).Error)
+				assert.Equal(t, int64(1), cnt)
 			},
-			reqBody:  `{"id": 1, "graph_id": 2}`,
-			wantCode: http.StatusOK,
+			reqBody:  `{"graph_id": 99, "type": "template", "metadata": "{\"template\": \"你好\"}"}`,
+			wantCode: 404001,
 		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.before()
 			req, err := http.NewRequest(http.MethodPost, "/node/save", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
 			resp := httptest.NewRecorder()
 			n.server.ServeHTTP(resp, req)
+			var result Result[json.RawMessage]
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, tc.wantCode, result.Code)
 			tc.after()
 		})
 	}
 }
 
+// assertGraphVersion 检查图的版本号，并且每个版本都有快照
+func (n *GraphTestSuite) assertGraphVersion(graphID int64, version int64) {
+	t := n.T()
+	var graph dao.Graph
+	require.NoError(t, n.db.First(&graph, graphID).Error)
+	assert.Equal(t, version, graph.Version)
+	var cnt int64
+	require.NoError(t, n.db.Model(&dao.GraphVersion{}).Where("graph_id = ?", graphID).Count(&cnt).Error)
+	assert.Equal(t, version, cnt)
+}
+
 func (n *GraphTestSuite) TestSaveEdge() {
 	t := n.T()
 
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	now := time.Now().UnixMilli()
+	err := n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error
+	require.NoError(t, err)
+	err = n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error
+	require.NoError(t, err)
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "template", Metadata: `{"template": "a"}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "b"}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "c"}`},
+		{GraphID: 2, Type: "template", Metadata: `{"template": "d"}`},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+
 	testcases := []struct {
 		name     string
 		before   func()
@@ -190,9 +273,10 @@ func (n *GraphTestSuite) TestSaveEdge() {
 				assert.Equal(t, int64(2), edge.TargetID)
 				assert.True(t, edge.Utime > 0)
 				assert.True(t, edge.Ctime > 0)
+				n.assertGraphVersion(1, 1)
 			},
 			reqBody:  `{"graph_id": 1, "source_id": 1, "target_id": 2}`,
-			wantCode: http.StatusOK,
+			wantCode: 0,
 		},
 		{
 			name: "更新edge",
@@ -205,9 +289,6 @@ func (n *GraphTestSuite) TestSaveEdge() {
 				provider := mocks.NewMockProvider(ctrl)
 				session.SetDefaultProvider(provider)
 				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
-				// 插入一条数据
-				err := n.db.Create(&dao.Edge{GraphID: 1, SourceID: 1, TargetID: 2, Ctime: time.Now().UnixMilli(), Utime: time.Now().UnixMilli()}).Error
-				require.NoError(t, err)
 			},
 			after: func() {
 				var edge dao.Edge
@@ -219,9 +300,48 @@ func (n *GraphTestSuite) TestSaveEdge() {
 
 				assert.True(t, edge.Ctime > 0)
 				assert.True(t, edge.Utime > 0)
+				n.assertGraphVersion(1, 2)
 			},
 			reqBody:  `{"id": 1, "graph_id": 1, "source_id": 2, "target_id": 3}`,
-			wantCode: http.StatusOK,
+			wantCode: 0,
+		},
+		{
+			name: "形成环",
+			before: func() {
+				sess := mocks.NewMockSession(ctrl)
+				sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+				provider := mocks.NewMockProvider(ctrl)
+				session.SetDefaultProvider(provider)
+				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
+			},
+			after: func() {
+				var cnt int64
+				err := n.db.Model(&dao.Edge{}).Where("source_id = ? AND target_id = ?", 3, 2).Count(&cnt).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), cnt)
+				n.assertGraphVersion(1, 2)
+			},
+			reqBody:  `{"graph_id": 1, "source_id": 3, "target_id": 2}`,
+			wantCode: 400001,
+		},
+		{
+			name: "连接其他图的节点",
+			before: func() {
+				sess := mocks.NewMockSession(ctrl)
+				sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+				provider := mocks.NewMockProvider(ctrl)
+				session.SetDefaultProvider(provider)
+				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
+			},
+			after: func() {
+				var cnt int64
+				err := n.db.Model(&dao.Edge{}).Where("target_id = ?", 4).Count(&cnt).Error
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), cnt)
+				n.assertGraphVersion(1, 2)
+			},
+			reqBody:  `{"graph_id": 1, "source_id": 3, "target_id": 4}`,
+			wantCode: 400001,
 		},
 	}
 	for _, tc := range testcases {
@@ -232,6 +352,9 @@ func (n *GraphTestSuite) TestSaveEdge() {
 			req.Header.Set("Content-Type", "application/json")
 			resp := httptest.NewRecorder()
 			n.server.ServeHTTP(resp, req)
+			var result Result[json.RawMessage]
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, tc.wantCode, result.Code)
 			tc.after()
 		})
 	}
@@ -289,6 +412,19 @@ func (n *GraphTestSuite) TestGetGraph() {
 	}
 }
 
+// createLinkedGraph 创建一个图，里面是两个节点和连接它们的一条边
+func (n *GraphTestSuite) createLinkedGraph() {
+	t := n.T()
+	now := time.Now().UnixMilli()
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "template", Metadata: `{"template": "a"}`, Ctime: now, Utime: now},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "b"}`, Ctime: now, Utime: now},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+	require.NoError(t, n.db.Create(&dao.Edge{GraphID: 1, SourceID: 1, TargetID: 2, Ctime: now, Utime: now}).Error)
+}
+
 func (n *GraphTestSuite) TestDeleteNode() {
 	t := n.T()
 	ctrl := gomock.NewController(t)
@@ -309,13 +445,19 @@ func (n *GraphTestSuite) TestDeleteNode() {
 				provider := mocks.NewMockProvider(ctrl)
 				session.SetDefaultProvider(provider)
 				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
-				err := n.db.Create(&dao.Node{GraphID: 1, Ctime: time.Now().UnixMilli(), Utime: time.Now().UnixMilli()}).Error
-				require.NoError(t, err)
+				n.createLinkedGraph()
 			},
 			after: func() {
 				var node dao.Node
 				err := n.db.Where("id = ?", 1).First(&node).Error
 				require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+				// 连着这个节点的边也一起删除
+				var cnt int64
+				require.NoError(t, n.db.Model(&dao.Edge{}).Count(&cnt).Error)
+				assert.Equal(t, int64(0), cnt)
+				require.NoError(t, n.db.Model(&dao.Node{}).Count(&cnt).Error)
+				assert.Equal(t, int64(1), cnt)
+				n.assertGraphVersion(1, 1)
 			},
 			reqBody: `{"id": 1}`,
 		},
@@ -354,16 +496,16 @@ func (n *GraphTestSuite) TestDeleteEdge() {
 				provider := mocks.NewMockProvider(ctrl)
 				session.SetDefaultProvider(provider)
 				provider.EXPECT().Get(gomock.Any()).Return(sess, nil)
-				err := n.db.Create(&dao.Edge{GraphID: 1, SourceID: 1, TargetID: 2, Ctime: time.Now().UnixMilli(), Utime: time.Now().UnixMilli()}).Error
-				require.NoError(t, err)
-				var edge1 dao.Edge
-				n.db.Create(&edge1)
-				require.NoError(t, err)
+				n.createLinkedGraph()
 			},
 			after: func() {
 				var edge dao.Edge
 				err := n.db.Where("id = ?", 1).First(&edge).Error
 				require.Equal(t, err, gorm.ErrRecordNotFound)
+				var cnt int64
+				require.NoError(t, n.db.Model(&dao.Node{}).Count(&cnt).Error)
+				assert.Equal(t, int64(2), cnt)
+				n.assertGraphVersion(1, 1)
 			},
 			reqBody: `{"id": 1}`,
 		},
@@ -381,3 +523,866 @@ func (n *GraphTestSuite) TestDeleteEdge() {
 		})
 	}
 }
+
+func (n *GraphTestSuite) TestRun() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	now := time.Now().UnixMilli()
+	err := n.db.Create(&dao.Graph{Metadata: "run", Ctime: now, Utime: now}).Error
+	require.NoError(t, err)
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "condition", Metadata: `{"cases":[{"path":"input.vip","op":"eq","value":true,"branch":"vip"}],"default":"normal"}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template":"尊贵的 {{input.name}}"}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template":"你好 {{input.name}}"}`},
+		{GraphID: 1, Type: "transform", Metadata: `{"fields":{"greeting":"input","name":"run.name"}}`},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+	edges := []dao.Edge{
+		{GraphID: 1, SourceID: 1, TargetID: 2, Metadata: `{"branch":"vip"}`},
+		{GraphID: 1, SourceID: 1, TargetID: 3, Metadata: `{"branch":"normal"}`},
+		{GraphID: 1, SourceID: 2, TargetID: 4},
+		{GraphID: 1, SourceID: 3, TargetID: 4},
+	}
+	require.NoError(t, n.db.Create(&edges).Error)
+
+	testcases := []struct {
+		name        string
+		reqBody     string
+		wantCode    int
+		wantStatus  string
+		wantOutput  any
+		wantSkipped int64
+	}{
+		{
+			name:        "选中 vip 分支",
+			reqBody:     `{"graph_id": 1, "input": {"name": "Tom", "vip": true}}`,
+			wantCode:    0,
+			wantStatus:  "succeeded",
+			wantOutput:  map[string]any{"greeting": "尊贵的 Tom", "name": "Tom"},
+			wantSkipped: 3,
+		},
+		{
+			name:        "选中默认分支",
+			reqBody:     `{"graph_id": 1, "input": {"name": "Jerry"}}`,
+			wantCode:    0,
+			wantStatus:  "succeeded",
+			wantOutput:  map[string]any{"greeting": "你好 Jerry", "name": "Jerry"},
+			wantSkipped: 2,
+		},
+		{
+			name:     "图不存在",
+			reqBody:  `{"graph_id": 100}`,
+			wantCode: 404001,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/graph/run", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			n.server.ServeHTTP(resp, req)
+			var result Result[web.GraphRunVO]
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCode, result.Code)
+			if tc.wantCode != 0 {
+				return
+			}
+			assert.Equal(t, tc.wantStatus, result.Data.Status)
+			assert.Equal(t, tc.wantOutput, result.Data.Output)
+			require.Len(t, result.Data.Nodes, 4)
+			for _, node := range result.Data.Nodes {
+				if node.NodeID == tc.wantSkipped {
+					assert.Equal(t, "skipped", node.Status)
+				} else {
+					assert.Equal(t, "succeeded", node.Status)
+				}
+			}
+
+			var run dao.GraphRun
+			err = n.db.Where("id = ?", result.Data.ID).First(&run).Error
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, run.Status)
+			var cnt int64
+			err = n.db.Model(&dao.NodeRun{}).Where("run_id = ? AND status = ?", run.ID, "succeeded").Count(&cnt).Error
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), cnt)
+		})
+	}
+}
+
+func (n *GraphTestSuite) TestLLMNodeACL() {
+	t := n.T()
+	defer n.TearDownTest()
+	require.NoError(t, dao.InitTable(n.db))
+	prompt := dao.Prompt{Name: "graph", Owner: 1, OwnerType: "personal"}
+	require.NoError(t, n.db.Create(&prompt).Error)
+	version := dao.PromptVersion{PromptID: prompt.ID, Content: "总结 {{input}}"}
+	require.NoError(t, n.db.Create(&version).Error)
+	defer func() {
+		require.NoError(t, n.db.Delete(&dao.PromptVersion{}, version.ID).Error)
+		require.NoError(t, n.db.Delete(&dao.Prompt{}, prompt.ID).Error)
+	}()
+
+	now := time.Now().UnixMilli()
+	graph := dao.Graph{Metadata: "llm", Ctime: now, Utime: now}
+	require.NoError(t, n.db.Create(&graph).Error)
+	node := dao.Node{GraphID: graph.ID, Type: "llm",
+		Metadata: fmt.Sprintf(`{"key":"llm","prompt_id":%d,"version_id":%d}`, prompt.ID, version.ID)}
+	require.NoError(t, n.db.Create(&node).Error)
+
+	testcases := []struct {
+		name       string
+		uid        int64
+		before     func(handler *mocks.MockHandler)
+		wantStatus domain.GraphRunStatus
+		wantOutput any
+	}{
+		{
+			name: "prompt 的 owner 可以执行",
+			uid:  1,
+			before: func(handler *mocks.MockHandler) {
+				handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+					Return(domain.ChatResponse{Response: domain.Message{Content: "摘要"}}, nil)
+			},
+			wantStatus: domain.GraphRunStatusSucceeded,
+			wantOutput: "摘要",
+		},
+		{
+			name:       "没有 prompt 权限的用户不能执行",
+			uid:        2,
+			before:     func(handler *mocks.MockHandler) {},
+			wantStatus: domain.GraphRunStatusFailed,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			handler := mocks.NewMockHandler(ctrl)
+			tc.before(handler)
+			graphRepo := repository.NewGraphRepo(dao.NewGraphDAO(n.db))
+			promptRepo := repository.NewPromptRepo(dao.NewPromptDAO(n.db))
+			promptACL := service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(n.db)), promptRepo)
+			runSvc := service.NewGraphRunService(graphRepo, repository.NewGraphRunRepo(dao.NewGraphRunDAO(n.db)),
+				service.NewGraphValidator(), service.NewPromptService(promptRepo), promptACL, handler, nil)
+
+			run, err := runSvc.Run(context.Background(), domain.GraphRunRequest{GraphID: graph.ID, Uid: tc.uid, Input: "文章"})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, run.Status)
+			assert.Equal(t, tc.wantOutput, run.Output)
+		})
+	}
+}
+
+func (n *GraphTestSuite) TestValidate() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	now := time.Now().UnixMilli()
+	err := n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error
+	require.NoError(t, err)
+	// 直接写数据库，绕过保存时的检查
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "template", Metadata: `{"template": "a"}`},
+		{GraphID: 1, Type: "shell"},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "c"}`},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+	edges := []dao.Edge{
+		{GraphID: 1, SourceID: 1, TargetID: 2},
+		{GraphID: 1, SourceID: 2, TargetID: 1},
+		{GraphID: 1, SourceID: 1, TargetID: 10},
+	}
+	require.NoError(t, n.db.Create(&edges).Error)
+
+	testcases := []struct {
+		name       string
+		reqBody    string
+		wantCode   int
+		wantIssues []web.GraphIssueVO
+	}{
+		{
+			name:     "返回所有问题",
+			reqBody:  `{"id": 1}`,
+			wantCode: 0,
+			wantIssues: []web.GraphIssueVO{
+				{Level: "error", Code: "unknown_type", NodeID: 2, Message: `节点 2 的类型 "shell" 不支持`},
+				{Level: "error", Code: "dangling_edge", EdgeID: 3, Message: "边 3 连接的节点 10 不存在"},
+				{Level: "error", Code: "cycle", NodeID: 1, Message: "节点 1 -> 2 组成了环"},
+				{Level: "warning", Code: "orphaned_node", NodeID: 3, Message: "节点 3 没有连接任何节点"},
+			},
+		},
+		{
+			name:     "图不存在",
+			reqBody:  `{"id": 100}`,
+			wantCode: 404001,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/graph/validate", bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			n.server.ServeHTTP(resp, req)
+			var result Result[[]web.GraphIssueVO]
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCode, result.Code)
+			assert.Equal(t, tc.wantIssues, result.Data)
+		})
+	}
+}
+
+// echoNode 自定义的节点类型，原样输出输入
+type echoNode struct{}
+
+func (echoNode) Execute(_ context.Context, nc service.NodeContext) (service.NodeResult, error) {
+	return service.NodeResult{Output: nc.Input}, nil
+}
+
+// 通过 WithNodeExecutor 注册的自定义节点可以保存，也可以执行
+func (n *GraphTestSuite) TestSaveCustomNode() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	post := func(path string, body string, data any) int {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		result := Result[json.RawMessage]{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		if data != nil && len(result.Data) > 0 {
+			require.NoError(t, json.Unmarshal(result.Data, data))
+		}
+		return result.Code
+	}
+
+	var graph web.GraphVO
+	code := post("/graph/save", `{"steps": [
+		{"id": -1, "type": "template", "metadata": "{\"template\": \"hello {{input.name}}\"}"},
+		{"id": -2, "type": "echo"}
+	], "edges": [{"source_id": -1, "target_id": -2}]}`, &graph)
+	require.Equal(t, 0, code)
+	require.Len(t, graph.Nodes, 2)
+
+	var run web.GraphRunVO
+	code = post("/graph/run", fmt.Sprintf(`{"graph_id": %d, "input": {"name": "Tom"}}`, graph.ID), &run)
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", run.Status)
+	assert.Equal(t, "hello Tom", run.Output)
+
+	// 没有注册的类型还是不能保存
+	code = post("/graph/save", `{"steps": [{"id": -1, "type": "shell"}]}`, nil)
+	assert.Equal(t, 400001, code)
+}
+
+func (n *GraphTestSuite) TestSaveGraph() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	post := func(path string, body string, data any) int {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		result := Result[json.RawMessage]{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		if data != nil && len(result.Data) > 0 {
+			require.NoError(t, json.Unmarshal(result.Data, data))
+		}
+		return result.Code
+	}
+
+	// 创建图，新节点使用临时 ID
+	var graph web.GraphVO
+	code := post("/graph/save", `{
+		"metadata": "v1",
+		"steps": [
+			{"id": -1, "type": "template", "metadata": "{\"template\": \"hello {{input.name}}\"}"},
+			{"id": -2, "type": "transform", "metadata": "{\"fields\": {\"greeting\": \"input\"}}"}
+		],
+		"edges": [{"source_id": -1, "target_id": -2}]
+	}`, &graph)
+	require.Equal(t, 0, code)
+	assert.Equal(t, int64(1), graph.Version)
+	assert.Equal(t, "v1", graph.Metadata)
+	require.Len(t, graph.Nodes, 2)
+	require.Len(t, graph.Edges, 1)
+	first, second := graph.Nodes[0].ID, graph.Nodes[1].ID
+	assert.True(t, first > 0 && second > 0)
+	assert.Equal(t, first, graph.Edges[0].SourceID)
+	assert.Equal(t, second, graph.Edges[0].TargetID)
+
+	// 修改第一个节点，删除第二个节点和边
+	body := fmt.Sprintf(`{"id": %d, "version": 1, "metadata": "v2", "steps": [
+		{"id": %d, "type": "template", "metadata": "{\"template\": \"hi {{input.name}}\"}"}
+	]}`, graph.ID, first)
+	code = post("/graph/save", body, &graph)
+	require.Equal(t, 0, code)
+	assert.Equal(t, int64(2), graph.Version)
+	require.Len(t, graph.Nodes, 1)
+	assert.Empty(t, graph.Edges)
+	var cnt int64
+	require.NoError(t, n.db.Model(&dao.Node{}).Where("graph_id = ?", graph.ID).Count(&cnt).Error)
+	assert.Equal(t, int64(1), cnt)
+	require.NoError(t, n.db.Model(&dao.Edge{}).Where("graph_id = ?", graph.ID).Count(&cnt).Error)
+	assert.Equal(t, int64(0), cnt)
+
+	// 使用旧的版本保存
+	code = post("/graph/save", body, nil)
+	assert.Equal(t, 409001, code)
+
+	// 图不合法的时候什么都不会保存
+	var issues []web.GraphIssueVO
+	code = post("/graph/save", fmt.Sprintf(`{"id": %d, "version": 2, "steps": [
+		{"id": %d, "type": "template", "metadata": "{\"template\": \"hi\"}"},
+		{"id": -1, "type": "shell"}
+	], "edges": [{"source_id": %d, "target_id": -1}]}`, graph.ID, first, first), &issues)
+	assert.Equal(t, 400001, code)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "unknown_type", issues[0].Code)
+	var saved dao.Graph
+	require.NoError(t, n.db.First(&saved, graph.ID).Error)
+	assert.Equal(t, int64(2), saved.Version)
+	assert.Equal(t, "v2", saved.Metadata)
+
+	// 每次保存都有一个版本
+	var versions []web.GraphVersionVO
+	code = post("/graph/versions", fmt.Sprintf(`{"id": %d}`, graph.ID), &versions)
+	require.Equal(t, 0, code)
+	assert.Equal(t, []int64{2, 1}, slice.Map(versions, func(idx int, src web.GraphVersionVO) int64 {
+		return src.Version
+	}))
+	var version web.GraphVersionVO
+	code = post("/graph/version/detail", fmt.Sprintf(`{"graph_id": %d, "version": 1}`, graph.ID), &version)
+	require.Equal(t, 0, code)
+	require.NotNil(t, version.Graph)
+	assert.Len(t, version.Graph.Nodes, 2)
+	assert.Equal(t, "v1", version.Graph.Metadata)
+
+	// 执行的时候可以指定版本
+	var run web.GraphRunVO
+	code = post("/graph/run", fmt.Sprintf(`{"graph_id": %d, "version": 1, "input": {"name": "Tom"}}`, graph.ID), &run)
+	require.Equal(t, 0, code)
+	assert.Equal(t, int64(1), run.Version)
+	assert.Equal(t, map[string]any{"greeting": "hello Tom"}, run.Output)
+	code = post("/graph/run", fmt.Sprintf(`{"graph_id": %d, "input": {"name": "Tom"}}`, graph.ID), &run)
+	require.Equal(t, 0, code)
+	assert.Equal(t, int64(2), run.Version)
+	assert.Equal(t, "hi Tom", run.Output)
+}
+
+func (n *GraphTestSuite) TestRetryAndResume() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	var healthy atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"answer": "42"}`))
+	}))
+	defer upstream.Close()
+
+	now := time.Now().UnixMilli()
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "template", Metadata: `{"template": "{{input.q}}"}`},
+		{GraphID: 1, Type: "http", Metadata: fmt.Sprintf(`{"url": "%s", "method": "POST", "body": "{{input}}"}`, upstream.URL)},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "答案是 {{input.answer}}"}`},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+	edges := []dao.Edge{
+		{GraphID: 1, SourceID: 1, TargetID: 2},
+		{GraphID: 1, SourceID: 2, TargetID: 3},
+	}
+	require.NoError(t, n.db.Create(&edges).Error)
+
+	post := func(path string, body string) (int, web.GraphRunVO) {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		var result Result[web.GraphRunVO]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Code, result.Data
+	}
+	statuses := func(run web.GraphRunVO) []string {
+		return slice.Map(run.Nodes, func(idx int, src web.NodeRunVO) string {
+			return fmt.Sprintf("%s/%d", src.Status, src.Attempts)
+		})
+	}
+
+	healthy.Store(false)
+	code, run := post("/graph/run", `{"graph_id": 1, "input": {"q": "问题"}}`)
+	require.Equal(t, 0, code)
+	assert.Equal(t, "failed", run.Status)
+	assert.Equal(t, []string{"succeeded/1", "failed/1", "pending/0"}, statuses(run))
+
+	// 只有失败的节点可以重试
+	code, _ = post("/graph/run/retry", fmt.Sprintf(`{"run_id": %d, "node_id": 1}`, run.ID))
+	assert.Equal(t, 400001, code)
+	// 重试之后还是失败
+	code, run = post("/graph/run/retry", fmt.Sprintf(`{"run_id": %d, "node_id": 2}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "failed", run.Status)
+	assert.Equal(t, []string{"succeeded/1", "failed/2", "pending/0"}, statuses(run))
+
+	healthy.Store(true)
+	code, run = post("/graph/run/retry", fmt.Sprintf(`{"run_id": %d, "node_id": 2}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "paused", run.Status)
+	assert.Equal(t, []string{"succeeded/1", "succeeded/3", "pending/0"}, statuses(run))
+
+	// 继续执行，已经成功的节点不会再执行
+	code, run = post("/graph/run/resume", fmt.Sprintf(`{"id": %d}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", run.Status)
+	assert.Equal(t, "答案是 42", run.Output)
+	assert.Equal(t, []string{"succeeded/1", "succeeded/3", "succeeded/1"}, statuses(run))
+	// 执行成功之后不能再继续
+	code, _ = post("/graph/run/resume", fmt.Sprintf(`{"id": %d}`, run.ID))
+	assert.Equal(t, 400001, code)
+
+	// 失败之后直接继续执行
+	healthy.Store(false)
+	code, second := post("/graph/run", `{"graph_id": 1, "input": {"q": "问题"}}`)
+	require.Equal(t, 0, code)
+	assert.Equal(t, "failed", second.Status)
+	healthy.Store(true)
+	code, second = post("/graph/run/resume", fmt.Sprintf(`{"id": %d}`, second.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", second.Status)
+	assert.Equal(t, []string{"succeeded/1", "succeeded/2", "succeeded/1"}, statuses(second))
+
+	code, detail := post("/graph/run/detail", fmt.Sprintf(`{"id": %d}`, second.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, statuses(second), statuses(detail))
+
+	req, err := http.NewRequest(http.MethodPost, "/graph/run/list", bytes.NewBuffer([]byte(`{"graph_id": 1}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	n.server.ServeHTTP(resp, req)
+	var list Result[[]web.GraphRunVO]
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Equal(t, []int64{second.ID, run.ID}, slice.Map(list.Data, func(idx int, src web.GraphRunVO) int64 {
+		return src.ID
+	}))
+}
+
+func (n *GraphTestSuite) TestApproval() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uid := int64(2)
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().DoAndReturn(func() session.Claims {
+		return session.Claims{Uid: uid}
+	}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	now := time.Now().UnixMilli()
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+	nodes := []dao.Node{
+		{GraphID: 1, Type: "template", Metadata: `{"template": "回复: {{input.q}}"}`},
+		{GraphID: 1, Type: "approval", Metadata: `{"timeout_seconds": 3600}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "发送 {{input}}"}`},
+		{GraphID: 1, Type: "template", Metadata: `{"template": "丢弃 {{input}}"}`},
+	}
+	require.NoError(t, n.db.Create(&nodes).Error)
+	edges := []dao.Edge{
+		{GraphID: 1, SourceID: 1, TargetID: 2},
+		{GraphID: 1, SourceID: 2, TargetID: 3},
+		{GraphID: 1, SourceID: 2, TargetID: 4, Metadata: `{"branch": "rejected"}`},
+	}
+	require.NoError(t, n.db.Create(&edges).Error)
+
+	post := func(path string, body string) (int, web.GraphRunVO) {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		var result Result[web.GraphRunVO]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Code, result.Data
+	}
+	statuses := func(run web.GraphRunVO) []string {
+		return slice.Map(run.Nodes, func(idx int, src web.NodeRunVO) string {
+			return src.Status
+		})
+	}
+
+	code, run := post("/graph/run", `{"graph_id": 1, "input": {"q": "你好"}}`)
+	require.Equal(t, 0, code)
+	assert.Equal(t, "waiting", run.Status)
+	assert.Equal(t, []string{"succeeded", "waiting", "pending", "pending"}, statuses(run))
+	assert.Equal(t, "回复: 你好", run.Nodes[1].Input)
+	assert.Greater(t, run.Nodes[1].Deadline, now)
+
+	approvals := func() []web.ApprovalVO {
+		req, err := http.NewRequest(http.MethodPost, "/graph/approval/list", bytes.NewBuffer([]byte(`{}`)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		var list Result[[]web.ApprovalVO]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		require.Equal(t, 0, list.Code)
+		return list.Data
+	}
+	list := approvals()
+	require.Len(t, list, 1)
+	assert.Equal(t, web.ApprovalVO{RunID: run.ID, NodeID: 2, Input: "回复: 你好", Deadline: run.Nodes[1].Deadline}, list[0])
+
+	// 其他用户看不到，也不能审批
+	uid = 3
+	assert.Empty(t, approvals())
+	code, _ = post("/graph/run/approve",
+		fmt.Sprintf(`{"run_id": %d, "node_id": 2, "approved": true, "payload": "别人的回复"}`, run.ID))
+	assert.Equal(t, 403001, code)
+	uid = 2
+
+	// 等待审批的时候不能继续执行
+	code, _ = post("/graph/run/resume", fmt.Sprintf(`{"id": %d}`, run.ID))
+	assert.Equal(t, 400001, code)
+	// 只有等待审批的节点可以审批
+	code, _ = post("/graph/run/approve", fmt.Sprintf(`{"run_id": %d, "node_id": 1, "approved": true}`, run.ID))
+	assert.Equal(t, 400001, code)
+
+	// 修改之后通过
+	code, run = post("/graph/run/approve",
+		fmt.Sprintf(`{"run_id": %d, "node_id": 2, "approved": true, "payload": "回复: 您好", "comment": "改得礼貌一点"}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", run.Status)
+	assert.Equal(t, "发送 回复: 您好", run.Output)
+	assert.Equal(t, []string{"succeeded", "succeeded", "succeeded", "skipped"}, statuses(run))
+	approval := run.Nodes[1].Approval
+	require.NotNil(t, approval)
+	assert.True(t, approval.Approved)
+	assert.True(t, approval.Edited)
+	assert.Equal(t, int64(2), approval.Uid)
+	assert.Equal(t, "改得礼貌一点", approval.Comment)
+	// 已经审批过了
+	code, _ = post("/graph/run/approve", fmt.Sprintf(`{"run_id": %d, "node_id": 2, "approved": false}`, run.ID))
+	assert.Equal(t, 400001, code)
+
+	// 拒绝
+	code, run = post("/graph/run", `{"graph_id": 1, "input": {"q": "你好"}}`)
+	require.Equal(t, 0, code)
+	code, run = post("/graph/run/approve", fmt.Sprintf(`{"run_id": %d, "node_id": 2, "approved": false}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", run.Status)
+	assert.Equal(t, "丢弃 回复: 你好", run.Output)
+	assert.Equal(t, []string{"succeeded", "succeeded", "skipped", "succeeded"}, statuses(run))
+
+	// 超时之后默认拒绝
+	code, run = post("/graph/run", `{"graph_id": 1, "input": {"q": "你好"}}`)
+	require.Equal(t, 0, code)
+	require.NoError(t, n.db.Model(&dao.NodeRun{}).Where("run_id = ?", run.ID).Update("deadline", now-1).Error)
+	code, _ = post("/graph/run/approve", fmt.Sprintf(`{"run_id": %d, "node_id": 2, "approved": true}`, run.ID))
+	assert.Equal(t, 400001, code)
+	cnt, err := n.runSvc.ExpireApprovals(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	code, run = post("/graph/run/detail", fmt.Sprintf(`{"id": %d}`, run.ID))
+	require.Equal(t, 0, code)
+	assert.Equal(t, "丢弃 回复: 你好", run.Output)
+	require.NotNil(t, run.Nodes[1].Approval)
+	assert.True(t, run.Nodes[1].Approval.Timeout)
+	cnt, err = n.runSvc.ExpireApprovals(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+}
+
+func (n *GraphTestSuite) TestTrigger() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 3}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	now := time.Now().UnixMilli()
+	require.NoError(t, n.db.Create(&dao.Graph{Ctime: now, Utime: now}).Error)
+	require.NoError(t, n.db.Create(&dao.Node{GraphID: 1, Type: "template", Metadata: `{"template": "收到 {{input.name}}"}`}).Error)
+
+	post := func(path string, body string, header map[string]string) Result[json.RawMessage] {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		var result Result[json.RawMessage]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+	save := func(body string) (int, web.GraphTriggerVO) {
+		res := post("/graph/trigger/save", body, nil)
+		var vo web.GraphTriggerVO
+		if res.Code == 0 {
+			require.NoError(t, json.Unmarshal(res.Data, &vo))
+		}
+		return res.Code, vo
+	}
+	record := func(res Result[json.RawMessage]) web.GraphTriggerRecordVO {
+		require.Equal(t, 0, res.Code)
+		var vo web.GraphTriggerRecordVO
+		require.NoError(t, json.Unmarshal(res.Data, &vo))
+		return vo
+	}
+	// 后台执行结束之后才能清理数据
+	waitRun := func(id int64) web.GraphRunVO {
+		var run web.GraphRunVO
+		require.Eventually(t, func() bool {
+			res := post("/graph/run/detail", fmt.Sprintf(`{"id": %d}`, id), nil)
+			require.NoError(t, json.Unmarshal(res.Data, &run))
+			return run.Status == "succeeded"
+		}, 5*time.Second, 50*time.Millisecond)
+		return run
+	}
+
+	code, _ := save(`{"graph_id": 1, "type": "cron", "cron": "every minute", "enabled": true}`)
+	assert.Equal(t, 400001, code)
+	code, _ = save(`{"graph_id": 2, "type": "manual", "enabled": true}`)
+	assert.Equal(t, 404001, code)
+
+	// 手动触发
+	code, manual := save(`{"graph_id": 1, "type": "manual", "enabled": true}`)
+	require.Equal(t, 0, code)
+	fired := record(post("/graph/trigger/fire", fmt.Sprintf(`{"id": %d, "payload": {"name": "手动"}}`, manual.ID), nil))
+	assert.Equal(t, "started", fired.Status)
+	assert.Equal(t, "收到 手动", waitRun(fired.RunID).Output)
+
+	// webhook 需要签名
+	code, hook := save(`{"graph_id": 1, "type": "webhook", "enabled": true}`)
+	require.Equal(t, 0, code)
+	require.NotEmpty(t, hook.Secret)
+	assert.Equal(t, fmt.Sprintf("/graph/webhook/%d", hook.ID), hook.WebhookPath)
+	body := `{"name": "webhook"}`
+	sign := func(timestamp int64, body string) map[string]string {
+		ts := strconv.FormatInt(timestamp, 10)
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write([]byte(ts + "." + body))
+		return map[string]string{"X-Timestamp": ts, "X-Signature": hex.EncodeToString(mac.Sum(nil))}
+	}
+	res := post(hook.WebhookPath, body, map[string]string{"X-Timestamp": strconv.FormatInt(time.Now().Unix(), 10), "X-Signature": "0000"})
+	assert.Equal(t, 403001, res.Code)
+	// 过期的请求不能重放
+	res = post(hook.WebhookPath, body, sign(time.Now().Add(-time.Hour).Unix(), body))
+	assert.Equal(t, 403001, res.Code)
+	// 请求体太大
+	large := `{"name": "` + strings.Repeat("a", 1<<20) + `"}`
+	res = post(hook.WebhookPath, large, sign(time.Now().Unix(), large))
+	assert.Equal(t, 400001, res.Code)
+	fired = record(post(hook.WebhookPath, body, sign(time.Now().Unix(), body)))
+	assert.Equal(t, "收到 webhook", waitRun(fired.RunID).Output)
+	// 手动触发的接口不能触发 webhook
+	res = post("/graph/trigger/fire", fmt.Sprintf(`{"id": %d}`, hook.ID), nil)
+	assert.Equal(t, 400001, res.Code)
+
+	// 定时触发，多个实例同时调度的时候只会执行一次
+	code, scheduled := save(`{"graph_id": 1, "type": "cron", "cron": "0 9 * * *", "enabled": true}`)
+	require.Equal(t, 0, code)
+	assert.Greater(t, scheduled.NextTime, now)
+	due := now - 1000
+	require.NoError(t, n.db.Model(&dao.GraphTrigger{}).Where("id = ?", scheduled.ID).Update("next_time", due).Error)
+	var (
+		wg    sync.WaitGroup
+		total atomic.Int64
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cnt, err := n.triggerSvc.Schedule(context.Background())
+			assert.NoError(t, err)
+			total.Add(int64(cnt))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), total.Load())
+
+	res = post("/graph/trigger/records", fmt.Sprintf(`{"trigger_id": %d}`, scheduled.ID), nil)
+	require.Equal(t, 0, res.Code)
+	var records []web.GraphTriggerRecordVO
+	require.NoError(t, json.Unmarshal(res.Data, &records))
+	require.Len(t, records, 1)
+	assert.Equal(t, due, records[0].FireTime)
+	waitRun(records[0].RunID)
+
+	res = post("/graph/trigger/list", `{"id": 1}`, nil)
+	require.Equal(t, 0, res.Code)
+	var triggers []web.GraphTriggerVO
+	require.NoError(t, json.Unmarshal(res.Data, &triggers))
+	assert.Equal(t, []int64{manual.ID, hook.ID, scheduled.ID}, slice.Map(triggers, func(idx int, src web.GraphTriggerVO) int64 {
+		return src.ID
+	}))
+	assert.Greater(t, triggers[2].NextTime, now)
+
+	res = post("/graph/trigger/records", `{"graph_id": 1}`, nil)
+	require.NoError(t, json.Unmarshal(res.Data, &records))
+	assert.Equal(t, []string{"cron", "webhook", "manual"}, slice.Map(records, func(idx int, src web.GraphTriggerRecordVO) string {
+		return src.Type
+	}))
+}
+
+func (n *GraphTestSuite) TestExportImport() {
+	t := n.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{Uid: 1}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	post := func(path string, body string, data any) int {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		n.server.ServeHTTP(resp, req)
+		result := Result[json.RawMessage]{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		if data != nil && len(result.Data) > 0 {
+			require.NoError(t, json.Unmarshal(result.Data, data))
+		}
+		return result.Code
+	}
+
+	// 第二个节点通过默认的 key 引用第一个节点
+	var graph web.GraphVO
+	code := post("/graph/save", `{
+		"metadata": "客服",
+		"steps": [
+			{"id": -1, "type": "template", "metadata": "{\"template\": \"你好 {{input.name}}\"}"},
+			{"id": -2, "type": "condition", "metadata": "{\"cases\": [{\"path\": \"run.vip\", \"op\": \"eq\", \"value\": true, \"branch\": \"vip\"}], \"default\": \"normal\"}"},
+			{"id": -3, "type": "template", "metadata": "{\"template\": \"{{input}}，尊贵的会员\"}"}
+		],
+		"edges": [
+			{"source_id": -1, "target_id": -2},
+			{"source_id": -2, "target_id": -3, "metadata": "{\"branch\": \"vip\"}"}
+		]
+	}`, &graph)
+	require.Equal(t, 0, code)
+	first := graph.Nodes[0].ID
+
+	var doc map[string]any
+	code = post("/graph/export", fmt.Sprintf(`{"id": %d}`, graph.ID), &doc)
+	require.Equal(t, 0, code)
+	ref := fmt.Sprintf("node_%d", first)
+	assert.Equal(t, "ai-gateway/graph@v1", doc["format"])
+	assert.Equal(t, "客服", doc["metadata"])
+	nodes := doc["nodes"].([]any)
+	require.Len(t, nodes, 3)
+	assert.Equal(t, map[string]any{
+		"ref":      ref,
+		"type":     "template",
+		"metadata": map[string]any{"key": ref, "template": "你好 {{input.name}}"},
+	}, nodes[0])
+	assert.Equal(t, map[string]any{
+		"source":   fmt.Sprintf("node_%d", graph.Nodes[1].ID),
+		"target":   fmt.Sprintf("node_%d", graph.Nodes[2].ID),
+		"metadata": map[string]any{"branch": "vip"},
+	}, doc["edges"].([]any)[1])
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var imported web.GraphVO
+	code = post("/graph/import", fmt.Sprintf(`{"document": %s}`, data), &imported)
+	require.Equal(t, 0, code)
+	assert.NotEqual(t, graph.ID, imported.ID)
+	assert.Equal(t, "客服", imported.Metadata)
+	require.Len(t, imported.Nodes, 3)
+	require.Len(t, imported.Edges, 2)
+	assert.Equal(t, imported.Nodes[1].ID, imported.Edges[1].SourceID)
+	assert.Equal(t, imported.Nodes[2].ID, imported.Edges[1].TargetID)
+
+	var run web.GraphRunVO
+	code = post("/graph/run", fmt.Sprintf(`{"graph_id": %d, "input": {"name": "小明", "vip": true}}`, imported.ID), &run)
+	require.Equal(t, 0, code)
+	assert.Equal(t, "succeeded", run.Status)
+	assert.Equal(t, "你好 小明，尊贵的会员", run.Output)
+
+	code = post("/graph/import", `{"document": {"format": "ai-gateway/graph@v1", "nodes": [{"ref": "a", "type": "shell"}]}}`, nil)
+	assert.Equal(t, 400001, code)
+
+	var templates []web.GraphTemplateVO
+	code = post("/graph/templates", `{}`, &templates)
+	require.Equal(t, 0, code)
+	assert.Equal(t, []string{"classify-then-route", "rag-answer", "summarize-and-translate"},
+		slice.Map(templates, func(idx int, src web.GraphTemplateVO) string {
+			return src.Name
+		}))
+
+	// 没有覆盖 prompt_id 的时候图不合法
+	var issues []web.GraphIssueVO
+	code = post("/graph/template/instantiate", `{"name": "summarize-and-translate"}`, &issues)
+	assert.Equal(t, 400001, code)
+	assert.Len(t, issues, 2)
+	var created web.GraphVO
+	code = post("/graph/template/instantiate", `{"name": "summarize-and-translate", "overrides": {
+		"summarize": {"prompt_id": 1}, "translate": {"prompt_id": 2, "version_id": 3}
+	}}`, &created)
+	require.Equal(t, 0, code)
+	require.Len(t, created.Nodes, 3)
+	assert.JSONEq(t, `{"key": "translate", "prompt_id": 2, "version_id": 3}`, created.Nodes[2].Metadata)
+	code = post("/graph/template/instantiate", `{"name": "unknown"}`, nil)
+	assert.Equal(t, 400001, code)
+}
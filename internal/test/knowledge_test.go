@@ -0,0 +1,239 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	aierrs "github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/test/mocks"
+	"github.com/ecodeclub/ai-gateway-go/internal/web"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/yumosx/got/pkg/config"
+	"go.uber.org/mock/gomock"
+	"gorm.io/gorm"
+)
+
+type KnowledgeTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	server *gin.Engine
+	repo   *repository.KnowledgeRepo
+	svc    *service.KnowledgeService
+}
+
+func TestKnowledge(t *testing.T) {
+	suite.Run(t, new(KnowledgeTestSuite))
+}
+
+func (s *KnowledgeTestSuite) SetupSuite() {
+	dbConfig := config.NewConfig(
+		config.WithDBName("ai_gateway_platform"),
+		config.WithUserName("root"),
+		config.WithPassword("root"),
+		config.WithHost("127.0.0.1"),
+		config.WithPort("13306"),
+	)
+
+	db, err := config.NewDB(dbConfig)
+	require.NoError(s.T(), err)
+	err = dao.InitKnowledgeTable(db)
+	require.NoError(s.T(), err)
+	s.db = db
+	s.repo = repository.NewKnowledgeRepo(dao.NewKnowledgeDAO(db))
+	s.svc = service.NewKnowledgeService(s.repo)
+	handler := web.NewKnowledgeHandler(s.svc)
+	server := gin.Default()
+	handler.PrivateRoutes(server)
+	s.server = server
+}
+
+func (s *KnowledgeTestSuite) TearDownTest() {
+	err := s.db.Exec("TRUNCATE TABLE knowledge_bases").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE knowledge_documents").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE knowledge_chunks").Error
+	require.NoError(s.T(), err)
+}
+
+func (s *KnowledgeTestSuite) TestIngest() {
+	t := s.T()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uid := int64(1)
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().DoAndReturn(func() session.Claims {
+		return session.Claims{Uid: uid}
+	}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
+
+	post := func(path string, body any) Result[json.RawMessage] {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		s.server.ServeHTTP(resp, req)
+		var result Result[json.RawMessage]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+	decode := func(res Result[json.RawMessage], val any) {
+		require.Equal(t, 0, res.Code, res.Msg)
+		require.NoError(t, json.Unmarshal(res.Data, val))
+	}
+
+	// 切分配置不合法
+	res := post("/knowledge/base/save", web.SaveKnowledgeBaseReq{Name: "文档", ChunkSize: 100, ChunkOverlap: 100})
+	assert.Equal(t, errs.InvalidParamError.Code, res.Code)
+
+	var kb web.KnowledgeBaseVO
+	decode(post("/knowledge/base/save", web.SaveKnowledgeBaseReq{Name: "文档", ChunkSize: 100, ChunkOverlap: 10}), &kb)
+	assert.Equal(t, 100, kb.ChunkSize)
+
+	// 不支持的格式
+	res = post("/knowledge/document/ingest", web.IngestDocumentReq{KBID: kb.ID, Title: "a", Format: "docx", Content: "a"})
+	assert.Equal(t, errs.InvalidParamError.Code, res.Code)
+
+	content := "# 介绍\n\n" + strings.Repeat("这是一段用来测试切分的文字。", 30) + "\n\n## 结尾\n\n最后一段。"
+	var doc web.KnowledgeDocumentVO
+	decode(post("/knowledge/document/ingest", web.IngestDocumentReq{KBID: kb.ID, Title: "手册", Format: "markdown", Content: content}), &doc)
+
+	require.Eventually(t, func() bool {
+		decode(post("/knowledge/document/detail", web.GetReq{ID: doc.ID}), &doc)
+		return doc.Status == "succeeded" || doc.Status == "failed"
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "succeeded", doc.Status)
+	assert.Equal(t, 100, doc.Progress)
+	assert.Greater(t, doc.Chunks, 1)
+
+	var chunks []web.KnowledgeChunkVO
+	decode(post("/knowledge/document/chunks", web.ListKnowledgeChunksReq{DocID: doc.ID, Limit: 100}), &chunks)
+	require.Len(t, chunks, doc.Chunks)
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.LessOrEqual(t, len([]rune(chunk.Content)), 100)
+		assert.NotContains(t, chunk.Content, "#")
+	}
+	assert.True(t, strings.HasPrefix(chunks[0].Content, "介绍"))
+	assert.True(t, strings.HasSuffix(chunks[len(chunks)-1].Content, "最后一段。"))
+
+	var docs []web.KnowledgeDocumentVO
+	decode(post("/knowledge/document/list", web.ListKnowledgeDocumentsReq{KBID: kb.ID}), &docs)
+	require.Len(t, docs, 1)
+
+	// 其他用户看不到
+	uid = 2
+	res = post("/knowledge/document/detail", web.GetReq{ID: doc.ID})
+	assert.Equal(t, errs.PermissionDeniedError.Code, res.Code)
+	res = post("/knowledge/base/delete", web.DeleteReq{ID: kb.ID})
+	assert.Equal(t, errs.PermissionDeniedError.Code, res.Code)
+
+	// 删除知识库的时候文档和片段一起删除
+	uid = 1
+	decode(post("/knowledge/base/delete", web.DeleteReq{ID: kb.ID}), &json.RawMessage{})
+	res = post("/knowledge/document/detail", web.GetReq{ID: doc.ID})
+	assert.Equal(t, errs.NotFoundError.Code, res.Code)
+	var count int64
+	require.NoError(t, s.db.Model(&dao.KnowledgeChunk{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func (s *KnowledgeTestSuite) TestSaveChunksAfterDelete() {
+	t := s.T()
+	defer s.TearDownTest()
+	ctx := context.Background()
+	docID, err := s.repo.CreateDocument(ctx, domain.KnowledgeDocument{KBID: 1, Owner: 1, Content: "内容", Status: domain.DocumentStatusProcessing})
+	require.NoError(t, err)
+	chunks := []domain.KnowledgeChunk{{DocID: docID, KBID: 1, Owner: 1, Index: 0, Content: "第一批"}}
+	require.NoError(t, s.repo.SaveChunks(ctx, chunks))
+
+	// 导入的过程中删除了文档，之后的批次不能再保存
+	require.NoError(t, s.repo.DeleteDocument(ctx, docID))
+	chunks = []domain.KnowledgeChunk{{DocID: docID, KBID: 1, Owner: 1, Index: 1, Content: "第二批"}}
+	err = s.repo.SaveChunks(ctx, chunks)
+	assert.ErrorIs(t, err, aierrs.ErrKnowledgeNotFound)
+	var cnt int64
+	require.NoError(t, s.db.Model(&dao.KnowledgeChunk{}).Where("doc_id = ?", docID).Count(&cnt).Error)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func (s *KnowledgeTestSuite) TestFailInterrupted() {
+	t := s.T()
+	defer s.TearDownTest()
+	stale := time.Now().Add(-time.Hour).UnixMilli()
+	now := time.Now().UnixMilli()
+	docs := []dao.KnowledgeDocument{
+		{KBID: 1, Owner: 1, Status: "processing", Progress: 50, Chunks: 1, Ctime: stale, Utime: stale},
+		{KBID: 1, Owner: 1, Status: "pending", Ctime: stale, Utime: stale},
+		// 其他实例正在导入
+		{KBID: 1, Owner: 1, Status: "processing", Progress: 50, Chunks: 1, Ctime: now, Utime: now},
+		{KBID: 1, Owner: 1, Status: "succeeded", Progress: 100, Chunks: 1, Ctime: stale, Utime: stale},
+	}
+	require.NoError(t, s.db.Create(&docs).Error)
+	chunks := []dao.KnowledgeChunk{
+		{DocID: docs[0].ID, KBID: 1, Owner: 1, Idx: 0, Content: "中断"},
+		{DocID: docs[2].ID, KBID: 1, Owner: 1, Idx: 0, Content: "导入中"},
+		{DocID: docs[3].ID, KBID: 1, Owner: 1, Idx: 0, Content: "完成"},
+	}
+	require.NoError(t, s.db.Create(&chunks).Error)
+
+	cnt, err := s.svc.FailInterrupted(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, cnt)
+
+	testCases := []struct {
+		name       string
+		id         int64
+		wantStatus string
+		wantChunks int64
+	}{
+		{name: "导入中断", id: docs[0].ID, wantStatus: "failed", wantChunks: 0},
+		{name: "还没有开始导入", id: docs[1].ID, wantStatus: "failed", wantChunks: 0},
+		{name: "最近还在更新进度", id: docs[2].ID, wantStatus: "processing", wantChunks: 1},
+		{name: "已经导入完", id: docs[3].ID, wantStatus: "succeeded", wantChunks: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc dao.KnowledgeDocument
+			require.NoError(t, s.db.Where("id = ?", tc.id).First(&doc).Error)
+			assert.Equal(t, tc.wantStatus, doc.Status)
+			var chunks int64
+			require.NoError(t, s.db.Model(&dao.KnowledgeChunk{}).Where("doc_id = ?", tc.id).Count(&chunks).Error)
+			assert.Equal(t, tc.wantChunks, chunks)
+		})
+	}
+}
@@ -16,15 +16,19 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository"
+	"github.com/ecodeclub/ai-gateway-go/internal/repository/cache"
 	"github.com/ecodeclub/ai-gateway-go/internal/repository/dao"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ai-gateway-go/internal/service/llm"
 	"github.com/ecodeclub/ai-gateway-go/internal/test/mocks"
 	"github.com/ecodeclub/ai-gateway-go/internal/web"
 	"github.com/ecodeclub/ginx/session"
@@ -32,6 +36,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/yumosx/got/pkg/config"
 	"go.uber.org/mock/gomock"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -52,11 +57,15 @@ func (s *PromptTestSuite) SetupSuite() {
 	require.NoError(s.T(), err)
 	err = dao.InitTable(db)
 	require.NoError(s.T(), err)
+	// 统计的数据来自对话的消息
+	err = dao.InitConversation(db)
+	require.NoError(s.T(), err)
 	s.db = db
 	d := dao.NewPromptDAO(db)
 	repo := repository.NewPromptRepo(d)
 	svc := service.NewPromptService(repo)
-	handler := web.NewHandler(svc)
+	acl := service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(db)), repo)
+	handler := web.NewHandler(svc, acl)
 	server := gin.Default()
 	handler.PrivateRoutes(server)
 	s.server = server
@@ -67,6 +76,28 @@ func (s *PromptTestSuite) TearDownTest() {
 	require.NoError(s.T(), err)
 	err = s.db.Exec("TRUNCATE TABLE prompt_versions").Error
 	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE prompt_acls").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE conversations").Error
+	require.NoError(s.T(), err)
+	err = s.db.Exec("TRUNCATE TABLE messages").Error
+	require.NoError(s.T(), err)
+}
+
+func (s *PromptTestSuite) mockSession(ctrl *gomock.Controller, uid int64) {
+	s.mockSessionAs(ctrl, uid, "personal")
+}
+
+// mockSessionAs 和 mockSession 一样，只不过可以指定创建 prompt 时的 owner_type
+func (s *PromptTestSuite) mockSessionAs(ctrl *gomock.Controller, uid int64, ownerType string) {
+	sess := mocks.NewMockSession(ctrl)
+	sess.EXPECT().Claims().Return(session.Claims{
+		Uid:  uid,
+		Data: map[string]string{"owner_type": ownerType},
+	}).AnyTimes()
+	provider := mocks.NewMockProvider(ctrl)
+	session.SetDefaultProvider(provider)
+	provider.EXPECT().Get(gomock.Any()).Return(sess, nil).AnyTimes()
 }
 
 func (s *PromptTestSuite) TestAdd() {
@@ -197,6 +228,7 @@ func (s *PromptTestSuite) TestGet() {
 				Owner:         1,
 				OwnerType:     "personal",
 				ActiveVersion: 1,
+				Status:        1,
 				Versions: []web.PromptVersionVO{{
 					ID:            1,
 					Label:         "test",
@@ -213,6 +245,7 @@ func (s *PromptTestSuite) TestGet() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodGet, "/prompt/1", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -235,6 +268,419 @@ func (s *PromptTestSuite) TestGet() {
 	}
 }
 
+func (s *PromptTestSuite) TestList() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	prepare := func() {
+		now := time.Now().UnixMilli()
+		prompts := []dao.Prompt{
+			{Name: "翻译", Description: "中英互译", Owner: 1, OwnerType: "personal", ActiveVersion: 1, Status: 1, Ctime: now, Utime: now + 1},
+			{Name: "总结", Description: "总结文章", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now, Utime: now + 2},
+			{Name: "润色", Description: "翻译之后润色", Owner: 1, OwnerType: "personal", ActiveVersion: 3, Status: 1, Ctime: now, Utime: now + 3},
+			{Name: "已删除的翻译", Description: "test", Owner: 1, OwnerType: "personal", Status: 0, Ctime: now, Utime: now + 4},
+			{Name: "别人的翻译", Description: "test", Owner: 2, OwnerType: "personal", Status: 1, Ctime: now, Utime: now + 5},
+		}
+		err := s.db.Create(&prompts).Error
+		require.NoError(s.T(), err)
+	}
+	testCases := []struct {
+		name     string
+		path     string
+		reqBody  string
+		wantCode int
+		wantIDs  []int64
+		wantNext bool
+		wantRes  int
+	}{
+		{
+			name:     "默认按照更新时间倒序",
+			path:     "/prompt/list",
+			reqBody:  `{}`,
+			wantCode: http.StatusOK,
+			wantIDs:  []int64{3, 2, 1},
+		},
+		{
+			name:     "分页",
+			path:     "/prompt/list",
+			reqBody:  `{"limit": 2}`,
+			wantCode: http.StatusOK,
+			wantIDs:  []int64{3, 2},
+			wantNext: true,
+		},
+		{
+			name:     "只看已发布的",
+			path:     "/prompt/list",
+			reqBody:  `{"has_published": true, "sort_by": "id", "asc": true}`,
+			wantCode: http.StatusOK,
+			wantIDs:  []int64{1, 3},
+		},
+		{
+			name:     "搜索名字和描述",
+			path:     "/prompt/search",
+			reqBody:  `{"keyword": "翻译"}`,
+			wantCode: http.StatusOK,
+			wantIDs:  []int64{3, 1},
+		},
+		{
+			name:     "搜索没有关键字",
+			path:     "/prompt/search",
+			reqBody:  `{"keyword": " "}`,
+			wantCode: http.StatusOK,
+			wantRes:  400001,
+		},
+		{
+			name:     "非法的排序字段",
+			path:     "/prompt/list",
+			reqBody:  `{"sort_by": "name"}`,
+			wantCode: http.StatusOK,
+			wantRes:  400001,
+		},
+	}
+	for _, tc := range testCases {
+		s.T().Run(tc.name, func(t *testing.T) {
+			prepare()
+			defer s.TearDownTest()
+			s.mockSession(ctrl, 1)
+
+			req, err := http.NewRequest(http.MethodPost, tc.path, bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			s.server.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantCode, resp.Code)
+			var result Result[web.PromptPageVO]
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantRes, result.Code)
+			ids := make([]int64, 0, len(result.Data.Prompts))
+			for _, p := range result.Data.Prompts {
+				ids = append(ids, p.ID)
+			}
+			if tc.wantIDs == nil {
+				tc.wantIDs = []int64{}
+			}
+			assert.Equal(t, tc.wantIDs, ids)
+			assert.Equal(t, tc.wantNext, result.Data.NextCursor != "")
+		})
+	}
+}
+
+func (s *PromptTestSuite) TestListCursor() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	t := s.T()
+	s.mockSession(ctrl, 1)
+	defer s.TearDownTest()
+	now := time.Now().UnixMilli()
+	// 三种排序方式下的顺序都不一样
+	prompts := []dao.Prompt{
+		{Name: "a", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now + 3, Utime: now + 2},
+		{Name: "b", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now + 1, Utime: now + 4},
+		{Name: "c", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now + 4, Utime: now + 1},
+		{Name: "d", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now + 2, Utime: now + 3},
+	}
+	require.NoError(t, s.db.Create(&prompts).Error)
+
+	list := func(req web.ListPromptReq) Result[web.PromptPageVO] {
+		data, err := json.Marshal(req)
+		require.NoError(t, err)
+		httpReq, err := http.NewRequest(http.MethodPost, "/prompt/list", bytes.NewBuffer(data))
+		require.NoError(t, err)
+		httpReq.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		s.server.ServeHTTP(resp, httpReq)
+		var result Result[web.PromptPageVO]
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+	ids := func(page web.PromptPageVO) []int64 {
+		res := make([]int64, 0, len(page.Prompts))
+		for _, p := range page.Prompts {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+
+	testCases := []struct {
+		name      string
+		sortBy    string
+		asc       bool
+		wantFirst []int64
+		wantNext  []int64
+	}{
+		{name: "按照 id 倒序", sortBy: "id", wantFirst: []int64{4, 3}, wantNext: []int64{2, 1}},
+		{name: "按照 id 正序", sortBy: "id", asc: true, wantFirst: []int64{1, 2}, wantNext: []int64{3, 4}},
+		{name: "按照创建时间倒序", sortBy: "ctime", wantFirst: []int64{3, 1}, wantNext: []int64{4, 2}},
+		{name: "按照创建时间正序", sortBy: "ctime", asc: true, wantFirst: []int64{2, 4}, wantNext: []int64{1, 3}},
+		{name: "按照更新时间倒序", sortBy: "utime", wantFirst: []int64{2, 4}, wantNext: []int64{1, 3}},
+		{name: "按照更新时间正序", sortBy: "utime", asc: true, wantFirst: []int64{3, 1}, wantNext: []int64{4, 2}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first := list(web.ListPromptReq{SortBy: tc.sortBy, Asc: tc.asc, Limit: 2})
+			require.Equal(t, 0, first.Code, first.Msg)
+			assert.Equal(t, tc.wantFirst, ids(first.Data))
+			require.NotEmpty(t, first.Data.NextCursor)
+
+			next := list(web.ListPromptReq{SortBy: tc.sortBy, Asc: tc.asc, Limit: 2, Cursor: first.Data.NextCursor})
+			require.Equal(t, 0, next.Code, next.Msg)
+			assert.Equal(t, tc.wantNext, ids(next.Data))
+
+			// 换了排序方式之后不能继续使用原来的游标
+			res := list(web.ListPromptReq{SortBy: tc.sortBy, Asc: !tc.asc, Limit: 2, Cursor: first.Data.NextCursor})
+			assert.Equal(t, 400001, res.Code)
+			other := "id"
+			if tc.sortBy == "id" {
+				other = "utime"
+			}
+			res = list(web.ListPromptReq{SortBy: other, Asc: tc.asc, Limit: 2, Cursor: first.Data.NextCursor})
+			assert.Equal(t, 400001, res.Code)
+		})
+	}
+}
+
+func (s *PromptTestSuite) TestACL() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	t := s.T()
+	defer s.TearDownTest()
+	const (
+		orgID = 100
+		// 组织的管理员，通过组织内的授权成为 publisher
+		admin = 7
+		// 普通成员
+		member = 2
+	)
+	now := time.Now().UnixMilli()
+	err := s.db.Create(&dao.PromptACL{
+		Scope: "organization", ScopeID: orgID, Uid: admin, Role: uint8(domain.PromptRolePublisher), Ctime: now, Utime: now,
+	}).Error
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		uid       int64
+		ownerType string
+		path      string
+		reqBody   string
+		wantCode  int
+	}{
+		{
+			name:      "没有组织授权不能在组织下创建",
+			uid:       member,
+			ownerType: "organization",
+			path:      "/prompt/add",
+			reqBody:   `{"owner": 100, "name": "test", "content": "test"}`,
+			wantCode:  403001,
+		},
+		{
+			name:      "用户 ID 和组织 ID 相同也不能在组织下创建",
+			uid:       orgID,
+			ownerType: "organization",
+			path:      "/prompt/add",
+			reqBody:   `{"owner": 100, "name": "test", "content": "test"}`,
+			wantCode:  403001,
+		},
+		{
+			name:      "管理员在组织下创建",
+			uid:       admin,
+			ownerType: "organization",
+			path:      "/prompt/add",
+			reqBody:   `{"owner": 100, "name": "test", "content": "test"}`,
+			wantCode:  0,
+		},
+		{
+			name:     "没有授权不能查看",
+			uid:      member,
+			path:     "/prompt/stats",
+			reqBody:  `{"id": 1}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "用户 ID 和组织 ID 相同不能查看",
+			uid:      orgID,
+			path:     "/prompt/stats",
+			reqBody:  `{"id": 1}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "用户 ID 和组织 ID 相同不能查看组织的列表",
+			uid:      orgID,
+			path:     "/prompt/list",
+			reqBody:  `{"owner_type": "organization"}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "用户 ID 和组织 ID 相同不能授权",
+			uid:      orgID,
+			path:     "/prompt/acl/grant",
+			reqBody:  `{"scope": "organization", "scope_id": 100, "uid": 100, "role": "publisher"}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "非 publisher 不能授权",
+			uid:      member,
+			path:     "/prompt/acl/grant",
+			reqBody:  `{"scope": "organization", "scope_id": 100, "uid": 2, "role": "publisher"}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "管理员授予 editor",
+			uid:      admin,
+			path:     "/prompt/acl/grant",
+			reqBody:  `{"scope": "organization", "scope_id": 100, "uid": 2, "role": "editor"}`,
+			wantCode: 0,
+		},
+		{
+			name:     "editor 可以查看组织的列表",
+			uid:      member,
+			path:     "/prompt/list",
+			reqBody:  `{"owner": 100, "owner_type": "organization"}`,
+			wantCode: 0,
+		},
+		{
+			name:     "editor 可以修改",
+			uid:      member,
+			path:     "/prompt/update",
+			reqBody:  `{"id": 1, "name": "new", "description": "new"}`,
+			wantCode: 0,
+		},
+		{
+			name:     "editor 不能发布",
+			uid:      member,
+			path:     "/prompt/publish",
+			reqBody:  `{"version_id": 1, "label": "v1"}`,
+			wantCode: 403001,
+		},
+		{
+			name:     "在 prompt 上授予 publisher",
+			uid:      admin,
+			path:     "/prompt/acl/grant",
+			reqBody:  `{"scope": "prompt", "scope_id": 1, "uid": 2, "role": "publisher"}`,
+			wantCode: 0,
+		},
+		{
+			name:     "publisher 可以发布",
+			uid:      member,
+			path:     "/prompt/publish",
+			reqBody:  `{"version_id": 1, "label": "v1"}`,
+			wantCode: 0,
+		},
+		{
+			name:     "非法的角色",
+			uid:      admin,
+			path:     "/prompt/acl/grant",
+			reqBody:  `{"scope": "prompt", "scope_id": 1, "uid": 3, "role": "owner"}`,
+			wantCode: 400001,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ownerType := tc.ownerType
+			if ownerType == "" {
+				ownerType = "personal"
+			}
+			s.mockSessionAs(ctrl, tc.uid, ownerType)
+			req, err := http.NewRequest(http.MethodPost, tc.path, bytes.NewBuffer([]byte(tc.reqBody)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			s.server.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var result Result[any]
+			err = json.NewDecoder(resp.Body).Decode(&result)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCode, result.Code)
+		})
+	}
+	var prompt dao.Prompt
+	err = s.db.Where("id = ?", 1).First(&prompt).Error
+	require.NoError(t, err)
+	// 组织的 prompt 属于组织，而不是创建它的管理员
+	assert.Equal(t, int64(orgID), prompt.Owner)
+	assert.Equal(t, "organization", prompt.OwnerType)
+	assert.Equal(t, "new", prompt.Name)
+	assert.Equal(t, int64(1), prompt.ActiveVersion)
+	var cnt int64
+	require.NoError(t, s.db.Model(&dao.Prompt{}).Count(&cnt).Error)
+	assert.Equal(t, int64(1), cnt)
+}
+
+func (s *PromptTestSuite) TestImportExport() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	defer s.TearDownTest()
+	const doc = `version: v1
+name: 翻译
+description: 中英互译
+owner_type: personal
+versions:
+  - label: v1
+    content: 翻译 {{text}}
+    temperature: 0.5
+    top_n: 0.9
+    max_tokens: 100
+    active: true
+  - content: 把 {{text}} 翻译成英文
+    max_tokens: 100
+`
+	do := func(path string, body any) Result[web.PromptImportResultVO] {
+		t := s.T()
+		s.mockSession(ctrl, 1)
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		s.server.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var result Result[web.PromptImportResultVO]
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		require.NoError(t, err)
+		return result
+	}
+	t := s.T()
+
+	// dry run 不会写入数据
+	res := do("/prompt/import", web.ImportPromptReq{Format: "yaml", Content: doc, DryRun: true})
+	assert.Equal(t, "create", res.Data.Action)
+	var cnt int64
+	require.NoError(t, s.db.Model(&dao.Prompt{}).Count(&cnt).Error)
+	assert.Equal(t, int64(0), cnt)
+
+	res = do("/prompt/import", web.ImportPromptReq{Format: "yaml", Content: doc})
+	assert.Equal(t, "create", res.Data.Action)
+	assert.Equal(t, int64(1), res.Data.PromptID)
+	var prompt dao.Prompt
+	require.NoError(t, s.db.Where("id = ?", 1).First(&prompt).Error)
+	assert.Equal(t, int64(1), prompt.Owner)
+	var versions []dao.PromptVersion
+	require.NoError(t, s.db.Where("prompt_id = ?", 1).Order("id").Find(&versions).Error)
+	require.Len(t, versions, 2)
+	assert.Equal(t, versions[0].ID, prompt.ActiveVersion)
+
+	// 重复导入不会有任何修改
+	res = do("/prompt/import", web.ImportPromptReq{Format: "yaml", Content: doc})
+	assert.Equal(t, "unchanged", res.Data.Action)
+	assert.Equal(t, []web.PromptVersionImportResultVO{
+		{Label: "v1", Action: "unchanged"},
+		{Action: "unchanged"},
+	}, res.Data.Versions)
+
+	// 导出之后再导入也不会有修改
+	s.mockSession(ctrl, 1)
+	req, err := http.NewRequest(http.MethodPost, "/prompt/export", bytes.NewBufferString(`{"id": 1, "format": "json"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.server.ServeHTTP(resp, req)
+	var exported Result[string]
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&exported))
+	res = do("/prompt/import", web.ImportPromptReq{Format: "json", Content: exported.Data})
+	assert.Equal(t, "unchanged", res.Data.Action)
+}
+
 func (s *PromptTestSuite) TestUpdatePrompt() {
 	ctrl := gomock.NewController(s.T())
 	defer ctrl.Finish()
@@ -286,6 +732,7 @@ func (s *PromptTestSuite) TestUpdatePrompt() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/update", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -312,7 +759,19 @@ func (s *PromptTestSuite) TestUpdateVersion() {
 			name: "成功",
 			before: func() {
 				now := time.Now().UnixMilli()
-				err := s.db.Create(&dao.PromptVersion{
+				// 修改版本需要是 prompt 的 owner
+				err := s.db.Create(&dao.Prompt{
+					Name:          "test",
+					Description:   "test",
+					Owner:         1,
+					OwnerType:     "personal",
+					ActiveVersion: 1,
+					Status:        1,
+					Ctime:         now,
+					Utime:         now,
+				}).Error
+				require.NoError(s.T(), err)
+				err = s.db.Create(&dao.PromptVersion{
 					PromptID:      1,
 					Label:         "test",
 					Content:       "test",
@@ -350,6 +809,7 @@ func (s *PromptTestSuite) TestUpdateVersion() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/update/version", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -423,6 +883,7 @@ func (s *PromptTestSuite) TestDelete() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/delete", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -496,6 +957,7 @@ func (s *PromptTestSuite) TestDeleteVersion() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/delete/version", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -571,6 +1033,7 @@ func (s *PromptTestSuite) TestPublish() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/publish", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
@@ -582,6 +1045,172 @@ func (s *PromptTestSuite) TestPublish() {
 	}
 }
 
+func (s *PromptTestSuite) TestPublishWeights() {
+	ctrl := gomock.NewController(s.T())
+	defer ctrl.Finish()
+	testCases := []struct {
+		name        string
+		uid         int64
+		reqBody     string
+		wantCode    int
+		wantWeights map[int64]int
+	}{
+		{
+			name:        "按照权重发布，没有出现的版本清零",
+			uid:         1,
+			reqBody:     `{"id": 1, "weights": [{"version_id": 2, "weight": 30}, {"version_id": 3, "weight": 70}]}`,
+			wantWeights: map[int64]int{1: 0, 2: 30, 3: 70, 4: 10},
+		},
+		{
+			name:        "其他 prompt 的版本",
+			uid:         1,
+			reqBody:     `{"id": 1, "weights": [{"version_id": 2, "weight": 30}, {"version_id": 4, "weight": 70}]}`,
+			wantCode:    400001,
+			wantWeights: map[int64]int{1: 100, 2: 0, 3: 0, 4: 10},
+		},
+		{
+			name:        "版本不存在",
+			uid:         1,
+			reqBody:     `{"id": 1, "weights": [{"version_id": 100, "weight": 30}]}`,
+			wantCode:    400001,
+			wantWeights: map[int64]int{1: 100, 2: 0, 3: 0, 4: 10},
+		},
+		{
+			name:        "权重为负数",
+			uid:         1,
+			reqBody:     `{"id": 1, "weights": [{"version_id": 2, "weight": -1}]}`,
+			wantCode:    400001,
+			wantWeights: map[int64]int{1: 100, 2: 0, 3: 0, 4: 10},
+		},
+		{
+			name:        "不是 publisher",
+			uid:         2,
+			reqBody:     `{"id": 1, "weights": [{"version_id": 2, "weight": 100}]}`,
+			wantCode:    403001,
+			wantWeights: map[int64]int{1: 100, 2: 0, 3: 0, 4: 10},
+		},
+	}
+	for _, tc := range testCases {
+		s.T().Run(tc.name, func(t *testing.T) {
+			defer s.TearDownTest()
+			now := time.Now().UnixMilli()
+			prompts := []dao.Prompt{
+				{Name: "a", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now, Utime: now},
+				{Name: "b", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now, Utime: now},
+			}
+			require.NoError(t, s.db.Create(&prompts).Error)
+			versions := []dao.PromptVersion{
+				{PromptID: 1, Content: "v1", Status: 1, Weight: 100, Ctime: now, Utime: now},
+				{PromptID: 1, Content: "v2", Status: 1, Ctime: now, Utime: now},
+				{PromptID: 1, Content: "v3", Status: 1, Ctime: now, Utime: now},
+				{PromptID: 2, Content: "v1", Status: 1, Weight: 10, Ctime: now, Utime: now},
+			}
+			require.NoError(t, s.db.Create(&versions).Error)
+
+			s.mockSession(ctrl, tc.uid)
+			res := s.post(t, "/prompt/publish/weights", tc.reqBody)
+			assert.Equal(t, tc.wantCode, res.Code)
+
+			var got []dao.PromptVersion
+			require.NoError(t, s.db.Order("id ASC").Find(&got).Error)
+			weights := make(map[int64]int, len(got))
+			for _, v := range got {
+				weights[v.ID] = v.Weight
+			}
+			assert.Equal(t, tc.wantWeights, weights)
+		})
+	}
+}
+
+// TestStats 通过对话生成消息，检查消息上记录的版本、耗时和 token，以及按照版本聚合的结果
+func (s *PromptTestSuite) TestStats() {
+	t := s.T()
+	defer s.TearDownTest()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now().UnixMilli()
+	require.NoError(t, s.db.Create(&dao.Prompt{Name: "a", Owner: 1, OwnerType: "personal", Status: 1, Ctime: now, Utime: now}).Error)
+	versions := []dao.PromptVersion{
+		{PromptID: 1, Content: "v1", SystemContent: "你是 v1", Status: 1, Ctime: now, Utime: now},
+		{PromptID: 1, Content: "v2", SystemContent: "你是 v2", Status: 1, Ctime: now, Utime: now},
+	}
+	require.NoError(t, s.db.Create(&versions).Error)
+	s.mockSession(ctrl, 1)
+	res := s.post(t, "/prompt/publish/weights", `{"id": 1, "weights": [{"version_id": 2, "weight": 100}]}`)
+	require.Equal(t, 0, res.Code)
+
+	handler := mocks.NewMockHandler(ctrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, msgs []domain.Message) (domain.ChatResponse, error) {
+			// 只有 v2 有流量
+			assert.Equal(t, "你是 v2", msgs[0].Content)
+			time.Sleep(10 * time.Millisecond)
+			return domain.ChatResponse{
+				Response: domain.Message{Role: domain.ASSISTANT, Content: "你好"},
+				Usage:    domain.Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30},
+			}, nil
+		}).Times(2)
+	conversationSvc := s.newConversationService(handler)
+	for i := 0; i < 2; i++ {
+		sn, err := conversationSvc.Create(context.Background(), domain.Conversation{Uid: "1", PromptID: 1, DisableAutoTitle: true})
+		require.NoError(t, err)
+		_, err = conversationSvc.Chat(context.Background(), sn, []domain.Message{{Role: domain.USER, Content: "你好"}})
+		require.NoError(t, err)
+	}
+
+	var replies []dao.Message
+	require.NoError(t, s.db.Where("role = ?", domain.ASSISTANT).Find(&replies).Error)
+	require.Len(t, replies, 2)
+	for _, reply := range replies {
+		assert.Equal(t, int64(2), reply.PromptVersionID)
+		assert.Equal(t, int64(30), reply.Tokens)
+		assert.GreaterOrEqual(t, reply.Latency, int64(10))
+	}
+	require.NoError(t, s.db.Model(&dao.Message{}).Where("id = ?", replies[0].ID).Update("feedback", -1).Error)
+
+	res = s.post(t, "/prompt/stats", `{"id": 1}`)
+	require.Equal(t, 0, res.Code)
+	var stats []web.PromptVersionStatsVO
+	require.NoError(t, json.Unmarshal(res.Data, &stats))
+	require.Len(t, stats, 1)
+	assert.Equal(t, int64(2), stats[0].VersionID)
+	assert.Equal(t, int64(2), stats[0].Count)
+	assert.Equal(t, int64(60), stats[0].Tokens)
+	assert.GreaterOrEqual(t, stats[0].AvgLatency, int64(10))
+	assert.Equal(t, int64(0), stats[0].Up)
+	assert.Equal(t, int64(1), stats[0].Down)
+
+	// 别人看不到统计
+	s.mockSession(ctrl, 2)
+	res = s.post(t, "/prompt/stats", `{"id": 1}`)
+	assert.Equal(t, 403001, res.Code)
+}
+
+// newConversationService 和 prompt 使用同一个数据库，用来生成带有 prompt 版本的消息
+func (s *PromptTestSuite) newConversationService(handler llm.Handler) *service.ConversationService {
+	rdb := config.NewCache(config.NewCacheConfig(config.WithAddr("localhost:6379")))
+	promptRepo := repository.NewPromptRepo(dao.NewPromptDAO(s.db))
+	return service.NewConversationService(
+		repository.NewConversationRepo(dao.NewConversationDao(s.db), cache.NewConversationCache(rdb)),
+		repository.NewFeedbackRepo(dao.NewFeedbackDAO(s.db)),
+		service.NewPromptService(promptRepo),
+		service.NewPromptACLService(repository.NewPromptACLRepo(dao.NewPromptACLDAO(s.db)), promptRepo),
+		nil, nil, handler,
+	)
+}
+
+func (s *PromptTestSuite) post(t *testing.T, path string, body string) Result[json.RawMessage] {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer([]byte(body)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.server.ServeHTTP(resp, req)
+	var res Result[json.RawMessage]
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return res
+}
+
 func (s *PromptTestSuite) TestFork() {
 	ctrl := gomock.NewController(s.T())
 	defer ctrl.Finish()
@@ -655,6 +1284,7 @@ func (s *PromptTestSuite) TestFork() {
 	for _, tc := range testCases {
 		s.T().Run(tc.name, func(t *testing.T) {
 			tc.before()
+			s.mockSession(ctrl, 1)
 			req, err := http.NewRequest(http.MethodPost, "/prompt/fork", bytes.NewBuffer([]byte(tc.reqBody)))
 			require.NoError(t, err)
 			req.Header.Set("Content-Type", "application/json")
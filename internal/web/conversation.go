@@ -0,0 +1,183 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/ecodeclub/ginx"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+)
+
+type ConversationHandler struct {
+	svc *service.ConversationService
+}
+
+func NewConversationHandler(svc *service.ConversationService) *ConversationHandler {
+	return &ConversationHandler{svc: svc}
+}
+
+func (h *ConversationHandler) PrivateRoutes(server *gin.Engine) {
+	group := server.Group("/conversation")
+	group.POST("/search", ginx.BS(h.Search))
+	group.POST("/export", ginx.BS(h.Export))
+	group.POST("/share", ginx.BS(h.CreateShare))
+	group.POST("/share/list", ginx.BS(h.ListShares))
+	group.POST("/share/revoke", ginx.BS(h.RevokeShare))
+	group.POST("/feedback", ginx.BS(h.Feedback))
+}
+
+// PublicRoutes 不需要登录的路由
+func (h *ConversationHandler) PublicRoutes(server *gin.Engine) {
+	server.GET("/share/:token", ginx.W(h.GetShare))
+}
+
+// Search 只在当前用户自己的对话里面搜索
+func (h *ConversationHandler) Search(ctx *ginx.Context, req SearchConversationReq, sess session.Session) (ginx.Result, error) {
+	results, err := h.svc.Search(ctx, domain.ConversationSearchQuery{
+		Uid:     strconv.FormatInt(sess.Claims().Uid, 10),
+		Keyword: req.Keyword,
+		Limit:   req.Limit,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{
+		Msg: "OK",
+		Data: slice.Map(results, func(idx int, src domain.ConversationSearchResult) ConversationSearchResultVO {
+			return ConversationSearchResultVO{
+				Sn:             src.Sn,
+				Title:          src.Title,
+				TitleHighlight: src.TitleHighlight,
+				UpdateTime:     src.Utime,
+				Matches: slice.Map(src.Matches, func(idx int, m domain.MessageMatch) MessageMatchVO {
+					return MessageMatchVO{MessageID: m.MessageID, Role: m.Role, Snippet: m.Snippet}
+				}),
+			}
+		}),
+	}, nil
+}
+
+// Export 导出当前用户的对话，内容直接放在 Data 里面返回
+func (h *ConversationHandler) Export(ctx *ginx.Context, req ExportConversationReq, sess session.Session) (ginx.Result, error) {
+	content, err := h.svc.Export(ctx, domain.ConversationExportQuery{
+		Uid:              strconv.FormatInt(sess.Claims().Uid, 10),
+		Sn:               req.Sn,
+		Start:            req.Start,
+		End:              req.End,
+		Format:           domain.ConversationExportFormat(req.Format),
+		IncludeReasoning: req.IncludeReasoning,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) || errors.Is(err, errs.ErrConversationNotFound) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{
+		Data: string(content),
+	}, nil
+}
+
+// CreateShare 为自己的对话创建只读的分享链接
+func (h *ConversationHandler) CreateShare(ctx *ginx.Context, req CreateShareReq, sess session.Session) (ginx.Result, error) {
+	share, err := h.svc.CreateShare(ctx, domain.ConversationShare{
+		Sn:               req.Sn,
+		Uid:              strconv.FormatInt(sess.Claims().Uid, 10),
+		MessageID:        req.MessageID,
+		IncludeReasoning: req.IncludeReasoning,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) || errors.Is(err, errs.ErrConversationNotFound) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: newConversationShareVO(share)}, nil
+}
+
+func (h *ConversationHandler) ListShares(ctx *ginx.Context, req ListSharesReq, sess session.Session) (ginx.Result, error) {
+	shares, err := h.svc.ListShares(ctx, req.Sn, strconv.FormatInt(sess.Claims().Uid, 10))
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(shares, func(idx int, src domain.ConversationShare) ConversationShareVO {
+		return newConversationShareVO(src)
+	})}, nil
+}
+
+func (h *ConversationHandler) RevokeShare(ctx *ginx.Context, req RevokeShareReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.RevokeShare(ctx, req.Token, strconv.FormatInt(sess.Claims().Uid, 10))
+	if errors.Is(err, errs.ErrShareNotFound) {
+		return notFoundResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+// GetShare 任何人都可以通过分享链接查看对话的快照
+func (h *ConversationHandler) GetShare(ctx *ginx.Context) (ginx.Result, error) {
+	shared, err := h.svc.GetShare(ctx, ctx.Param("token").StringOrDefault(""))
+	if errors.Is(err, errs.ErrShareNotFound) {
+		return notFoundResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: SharedConversationVO{
+		Title:      shared.Title,
+		CreateTime: shared.Ctime,
+		Messages: slice.Map(shared.Messages, func(idx int, src domain.Message) SharedMessageVO {
+			return SharedMessageVO{
+				ID:               src.ID,
+				Role:             src.Role,
+				Content:          src.Content,
+				ReasoningContent: src.ReasoningContent,
+			}
+		}),
+	}}, nil
+}
+
+// Feedback 评价自己对话里面的回答
+func (h *ConversationHandler) Feedback(ctx *ginx.Context, req FeedbackReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.Feedback(ctx, domain.MessageFeedback{
+		MessageID: req.MessageID,
+		Uid:       strconv.FormatInt(sess.Claims().Uid, 10),
+		Rating:    domain.FeedbackRating(max(min(req.Rating, 1), -1)),
+		Reason:    domain.FeedbackReason(req.Reason),
+		Comment:   req.Comment,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, err
+	}
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		return permissionDeniedResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/ecodeclub/ginx"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+)
+
+type EvaluationHandler struct {
+	svc *service.EvaluationService
+}
+
+func NewEvaluationHandler(svc *service.EvaluationService) *EvaluationHandler {
+	return &EvaluationHandler{svc: svc}
+}
+
+func (h *EvaluationHandler) PrivateRoutes(server *gin.Engine) {
+	eval := server.Group("/prompt/eval")
+	eval.POST("/dataset/create", ginx.BS(h.CreateDataset))
+	eval.POST("/dataset/cases/add", ginx.BS(h.AddCases))
+	eval.POST("/dataset/detail", ginx.BS(h.GetDataset))
+	eval.POST("/run", ginx.BS(h.Run))
+	eval.POST("/run/detail", ginx.BS(h.GetRun))
+	eval.POST("/compare", ginx.BS(h.Compare))
+}
+
+func (h *EvaluationHandler) PublicRoutes(_ *gin.Engine) {}
+
+func (h *EvaluationHandler) CreateDataset(ctx *ginx.Context, req CreateDatasetReq, sess session.Session) (ginx.Result, error) {
+	id, err := h.svc.CreateDataset(ctx, domain.EvalDataset{
+		Name:        req.Name,
+		Owner:       sess.Claims().Uid,
+		Description: req.Description,
+		Cases:       toDomainEvalCases(req.Cases),
+	})
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: id}, nil
+}
+
+func (h *EvaluationHandler) AddCases(ctx *ginx.Context, req AddCasesReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.AddCases(ctx, sess.Claims().Uid, req.DatasetID, toDomainEvalCases(req.Cases))
+	if err != nil {
+		return evalErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *EvaluationHandler) GetDataset(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	dataset, err := h.svc.GetDataset(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return evalErrorResult(err), err
+	}
+	return ginx.Result{Data: newEvalDatasetVO(dataset)}, nil
+}
+
+// Run 在数据集上评测某个版本，评测在后台执行
+func (h *EvaluationHandler) Run(ctx *ginx.Context, req RunEvalReq, sess session.Session) (ginx.Result, error) {
+	id, err := h.svc.Run(ctx, sess.Claims().Uid, req.DatasetID, req.VersionID, req.Concurrency)
+	if err != nil {
+		return evalErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: id}, nil
+}
+
+func (h *EvaluationHandler) GetRun(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.svc.GetRun(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return evalErrorResult(err), err
+	}
+	return ginx.Result{Data: newEvalRunVO(run)}, nil
+}
+
+// Compare 对比两次评测，一般用于发布之前确认新版本的效果
+func (h *EvaluationHandler) Compare(ctx *ginx.Context, req CompareEvalReq, sess session.Session) (ginx.Result, error) {
+	res, err := h.svc.Compare(ctx, sess.Claims().Uid, req.A, req.B)
+	if err != nil {
+		return evalErrorResult(err), err
+	}
+	// 对比的时候逐条展示，不需要重复返回评测的明细
+	res.A.Results, res.B.Results = nil, nil
+	return ginx.Result{Data: EvalComparisonVO{
+		A: newEvalRunVO(res.A),
+		B: newEvalRunVO(res.B),
+		Cases: slice.Map(res.Cases, func(idx int, src domain.EvalCaseComparison) EvalCaseComparisonVO {
+			return EvalCaseComparisonVO{
+				CaseID: src.CaseID,
+				A:      newEvalResultVO(src.A),
+				B:      newEvalResultVO(src.B),
+			}
+		}),
+	}}, nil
+}
+
+func evalErrorResult(err error) ginx.Result {
+	switch {
+	case errors.Is(err, errs.ErrInvalidParam):
+		return ginx.Result{Code: invalidParamResult.Code, Msg: err.Error()}
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return permissionDeniedResult
+	case errors.Is(err, errs.ErrEvaluationNotFound):
+		return notFoundResult
+	default:
+		return systemErrorResult
+	}
+}
+
+func toDomainEvalCases(cases []EvalCaseVO) []domain.EvalCase {
+	return slice.Map(cases, func(idx int, src EvalCaseVO) domain.EvalCase {
+		return domain.EvalCase{
+			Variables: src.Variables,
+			Expected:  src.Expected,
+			Assertions: slice.Map(src.Assertions, func(idx int, a AssertionVO) domain.Assertion {
+				return domain.Assertion{Type: domain.AssertionType(a.Type), Value: a.Value}
+			}),
+		}
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/ecodeclub/ginx"
+	"github.com/gin-gonic/gin"
+)
+
+// FeedbackHandler 管理后台查看用户评价
+type FeedbackHandler struct {
+	svc *service.FeedbackService
+}
+
+func NewFeedbackHandler(svc *service.FeedbackService) *FeedbackHandler {
+	return &FeedbackHandler{svc: svc}
+}
+
+func (h *FeedbackHandler) PrivateRoutes(server *gin.Engine) {
+	group := server.Group("/feedback")
+	group.POST("/stats", ginx.B(h.Stats))
+	group.POST("/reviews", ginx.B(h.Reviews))
+	group.POST("/export", ginx.B(h.Export))
+}
+
+func (h *FeedbackHandler) PublicRoutes(_ *gin.Engine) {}
+
+// Stats 按照模型或者 prompt 版本聚合评价
+func (h *FeedbackHandler) Stats(ctx *ginx.Context, req FeedbackStatsReq) (ginx.Result, error) {
+	res, err := h.svc.Stats(ctx, domain.FeedbackStatsQuery{
+		GroupBy:  domain.FeedbackGroupBy(req.GroupBy),
+		PromptID: req.PromptID,
+		Start:    req.Start,
+		End:      req.End,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(res, func(idx int, src domain.FeedbackStats) FeedbackStatsVO {
+		reasons := make(map[string]int64, len(src.Reasons))
+		for reason, cnt := range src.Reasons {
+			reasons[string(reason)] = cnt
+		}
+		return FeedbackStatsVO{
+			Provider:        src.Provider,
+			Model:           src.Model,
+			PromptVersionID: src.PromptVersionID,
+			Up:              src.Up,
+			Down:            src.Down,
+			Reasons:         reasons,
+		}
+	})}, nil
+}
+
+// Reviews 查询需要复核的评价
+func (h *FeedbackHandler) Reviews(ctx *ginx.Context, req FeedbackReviewReq) (ginx.Result, error) {
+	res, err := h.svc.Reviews(ctx, h.toQuery(req))
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(res, func(idx int, src domain.FeedbackReview) FeedbackReviewVO {
+		return FeedbackReviewVO{
+			MessageID:       src.Feedback.MessageID,
+			Sn:              src.Feedback.Sn,
+			Rating:          int8(src.Feedback.Rating),
+			Reason:          string(src.Feedback.Reason),
+			Comment:         src.Feedback.Comment,
+			Provider:        src.Feedback.Provider,
+			Model:           src.Feedback.Model,
+			PromptVersionID: src.Feedback.PromptVersionID,
+			Question:        src.Question,
+			Answer:          src.Answer,
+			UpdateTime:      src.Feedback.Utime,
+		}
+	})}, nil
+}
+
+// Export 把需要复核的评价导出为 JSONL
+func (h *FeedbackHandler) Export(ctx *ginx.Context, req FeedbackReviewReq) (ginx.Result, error) {
+	content, err := h.svc.ExportReviews(ctx, h.toQuery(req))
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Data: string(content)}, nil
+}
+
+func (h *FeedbackHandler) toQuery(req FeedbackReviewReq) domain.FeedbackQuery {
+	return domain.FeedbackQuery{
+		Rating:   domain.FeedbackRating(max(min(req.Rating, 1), -1)),
+		Reason:   domain.FeedbackReason(req.Reason),
+		PromptID: req.PromptID,
+		Provider: req.Provider,
+		Model:    req.Model,
+		Start:    req.Start,
+		End:      req.End,
+		Limit:    req.Limit,
+	}
+}
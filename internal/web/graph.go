@@ -15,22 +15,27 @@
 package web
 
 import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
 	"github.com/ecodeclub/ekit"
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/ecodeclub/ginx"
 	"github.com/ecodeclub/ginx/session"
 	"github.com/gin-gonic/gin"
 	"github.com/gotomicro/ego/core/elog"
-	"go.uber.org/zap"
 )
 
 type GraphHandler struct {
-	svc *service.NodeService
+	svc    *service.NodeService
+	runSvc *service.GraphRunService
 }
 
-func NewGraphHandler(nodeSvc *service.NodeService) *GraphHandler {
-	return &GraphHandler{svc: nodeSvc}
+func NewGraphHandler(nodeSvc *service.NodeService, runSvc *service.GraphRunService) *GraphHandler {
+	return &GraphHandler{svc: nodeSvc, runSvc: runSvc}
 }
 
 func (h *GraphHandler) PrivateRoutes(engine *gin.Engine) {
@@ -38,6 +43,20 @@ func (h *GraphHandler) PrivateRoutes(engine *gin.Engine) {
 	graph.POST("/save", ginx.BS[SaveGraphReq](h.SaveGraph))
 	graph.POST("/delete", ginx.BS[DeleteReq](h.DeleteGraph))
 	graph.POST("/detail", ginx.BS[GetReq](h.GetGraph))
+	graph.POST("/versions", ginx.BS[GetReq](h.ListVersions))
+	graph.POST("/version/detail", ginx.BS[GraphVersionReq](h.GetVersion))
+	graph.POST("/validate", ginx.BS[GetReq](h.Validate))
+	graph.POST("/export", ginx.BS[GetReq](h.Export))
+	graph.POST("/import", ginx.BS[ImportGraphReq](h.Import))
+	graph.POST("/templates", ginx.S(h.ListTemplates))
+	graph.POST("/template/instantiate", ginx.BS[InstantiateTemplateReq](h.Instantiate))
+	graph.POST("/run", ginx.BS[RunGraphReq](h.Run))
+	graph.POST("/run/detail", ginx.BS[GetReq](h.GetRun))
+	graph.POST("/run/list", ginx.BS[ListGraphRunsReq](h.ListRuns))
+	graph.POST("/run/retry", ginx.BS[RetryNodeReq](h.RetryNode))
+	graph.POST("/run/resume", ginx.BS[GetReq](h.Resume))
+	graph.POST("/run/approve", ginx.BS[ApproveReq](h.Approve))
+	graph.POST("/approval/list", ginx.BS[ListApprovalsReq](h.ListApprovals))
 
 	node := engine.Group("/node")
 	node.POST("/save", ginx.BS[Node](h.SaveNode))
@@ -60,18 +79,103 @@ func (h *GraphHandler) GetGraph(ctx *ginx.Context, req GetReq, _ session.Session
 	return ginx.Result{Msg: "OK", Data: newGetNodeVO(graph)}, err
 }
 
+// SaveGraph 整体保存图，返回保存之后的图，新节点的临时 ID 会被替换成真实的 ID
 func (h *GraphHandler) SaveGraph(ctx *ginx.Context, req SaveGraphReq, _ session.Session) (ginx.Result, error) {
 	graph := domain.Graph{
-		ID: req.ID,
+		ID:       req.ID,
+		Version:  req.Version,
+		Metadata: ekit.AnyValue{Val: req.Metadata},
+		Steps: slice.Map(req.Steps, func(idx int, src Node) domain.Node {
+			return domain.Node{ID: src.ID, Type: src.Type, Status: src.Status, Metadata: ekit.AnyValue{Val: src.Metadata}}
+		}),
+		Edges: slice.Map(req.Edges, func(idx int, src Edge) domain.Edge {
+			return domain.Edge{ID: src.ID, SourceID: src.SourceID, TargetID: src.TargetID, Metadata: ekit.AnyValue{Val: src.Metadata}}
+		}),
+	}
+
+	return h.savedResult(h.svc.SaveGraph(ctx, graph))
+}
+
+// Export 导出成不包含数据库 ID 的 JSON 文档，文档直接放在 Data 里面
+func (h *GraphHandler) Export(ctx *ginx.Context, req GetReq, _ session.Session) (ginx.Result, error) {
+	doc, err := h.svc.Export(ctx, req.ID)
+	switch {
+	case errors.Is(err, errs.ErrInvalidParam):
+		return invalidParamResult, err
+	case errors.Is(err, errs.ErrGraphNotFound):
+		return notFoundResult, err
+	case err != nil:
+		return systemErrorResult, err
 	}
+	return ginx.Result{Msg: "OK", Data: json.RawMessage(doc)}, nil
+}
+
+// Import 用导出的文档创建一个新的图
+func (h *GraphHandler) Import(ctx *ginx.Context, req ImportGraphReq, _ session.Session) (ginx.Result, error) {
+	return h.savedResult(h.svc.Import(ctx, req.Document))
+}
 
-	id, err := h.svc.SaveGraph(ctx, graph)
+func (h *GraphHandler) ListTemplates(_ *ginx.Context, _ session.Session) (ginx.Result, error) {
+	return ginx.Result{Msg: "OK", Data: slice.Map(h.svc.ListTemplates(), func(idx int, src domain.GraphTemplate) GraphTemplateVO {
+		return GraphTemplateVO{
+			Name:        src.Name,
+			Title:       src.Title,
+			Description: src.Description,
+			Document:    json.RawMessage(src.Document),
+		}
+	})}, nil
+}
+
+// Instantiate 用内置的模板创建一个新的图
+func (h *GraphHandler) Instantiate(ctx *ginx.Context, req InstantiateTemplateReq, _ session.Session) (ginx.Result, error) {
+	return h.savedResult(h.svc.Instantiate(ctx, req.Name, req.Overrides))
+}
+
+func (h *GraphHandler) savedResult(saved domain.Graph, err error) (ginx.Result, error) {
 	if err != nil {
-		elog.Error("保存 Graph 失败", elog.Int64("ID", req.ID), elog.Any("err", err))
-		return ginx.Result{Code: 500, Msg: "内部错误"}, ginx.ErrNoResponse
+		return saveErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGetNodeVO(saved)}, nil
+}
+
+// saveErrorResult 修改图的接口共用的错误映射
+func saveErrorResult(err error) ginx.Result {
+	switch {
+	case errors.Is(err, errs.ErrInvalidParam):
+		return graphInvalidResult(err)
+	case errors.Is(err, errs.ErrGraphVersionConflict):
+		return conflictResult
+	case errors.Is(err, errs.ErrGraphNotFound):
+		return notFoundResult
+	default:
+		return systemErrorResult
+	}
+}
+
+func (h *GraphHandler) ListVersions(ctx *ginx.Context, req GetReq, _ session.Session) (ginx.Result, error) {
+	versions, err := h.svc.ListVersions(ctx, req.ID)
+	if err != nil {
+		return systemErrorResult, err
 	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(versions, func(idx int, src domain.GraphVersion) GraphVersionVO {
+		return GraphVersionVO{Version: src.Version, CreateTime: src.Ctime}
+	})}, nil
+}
 
-	return ginx.Result{Msg: "OK", Data: id}, nil
+func (h *GraphHandler) GetVersion(ctx *ginx.Context, req GraphVersionReq, _ session.Session) (ginx.Result, error) {
+	version, err := h.svc.GetVersion(ctx, req.GraphID, req.Version)
+	if errors.Is(err, errs.ErrGraphNotFound) {
+		return notFoundResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	graph := newGetNodeVO(version.Graph)
+	return ginx.Result{Msg: "OK", Data: GraphVersionVO{
+		Version:    version.Version,
+		Graph:      &graph,
+		CreateTime: version.Ctime,
+	}}, nil
 }
 
 func (h *GraphHandler) SaveNode(ctx *ginx.Context, req Node, _ session.Session) (ginx.Result, error) {
@@ -85,8 +189,7 @@ func (h *GraphHandler) SaveNode(ctx *ginx.Context, req Node, _ session.Session)
 
 	id, err := h.svc.SaveNode(ctx, node)
 	if err != nil {
-		elog.Error("保存 Node 失败", elog.Int64("ID", req.ID), elog.Any("err", err))
-		return ginx.Result{Code: 500, Msg: "内部错误"}, ginx.ErrNoResponse
+		return saveErrorResult(err), err
 	}
 	return ginx.Result{Data: id}, nil
 }
@@ -102,22 +205,17 @@ func (h *GraphHandler) SaveEdge(ctx *ginx.Context, req Edge, _ session.Session)
 
 	id, err := h.svc.SaveEdge(ctx, edge)
 	if err != nil {
-		elog.Error("保存 Edge 失败", elog.Int64("ID", req.ID), elog.Any("err", err))
-		return ginx.Result{Code: 500, Msg: "内部错误"}, ginx.ErrNoResponse
+		return saveErrorResult(err), err
 	}
-
 	return ginx.Result{
 		Data: id,
 	}, nil
 }
 
 func (h *GraphHandler) DeleteNode(ctx *ginx.Context, req DeleteReq, _ session.Session) (ginx.Result, error) {
-	id := req.ID
-
-	err := h.svc.DeleteNode(ctx, id)
+	err := h.svc.DeleteNode(ctx, req.ID)
 	if err != nil {
-		elog.Error("删除 Node 失败", elog.Int64("ID", req.ID), elog.Any("err", err))
-		return ginx.Result{Code: 500, Msg: "内部错误"}, ginx.ErrNoResponse
+		return saveErrorResult(err), err
 	}
 	return ginx.Result{
 		Msg: "OK",
@@ -125,11 +223,9 @@ func (h *GraphHandler) DeleteNode(ctx *ginx.Context, req DeleteReq, _ session.Se
 }
 
 func (h *GraphHandler) DeleteEdge(ctx *ginx.Context, req DeleteReq, _ session.Session) (ginx.Result, error) {
-	id := req.ID
-	err := h.svc.DeleteEdge(ctx, id)
+	err := h.svc.DeleteEdge(ctx, req.ID)
 	if err != nil {
-		elog.Error("删除 Edge 失败", elog.Int64("ID", req.ID), zap.Any("err", err))
-		return ginx.Result{Code: 500, Msg: "内部错误"}, ginx.ErrNoResponse
+		return saveErrorResult(err), err
 	}
 	return ginx.Result{
 		Msg: "OK",
@@ -147,3 +243,125 @@ func (h *GraphHandler) DeleteGraph(ctx *ginx.Context, req DeleteReq, _ session.S
 		Msg: "OK",
 	}, nil
 }
+
+// Validate 返回图的所有问题，包括不影响执行的警告
+func (h *GraphHandler) Validate(ctx *ginx.Context, req GetReq, _ session.Session) (ginx.Result, error) {
+	issues, err := h.svc.Validate(ctx, req.ID)
+	if errors.Is(err, errs.ErrGraphNotFound) {
+		return notFoundResult, err
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphIssueVOs(issues)}, nil
+}
+
+// graphInvalidResult 图检查不通过的时候把问题放在 Data 里面
+func graphInvalidResult(err error) ginx.Result {
+	var verr *service.GraphValidationError
+	if !errors.As(err, &verr) {
+		return invalidParamResult
+	}
+	return ginx.Result{
+		Code: invalidParamResult.Code,
+		Msg:  verr.Error(),
+		Data: newGraphIssueVOs(verr.Issues),
+	}
+}
+
+// Run 同步执行图，节点执行失败的时候也会返回执行记录，结果看 status
+func (h *GraphHandler) Run(ctx *ginx.Context, req RunGraphReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.runSvc.Run(ctx, domain.GraphRunRequest{
+		GraphID: req.GraphID,
+		Version: req.Version,
+		Uid:     sess.Claims().Uid,
+		Input:   req.Input,
+	})
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphRunVO(run)}, nil
+}
+
+func (h *GraphHandler) GetRun(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.runSvc.GetRun(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphRunVO(run)}, nil
+}
+
+// ListRuns 自己发起的执行，不包含节点的状态
+func (h *GraphHandler) ListRuns(ctx *ginx.Context, req ListGraphRunsReq, sess session.Session) (ginx.Result, error) {
+	runs, err := h.runSvc.ListRuns(ctx, domain.GraphRunQuery{
+		Uid:     sess.Claims().Uid,
+		GraphID: req.GraphID,
+		Status:  domain.GraphRunStatus(req.Status),
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+	})
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(runs, func(idx int, src domain.GraphRun) GraphRunVO {
+		return newGraphRunVO(src)
+	})}, nil
+}
+
+// RetryNode 单独重试失败的节点，成功之后执行的状态是 paused，调用 Resume 执行下游的节点
+func (h *GraphHandler) RetryNode(ctx *ginx.Context, req RetryNodeReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.runSvc.RetryNode(ctx, req.RunID, sess.Claims().Uid, req.NodeID)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphRunVO(run)}, nil
+}
+
+// Resume 从失败的节点继续执行，执行成功的节点不会再执行
+func (h *GraphHandler) Resume(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.runSvc.Resume(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphRunVO(run)}, nil
+}
+
+// Approve 审批等待中的审批节点，然后继续执行
+func (h *GraphHandler) Approve(ctx *ginx.Context, req ApproveReq, sess session.Session) (ginx.Result, error) {
+	run, err := h.runSvc.Approve(ctx, domain.GraphApproval{
+		RunID:    req.RunID,
+		NodeID:   req.NodeID,
+		Uid:      sess.Claims().Uid,
+		Approved: req.Approved,
+		Payload:  req.Payload,
+		Comment:  req.Comment,
+	})
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphRunVO(run)}, nil
+}
+
+// ListApprovals 自己发起的执行里面等待审批的节点，截止时间早的排在前面
+func (h *GraphHandler) ListApprovals(ctx *ginx.Context, req ListApprovalsReq, sess session.Session) (ginx.Result, error) {
+	nodes, err := h.runSvc.ListApprovals(ctx, sess.Claims().Uid, req.Limit, req.Offset)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(nodes, func(idx int, src domain.NodeRun) ApprovalVO {
+		return ApprovalVO{RunID: src.RunID, NodeID: src.NodeID, Input: src.Input, Deadline: src.Deadline}
+	})}, nil
+}
+
+func runErrorResult(err error) ginx.Result {
+	switch {
+	case errors.Is(err, errs.ErrInvalidParam):
+		return graphInvalidResult(err)
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return permissionDeniedResult
+	case errors.Is(err, errs.ErrGraphNotFound), errors.Is(err, errs.ErrGraphTriggerNotFound):
+		return notFoundResult
+	default:
+		return systemErrorResult
+	}
+}
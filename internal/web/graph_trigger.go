@@ -0,0 +1,137 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/ecodeclub/ginx"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// webhookSignatureHeader 对时间戳和请求体的 HMAC-SHA256 签名，十六进制编码
+	webhookSignatureHeader = "X-Signature"
+	// webhookTimestampHeader 发送请求时的 Unix 时间戳，单位是秒
+	webhookTimestampHeader = "X-Timestamp"
+	// maxWebhookBodySize webhook 不需要登录，请求体需要限制大小
+	maxWebhookBodySize = 1 << 20
+)
+
+// GraphTriggerHandler 管理图的触发器，webhook 不需要登录，通过签名校验
+type GraphTriggerHandler struct {
+	svc *service.GraphTriggerService
+}
+
+func NewGraphTriggerHandler(svc *service.GraphTriggerService) *GraphTriggerHandler {
+	return &GraphTriggerHandler{svc: svc}
+}
+
+func (h *GraphTriggerHandler) PrivateRoutes(server *gin.Engine) {
+	group := server.Group("/graph/trigger")
+	group.POST("/save", ginx.BS[SaveGraphTriggerReq](h.Save))
+	group.POST("/list", ginx.BS[GetReq](h.List))
+	group.POST("/delete", ginx.BS[DeleteReq](h.Delete))
+	group.POST("/fire", ginx.BS[FireGraphTriggerReq](h.Fire))
+	group.POST("/records", ginx.BS[ListGraphTriggerRecordsReq](h.Records))
+}
+
+func (h *GraphTriggerHandler) PublicRoutes(server *gin.Engine) {
+	server.POST("/graph/webhook/:id", ginx.W(h.Webhook))
+}
+
+func (h *GraphTriggerHandler) Save(ctx *ginx.Context, req SaveGraphTriggerReq, sess session.Session) (ginx.Result, error) {
+	trigger, err := h.svc.SaveTrigger(ctx, domain.GraphTrigger{
+		ID:      req.ID,
+		GraphID: req.GraphID,
+		Uid:     sess.Claims().Uid,
+		Type:    domain.GraphTriggerType(req.Type),
+		Cron:    req.Cron,
+		Secret:  req.Secret,
+		Enabled: req.Enabled,
+	})
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphTriggerVO(trigger)}, nil
+}
+
+// List 图上面自己创建的触发器，ID 是图的 ID
+func (h *GraphTriggerHandler) List(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	triggers, err := h.svc.ListTriggers(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(triggers, func(idx int, src domain.GraphTrigger) GraphTriggerVO {
+		return newGraphTriggerVO(src)
+	})}, nil
+}
+
+func (h *GraphTriggerHandler) Delete(ctx *ginx.Context, req DeleteReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.DeleteTrigger(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+// Fire 手动触发，图在后台执行，执行的结果通过 /graph/run/detail 查询
+func (h *GraphTriggerHandler) Fire(ctx *ginx.Context, req FireGraphTriggerReq, sess session.Session) (ginx.Result, error) {
+	record, err := h.svc.Fire(ctx, req.ID, sess.Claims().Uid, req.Payload)
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphTriggerRecordVO(record)}, nil
+}
+
+func (h *GraphTriggerHandler) Records(ctx *ginx.Context, req ListGraphTriggerRecordsReq, sess session.Session) (ginx.Result, error) {
+	records, err := h.svc.ListRecords(ctx, domain.GraphTriggerQuery{
+		Uid:       sess.Claims().Uid,
+		GraphID:   req.GraphID,
+		TriggerID: req.TriggerID,
+		Limit:     req.Limit,
+		Offset:    req.Offset,
+	})
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(records, func(idx int, src domain.GraphTriggerRecord) GraphTriggerRecordVO {
+		return newGraphTriggerRecordVO(src)
+	})}, nil
+}
+
+// Webhook 外部系统触发，请求体是 JSON 格式的图的输入
+func (h *GraphTriggerHandler) Webhook(ctx *ginx.Context) (ginx.Result, error) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxWebhookBodySize)
+	body, err := ctx.GetRawData()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return ginx.Result{Code: invalidParamResult.Code, Msg: "请求体太大"}, err
+		}
+		return invalidParamResult, err
+	}
+	id := ctx.Param("id").Int64OrDefault(0)
+	record, err := h.svc.Webhook(ctx, id, body, ctx.GetHeader(webhookTimestampHeader), ctx.GetHeader(webhookSignatureHeader))
+	if err != nil {
+		return runErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newGraphTriggerRecordVO(record)}, nil
+}
@@ -15,31 +15,48 @@
 package web
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
 	"github.com/ecodeclub/ginx"
 	"github.com/ecodeclub/ginx/session"
 	"github.com/gin-gonic/gin"
+	"github.com/gotomicro/ego/core/elog"
 )
 
 type Handler struct {
 	svc *service.PromptService
+	acl *service.PromptACLService
 }
 
-func NewHandler(svc *service.PromptService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *service.PromptService, acl *service.PromptACLService) *Handler {
+	return &Handler{svc: svc, acl: acl}
 }
 
 func (h *Handler) PrivateRoutes(server *gin.Engine) {
 	prompt := server.Group("/prompt")
 	prompt.POST("/add", ginx.BS(h.Add))
-	prompt.GET("/:id", ginx.W(h.Get))
-	prompt.POST("/delete", ginx.B(h.Delete))
-	prompt.POST("/delete/version", ginx.B(h.DeleteVersion))
-	prompt.POST("/update", ginx.B(h.UpdatePrompt))
-	prompt.POST("/update/version", ginx.B(h.UpdateVersion))
-	prompt.POST("/publish", ginx.B(h.Publish))
-	prompt.POST("/fork", ginx.B(h.Fork))
+	prompt.GET("/:id", ginx.S(h.Get))
+	prompt.POST("/list", ginx.BS(h.List))
+	prompt.POST("/search", ginx.BS(h.Search))
+	prompt.POST("/delete", ginx.BS(h.Delete))
+	prompt.POST("/delete/version", ginx.BS(h.DeleteVersion))
+	prompt.POST("/update", ginx.BS(h.UpdatePrompt))
+	prompt.POST("/update/version", ginx.BS(h.UpdateVersion))
+	prompt.POST("/publish", ginx.BS(h.Publish))
+	prompt.POST("/publish/weights", ginx.BS(h.PublishWeights))
+	prompt.POST("/stats", ginx.BS(h.Stats))
+	prompt.POST("/fork", ginx.BS(h.Fork))
+	prompt.POST("/export", ginx.BS(h.Export))
+	prompt.POST("/import", ginx.BS(h.Import))
+	prompt.POST("/acl/grant", ginx.BS(h.Grant))
+	prompt.POST("/acl/revoke", ginx.BS(h.Revoke))
+	prompt.POST("/acl/list", ginx.BS(h.ListACL))
 }
 
 func (h *Handler) PublicRoutes(_ *gin.Engine) {}
@@ -51,10 +68,19 @@ func (h *Handler) Add(ctx *ginx.Context, req AddReq, sess session.Session) (ginx
 	if err != nil {
 		return ginx.Result{}, ginx.ErrUnauthorized
 	}
+	owner := uid
+	// 组织的 prompt 属于组织，需要组织内的 publisher 角色
+	if ownerType == domain.OwnerTypeOrganization.String() {
+		owner = req.Owner
+		if err = h.acl.CheckOrganization(ctx, uid, owner, domain.PromptRolePublisher); err != nil {
+			h.logDenied(uid, "add", owner, err)
+			return h.deniedResult(err)
+		}
+	}
 	prompt := domain.Prompt{
 		Name:        req.Name,
 		Description: req.Description,
-		Owner:       uid,
+		Owner:       owner,
 		OwnerType:   domain.OwnerType(ownerType),
 	}
 	version := domain.PromptVersion{
@@ -73,11 +99,14 @@ func (h *Handler) Add(ctx *ginx.Context, req AddReq, sess session.Session) (ginx
 	}, nil
 }
 
-func (h *Handler) Get(ctx *ginx.Context) (ginx.Result, error) {
+func (h *Handler) Get(ctx *ginx.Context, sess session.Session) (ginx.Result, error) {
 	id, err := ctx.Param("id").AsInt64()
 	if err != nil {
 		return ginx.Result{}, ginx.ErrNoResponse
 	}
+	if err = h.checkPrompt(ctx, sess, "get", id, domain.PromptRoleViewer); err != nil {
+		return h.deniedResult(err)
+	}
 	res, err := h.svc.Get(ctx, id)
 	if err != nil {
 		return systemErrorResult, err
@@ -87,8 +116,68 @@ func (h *Handler) Get(ctx *ginx.Context) (ginx.Result, error) {
 	}, nil
 }
 
+// List 分页查询 prompt 列表
+func (h *Handler) List(ctx *ginx.Context, req ListPromptReq, sess session.Session) (ginx.Result, error) {
+	uid := sess.Claims().Uid
+	if req.Owner == 0 {
+		req.Owner = uid
+	}
+	// owner 只有和 owner_type 一起才有意义，不传的时候查询个人的 prompt
+	if req.OwnerType == "" {
+		req.OwnerType = domain.OwnerTypePersonal.String()
+	}
+	// 组织的 prompt 列表只能通过组织授权查看，组织 ID 和用户 ID 相同也不例外
+	var err error
+	if req.OwnerType == domain.OwnerTypeOrganization.String() {
+		err = h.acl.CheckOrganization(ctx, uid, req.Owner, domain.PromptRoleViewer)
+	} else if req.Owner != uid {
+		err = fmt.Errorf("%w: 不能查看其他用户的 prompt", errs.ErrPermissionDenied)
+	}
+	if err != nil {
+		h.logDenied(uid, "list", req.Owner, err)
+		return h.deniedResult(err)
+	}
+	res, err := h.svc.List(ctx, domain.PromptQuery{
+		Owner:        req.Owner,
+		OwnerType:    domain.OwnerType(req.OwnerType),
+		Keyword:      req.Keyword,
+		Status:       req.Status,
+		HasPublished: req.HasPublished,
+		SortBy:       req.SortBy,
+		Asc:          req.Asc,
+		Cursor:       req.Cursor,
+		Limit:        req.Limit,
+	})
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, nil
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{
+		Data: PromptPageVO{
+			Prompts: slice.Map(res.Prompts, func(idx int, src domain.Prompt) PromptVO {
+				return newPromptVO(src)
+			}),
+			NextCursor: res.NextCursor,
+		},
+	}, nil
+}
+
+// Search 按照关键字在名字和描述里面搜索，其余条件和 List 一样
+func (h *Handler) Search(ctx *ginx.Context, req ListPromptReq, sess session.Session) (ginx.Result, error) {
+	if strings.TrimSpace(req.Keyword) == "" {
+		return invalidParamResult, nil
+	}
+	req.Keyword = strings.TrimSpace(req.Keyword)
+	return h.List(ctx, req, sess)
+}
+
 // Delete 删除整个 prompt
-func (h *Handler) Delete(ctx *ginx.Context, req DeleteReq) (ginx.Result, error) {
+func (h *Handler) Delete(ctx *ginx.Context, req DeleteReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkPrompt(ctx, sess, "delete", req.ID, domain.PromptRolePublisher); err != nil {
+		return h.deniedResult(err)
+	}
 	err := h.svc.Delete(ctx, req.ID)
 	if err != nil {
 		return systemErrorResult, err
@@ -98,7 +187,10 @@ func (h *Handler) Delete(ctx *ginx.Context, req DeleteReq) (ginx.Result, error)
 	}, nil
 }
 
-func (h *Handler) DeleteVersion(ctx *ginx.Context, req DeleteVersionReq) (ginx.Result, error) {
+func (h *Handler) DeleteVersion(ctx *ginx.Context, req DeleteVersionReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkVersion(ctx, sess, "delete_version", req.VersionID, domain.PromptRoleEditor); err != nil {
+		return h.deniedResult(err)
+	}
 	err := h.svc.DeleteVersion(ctx, req.VersionID)
 	if err != nil {
 		return systemErrorResult, err
@@ -109,7 +201,10 @@ func (h *Handler) DeleteVersion(ctx *ginx.Context, req DeleteVersionReq) (ginx.R
 }
 
 // UpdatePrompt 更新 prompt 的基本信息
-func (h *Handler) UpdatePrompt(ctx *ginx.Context, req UpdatePromptReq) (ginx.Result, error) {
+func (h *Handler) UpdatePrompt(ctx *ginx.Context, req UpdatePromptReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkPrompt(ctx, sess, "update", req.ID, domain.PromptRoleEditor); err != nil {
+		return h.deniedResult(err)
+	}
 	prompt := domain.Prompt{
 		ID:          req.ID,
 		Name:        req.Name,
@@ -124,7 +219,10 @@ func (h *Handler) UpdatePrompt(ctx *ginx.Context, req UpdatePromptReq) (ginx.Res
 	}, nil
 }
 
-func (h *Handler) UpdateVersion(ctx *ginx.Context, req UpdateVersionReq) (ginx.Result, error) {
+func (h *Handler) UpdateVersion(ctx *ginx.Context, req UpdateVersionReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkVersion(ctx, sess, "update_version", req.VersionID, domain.PromptRoleEditor); err != nil {
+		return h.deniedResult(err)
+	}
 	version := domain.PromptVersion{
 		ID:            req.VersionID,
 		Content:       req.Content,
@@ -142,7 +240,11 @@ func (h *Handler) UpdateVersion(ctx *ginx.Context, req UpdateVersionReq) (ginx.R
 	}, nil
 }
 
-func (h *Handler) Publish(ctx *ginx.Context, req PublishReq) (ginx.Result, error) {
+// Publish 修改 active_version，只有 publisher 可以发布
+func (h *Handler) Publish(ctx *ginx.Context, req PublishReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkVersion(ctx, sess, "publish", req.VersionID, domain.PromptRolePublisher); err != nil {
+		return h.deniedResult(err)
+	}
 	err := h.svc.Publish(ctx, req.VersionID, req.Label)
 	if err != nil {
 		return systemErrorResult, err
@@ -152,8 +254,48 @@ func (h *Handler) Publish(ctx *ginx.Context, req PublishReq) (ginx.Result, error
 	}, nil
 }
 
+// PublishWeights 按照权重同时发布多个版本，用于 A/B 测试
+func (h *Handler) PublishWeights(ctx *ginx.Context, req PublishWeightsReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkPrompt(ctx, sess, "publish_weights", req.ID, domain.PromptRolePublisher); err != nil {
+		return h.deniedResult(err)
+	}
+	weights := make(map[int64]int, len(req.Weights))
+	for _, w := range req.Weights {
+		weights[w.VersionID] = w.Weight
+	}
+	err := h.svc.PublishWeights(ctx, req.ID, weights)
+	if errors.Is(err, errs.ErrInvalidParam) {
+		return invalidParamResult, nil
+	}
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{
+		Msg: "OK",
+	}, nil
+}
+
+// Stats 各个版本的使用次数、耗时、token 消耗以及用户反馈
+func (h *Handler) Stats(ctx *ginx.Context, req StatsReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkPrompt(ctx, sess, "stats", req.ID, domain.PromptRoleViewer); err != nil {
+		return h.deniedResult(err)
+	}
+	res, err := h.svc.Stats(ctx, req.ID)
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{
+		Data: slice.Map(res, func(idx int, src domain.PromptVersionStats) PromptVersionStatsVO {
+			return newPromptVersionStatsVO(src)
+		}),
+	}, nil
+}
+
 // Fork 新增一个版本
-func (h *Handler) Fork(ctx *ginx.Context, req ForkReq) (ginx.Result, error) {
+func (h *Handler) Fork(ctx *ginx.Context, req ForkReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkVersion(ctx, sess, "fork", req.VersionID, domain.PromptRoleEditor); err != nil {
+		return h.deniedResult(err)
+	}
 	err := h.svc.Fork(ctx, req.VersionID)
 	if err != nil {
 		return systemErrorResult, err
@@ -162,3 +304,157 @@ func (h *Handler) Fork(ctx *ginx.Context, req ForkReq) (ginx.Result, error) {
 		Msg: "OK",
 	}, nil
 }
+
+// Export 把 prompt 和它所有的版本导出为 json 或者 yaml 文件
+func (h *Handler) Export(ctx *ginx.Context, req ExportPromptReq, sess session.Session) (ginx.Result, error) {
+	if err := h.checkPrompt(ctx, sess, "export", req.ID, domain.PromptRoleViewer); err != nil {
+		return h.deniedResult(err)
+	}
+	doc, err := h.svc.Export(ctx, req.ID)
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	content, err := service.MarshalPromptDocument(doc, req.Format)
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	return ginx.Result{
+		Data: string(content),
+	}, nil
+}
+
+// Import 导入 Export 导出的文件，按照名字和 owner 匹配已有的 prompt，dry_run 的时候只返回将要执行的操作
+func (h *Handler) Import(ctx *ginx.Context, req ImportPromptReq, sess session.Session) (ginx.Result, error) {
+	doc, err := service.UnmarshalPromptDocument([]byte(req.Content), req.Format)
+	if err != nil {
+		return invalidParamResult, nil
+	}
+	uid := sess.Claims().Uid
+	if req.Owner == 0 {
+		req.Owner = uid
+	}
+	// 导入到组织下面需要组织的 publisher 角色，组织 ID 和用户 ID 相同也不例外
+	if doc.OwnerType == domain.OwnerTypeOrganization.String() {
+		err = h.acl.CheckOrganization(ctx, uid, req.Owner, domain.PromptRolePublisher)
+	} else if req.Owner != uid {
+		err = fmt.Errorf("%w: 不能导入到其他用户名下", errs.ErrPermissionDenied)
+	}
+	if err != nil {
+		h.logDenied(uid, "import", req.Owner, err)
+		return h.deniedResult(err)
+	}
+	res, err := h.svc.Import(ctx, doc, req.Owner, req.DryRun)
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	return ginx.Result{
+		Data: PromptImportResultVO{
+			PromptID: res.PromptID,
+			Name:     res.Name,
+			Action:   string(res.Action),
+			Versions: slice.Map(res.Versions, func(idx int, src domain.PromptVersionImportResult) PromptVersionImportResultVO {
+				return PromptVersionImportResultVO{Label: src.Label, Action: string(src.Action)}
+			}),
+		},
+	}, nil
+}
+
+// Grant 给用户授予 prompt 或者组织的角色，重复授权会覆盖原来的角色
+func (h *Handler) Grant(ctx *ginx.Context, req GrantReq, sess session.Session) (ginx.Result, error) {
+	role, ok := domain.ParsePromptRole(req.Role)
+	if !ok {
+		return invalidParamResult, nil
+	}
+	uid := sess.Claims().Uid
+	err := h.acl.Grant(ctx, uid, domain.PromptACL{
+		Scope:   domain.ACLScope(req.Scope),
+		ScopeID: req.ScopeID,
+		Uid:     req.Uid,
+		Role:    role,
+	})
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		h.logDenied(uid, "grant", req.ScopeID, err)
+	}
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	return ginx.Result{
+		Msg: "OK",
+	}, nil
+}
+
+func (h *Handler) Revoke(ctx *ginx.Context, req RevokeReq, sess session.Session) (ginx.Result, error) {
+	uid := sess.Claims().Uid
+	err := h.acl.Revoke(ctx, uid, domain.ACLScope(req.Scope), req.ScopeID, req.Uid)
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		h.logDenied(uid, "revoke", req.ScopeID, err)
+	}
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	return ginx.Result{
+		Msg: "OK",
+	}, nil
+}
+
+func (h *Handler) ListACL(ctx *ginx.Context, req ListACLReq, sess session.Session) (ginx.Result, error) {
+	uid := sess.Claims().Uid
+	res, err := h.acl.List(ctx, uid, domain.ACLScope(req.Scope), req.ScopeID)
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		h.logDenied(uid, "list_acl", req.ScopeID, err)
+	}
+	if err != nil {
+		return h.deniedResult(err)
+	}
+	return ginx.Result{
+		Data: slice.Map(res, func(idx int, src domain.PromptACL) PromptACLVO {
+			return PromptACLVO{
+				Scope:      string(src.Scope),
+				ScopeID:    src.ScopeID,
+				Uid:        src.Uid,
+				Role:       src.Role.String(),
+				CreateTime: src.Ctime.UnixMilli(),
+				UpdateTime: src.Utime.UnixMilli(),
+			}
+		}),
+	}, nil
+}
+
+// checkPrompt 检查当前用户在 prompt 上的权限，被拒绝的请求会记录下来
+func (h *Handler) checkPrompt(ctx *ginx.Context, sess session.Session, action string, promptID int64, need domain.PromptRole) error {
+	uid := sess.Claims().Uid
+	err := h.acl.Check(ctx, uid, promptID, need)
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		h.logDenied(uid, action, promptID, err)
+	}
+	return err
+}
+
+// checkVersion 和 checkPrompt 一样，只不过请求里面只有版本 id
+func (h *Handler) checkVersion(ctx *ginx.Context, sess session.Session, action string, versionID int64, need domain.PromptRole) error {
+	uid := sess.Claims().Uid
+	err := h.acl.CheckVersion(ctx, uid, versionID, need)
+	if errors.Is(err, errs.ErrPermissionDenied) {
+		h.logDenied(uid, action, versionID, err)
+	}
+	return err
+}
+
+func (h *Handler) logDenied(uid int64, action string, id int64, err error) {
+	elog.Warn("拒绝访问 prompt",
+		elog.Int64("uid", uid),
+		elog.String("action", action),
+		elog.Int64("id", id),
+		elog.FieldErr(err))
+}
+
+func (h *Handler) deniedResult(err error) (ginx.Result, error) {
+	switch {
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return permissionDeniedResult, nil
+	case errors.Is(err, errs.ErrInvalidParam):
+		return invalidParamResult, nil
+	default:
+		return systemErrorResult, err
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 ecodeclub
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+
+	"github.com/ecodeclub/ai-gateway-go/errs"
+	"github.com/ecodeclub/ai-gateway-go/internal/domain"
+	"github.com/ecodeclub/ai-gateway-go/internal/service"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/ecodeclub/ginx"
+	"github.com/ecodeclub/ginx/session"
+	"github.com/gin-gonic/gin"
+)
+
+// KnowledgeHandler 管理用户自己的知识库和文档，只能操作自己的数据
+type KnowledgeHandler struct {
+	svc *service.KnowledgeService
+}
+
+func NewKnowledgeHandler(svc *service.KnowledgeService) *KnowledgeHandler {
+	return &KnowledgeHandler{svc: svc}
+}
+
+func (h *KnowledgeHandler) PrivateRoutes(server *gin.Engine) {
+	group := server.Group("/knowledge")
+	group.POST("/base/save", ginx.BS[SaveKnowledgeBaseReq](h.SaveBase))
+	group.POST("/base/list", ginx.S(h.ListBases))
+	group.POST("/base/delete", ginx.BS[DeleteReq](h.DeleteBase))
+	group.POST("/document/ingest", ginx.BS[IngestDocumentReq](h.Ingest))
+	group.POST("/document/detail", ginx.BS[GetReq](h.GetDocument))
+	group.POST("/document/list", ginx.BS[ListKnowledgeDocumentsReq](h.ListDocuments))
+	group.POST("/document/delete", ginx.BS[DeleteReq](h.DeleteDocument))
+	group.POST("/document/chunks", ginx.BS[ListKnowledgeChunksReq](h.ListChunks))
+}
+
+func (h *KnowledgeHandler) PublicRoutes(_ *gin.Engine) {}
+
+func (h *KnowledgeHandler) SaveBase(ctx *ginx.Context, req SaveKnowledgeBaseReq, sess session.Session) (ginx.Result, error) {
+	kb, err := h.svc.SaveBase(ctx, domain.KnowledgeBase{
+		ID:           req.ID,
+		Owner:        sess.Claims().Uid,
+		Name:         req.Name,
+		Description:  req.Description,
+		ChunkSize:    req.ChunkSize,
+		ChunkOverlap: req.ChunkOverlap,
+	})
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newKnowledgeBaseVO(kb)}, nil
+}
+
+func (h *KnowledgeHandler) ListBases(ctx *ginx.Context, sess session.Session) (ginx.Result, error) {
+	bases, err := h.svc.ListBases(ctx, sess.Claims().Uid)
+	if err != nil {
+		return systemErrorResult, err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(bases, func(idx int, src domain.KnowledgeBase) KnowledgeBaseVO {
+		return newKnowledgeBaseVO(src)
+	})}, nil
+}
+
+// DeleteBase 删除知识库，知识库里面的文档和片段一起删除
+func (h *KnowledgeHandler) DeleteBase(ctx *ginx.Context, req DeleteReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.DeleteBase(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+// Ingest 导入文档，切分在后台执行，通过 /knowledge/document/detail 查询进度
+func (h *KnowledgeHandler) Ingest(ctx *ginx.Context, req IngestDocumentReq, sess session.Session) (ginx.Result, error) {
+	doc, err := h.svc.Ingest(ctx, domain.KnowledgeDocument{
+		KBID:    req.KBID,
+		Owner:   sess.Claims().Uid,
+		Title:   req.Title,
+		Format:  domain.DocumentFormat(req.Format),
+		Content: req.Content,
+	})
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newKnowledgeDocumentVO(doc)}, nil
+}
+
+func (h *KnowledgeHandler) GetDocument(ctx *ginx.Context, req GetReq, sess session.Session) (ginx.Result, error) {
+	doc, err := h.svc.GetDocument(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: newKnowledgeDocumentVO(doc)}, nil
+}
+
+func (h *KnowledgeHandler) ListDocuments(ctx *ginx.Context, req ListKnowledgeDocumentsReq, sess session.Session) (ginx.Result, error) {
+	docs, err := h.svc.ListDocuments(ctx, domain.KnowledgeDocumentQuery{
+		Owner:  sess.Claims().Uid,
+		KBID:   req.KBID,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(docs, func(idx int, src domain.KnowledgeDocument) KnowledgeDocumentVO {
+		return newKnowledgeDocumentVO(src)
+	})}, nil
+}
+
+func (h *KnowledgeHandler) DeleteDocument(ctx *ginx.Context, req DeleteReq, sess session.Session) (ginx.Result, error) {
+	err := h.svc.DeleteDocument(ctx, req.ID, sess.Claims().Uid)
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK"}, nil
+}
+
+func (h *KnowledgeHandler) ListChunks(ctx *ginx.Context, req ListKnowledgeChunksReq, sess session.Session) (ginx.Result, error) {
+	chunks, err := h.svc.ListChunks(ctx, req.DocID, sess.Claims().Uid, req.Limit, req.Offset)
+	if err != nil {
+		return knowledgeErrorResult(err), err
+	}
+	return ginx.Result{Msg: "OK", Data: slice.Map(chunks, func(idx int, src domain.KnowledgeChunk) KnowledgeChunkVO {
+		return newKnowledgeChunkVO(src)
+	})}, nil
+}
+
+func knowledgeErrorResult(err error) ginx.Result {
+	switch {
+	case errors.Is(err, errs.ErrInvalidParam):
+		return ginx.Result{Code: invalidParamResult.Code, Msg: err.Error()}
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return permissionDeniedResult
+	case errors.Is(err, errs.ErrKnowledgeNotFound):
+		return notFoundResult
+	default:
+		return systemErrorResult
+	}
+}
@@ -33,3 +33,18 @@ var insufficientBalanceResult = ginx.Result{
 	Code: errs.InsufficientBalanceError.Code,
 	Msg:  errs.InsufficientBalanceError.Msg,
 }
+
+var permissionDeniedResult = ginx.Result{
+	Code: errs.PermissionDeniedError.Code,
+	Msg:  errs.PermissionDeniedError.Msg,
+}
+
+var notFoundResult = ginx.Result{
+	Code: errs.NotFoundError.Code,
+	Msg:  errs.NotFoundError.Msg,
+}
+
+var conflictResult = ginx.Result{
+	Code: errs.ConflictError.Code,
+	Msg:  errs.ConflictError.Msg,
+}
@@ -15,6 +15,9 @@
 package web
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/ecodeclub/ai-gateway-go/internal/domain"
 	"github.com/ecodeclub/ekit/slice"
 )
@@ -27,6 +30,7 @@ type PromptVO struct {
 	ActiveVersion int64             `json:"active_version"`
 	Versions      []PromptVersionVO `json:"versions"`
 	Description   string            `json:"description"`
+	Status        uint8             `json:"status"`
 	CreateTime    int64             `json:"create_time"`
 	UpdateTime    int64             `json:"update_time"`
 }
@@ -40,6 +44,7 @@ type PromptVersionVO struct {
 	TopN          float32 `json:"top_n"`
 	MaxTokens     int     `json:"max_tokens"`
 	Status        uint8   `json:"status"`
+	Weight        int     `json:"weight"`
 	CreateTime    int64   `json:"ctime"`
 	UpdateTime    int64   `json:"utime"`
 }
@@ -56,6 +61,7 @@ func newPromptVO(p domain.Prompt) PromptVO {
 			TopN:          v.TopN,
 			MaxTokens:     v.MaxTokens,
 			Status:        v.Status,
+			Weight:        v.Weight,
 			CreateTime:    v.Ctime.UnixMilli(),
 			UpdateTime:    v.Utime.UnixMilli(),
 		}
@@ -68,12 +74,15 @@ func newPromptVO(p domain.Prompt) PromptVO {
 		ActiveVersion: p.ActiveVersion,
 		Versions:      versions,
 		Description:   p.Description,
+		Status:        p.Status,
 		CreateTime:    p.Ctime.UnixMilli(),
 		UpdateTime:    p.Utime.UnixMilli(),
 	}
 }
 
 type AddReq struct {
+	// 组织的 prompt 需要传组织 ID，个人的 prompt 不需要传
+	Owner         int64   `json:"owner"`
 	Name          string  `json:"name"`
 	Content       string  `json:"content"`
 	Description   string  `json:"description"`
@@ -97,16 +106,278 @@ type UpdatePromptReq struct {
 	Description string `json:"description,omitempty"`
 }
 
+// SaveGraphReq 整体保存图。ID 为 0 的时候创建新的图，Version 是编辑之前读到的版本。
+// 新的节点使用负数的临时 ID，边通过临时 ID 引用它们
 type SaveGraphReq struct {
-	ID    int64  `json:"id"`
-	Steps []Node `json:"steps"`
-	Edges []Edge `json:"edges"`
+	ID       int64  `json:"id"`
+	Version  int64  `json:"version"`
+	Metadata string `json:"metadata,omitempty"`
+	Steps    []Node `json:"steps"`
+	Edges    []Edge `json:"edges"`
+}
+
+type ImportGraphReq struct {
+	// Export 导出的文档
+	Document json.RawMessage `json:"document"`
+}
+
+type InstantiateTemplateReq struct {
+	Name string `json:"name"`
+	// 按照节点的 ref 覆盖节点配置里面的字段，比如 {"classify": {"prompt_id": 1}}
+	Overrides map[string]map[string]any `json:"overrides"`
+}
+
+type GraphTemplateVO struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Document    json.RawMessage `json:"document"`
 }
 
 type GraphVO struct {
-	ID    int64  `json:"id"`
-	Nodes []Node `json:"steps"`
-	Edges []Edge `json:"edges"`
+	ID       int64  `json:"id"`
+	Version  int64  `json:"version"`
+	Metadata string `json:"metadata,omitempty"`
+	Nodes    []Node `json:"steps"`
+	Edges    []Edge `json:"edges"`
+}
+
+type GraphVersionReq struct {
+	GraphID int64 `json:"graph_id"`
+	Version int64 `json:"version"`
+}
+
+type GraphVersionVO struct {
+	Version int64 `json:"version"`
+	// 列表里面没有快照
+	Graph      *GraphVO `json:"graph,omitempty"`
+	CreateTime int64    `json:"create_time"`
+}
+
+type GraphIssueVO struct {
+	// error 或者 warning
+	Level   string `json:"level"`
+	Code    string `json:"code"`
+	NodeID  int64  `json:"node_id,omitempty"`
+	EdgeID  int64  `json:"edge_id,omitempty"`
+	Message string `json:"message"`
+}
+
+func newGraphIssueVOs(issues []domain.GraphIssue) []GraphIssueVO {
+	return slice.Map(issues, func(idx int, src domain.GraphIssue) GraphIssueVO {
+		return GraphIssueVO{
+			Level:   string(src.Level),
+			Code:    string(src.Code),
+			NodeID:  src.NodeID,
+			EdgeID:  src.EdgeID,
+			Message: src.Message,
+		}
+	})
+}
+
+type RunGraphReq struct {
+	GraphID int64 `json:"graph_id"`
+	// 为 0 的时候执行图当前的状态
+	Version int64 `json:"version"`
+	// 任意的 JSON，没有上游的节点以它作为输入
+	Input any `json:"input"`
+}
+
+type ListGraphRunsReq struct {
+	// 为 0 的时候查询所有图的执行
+	GraphID int64  `json:"graph_id"`
+	Status  string `json:"status"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+type RetryNodeReq struct {
+	RunID  int64 `json:"run_id"`
+	NodeID int64 `json:"node_id"`
+}
+
+type ApproveReq struct {
+	RunID    int64 `json:"run_id"`
+	NodeID   int64 `json:"node_id"`
+	Approved bool  `json:"approved"`
+	// 审批人修改之后的内容，为 null 的时候输出节点的输入
+	Payload any    `json:"payload"`
+	Comment string `json:"comment"`
+}
+
+type ListApprovalsReq struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// ApprovalVO 等待审批的节点，Input 是需要审批的内容
+type ApprovalVO struct {
+	RunID    int64 `json:"run_id"`
+	NodeID   int64 `json:"node_id"`
+	Input    any   `json:"input"`
+	Deadline int64 `json:"deadline"`
+}
+
+type SaveGraphTriggerReq struct {
+	ID      int64  `json:"id"`
+	GraphID int64  `json:"graph_id"`
+	Type    string `json:"type"`
+	Cron    string `json:"cron"`
+	// webhook 的签名密钥，为空的时候自动生成或者保持不变
+	Secret  string `json:"secret"`
+	Enabled bool   `json:"enabled"`
+}
+
+type FireGraphTriggerReq struct {
+	ID      int64 `json:"id"`
+	Payload any   `json:"payload"`
+}
+
+type ListGraphTriggerRecordsReq struct {
+	GraphID   int64 `json:"graph_id"`
+	TriggerID int64 `json:"trigger_id"`
+	Limit     int   `json:"limit"`
+	Offset    int   `json:"offset"`
+}
+
+type GraphTriggerVO struct {
+	ID      int64  `json:"id"`
+	GraphID int64  `json:"graph_id"`
+	Type    string `json:"type"`
+	Cron    string `json:"cron,omitempty"`
+	Secret  string `json:"secret,omitempty"`
+	// webhook 触发器的地址
+	WebhookPath string `json:"webhook_path,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	NextTime    int64  `json:"next_time,omitempty"`
+	CreateTime  int64  `json:"create_time"`
+	UpdateTime  int64  `json:"update_time"`
+}
+
+func newGraphTriggerVO(trigger domain.GraphTrigger) GraphTriggerVO {
+	res := GraphTriggerVO{
+		ID:         trigger.ID,
+		GraphID:    trigger.GraphID,
+		Type:       string(trigger.Type),
+		Cron:       trigger.Cron,
+		Secret:     trigger.Secret,
+		Enabled:    trigger.Enabled,
+		NextTime:   trigger.NextTime,
+		CreateTime: trigger.Ctime,
+		UpdateTime: trigger.Utime,
+	}
+	if trigger.Type == domain.GraphTriggerWebhook {
+		res.WebhookPath = fmt.Sprintf("/graph/webhook/%d", trigger.ID)
+	}
+	return res
+}
+
+type GraphTriggerRecordVO struct {
+	ID         int64  `json:"id"`
+	TriggerID  int64  `json:"trigger_id"`
+	GraphID    int64  `json:"graph_id"`
+	Type       string `json:"type"`
+	Payload    any    `json:"payload"`
+	RunID      int64  `json:"run_id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	FireTime   int64  `json:"fire_time"`
+	CreateTime int64  `json:"create_time"`
+}
+
+func newGraphTriggerRecordVO(record domain.GraphTriggerRecord) GraphTriggerRecordVO {
+	return GraphTriggerRecordVO{
+		ID:         record.ID,
+		TriggerID:  record.TriggerID,
+		GraphID:    record.GraphID,
+		Type:       string(record.Type),
+		Payload:    record.Payload,
+		RunID:      record.RunID,
+		Status:     string(record.Status),
+		Error:      record.Error,
+		FireTime:   record.FireTime,
+		CreateTime: record.Ctime,
+	}
+}
+
+type GraphRunVO struct {
+	ID         int64       `json:"id"`
+	GraphID    int64       `json:"graph_id"`
+	Version    int64       `json:"version"`
+	Status     string      `json:"status"`
+	Input      any         `json:"input"`
+	Output     any         `json:"output"`
+	Error      string      `json:"error,omitempty"`
+	Nodes      []NodeRunVO `json:"nodes"`
+	CreateTime int64       `json:"create_time"`
+	UpdateTime int64       `json:"update_time"`
+}
+
+type NodeRunVO struct {
+	NodeID   int64  `json:"node_id"`
+	Status   string `json:"status"`
+	Input    any    `json:"input,omitempty"`
+	Output   any    `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Tokens   int64  `json:"tokens"`
+	Latency  int64  `json:"latency"`
+	Attempts int    `json:"attempts"`
+	Deadline int64  `json:"deadline,omitempty"`
+	// 审批节点的审批结果
+	Approval *NodeApprovalVO `json:"approval,omitempty"`
+}
+
+type NodeApprovalVO struct {
+	Approved bool   `json:"approved"`
+	Uid      int64  `json:"uid"`
+	Comment  string `json:"comment,omitempty"`
+	Edited   bool   `json:"edited"`
+	Timeout  bool   `json:"timeout"`
+	Time     int64  `json:"time"`
+}
+
+func newGraphRunVO(run domain.GraphRun) GraphRunVO {
+	return GraphRunVO{
+		ID:      run.ID,
+		GraphID: run.GraphID,
+		Version: run.Version,
+		Status:  string(run.Status),
+		Input:   run.Input,
+		Output:  run.Output,
+		Error:   run.Error,
+		Nodes: slice.Map(run.Nodes, func(idx int, src domain.NodeRun) NodeRunVO {
+			return NodeRunVO{
+				NodeID:   src.NodeID,
+				Status:   string(src.Status),
+				Input:    src.Input,
+				Output:   src.Output,
+				Error:    src.Error,
+				Branch:   src.Branch,
+				Tokens:   src.Tokens,
+				Latency:  src.Latency,
+				Attempts: src.Attempts,
+				Deadline: src.Deadline,
+				Approval: newNodeApprovalVO(src.Approval),
+			}
+		}),
+		CreateTime: run.Ctime,
+		UpdateTime: run.Utime,
+	}
+}
+
+func newNodeApprovalVO(approval *domain.NodeApproval) *NodeApprovalVO {
+	if approval == nil {
+		return nil
+	}
+	return &NodeApprovalVO{
+		Approved: approval.Approved,
+		Uid:      approval.Uid,
+		Comment:  approval.Comment,
+		Edited:   approval.Edited,
+		Timeout:  approval.Timeout,
+		Time:     approval.Time,
+	}
 }
 
 type GetReq struct {
@@ -132,6 +403,8 @@ type Edge struct {
 func newGetNodeVO(plan domain.Graph) GraphVO {
 	var vo GraphVO
 	vo.ID = plan.ID
+	vo.Version = plan.Version
+	vo.Metadata, _ = plan.Metadata.AsString()
 	vo.Nodes = slice.Map[domain.Node, Node](plan.Steps, func(idx int, src domain.Node) Node {
 		m, _ := src.Metadata.AsString()
 		return Node{ID: src.ID, Type: src.Type, Status: src.Status, Metadata: m, GraphID: src.GraphID}
@@ -160,3 +433,467 @@ type PublishReq struct {
 type ForkReq struct {
 	VersionID int64 `json:"version_id"`
 }
+
+type VersionWeightReq struct {
+	VersionID int64 `json:"version_id"`
+	Weight    int   `json:"weight"`
+}
+
+type PublishWeightsReq struct {
+	ID      int64              `json:"id"`
+	Weights []VersionWeightReq `json:"weights"`
+}
+
+type StatsReq struct {
+	ID int64 `json:"id"`
+}
+
+type PromptVersionStatsVO struct {
+	VersionID  int64 `json:"version_id"`
+	Count      int64 `json:"count"`
+	AvgLatency int64 `json:"avg_latency"`
+	Tokens     int64 `json:"tokens"`
+	Up         int64 `json:"up"`
+	Down       int64 `json:"down"`
+}
+
+func newPromptVersionStatsVO(s domain.PromptVersionStats) PromptVersionStatsVO {
+	return PromptVersionStatsVO{
+		VersionID:  s.VersionID,
+		Count:      s.Count,
+		AvgLatency: s.AvgLatency,
+		Tokens:     s.Tokens,
+		Up:         s.Up,
+		Down:       s.Down,
+	}
+}
+
+type ListPromptReq struct {
+	// 不传默认是当前用户
+	Owner     int64  `json:"owner"`
+	OwnerType string `json:"owner_type"`
+	Keyword   string `json:"keyword"`
+	Status    uint8  `json:"status"`
+	// 不传表示不限制
+	HasPublished *bool `json:"has_published"`
+	// id, ctime 或者 utime，默认是 utime
+	SortBy string `json:"sort_by"`
+	Asc    bool   `json:"asc"`
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"`
+}
+
+type PromptPageVO struct {
+	Prompts    []PromptVO `json:"prompts"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+type ExportPromptReq struct {
+	ID int64 `json:"id"`
+	// json 或者 yaml
+	Format string `json:"format"`
+}
+
+type ImportPromptReq struct {
+	// 不传默认导入到当前用户名下
+	Owner int64 `json:"owner"`
+	// json 或者 yaml
+	Format  string `json:"format"`
+	Content string `json:"content"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+type PromptVersionImportResultVO struct {
+	Label string `json:"label"`
+	// create, update 或者 unchanged
+	Action string `json:"action"`
+}
+
+type PromptImportResultVO struct {
+	PromptID int64                         `json:"prompt_id"`
+	Name     string                        `json:"name"`
+	Action   string                        `json:"action"`
+	Versions []PromptVersionImportResultVO `json:"versions"`
+}
+
+type GrantReq struct {
+	// prompt 或者 organization
+	Scope   string `json:"scope"`
+	ScopeID int64  `json:"scope_id"`
+	Uid     int64  `json:"uid"`
+	// viewer, editor 或者 publisher
+	Role string `json:"role"`
+}
+
+type RevokeReq struct {
+	Scope   string `json:"scope"`
+	ScopeID int64  `json:"scope_id"`
+	Uid     int64  `json:"uid"`
+}
+
+type ListACLReq struct {
+	Scope   string `json:"scope"`
+	ScopeID int64  `json:"scope_id"`
+}
+
+type PromptACLVO struct {
+	Scope      string `json:"scope"`
+	ScopeID    int64  `json:"scope_id"`
+	Uid        int64  `json:"uid"`
+	Role       string `json:"role"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+type SearchConversationReq struct {
+	Keyword string `json:"keyword"`
+	Limit   int    `json:"limit"`
+}
+
+type ExportConversationReq struct {
+	// 不为空的时候只导出这个对话，否则导出 [start, end) 之间创建的对话，单位秒
+	Sn    string `json:"sn"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	// markdown、json 或者 jsonl
+	Format           string `json:"format"`
+	IncludeReasoning bool   `json:"include_reasoning"`
+}
+
+type CreateShareReq struct {
+	Sn string `json:"sn"`
+	// 分享到这条消息为止，不传表示当前分支的最后一条消息
+	MessageID int64 `json:"message_id"`
+	// 是否公开模型的思考过程
+	IncludeReasoning bool `json:"include_reasoning"`
+}
+
+type ListSharesReq struct {
+	Sn string `json:"sn"`
+}
+
+type RevokeShareReq struct {
+	Token string `json:"token"`
+}
+
+type ConversationShareVO struct {
+	Token            string `json:"token"`
+	Sn               string `json:"sn"`
+	Title            string `json:"title"`
+	MessageID        int64  `json:"message_id"`
+	IncludeReasoning bool   `json:"include_reasoning"`
+	CreateTime       int64  `json:"create_time"`
+}
+
+func newConversationShareVO(share domain.ConversationShare) ConversationShareVO {
+	return ConversationShareVO{
+		Token:            share.Token,
+		Sn:               share.Sn,
+		Title:            share.Title,
+		MessageID:        share.MessageID,
+		IncludeReasoning: share.IncludeReasoning,
+		CreateTime:       share.Ctime,
+	}
+}
+
+type SharedConversationVO struct {
+	Title      string            `json:"title"`
+	Messages   []SharedMessageVO `json:"messages"`
+	CreateTime int64             `json:"create_time"`
+}
+
+type SharedMessageVO struct {
+	ID               int64  `json:"id"`
+	Role             int32  `json:"role"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+type FeedbackReq struct {
+	MessageID int64 `json:"message_id"`
+	// 1 表示赞，-1 表示踩，0 表示取消
+	Rating  int    `json:"rating"`
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+type FeedbackStatsReq struct {
+	// model 或者 prompt_version
+	GroupBy  string `json:"group_by"`
+	PromptID int64  `json:"prompt_id"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+}
+
+type FeedbackStatsVO struct {
+	Provider        string           `json:"provider,omitempty"`
+	Model           string           `json:"model,omitempty"`
+	PromptVersionID int64            `json:"prompt_version_id,omitempty"`
+	Up              int64            `json:"up"`
+	Down            int64            `json:"down"`
+	Reasons         map[string]int64 `json:"reasons"`
+}
+
+type FeedbackReviewReq struct {
+	// 默认只查询点踩的
+	Rating   int    `json:"rating"`
+	Reason   string `json:"reason"`
+	PromptID int64  `json:"prompt_id"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Start    int64  `json:"start"`
+	End      int64  `json:"end"`
+	Limit    int    `json:"limit"`
+}
+
+type FeedbackReviewVO struct {
+	MessageID       int64  `json:"message_id"`
+	Sn              string `json:"sn"`
+	Rating          int8   `json:"rating"`
+	Reason          string `json:"reason"`
+	Comment         string `json:"comment"`
+	Provider        string `json:"provider"`
+	Model           string `json:"model"`
+	PromptVersionID int64  `json:"prompt_version_id"`
+	Question        string `json:"question"`
+	Answer          string `json:"answer"`
+	UpdateTime      int64  `json:"update_time"`
+}
+
+type ConversationSearchResultVO struct {
+	Sn    string `json:"sn"`
+	Title string `json:"title"`
+	// 命中的部分用 <em></em> 包起来，标题没有命中的时候为空
+	TitleHighlight string           `json:"title_highlight"`
+	Matches        []MessageMatchVO `json:"matches"`
+	UpdateTime     int64            `json:"update_time"`
+}
+
+type MessageMatchVO struct {
+	MessageID int64  `json:"message_id"`
+	Role      int32  `json:"role"`
+	Snippet   string `json:"snippet"`
+}
+
+type SaveKnowledgeBaseReq struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// 都为 0 的时候使用默认的切分配置
+	ChunkSize    int `json:"chunk_size"`
+	ChunkOverlap int `json:"chunk_overlap"`
+}
+
+type IngestDocumentReq struct {
+	KBID  int64  `json:"kb_id"`
+	Title string `json:"title"`
+	// text、markdown、html 或者 pdf，pdf 传提取出来的文本
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
+type ListKnowledgeDocumentsReq struct {
+	KBID   int64 `json:"kb_id"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+type ListKnowledgeChunksReq struct {
+	DocID  int64 `json:"doc_id"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+type KnowledgeBaseVO struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	ChunkSize    int    `json:"chunk_size"`
+	ChunkOverlap int    `json:"chunk_overlap"`
+	CreateTime   int64  `json:"create_time"`
+	UpdateTime   int64  `json:"update_time"`
+}
+
+func newKnowledgeBaseVO(kb domain.KnowledgeBase) KnowledgeBaseVO {
+	return KnowledgeBaseVO{
+		ID:           kb.ID,
+		Name:         kb.Name,
+		Description:  kb.Description,
+		ChunkSize:    kb.ChunkSize,
+		ChunkOverlap: kb.ChunkOverlap,
+		CreateTime:   kb.Ctime,
+		UpdateTime:   kb.Utime,
+	}
+}
+
+type KnowledgeDocumentVO struct {
+	ID     int64  `json:"id"`
+	KBID   int64  `json:"kb_id"`
+	Title  string `json:"title"`
+	Format string `json:"format"`
+	Status string `json:"status"`
+	// 导入的进度，0 到 100
+	Progress   int    `json:"progress"`
+	Chunks     int    `json:"chunks"`
+	Error      string `json:"error,omitempty"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+func newKnowledgeDocumentVO(doc domain.KnowledgeDocument) KnowledgeDocumentVO {
+	return KnowledgeDocumentVO{
+		ID:         doc.ID,
+		KBID:       doc.KBID,
+		Title:      doc.Title,
+		Format:     string(doc.Format),
+		Status:     string(doc.Status),
+		Progress:   doc.Progress,
+		Chunks:     doc.Chunks,
+		Error:      doc.Error,
+		CreateTime: doc.Ctime,
+		UpdateTime: doc.Utime,
+	}
+}
+
+type KnowledgeChunkVO struct {
+	ID      int64  `json:"id"`
+	DocID   int64  `json:"doc_id"`
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+}
+
+func newKnowledgeChunkVO(chunk domain.KnowledgeChunk) KnowledgeChunkVO {
+	return KnowledgeChunkVO{
+		ID:      chunk.ID,
+		DocID:   chunk.DocID,
+		Index:   chunk.Index,
+		Content: chunk.Content,
+	}
+}
+
+type AssertionVO struct {
+	// contains, regex, json_schema, exact, llm_judge
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type EvalCaseVO struct {
+	ID         int64             `json:"id,omitempty"`
+	Variables  map[string]string `json:"variables"`
+	Expected   string            `json:"expected"`
+	Assertions []AssertionVO     `json:"assertions"`
+}
+
+type CreateDatasetReq struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Cases       []EvalCaseVO `json:"cases"`
+}
+
+type AddCasesReq struct {
+	DatasetID int64        `json:"dataset_id"`
+	Cases     []EvalCaseVO `json:"cases"`
+}
+
+type RunEvalReq struct {
+	DatasetID int64 `json:"dataset_id"`
+	VersionID int64 `json:"version_id"`
+	// 并发度，不传使用默认值
+	Concurrency int `json:"concurrency"`
+}
+
+type CompareEvalReq struct {
+	A int64 `json:"a"`
+	B int64 `json:"b"`
+}
+
+type EvalDatasetVO struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Cases       []EvalCaseVO `json:"cases"`
+	CreateTime  int64        `json:"create_time"`
+	UpdateTime  int64        `json:"update_time"`
+}
+
+func newEvalDatasetVO(dataset domain.EvalDataset) EvalDatasetVO {
+	return EvalDatasetVO{
+		ID:          dataset.ID,
+		Name:        dataset.Name,
+		Description: dataset.Description,
+		Cases: slice.Map(dataset.Cases, func(idx int, src domain.EvalCase) EvalCaseVO {
+			return EvalCaseVO{
+				ID:        src.ID,
+				Variables: src.Variables,
+				Expected:  src.Expected,
+				Assertions: slice.Map(src.Assertions, func(idx int, a domain.Assertion) AssertionVO {
+					return AssertionVO{Type: string(a.Type), Value: a.Value}
+				}),
+			}
+		}),
+		CreateTime: dataset.Ctime.UnixMilli(),
+		UpdateTime: dataset.Utime.UnixMilli(),
+	}
+}
+
+type EvalResultVO struct {
+	CaseID  int64   `json:"case_id"`
+	Output  string  `json:"output"`
+	Passed  bool    `json:"passed"`
+	Score   float64 `json:"score"`
+	Reason  string  `json:"reason"`
+	Latency int64   `json:"latency"`
+	Tokens  int64   `json:"tokens"`
+}
+
+func newEvalResultVO(res domain.EvalResult) EvalResultVO {
+	return EvalResultVO{
+		CaseID:  res.CaseID,
+		Output:  res.Output,
+		Passed:  res.Passed,
+		Score:   res.Score,
+		Reason:  res.Reason,
+		Latency: res.Latency,
+		Tokens:  res.Tokens,
+	}
+}
+
+type EvalRunVO struct {
+	ID         int64          `json:"id"`
+	DatasetID  int64          `json:"dataset_id"`
+	VersionID  int64          `json:"version_id"`
+	Status     string         `json:"status"`
+	Total      int64          `json:"total"`
+	Passed     int64          `json:"passed"`
+	Score      float64        `json:"score"`
+	Results    []EvalResultVO `json:"results,omitempty"`
+	CreateTime int64          `json:"create_time"`
+	UpdateTime int64          `json:"update_time"`
+}
+
+func newEvalRunVO(run domain.EvalRun) EvalRunVO {
+	return EvalRunVO{
+		ID:         run.ID,
+		DatasetID:  run.DatasetID,
+		VersionID:  run.VersionID,
+		Status:     string(run.Status),
+		Total:      run.Total,
+		Passed:     run.Passed,
+		Score:      run.Score,
+		Results:    slice.Map(run.Results, func(idx int, src domain.EvalResult) EvalResultVO { return newEvalResultVO(src) }),
+		CreateTime: run.Ctime.UnixMilli(),
+		UpdateTime: run.Utime.UnixMilli(),
+	}
+}
+
+type EvalCaseComparisonVO struct {
+	CaseID int64        `json:"case_id"`
+	A      EvalResultVO `json:"a"`
+	B      EvalResultVO `json:"b"`
+}
+
+type EvalComparisonVO struct {
+	A     EvalRunVO              `json:"a"`
+	B     EvalRunVO              `json:"b"`
+	Cases []EvalCaseComparisonVO `json:"cases"`
+}